@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Access modes selectable with --access-mode.
+const (
+	// AccessDirect connects to pod IPs, which only works inside the cluster
+	// network.
+	AccessDirect = "direct"
+	// AccessProxy goes through the API server's pods/proxy subresource.
+	AccessProxy = "proxy"
+	// AccessAuto uses direct access in-cluster and the proxy otherwise.
+	AccessAuto = "auto"
+)
+
+// maxPodResponse is the largest response body read from a pod. Info
+// documents are far smaller; larger bodies are rejected rather than buffered.
+const maxPodResponse = 1 << 20
+
+// podFetcher sends an HTTP or HTTPS request to a path on a pod port. A
+// non-nil error means the pod could not be reached; any response, whatever
+// its status, is returned with a nil error.
+type podFetcher interface {
+	fetch(ctx context.Context, pod *corev1.Pod, scheme string, port int, method, path string) (status int, body []byte, err error)
+}
+
+// directFetcher talks to pod IPs with a shared HTTP client, preferring IPs
+// of the given family on dual-stack pods.
+type directFetcher struct {
+	client *http.Client
+	family string
+}
+
+func (f *directFetcher) fetch(ctx context.Context, pod *corev1.Pod, scheme string, port int, method, path string) (int, []byte, error) {
+	url := scheme + "://" + net.JoinHostPort(podIP(pod, f.family), strconv.Itoa(port)) + path
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to build request: %v", err)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to connect: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := readPodResponse(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	return resp.StatusCode, body, nil
+}
+
+// readPodResponse reads a response body of at most maxPodResponse bytes.
+func readPodResponse(r io.Reader) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r, maxPodResponse+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxPodResponse {
+		return nil, fmt.Errorf("response exceeds %d bytes", maxPodResponse)
+	}
+	return body, nil
+}
+
+// proxyFetcher reaches pods through the API server, for running the
+// dashboard outside the cluster against a kubeconfig. It needs the
+// pods/proxy permission.
+type proxyFetcher struct {
+	clientset kubernetes.Interface
+}
+
+func (f *proxyFetcher) fetch(ctx context.Context, pod *corev1.Pod, scheme string, port int, method, path string) (int, []byte, error) {
+	// The proxy takes the scheme as a prefix of the pod name and defaults
+	// to http.
+	name := pod.Name + ":" + strconv.Itoa(port)
+	if scheme == SchemeHTTPS {
+		name = scheme + ":" + name
+	}
+	// Streaming lets the body be read with a limit. Successful responses
+	// don't carry their exact status, so they count as 200.
+	stream, err := f.clientset.CoreV1().RESTClient().
+		Verb(method).
+		Namespace(pod.Namespace).
+		Resource("pods").
+		Name(name).
+		SubResource("proxy").
+		Suffix(path).
+		Stream(ctx)
+	if err != nil {
+		// Error responses of the target come back as API status errors.
+		var apiStatus apierrors.APIStatus
+		if errors.As(err, &apiStatus) && apiStatus.Status().Code != 0 {
+			return int(apiStatus.Status().Code), []byte(apiStatus.Status().Message), nil
+		}
+		return 0, nil, fmt.Errorf("failed to reach pod through the API server: %v", err)
+	}
+	defer stream.Close()
+
+	body, err := readPodResponse(stream)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	return http.StatusOK, body, nil
+}
+
+// newPodFetcher returns the fetcher for an access mode. Auto falls back to
+// direct access here; NewDashboard resolves it from how the kubeconfig was
+// obtained.
+func newPodFetcher(mode, family string, clientset kubernetes.Interface, client *http.Client) podFetcher {
+	if mode == AccessProxy {
+		return &proxyFetcher{clientset: clientset}
+	}
+	return &directFetcher{client: client, family: family}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestDirectFetcherLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		size    int
+		wantErr bool
+	}{
+		{name: "small", status: http.StatusOK, size: 100},
+		{name: "error status", status: http.StatusServiceUnavailable, size: 100},
+		{name: "at the limit", status: http.StatusOK, size: maxPodResponse},
+		{name: "over the limit", status: http.StatusOK, size: maxPodResponse + 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(strings.Repeat("x", tt.size)))
+			}))
+			defer server.Close()
+			host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+			portNum, _ := strconv.Atoi(port)
+			pod := &corev1.Pod{Status: corev1.PodStatus{PodIP: host}}
+
+			f := &directFetcher{client: server.Client(), family: IPFamilyAny}
+			status, body, err := f.fetch(context.Background(), pod, SchemeHTTP, portNum, http.MethodGet, "/")
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("fetch() read %d bytes, want an error", len(body))
+				}
+				return
+			}
+			if err != nil || status != tt.status || len(body) != tt.size {
+				t.Errorf("fetch() = %d, %d bytes, %v; want %d, %d bytes", status, len(body), err, tt.status, tt.size)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/pascal71/k8s-probe-monitor/pkg/api"
+)
+
+// actionError is a probe action that failed, with the HTTP status the API
+// answers it with.
+type actionError struct {
+	status int
+	msg    string
+}
+
+func (e *actionError) Error() string { return e.msg }
+
+// ProbeActionResponse is the response of a probe action: the pod's status
+// after it.
+type ProbeActionResponse struct {
+	Pod    string         `json:"pod"`
+	Probe  string         `json:"probe"`
+	Action string         `json:"action"`
+	Status *PodStatusInfo `json:"status"`
+}
+
+// handleProbeAction serves POST /api/pods/{name}/probes/{probe}/{action}. It
+// resolves the pod's IP server-side, asks the target application to fail or
+// recover the probe, rescrapes the pod and returns its resulting status.
+func (d *Dashboard) handleProbeAction(w http.ResponseWriter, r *http.Request) {
+	probe, action := r.PathValue("probe"), r.PathValue("action")
+	key, err := d.requestPodKey(r)
+	var status *PodStatusInfo
+	if err == nil {
+		status, err = d.probeAction(r.Context(), requestActor(r), key, probe, action)
+	}
+	if err != nil {
+		code := http.StatusInternalServerError
+		if e, ok := err.(*actionError); ok {
+			code = e.status
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ProbeActionResponse{r.PathValue("name"), probe, action, status})
+}
+
+// probeAction asks the target application of the pod with key to fail or
+// recover a probe on behalf of by, rescrapes the pod and returns its
+// resulting status. Errors are *actionError values. Every attempt on a known
+// probe and action is audited.
+func (d *Dashboard) probeAction(ctx context.Context, by actor, key, probe, action string) (_ *PodStatusInfo, err error) {
+	if !api.ValidProbe(probe) {
+		return nil, &actionError{http.StatusNotFound, fmt.Sprintf("Unknown probe %q", probe)}
+	}
+	if !api.ValidAction(action) {
+		return nil, &actionError{http.StatusNotFound, fmt.Sprintf("Unknown action %q", action)}
+	}
+	namespace, name := splitPodKey(key)
+	entry := AuditEntry{actor: by, Action: action, Namespace: namespace, Pod: name, Probe: probe}
+	defer func() { d.audit(entry, err) }()
+
+	d.mu.RLock()
+	status := d.pods[key]
+	d.mu.RUnlock()
+	if status == nil {
+		return nil, &actionError{http.StatusNotFound, "Pod not found"}
+	}
+	pod, err := d.currentWatch().get(status.Namespace, name)
+	if err != nil {
+		return nil, &actionError{http.StatusNotFound, "Pod not found"}
+	}
+	if !scrapeable(pod) {
+		return nil, &actionError{http.StatusConflict, "Pod is not running"}
+	}
+
+	cfg := d.cfg()
+	target, err := podTarget(pod, cfg)
+	if err != nil {
+		return nil, &actionError{http.StatusConflict, err.Error()}
+	}
+	if target.Protocol != ProtocolHTTP {
+		return nil, &actionError{http.StatusConflict, "Probe actions are only supported for pods monitored over HTTP"}
+	}
+	fetchCtx, cancel := context.WithTimeout(ctx, cfg.FetchTimeout)
+	defer cancel()
+	code, body, err := d.fetcher.fetch(fetchCtx, pod, target.Scheme, target.Port, http.MethodPost, api.ProbeActionPath(probe, action))
+	logger := slog.With(append(by.logAttrs(), "probe", probe, "action", action,
+		"pod", name, "namespace", pod.Namespace, "node", pod.Spec.NodeName, "phase", pod.Status.Phase)...)
+	if err != nil {
+		logger.Warn("Probe action failed", "error", err)
+		return nil, &actionError{http.StatusBadGateway, fmt.Sprintf("Failed to call pod API: %v", err)}
+	}
+	if code/100 != 2 {
+		logger.Warn("Probe action rejected by pod", "status", code)
+		return nil, &actionError{http.StatusBadGateway, fmt.Sprintf("Pod API returned %d: %s", code, body)}
+	}
+
+	logger.Info("Probe action performed", "status", code)
+
+	// Rescrape right away so the caller and every stream subscriber see
+	// the new probe state instead of waiting for the next cycle.
+	d.refreshPod(ctx, pod)
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.pods[key], nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// unstableWindow is how long after a probe transition a pod is polled at the
+// fast interval.
+const unstableWindow = time.Minute
+
+// pollSchedule remembers when each pod was last picked for a scrape cycle,
+// for adaptive polling.
+type pollSchedule struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+func newPollSchedule() *pollSchedule {
+	return &pollSchedule{last: make(map[string]time.Time)}
+}
+
+func (s *pollSchedule) forget(pod string) {
+	s.mu.Lock()
+	delete(s.last, pod)
+	s.mu.Unlock()
+}
+
+// adaptivePolling reports whether pods are polled at intervals depending on
+// their stability.
+func (c Config) adaptivePolling() bool {
+	return c.FastPollInterval > 0 || c.SlowPollInterval > 0
+}
+
+// cycleInterval is how often scrape cycles start: the fast interval with
+// adaptive polling, else the poll interval.
+func (c Config) cycleInterval() time.Duration {
+	if c.FastPollInterval > 0 {
+		return c.FastPollInterval
+	}
+	return c.PollInterval
+}
+
+// pollInterval picks a pod's scrape interval. Pods that are failing or
+// changed state within the last minute are polled at the fast interval, and
+// healthy pods without a change for StableAfter at the slow one.
+func (d *Dashboard) pollInterval(key string, cfg Config, now time.Time) time.Duration {
+	d.mu.RLock()
+	status := d.pods[key]
+	d.mu.RUnlock()
+	healthy := status != nil && status.Error == "" && status.Info != nil && status.Info.ProbeStatus.Ready
+	if status != nil && status.Effective != nil {
+		healthy = healthy && status.Effective.Ready
+	}
+	since := now.Sub(d.history.lastTransition(key, now))
+
+	switch {
+	case cfg.FastPollInterval > 0 && (!healthy || since < unstableWindow):
+		return cfg.FastPollInterval
+	case cfg.SlowPollInterval > 0 && healthy && since >= cfg.StableAfter:
+		return cfg.SlowPollInterval
+	}
+	return cfg.PollInterval
+}
+
+// duePods returns the pods whose interval has passed at the start of a
+// cycle, and records them as picked. Without adaptive polling every pod is
+// due. A pod is due half a cycle early rather than a whole cycle late.
+func (d *Dashboard) duePods(pods []*corev1.Pod, cfg Config, now time.Time) []*corev1.Pod {
+	if !cfg.adaptivePolling() {
+		return pods
+	}
+	slack := cfg.cycleInterval() / 2
+	var due []*corev1.Pod
+	for _, pod := range pods {
+		key := podKey(pod.Namespace, pod.Name)
+		interval := d.pollInterval(key, cfg, now)
+		d.polls.mu.Lock()
+		last, seen := d.polls.last[key]
+		if !seen || !now.Add(slack).Before(last.Add(interval)) {
+			d.polls.last[key] = now
+			due = append(due, pod)
+		}
+		d.polls.mu.Unlock()
+	}
+	return due
+}
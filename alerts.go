@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// DefaultNotifyTemplate renders the text of a state change notification.
+const DefaultNotifyTemplate = "{{.Pod}} on {{.Node}}: {{.Signal}} changed from {{.From}} to {{.To}} (was {{.From}} for {{.Held}})"
+
+// StateChange is a debounced change of one of a pod's signals: the started,
+// live and ready flags it reports, or whether it can be reached at all. It is
+// the data of the notification template.
+type StateChange struct {
+	// Cluster is set when monitoring several clusters.
+	Cluster   string
+	Pod       string
+	Namespace string
+	Node      string
+	Signal    string
+	From      string
+	To        string
+	// Held is how long the previous state lasted.
+	Held time.Duration
+	Time time.Time
+}
+
+// healthySignalStates are the states a signal recovers to.
+var healthySignalStates = map[string]bool{"reachable": true, "started": true, "live": true, "ready": true}
+
+func (c StateChange) notification(tmpl *template.Template) Notification {
+	key := c.Namespace + "/" + c.Pod + "/" + c.Signal
+	if c.Cluster != "" {
+		key = c.Cluster + "/" + key
+	}
+	var text strings.Builder
+	if err := tmpl.Execute(&text, c); err != nil {
+		text.Reset()
+		template.Must(template.New("").Parse(DefaultNotifyTemplate)).Execute(&text, c)
+	}
+	return Notification{
+		Kind:  "state-change",
+		Title: fmt.Sprintf("%s is %s", c.Pod, c.To),
+		Text:  text.String(),
+		Fields: map[string]string{
+			"pod":       c.Pod,
+			"namespace": c.Namespace,
+			"node":      c.Node,
+			"signal":    c.Signal,
+			"from":      c.From,
+			"to":        c.To,
+		},
+		Time:     c.Time,
+		Key:      key,
+		Resolved: healthySignalStates[c.To],
+	}
+}
+
+// podSignals returns the current state of each signal of a scraped pod.
+// Signals that can't be determined from this scrape are left out.
+func podSignals(status *PodStatusInfo) map[string]string {
+	if status.Info == nil {
+		if status.ErrorKind == ErrorKindConnection {
+			return map[string]string{"reachable": "unreachable"}
+		}
+		return nil
+	}
+	flag := func(on bool, yes, no string) string {
+		if on {
+			return yes
+		}
+		return no
+	}
+	probes := status.Info.ProbeStatus
+	return map[string]string{
+		"reachable": "reachable",
+		"started":   flag(probes.Started, "started", "not started"),
+		"live":      flag(probes.Live, "live", "not live"),
+		"ready":     flag(probes.Ready, "ready", "not ready"),
+	}
+}
+
+type pendingState struct {
+	state string
+	since time.Time
+}
+
+// signalState tracks one signal of one pod. A new state has to hold for the
+// debounce period before it replaces the stable one, so flaps shorter than
+// that are never announced.
+type signalState struct {
+	stable      string
+	stableSince time.Time
+	pending     *pendingState
+}
+
+// alerter turns scrape results into debounced state changes.
+type alerter struct {
+	mu   sync.Mutex
+	pods map[string]map[string]*signalState
+}
+
+func newAlerter() *alerter {
+	return &alerter{pods: make(map[string]map[string]*signalState)}
+}
+
+// observe records a scrape result and returns the changes that have now held
+// for at least debounce. The first observation of a signal only sets its
+// baseline.
+func (a *alerter) observe(status *PodStatusInfo, now time.Time, debounce time.Duration) []StateChange {
+	signals := podSignals(status)
+	if len(signals) == 0 {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := podKey(status.Namespace, status.Name)
+	states := a.pods[key]
+	if states == nil {
+		states = make(map[string]*signalState)
+		a.pods[key] = states
+	}
+
+	var changes []StateChange
+	for _, signal := range []string{"reachable", "started", "live", "ready"} {
+		cur, ok := signals[signal]
+		if !ok {
+			continue
+		}
+		s := states[signal]
+		switch {
+		case s == nil:
+			states[signal] = &signalState{stable: cur, stableSince: now}
+			continue
+		case cur == s.stable:
+			s.pending = nil
+			continue
+		case s.pending == nil || s.pending.state != cur:
+			s.pending = &pendingState{state: cur, since: now}
+		}
+		if now.Sub(s.pending.since) < debounce {
+			continue
+		}
+
+		changes = append(changes, StateChange{
+			Cluster:   status.Cluster,
+			Pod:       status.Name,
+			Namespace: status.Namespace,
+			Node:      status.Node,
+			Signal:    signal,
+			From:      s.stable,
+			To:        cur,
+			Held:      s.pending.since.Sub(s.stableSince).Round(time.Second),
+			Time:      s.pending.since,
+		})
+		s.stable, s.stableSince, s.pending = cur, s.pending.since, nil
+	}
+	return changes
+}
+
+func (a *alerter) forget(name string) {
+	a.mu.Lock()
+	delete(a.pods, name)
+	a.mu.Unlock()
+}
+
+// notifyChanges sends a notification per debounced state change of a
+// scraped pod.
+func (d *Dashboard) notifyChanges(status *PodStatusInfo) {
+	cfg := d.cfg()
+	notifiers := d.notifiers()
+	changes := d.alerts.observe(status, status.LastCheck, cfg.NotifyDebounce)
+	if len(notifiers) == 0 || len(changes) == 0 {
+		return
+	}
+
+	// The template was checked when the config was validated.
+	tmpl, _ := template.New("notify").Parse(cfg.NotifyTemplate)
+	for _, c := range changes {
+		d.sendNotification(notifiers, c.notification(tmpl))
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Pod annotations that override the target settings per pod, in the manner
+// of the prometheus.io scrape annotations.
+const (
+	portAnnotation        = "probe-monitor/port"
+	pathAnnotation        = "probe-monitor/path"
+	schemeAnnotation      = "probe-monitor/scheme"
+	protocolAnnotation    = "probe-monitor/protocol"
+	grpcServiceAnnotation = "probe-monitor/grpc-service"
+)
+
+// URL schemes of HTTP targets.
+const (
+	SchemeHTTP  = "http"
+	SchemeHTTPS = "https"
+)
+
+// scrapeTarget is where and how a pod is scraped.
+type scrapeTarget struct {
+	Protocol string
+	Scheme   string
+	Port     int
+	Path     string
+	// GRPCService is the service name sent in gRPC health checks; empty
+	// asks for the server's overall health.
+	GRPCService string
+}
+
+// podTarget applies the pod's annotations to the configured target. Invalid
+// annotations are reported as errors rather than ignored, so a typo doesn't
+// silently send the dashboard to the wrong port.
+func podTarget(pod *corev1.Pod, cfg Config) (scrapeTarget, error) {
+	t := scrapeTarget{
+		Protocol:    cfg.Protocol,
+		Scheme:      cfg.TargetScheme,
+		Port:        cfg.TargetPort,
+		Path:        cfg.TargetPath,
+		GRPCService: pod.Annotations[grpcServiceAnnotation],
+	}
+	if v, ok := pod.Annotations[protocolAnnotation]; ok {
+		if v != ProtocolHTTP && v != ProtocolGRPC {
+			return t, fmt.Errorf("invalid %s annotation %q: must be %q or %q", protocolAnnotation, v, ProtocolHTTP, ProtocolGRPC)
+		}
+		t.Protocol = v
+	}
+	if v, ok := pod.Annotations[schemeAnnotation]; ok {
+		if v != SchemeHTTP && v != SchemeHTTPS {
+			return t, fmt.Errorf("invalid %s annotation %q: must be %q or %q", schemeAnnotation, v, SchemeHTTP, SchemeHTTPS)
+		}
+		t.Scheme = v
+	}
+	if v, ok := pod.Annotations[portAnnotation]; ok {
+		port, err := strconv.Atoi(v)
+		if err != nil || port < 1 || port > 65535 {
+			return t, fmt.Errorf("invalid %s annotation %q", portAnnotation, v)
+		}
+		t.Port = port
+	}
+	if v, ok := pod.Annotations[pathAnnotation]; ok {
+		if !strings.HasPrefix(v, "/") {
+			return t, fmt.Errorf("invalid %s annotation %q: must start with /", pathAnnotation, v)
+		}
+		t.Path = v
+	}
+	return t, nil
+}
+
+// url returns the address of the target on the given pod IP, for display.
+func (t scrapeTarget) url(ip string) string {
+	if t.Protocol == ProtocolGRPC {
+		return "grpc://" + net.JoinHostPort(ip, strconv.Itoa(t.Port))
+	}
+	return t.Scheme + "://" + net.JoinHostPort(ip, strconv.Itoa(t.Port)) + t.Path
+}
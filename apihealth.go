@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Bounds of the delay between reconnection attempts while the Kubernetes API
+// is unreachable. The delay doubles with every failed attempt.
+const (
+	apiBackoffBase = time.Second
+	apiBackoffMax  = 2 * time.Minute
+)
+
+// API connection states reported by GET /api/status.
+const (
+	APIStateOK       = "ok"
+	APIStateDegraded = "degraded"
+)
+
+// APIStatus is a cluster's Kubernetes API connection state.
+type APIStatus struct {
+	Cluster string `json:"cluster,omitempty"`
+	// State is ok or degraded.
+	State string `json:"state"`
+	// Since is when the API became unreachable, while degraded.
+	Since *time.Time `json:"since,omitempty"`
+	Error string     `json:"error,omitempty"`
+	// Retries counts the failed reconnection attempts so far.
+	Retries   int        `json:"retries,omitempty"`
+	NextRetry *time.Time `json:"nextRetry,omitempty"`
+}
+
+// APIStatusResponse is the response of GET /api/status. State is degraded
+// when any cluster is.
+type APIStatusResponse struct {
+	State    string      `json:"state"`
+	Clusters []APIStatus `json:"clusters"`
+}
+
+// apiHealth tracks whether a cluster's Kubernetes API is reachable. A failed
+// list or watch of the pod informers marks it degraded; reconnectAPI then
+// checks the API with exponential backoff and jitter until it answers.
+type apiHealth struct {
+	mu       sync.Mutex
+	degraded bool
+	since    time.Time
+	lastErr  string
+	retries  int
+	retryAt  time.Time
+	// wake is signalled when the API becomes degraded.
+	wake chan struct{}
+}
+
+func newAPIHealth() *apiHealth {
+	return &apiHealth{wake: make(chan struct{}, 1)}
+}
+
+// apiBackoff returns the delay before reconnection attempt n, counting from
+// zero: the doubled delay with equal jitter, so clients of a restarted API
+// server don't all retry at once.
+func apiBackoff(n int) time.Duration {
+	delay := apiBackoffMax
+	if n < 16 {
+		delay = min(apiBackoffBase<<n, apiBackoffMax)
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// watchFailed is the watch error handler of the pod informers. Expired
+// resource versions and closed watches are routine; anything else means
+// the API server could not be reached or refused the list.
+func (d *Dashboard) watchFailed(r *cache.Reflector, err error) {
+	if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) || errors.Is(err, io.EOF) {
+		cache.DefaultWatchErrorHandler(context.Background(), r, err)
+		return
+	}
+	d.apiFailed(err, time.Now())
+}
+
+// apiFailed marks the API degraded, logging only the first failure.
+func (d *Dashboard) apiFailed(err error, now time.Time) {
+	h := d.apiHealth
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastErr = err.Error()
+	if h.degraded {
+		slog.Debug("Kubernetes API still unreachable", "cluster", d.cluster, "error", err)
+		return
+	}
+	h.degraded, h.since, h.retries = true, now, 0
+	h.retryAt = now.Add(apiBackoff(0))
+	d.metrics.apiDegraded.Set(1)
+	slog.Warn("Kubernetes API unreachable, backing off", "cluster", d.cluster, "error", err)
+	select {
+	case h.wake <- struct{}{}:
+	default:
+	}
+}
+
+// apiRecovered marks the API reachable again.
+func (d *Dashboard) apiRecovered(now time.Time) {
+	h := d.apiHealth
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.degraded {
+		return
+	}
+	slog.Info("Kubernetes API reachable again", "cluster", d.cluster, "downtime", now.Sub(h.since).Round(time.Second), "retries", h.retries)
+	h.degraded, h.lastErr, h.retries = false, "", 0
+	d.metrics.apiDegraded.Set(0)
+	d.metrics.apiBackoff.Set(0)
+}
+
+// apiDegraded reports whether the Kubernetes API is unreachable.
+func (d *Dashboard) apiDegraded() bool {
+	d.apiHealth.mu.Lock()
+	defer d.apiHealth.mu.Unlock()
+	return d.apiHealth.degraded
+}
+
+// apiStatus returns the API connection state.
+func (d *Dashboard) apiStatus() APIStatus {
+	h := d.apiHealth
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	status := APIStatus{Cluster: d.cluster, State: APIStateOK}
+	if h.degraded {
+		since, retryAt := h.since, h.retryAt
+		status.State = APIStateDegraded
+		status.Since = &since
+		status.Error = h.lastErr
+		status.Retries = h.retries
+		status.NextRetry = &retryAt
+	}
+	return status
+}
+
+// reconnectAPI waits for the API to become degraded, then checks it at
+// growing, jittered intervals until it answers, until ctx is done. The
+// informers reconnect on their own; this decides when the monitor considers
+// the API back.
+func (d *Dashboard) reconnectAPI(ctx context.Context) {
+	h := d.apiHealth
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.wake:
+		}
+		for d.apiDegraded() {
+			h.mu.Lock()
+			wait := time.Until(h.retryAt)
+			h.mu.Unlock()
+			d.metrics.apiBackoff.Set(wait.Seconds())
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			err := d.pingAPI(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if err == nil {
+				d.metrics.apiRetries.WithLabelValues("success").Inc()
+				d.apiRecovered(time.Now())
+				break
+			}
+			d.metrics.apiRetries.WithLabelValues("failure").Inc()
+			h.mu.Lock()
+			h.lastErr = err.Error()
+			h.retries++
+			h.retryAt = time.Now().Add(apiBackoff(h.retries))
+			h.mu.Unlock()
+			slog.Debug("Kubernetes API still unreachable", "cluster", d.cluster, "error", err)
+		}
+	}
+}
+
+// pingAPI requests the API server's version.
+func (d *Dashboard) pingAPI(ctx context.Context) error {
+	// The fake clientset of demo mode has no API server to reach.
+	client := d.clientset.Discovery().RESTClient()
+	if client == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, readyzTimeout)
+	defer cancel()
+	return client.Get().AbsPath("/version").Do(ctx).Error()
+}
+
+// handleAPIStatus serves GET /api/status, the Kubernetes API connection
+// state of every cluster.
+func (d *Dashboard) handleAPIStatus(w http.ResponseWriter, r *http.Request) {
+	resp := APIStatusResponse{State: APIStateOK}
+	for _, c := range d.clusters() {
+		status := c.apiStatus()
+		if status.State == APIStateDegraded {
+			resp.State = APIStateDegraded
+		}
+		resp.Clusters = append(resp.Clusters, status)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Audit results.
+const (
+	AuditSucceeded = "succeeded"
+	AuditFailed    = "failed"
+)
+
+// AuditEntry records a change made through the dashboard: a probe action, a
+// pod deletion or eviction, a node cordon or drain, a scale or a chaos
+// schedule edit. Entries are appended to the store and never pruned.
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// Cluster is set when monitoring several clusters.
+	Cluster string `json:"cluster,omitempty"`
+	actor
+	Action     string `json:"action"`
+	Namespace  string `json:"namespace,omitempty"`
+	Pod        string `json:"pod,omitempty"`
+	Node       string `json:"node,omitempty"`
+	Deployment string `json:"deployment,omitempty"`
+	Probe      string `json:"probe,omitempty"`
+	// Detail adds what the action doesn't say, such as the replica counts
+	// of a scale.
+	Detail string `json:"detail,omitempty"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// actor is who asked for a change.
+type actor struct {
+	// User is the authenticated identity; empty when auth is off.
+	User string `json:"user,omitempty"`
+	// Remote is the client address of an API request and Source names
+	// automated callers such as a chaos schedule.
+	Remote string `json:"remote,omitempty"`
+	Source string `json:"source,omitempty"`
+}
+
+// requestActor returns the actor of an API request.
+func requestActor(r *http.Request) actor {
+	return actor{User: requestUser(r), Remote: r.RemoteAddr}
+}
+
+// logAttrs returns the actor as slog attributes.
+func (a actor) logAttrs() []any {
+	var attrs []any
+	if a.User != "" {
+		attrs = append(attrs, "user", a.User)
+	}
+	if a.Remote != "" {
+		attrs = append(attrs, "remote", a.Remote)
+	}
+	if a.Source != "" {
+		attrs = append(attrs, "source", a.Source)
+	}
+	return attrs
+}
+
+// audit completes an entry with the time, cluster and the result of err,
+// logs it and appends it to the store.
+func (d *Dashboard) audit(e AuditEntry, err error) {
+	e.Time = time.Now()
+	e.Cluster = d.cluster
+	e.Result = AuditSucceeded
+	if err != nil {
+		e.Result, e.Error = AuditFailed, err.Error()
+	}
+
+	attrs := append(e.actor.logAttrs(), "action", e.Action, "result", e.Result)
+	for _, kv := range [][2]string{{"cluster", e.Cluster}, {"namespace", e.Namespace}, {"pod", e.Pod}, {"node", e.Node},
+		{"deployment", e.Deployment}, {"probe", e.Probe}, {"detail", e.Detail}, {"error", e.Error}} {
+		if kv[1] != "" {
+			attrs = append(attrs, kv[0], kv[1])
+		}
+	}
+	slog.Info("Audit", attrs...)
+	d.recordAction(e)
+
+	if err := d.store.AppendAudit(e); err != nil {
+		slog.Error("Failed to store audit entry", "action", e.Action, "error", err)
+	}
+}
+
+// handleAudit serves GET /api/audit, oldest entry first. The from and to
+// query parameters bound the time range (RFC 3339), pod and action filter
+// the entries and limit keeps only the newest ones.
+func (d *Dashboard) handleAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var from, to time.Time
+	for _, bound := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		if v := query.Get(bound.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid %s: %v", bound.name, err), http.StatusBadRequest)
+				return
+			}
+			*bound.dst = t
+		}
+	}
+	limit := 0
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit: must be a positive number", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	stored, err := d.store.Audit(from, to)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read audit log: %v", err), http.StatusInternalServerError)
+		return
+	}
+	entries := []AuditEntry{}
+	pod, action := query.Get("pod"), query.Get("action")
+	for _, e := range stored {
+		if (pod == "" || e.Pod == pod) && (action == "" || e.Action == action) {
+			entries = append(entries, e)
+		}
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+// identity is an authenticated caller.
+type identity struct {
+	User string
+	// Kube is set for Kubernetes tokens, whose mutating calls are
+	// authorized by RBAC.
+	Kube *authenticationv1.UserInfo
+}
+
+// identityKey is the request context key of the identity.
+type identityKey struct{}
+
+// withIdentity returns r carrying the authenticated identity.
+func withIdentity(r *http.Request, id identity) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), identityKey{}, id))
+}
+
+// requestIdentity returns the identity of r, reporting false when the
+// request wasn't authenticated.
+func requestIdentity(r *http.Request) (identity, bool) {
+	id, ok := r.Context().Value(identityKey{}).(identity)
+	return id, ok
+}
+
+// requestUser returns the authenticated user of r, or "" when the request
+// wasn't authenticated.
+func requestUser(r *http.Request) string {
+	id, _ := requestIdentity(r)
+	return id.User
+}
+
+// splitToken splits an AuthTokens entry into the name of its holder and the
+// token. Bare tokens are named after a hash prefix, so audit entries tell
+// them apart without revealing them.
+func splitToken(entry string) (user, token string) {
+	if user, token, ok := strings.Cut(entry, ":"); ok {
+		return user, token
+	}
+	sum := sha256.Sum256([]byte(entry))
+	return "token-" + hex.EncodeToString(sum[:4]), entry
+}
+
+// readTokenFile reads the tokens in path, one per line. Blank lines and
+// lines starting with # are skipped.
+func readTokenFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read auth token file: %v", err)
+	}
+	defer f.Close()
+
+	var tokens []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			tokens = append(tokens, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read auth token file: %v", err)
+	}
+	return tokens, nil
+}
+
+// allowedUser reports whether an OIDC user may use the dashboard: every
+// user when the allow list is empty, otherwise listed emails and emails of
+// listed @domains.
+func allowedUser(user string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, entry := range allowed {
+		if strings.EqualFold(user, entry) ||
+			strings.HasPrefix(entry, "@") && strings.HasSuffix(strings.ToLower(user), strings.ToLower(entry)) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate returns the identity of r. A bearer token is matched against
+// the configured tokens, then verified as an ID token of the OIDC issuer and
+// as a Kubernetes token when those are enabled; without one the OIDC session
+// cookie is checked.
+func (d *Dashboard) authenticate(r *http.Request) (identity, bool) {
+	cfg := d.cfg()
+	if presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		for _, entry := range cfg.AuthTokens {
+			user, token := splitToken(entry)
+			if subtle.ConstantTimeCompare([]byte(presented), []byte(token)) == 1 {
+				return identity{User: user}, true
+			}
+		}
+		if d.oidc != nil {
+			user, err := d.oidc.verify(r.Context(), presented, "")
+			if err == nil && allowedUser(user, cfg.OIDCAllowedUsers) {
+				return identity{User: user}, true
+			}
+		}
+		if cfg.KubeAuth {
+			// The token is reviewed by the cluster the request addresses.
+			c := d.clusterNamed(r.URL.Query().Get("cluster"))
+			if c == nil {
+				c = d
+			}
+			user, err := c.reviewToken(r.Context(), presented)
+			if err != nil {
+				slog.Warn("Failed to review bearer token", "error", err)
+			}
+			if user != nil {
+				return identity{User: user.Username, Kube: user}, true
+			}
+		}
+		return identity{}, false
+	}
+	if d.oidc != nil {
+		if user, ok := d.oidc.session(r); ok && allowedUser(user, cfg.OIDCAllowedUsers) {
+			return identity{User: user}, true
+		}
+	}
+	return identity{}, false
+}
+
+// unauthorized answers a request that failed authentication.
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="k8s-probe-monitor"`)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// requireLogin guards the whole dashboard while OIDC is enabled. Browsers
+// are sent to the provider's login page; API clients get 401. Health checks,
+// metrics and the login flow itself stay open.
+func (d *Dashboard) requireLogin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d.oidc == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		switch r.URL.Path {
+		case "/healthz", "/readyz", "/metrics", "/auth/login", "/auth/callback", "/auth/logout":
+			next.ServeHTTP(w, r)
+			return
+		}
+		if id, ok := d.authenticate(r); ok {
+			next.ServeHTTP(w, withIdentity(r, id))
+			return
+		}
+		if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			http.Redirect(w, r, "/auth/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+			return
+		}
+		unauthorized(w)
+	})
+}
+
+// requireAuth guards the reads that reveal more than the dashboard shows,
+// the audit log and recordings naming who changed what, with the same
+// credentials as requireToken. Without OIDC the other reads, including the
+// probe history in every form (history, export, Grafana, GraphQL), stay
+// open: they show the pod states the dashboard page does, and the page has
+// no way to present a bearer token.
+func (d *Dashboard) requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg := d.cfg()
+		if len(cfg.AuthTokens) == 0 && d.oidc == nil && !cfg.KubeAuth {
+			next(w, r)
+			return
+		}
+		if _, ok := requestIdentity(r); !ok {
+			id, ok := d.authenticate(r)
+			if !ok {
+				unauthorized(w)
+				return
+			}
+			r = withIdentity(r, id)
+		}
+		next(w, r)
+	}
+}
+
+// requireToken guards a mutating endpoint with the configured bearer tokens,
+// an OIDC login or a Kubernetes token whose user may change the pods or
+// node concerned. Requests pass unchecked while none of them is enabled. Callers
+// are then held to ActionRateLimit. In read-only mode every mutating
+// endpoint answers 403.
+func (d *Dashboard) requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg := d.cfg()
+		if cfg.ReadOnly {
+			http.Error(w, "The dashboard is read-only", http.StatusForbidden)
+			return
+		}
+		limited := func(w http.ResponseWriter, r *http.Request) {
+			if d.limitClient(w, r, d.actionLimiter, "actions", cfg.ActionRateLimit, cfg.ActionRateBurst) {
+				next(w, r)
+			}
+		}
+		if len(cfg.AuthTokens) == 0 && d.oidc == nil && !cfg.KubeAuth {
+			limited(w, r)
+			return
+		}
+		id, ok := requestIdentity(r)
+		if !ok {
+			if id, ok = d.authenticate(r); !ok {
+				unauthorized(w)
+				return
+			}
+			r = withIdentity(r, id)
+		}
+		if id.Kube != nil {
+			// RBAC is checked in the cluster the action runs in.
+			name := r.URL.Query().Get("cluster")
+			c := d.clusterNamed(name)
+			if c == nil {
+				http.Error(w, fmt.Sprintf("Unknown cluster %q", name), http.StatusNotFound)
+				return
+			}
+			allowed, err := c.authorizeKube(r, id.Kube)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to authorize: %v", err), http.StatusBadGateway)
+				return
+			}
+			if !allowed {
+				http.Error(w, fmt.Sprintf("User %s may not change these objects", id.User), http.StatusForbidden)
+				return
+			}
+		}
+		limited(w, r)
+	}
+}
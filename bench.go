@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pascal71/k8s-probe-monitor/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// runBench implements the "bench" subcommand. It starts in-process fake target
+// servers, registers synthetic pods in a fake clientset, drives the regular
+// monitor pipeline against them and prints timing and allocation figures.
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	targets := fs.Int("targets", 10, "number of in-process fake target servers")
+	pods := fs.Int("pods", 100, "number of synthetic pods spread over the targets")
+	cycles := fs.Int("cycles", 20, "number of monitor cycles to run")
+	cfg := DefaultConfig()
+	fs.IntVar(&cfg.Concurrency, "concurrency", cfg.Concurrency, "maximum number of pods scraped at once")
+	verbose := fs.Bool("v", false, "keep dashboard logging enabled while benchmarking")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *targets < 1 || *pods < 1 || *cycles < 1 {
+		return fmt.Errorf("targets, pods and cycles must all be at least 1")
+	}
+
+	if !*verbose {
+		defer slog.SetDefault(slog.Default())
+		slog.SetDefault(slog.New(slog.DiscardHandler))
+	}
+
+	servers := make([]*httptest.Server, *targets)
+	for i := range servers {
+		servers[i] = httptest.NewServer(fakeTargetHandler(i))
+		defer servers[i].Close()
+	}
+
+	// Route each synthetic pod IP to one of the fake targets and time every
+	// round trip so target latency can be reported separately.
+	routes := make(map[string]string, *pods)
+	objects := make([]k8sruntime.Object, 0, *pods)
+	for i := 0; i < *pods; i++ {
+		pod := syntheticPod(i)
+		routes[pod.Status.PodIP] = servers[i%len(servers)].Listener.Addr().String()
+		objects = append(objects, pod)
+	}
+
+	fetches := &latencyRecorder{}
+	transport := routedTransport(func(host string) (string, bool) {
+		target, ok := routes[host]
+		return target, ok
+	})
+	transport.MaxIdleConnsPerHost = cfg.Concurrency
+	client := &http.Client{Transport: &timedTransport{next: transport, rec: fetches}}
+
+	d, err := newDashboard(fake.NewClientset(objects...), client, cfg, newDashboardMetrics())
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := d.startInformers(ctx); err != nil {
+		return err
+	}
+
+	cycleTimes := &latencyRecorder{}
+	apiTimes := &latencyRecorder{}
+	indexTimes := &latencyRecorder{}
+	var allocs, allocBytes uint64
+
+	for c := 0; c < *cycles; c++ {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+		d.updatePodStatuses(ctx, 0)
+		d.markLoaded()
+		cycleTimes.add(time.Since(start))
+		runtime.ReadMemStats(&after)
+		allocs += after.Mallocs - before.Mallocs
+		allocBytes += after.TotalAlloc - before.TotalAlloc
+
+		apiTimes.add(timeHandler(d.handleAPI, "/api/pods"))
+		indexTimes.add(timeHandler(d.handleIndex, "/"))
+	}
+
+	d.mu.RLock()
+	monitored, failed := len(d.pods), 0
+	for _, p := range d.pods {
+		if p.Error != "" {
+			failed++
+		}
+	}
+	d.mu.RUnlock()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Benchmark: %d targets, %d pods, %d cycles, concurrency %d (%d monitored, %d with errors)\n\n", *targets, *pods, *cycles, cfg.Concurrency, monitored, failed)
+	fmt.Fprintln(w, "metric\tcount\tmin\tavg\tp50\tp95\tmax")
+	cycleTimes.print(w, "monitor cycle")
+	fetches.print(w, "pod info fetch")
+	apiTimes.print(w, "GET /api/pods")
+	indexTimes.print(w, "GET /")
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "allocations per cycle\t%d objects\t%s\n", allocs/uint64(*cycles), formatBytes(allocBytes/uint64(*cycles)))
+	return w.Flush()
+}
+
+// fakeTargetHandler serves the /api/info contract of the probe-demo app with
+// probe states that vary per target so every card variant gets rendered.
+func fakeTargetHandler(n int) http.Handler {
+	started := time.Now()
+	mux := http.NewServeMux()
+	mux.HandleFunc(api.InfoPath, func(w http.ResponseWriter, r *http.Request) {
+		info := PodInfo{
+			PodName:      fmt.Sprintf("fake-target-%d", n),
+			ContainerAge: time.Since(started).Nanoseconds(),
+			StartTime:    started.Format(time.RFC3339),
+			StartupDelay: 5,
+			StartupReady: started.Add(5 * time.Second).Format(time.RFC3339),
+			ProbeStatus: ProbeStatus{
+				Started: true,
+				Live:    n%7 != 0,
+				Ready:   n%3 != 0,
+			},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+	})
+	return mux
+}
+
+// syntheticPod returns a running pod that matches the monitor's selector.
+func syntheticPod(i int) *corev1.Pod {
+	started := metav1.NewTime(time.Now().Add(-time.Minute))
+	probe := func(path string) *corev1.Probe {
+		return &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{
+				HTTPGet: &corev1.HTTPGetAction{Path: path, Port: intstr.FromInt32(8080)},
+			},
+			PeriodSeconds:    5,
+			SuccessThreshold: 1,
+			FailureThreshold: 3,
+		}
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("probe-demo-%08x-%05d", i/10, i),
+			Namespace: "default",
+			Labels:    map[string]string{"app": "probe-demo"},
+		},
+		Spec: corev1.PodSpec{
+			NodeName: fmt.Sprintf("bench-node-%d", i%5),
+			Containers: []corev1.Container{{
+				Name:           "app",
+				StartupProbe:   probe("/startup"),
+				LivenessProbe:  probe("/healthz"),
+				ReadinessProbe: probe("/ready"),
+			}},
+		},
+		Status: corev1.PodStatus{
+			Phase:     corev1.PodRunning,
+			PodIP:     fmt.Sprintf("10.%d.%d.%d", 200+i>>16&0x3f, i>>8&0xff, i&0xff),
+			StartTime: &started,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "app",
+				State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: started}},
+			}},
+		},
+	}
+}
+
+// timeHandler invokes an HTTP handler in-process and returns how long it took.
+func timeHandler(h http.HandlerFunc, path string) time.Duration {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	h(rec, req)
+	return time.Since(start)
+}
+
+// timedTransport records the duration of every round trip it forwards.
+type timedTransport struct {
+	next http.RoundTripper
+	rec  *latencyRecorder
+}
+
+func (t *timedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	t.rec.add(time.Since(start))
+	return resp, err
+}
+
+// latencyRecorder collects duration samples and summarizes them.
+type latencyRecorder struct {
+	mu      sync.Mutex
+	samples []time.Duration
+}
+
+func (l *latencyRecorder) add(d time.Duration) {
+	l.mu.Lock()
+	l.samples = append(l.samples, d)
+	l.mu.Unlock()
+}
+
+func (l *latencyRecorder) print(w io.Writer, name string) {
+	l.mu.Lock()
+	samples := append([]time.Duration(nil), l.samples...)
+	l.mu.Unlock()
+
+	if len(samples) == 0 {
+		fmt.Fprintf(w, "%s\t0\t-\t-\t-\t-\t-\n", name)
+		return
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	var total time.Duration
+	for _, s := range samples {
+		total += s
+	}
+	pct := func(p float64) time.Duration {
+		return samples[int(p*float64(len(samples)-1))]
+	}
+	fmt.Fprintf(w, "%s\t%d\t%v\t%v\t%v\t%v\t%v\n", name, len(samples),
+		samples[0], total/time.Duration(len(samples)), pct(0.50), pct(0.95), samples[len(samples)-1])
+}
+
+func formatBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/pascal71/k8s-probe-monitor/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// BulkActionRequest is the body of POST /api/actions/bulk. The filters are
+// combined and at least one is required, so a bulk action can't hit every
+// pod by accident.
+type BulkActionRequest struct {
+	Probe  string `json:"probe"`
+	Action string `json:"action"`
+	// Selector is a label selector, ReplicaSet the name of the pods'
+	// controlling ReplicaSet and Node the node they run on.
+	Selector   string `json:"selector,omitempty"`
+	ReplicaSet string `json:"replicaSet,omitempty"`
+	Node       string `json:"node,omitempty"`
+}
+
+// BulkActionResult is the outcome of a bulk action for one pod.
+type BulkActionResult struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	OK        bool   `json:"ok"`
+	Error     string `json:"error,omitempty"`
+	// ProbeStatus is what the pod reported after the action.
+	ProbeStatus *ProbeStatus `json:"probeStatus,omitempty"`
+}
+
+// BulkActionReport is the response of POST /api/actions/bulk.
+type BulkActionReport struct {
+	Probe     string             `json:"probe"`
+	Action    string             `json:"action"`
+	Matched   int                `json:"matched"`
+	Succeeded int                `json:"succeeded"`
+	Failed    int                `json:"failed"`
+	Results   []BulkActionResult `json:"results"`
+}
+
+// matches reports whether a pod passes every filter of the request.
+func (req *BulkActionRequest) matches(pod *corev1.Pod, selector labels.Selector) bool {
+	if !selector.Matches(labels.Set(pod.Labels)) {
+		return false
+	}
+	if req.Node != "" && pod.Spec.NodeName != req.Node {
+		return false
+	}
+	if req.ReplicaSet != "" {
+		ref := metav1.GetControllerOf(pod)
+		if ref == nil || ref.Kind != "ReplicaSet" || ref.Name != req.ReplicaSet {
+			return false
+		}
+	}
+	return true
+}
+
+// handleBulkAction serves POST /api/actions/bulk. It fails or recovers a
+// probe on every monitored pod matching the filters, at most Concurrency pods
+// at a time, and reports the result per pod.
+func (d *Dashboard) handleBulkAction(w http.ResponseWriter, r *http.Request) {
+	var req BulkActionRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if !api.ValidProbe(req.Probe) {
+		http.Error(w, fmt.Sprintf("Unknown probe %q", req.Probe), http.StatusBadRequest)
+		return
+	}
+	if !api.ValidAction(req.Action) {
+		http.Error(w, fmt.Sprintf("Unknown action %q", req.Action), http.StatusBadRequest)
+		return
+	}
+	if req.Selector == "" && req.ReplicaSet == "" && req.Node == "" {
+		http.Error(w, "At least one of selector, replicaSet and node is required", http.StatusBadRequest)
+		return
+	}
+	selector, err := labels.Parse(req.Selector)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid selector: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	pods, err := d.currentWatch().list()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list pods: %v", err), http.StatusInternalServerError)
+		return
+	}
+	var keys []string
+	for _, pod := range pods {
+		if req.matches(pod, selector) {
+			keys = append(keys, podKey(pod.Namespace, pod.Name))
+		}
+	}
+	sort.Strings(keys)
+
+	by := requestActor(r)
+	by.Source = "bulk"
+	slog.Info("Performing bulk probe action", "probe", req.Probe, "action", req.Action, "remote", r.RemoteAddr,
+		"selector", req.Selector, "replicaSet", req.ReplicaSet, "node", req.Node, "pods", len(keys))
+
+	results := make([]BulkActionResult, len(keys))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < min(d.cfg().Concurrency, len(keys)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				result := BulkActionResult{OK: true}
+				result.Namespace, result.Pod = splitPodKey(keys[i])
+				status, err := d.probeAction(r.Context(), by, keys[i], req.Probe, req.Action)
+				if err != nil {
+					result.OK, result.Error = false, err.Error()
+				} else if status != nil && status.Info != nil {
+					probes := status.Info.ProbeStatus
+					result.ProbeStatus = &probes
+				}
+				results[i] = result
+			}
+		}()
+	}
+	for i := range keys {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	report := BulkActionReport{Probe: req.Probe, Action: req.Action, Matched: len(keys), Results: results}
+	for _, result := range results {
+		if result.OK {
+			report.Succeeded++
+		} else {
+			report.Failed++
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
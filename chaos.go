@@ -0,0 +1,450 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pascal71/k8s-probe-monitor/pkg/api"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ChaosSchedule is an unattended chaos experiment managed through /api/chaos.
+// Every run picks random monitored pods and fails or recovers one of their
+// probes through the probe action contract, for example "fail readiness of
+// one random pod every 2 minutes for 30s".
+type ChaosSchedule struct {
+	ID    string `json:"id"`
+	Probe string `json:"probe"`
+	// Action is fail, the default, or recover.
+	Action string `json:"action,omitempty"`
+	// Selector narrows the monitored pods by label; empty matches them all.
+	Selector string `json:"selector,omitempty"`
+	// Pods is how many matching pods each run picks, 1 when unset.
+	Pods int `json:"pods,omitempty"`
+	// Every is the interval between runs, such as "2m", and Cron a
+	// five-field cron expression; exactly one must be set.
+	Every string `json:"every,omitempty"`
+	Cron  string `json:"cron,omitempty"`
+	// For is how long a failed probe is held before it is recovered. When
+	// empty it stays failed until the schedule is deleted.
+	For    string `json:"for,omitempty"`
+	Paused bool   `json:"paused,omitempty"`
+
+	// Set by the scheduler.
+	NextRun *time.Time  `json:"nextRun,omitempty"`
+	LastRun *time.Time  `json:"lastRun,omitempty"`
+	Holding []ChaosHold `json:"holding,omitempty"`
+}
+
+// ChaosHold is a pod whose probe a schedule currently holds failed.
+type ChaosHold struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Probe     string `json:"probe"`
+	// Until is when the probe is recovered; unset means never.
+	Until *time.Time `json:"until,omitempty"`
+}
+
+// chaosSchedule is a validated ChaosSchedule with its run state.
+type chaosSchedule struct {
+	ChaosSchedule
+	seq      int
+	selector labels.Selector
+	every    time.Duration
+	cron     *cronSchedule
+	hold     time.Duration
+	next     time.Time
+	last     time.Time
+	// holds maps the keys of the pods this schedule failed to their hold.
+	holds map[string]chaosHold
+}
+
+type chaosHold struct {
+	probe string
+	until time.Time
+}
+
+// chaosRelease is a held probe to recover, of the pod with key pod.
+type chaosRelease struct {
+	schedule, pod, probe string
+}
+
+// compileChaosSchedule validates s and fills in its defaults.
+func compileChaosSchedule(s ChaosSchedule) (*chaosSchedule, error) {
+	if !api.ValidProbe(s.Probe) {
+		return nil, fmt.Errorf("invalid probe %q, must be startup, liveness or readiness", s.Probe)
+	}
+	if s.Action == "" {
+		s.Action = api.ActionFail
+	}
+	if !api.ValidAction(s.Action) {
+		return nil, fmt.Errorf("invalid action %q, must be fail or recover", s.Action)
+	}
+	if s.Pods == 0 {
+		s.Pods = 1
+	}
+	if s.Pods < 0 {
+		return nil, fmt.Errorf("pods must not be negative")
+	}
+	c := &chaosSchedule{holds: make(map[string]chaosHold)}
+	var err error
+	if c.selector, err = labels.Parse(s.Selector); err != nil {
+		return nil, fmt.Errorf("invalid selector %q: %v", s.Selector, err)
+	}
+	switch {
+	case (s.Every == "") == (s.Cron == ""):
+		return nil, fmt.Errorf("exactly one of every and cron must be set")
+	case s.Every != "":
+		if c.every, err = time.ParseDuration(s.Every); err != nil || c.every < time.Second {
+			return nil, fmt.Errorf("invalid every %q, must be a duration of at least 1s", s.Every)
+		}
+	default:
+		if c.cron, err = parseCron(s.Cron); err != nil {
+			return nil, fmt.Errorf("invalid cron %q: %v", s.Cron, err)
+		}
+	}
+	if s.For != "" {
+		if s.Action != api.ActionFail {
+			return nil, fmt.Errorf("for only applies to the fail action")
+		}
+		if c.hold, err = time.ParseDuration(s.For); err != nil || c.hold <= 0 {
+			return nil, fmt.Errorf("invalid for %q, must be a positive duration", s.For)
+		}
+	}
+	s.NextRun, s.LastRun, s.Holding = nil, nil, nil
+	c.ChaosSchedule = s
+	return c, nil
+}
+
+// nextRun returns when a schedule runs next after t.
+func (c *chaosSchedule) nextRun(t time.Time) time.Time {
+	if c.cron != nil {
+		return c.cron.next(t)
+	}
+	return t.Add(c.every)
+}
+
+// snapshot returns the schedule as served by the API.
+func (c *chaosSchedule) snapshot() ChaosSchedule {
+	s := c.ChaosSchedule
+	if !c.next.IsZero() && !c.Paused {
+		next := c.next
+		s.NextRun = &next
+	}
+	if !c.last.IsZero() {
+		last := c.last
+		s.LastRun = &last
+	}
+	for key, h := range c.holds {
+		hold := ChaosHold{Probe: h.probe}
+		hold.Namespace, hold.Pod = splitPodKey(key)
+		if !h.until.IsZero() {
+			until := h.until
+			hold.Until = &until
+		}
+		s.Holding = append(s.Holding, hold)
+	}
+	sort.Slice(s.Holding, func(i, j int) bool {
+		return podKey(s.Holding[i].Namespace, s.Holding[i].Pod) < podKey(s.Holding[j].Namespace, s.Holding[j].Pod)
+	})
+	return s
+}
+
+// chaosScheduler holds the chaos schedules of a dashboard.
+type chaosScheduler struct {
+	mu        sync.Mutex
+	schedules map[string]*chaosSchedule
+	lastSeq   int
+}
+
+func newChaosScheduler() *chaosScheduler {
+	return &chaosScheduler{schedules: make(map[string]*chaosSchedule)}
+}
+
+func (s *chaosScheduler) list() []ChaosSchedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all := make([]*chaosSchedule, 0, len(s.schedules))
+	for _, c := range s.schedules {
+		all = append(all, c)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].seq < all[j].seq })
+	list := make([]ChaosSchedule, len(all))
+	for i, c := range all {
+		list[i] = c.snapshot()
+	}
+	return list
+}
+
+func (s *chaosScheduler) get(id string) (ChaosSchedule, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.schedules[id]
+	if !ok {
+		return ChaosSchedule{}, false
+	}
+	return c.snapshot(), true
+}
+
+// add registers a new schedule under a fresh ID.
+func (s *chaosScheduler) add(c *chaosSchedule, now time.Time) ChaosSchedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastSeq++
+	c.seq = s.lastSeq
+	c.ID = strconv.Itoa(c.seq)
+	c.next = c.nextRun(now)
+	s.schedules[c.ID] = c
+	return c.snapshot()
+}
+
+// replace swaps the definition of an existing schedule, keeping its holds.
+func (s *chaosScheduler) replace(id string, c *chaosSchedule, now time.Time) (ChaosSchedule, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.schedules[id]
+	if !ok {
+		return ChaosSchedule{}, false
+	}
+	c.seq, c.ID, c.last, c.holds = old.seq, id, old.last, old.holds
+	c.next = c.nextRun(now)
+	s.schedules[id] = c
+	return c.snapshot(), true
+}
+
+// remove deletes a schedule and returns the probes it was holding.
+func (s *chaosScheduler) remove(id string) ([]chaosRelease, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.schedules[id]
+	if !ok {
+		return nil, false
+	}
+	delete(s.schedules, id)
+	var releases []chaosRelease
+	for pod, h := range c.holds {
+		releases = append(releases, chaosRelease{id, pod, h.probe})
+	}
+	return releases, true
+}
+
+// due returns copies of the schedules to run at now, advancing their next
+// run, and takes the holds that have expired.
+func (s *chaosScheduler) due(now time.Time) ([]*chaosSchedule, []chaosRelease) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var runs []*chaosSchedule
+	var releases []chaosRelease
+	for id, c := range s.schedules {
+		for pod, h := range c.holds {
+			if !h.until.IsZero() && !now.Before(h.until) {
+				delete(c.holds, pod)
+				releases = append(releases, chaosRelease{id, pod, h.probe})
+			}
+		}
+		if c.next.IsZero() || now.Before(c.next) {
+			continue
+		}
+		c.next = c.nextRun(now)
+		if c.Paused {
+			continue
+		}
+		c.last = now
+		run := *c
+		run.holds = make(map[string]chaosHold, len(c.holds))
+		for pod, h := range c.holds {
+			run.holds[pod] = h
+		}
+		runs = append(runs, &run)
+	}
+	return runs, releases
+}
+
+// hold records that a schedule failed a pod's probe. It reports false when
+// the schedule has been deleted meanwhile, in which case the probe should be
+// recovered right away.
+func (s *chaosScheduler) hold(id, pod string, h chaosHold) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.schedules[id]
+	if ok {
+		c.holds[pod] = h
+	}
+	return ok
+}
+
+// releaseAll removes every hold of every schedule and returns them.
+func (s *chaosScheduler) releaseAll() []chaosRelease {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var releases []chaosRelease
+	for id, c := range s.schedules {
+		for pod, h := range c.holds {
+			releases = append(releases, chaosRelease{id, pod, h.probe})
+		}
+		c.holds = make(map[string]chaosHold)
+	}
+	return releases
+}
+
+// runChaos runs the chaos schedules until ctx is done. On the way out every
+// held probe is recovered so no experiment outlives the dashboard.
+func (d *Dashboard) runChaos(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			cleanup, cancel := context.WithTimeout(context.Background(), d.cfg().FetchTimeout)
+			defer cancel()
+			d.releaseChaos(cleanup, d.chaos.releaseAll())
+			return
+		case now := <-ticker.C:
+			runs, releases := d.chaos.due(now)
+			d.releaseChaos(ctx, releases)
+			if d.cfg().ReadOnly {
+				// Holds are still released, but nothing new is failed.
+				runs = nil
+			}
+			for _, c := range runs {
+				d.runChaosSchedule(ctx, c, now)
+			}
+		}
+	}
+}
+
+// runChaosSchedule performs one run of a schedule against randomly picked
+// pods that match its selector and that it doesn't already hold.
+func (d *Dashboard) runChaosSchedule(ctx context.Context, c *chaosSchedule, now time.Time) {
+	logger := slog.With("schedule", c.ID, "probe", c.Probe, "action", c.Action)
+	by := actor{Source: "chaos schedule " + c.ID}
+	var candidates []string
+	d.mu.RLock()
+	watch := d.watch
+	for key, status := range d.pods {
+		if _, held := c.holds[key]; held || status.Info == nil {
+			continue
+		}
+		pod, err := watch.get(status.Namespace, status.Name)
+		if err != nil || !c.selector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		candidates = append(candidates, key)
+	}
+	d.mu.RUnlock()
+	if len(candidates) == 0 {
+		logger.Info("Chaos schedule found no pods to act on")
+		return
+	}
+
+	rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	picked := candidates[:min(c.Pods, len(candidates))]
+	logger.Info("Running chaos schedule", "pods", picked)
+	for _, key := range picked {
+		if _, err := d.probeAction(ctx, by, key, c.Probe, c.Action); err != nil {
+			continue
+		}
+		if c.Action != api.ActionFail {
+			continue
+		}
+		h := chaosHold{probe: c.Probe}
+		if c.hold > 0 {
+			h.until = now.Add(c.hold)
+		}
+		if !d.chaos.hold(c.ID, key, h) {
+			d.releaseChaos(ctx, []chaosRelease{{c.ID, key, c.Probe}})
+		}
+	}
+}
+
+// releaseChaos recovers held probes.
+func (d *Dashboard) releaseChaos(ctx context.Context, releases []chaosRelease) {
+	for _, r := range releases {
+		d.probeAction(ctx, actor{Source: "chaos schedule " + r.schedule}, r.pod, r.probe, api.ActionRecover)
+	}
+}
+
+// handleChaosList serves GET /api/chaos.
+func (d *Dashboard) handleChaosList(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d.chaos.list())
+}
+
+// handleChaosGet serves GET /api/chaos/{id}.
+func (d *Dashboard) handleChaosGet(w http.ResponseWriter, r *http.Request) {
+	s, ok := d.chaos.get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+// handleChaosCreate serves POST /api/chaos.
+func (d *Dashboard) handleChaosCreate(w http.ResponseWriter, r *http.Request) {
+	c, ok := decodeChaosSchedule(w, r)
+	if !ok {
+		return
+	}
+	s := d.chaos.add(c, time.Now())
+	d.audit(AuditEntry{actor: requestActor(r), Action: "chaos-create", Probe: s.Probe, Detail: "schedule " + s.ID}, nil)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/chaos/"+s.ID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(s)
+}
+
+// handleChaosUpdate serves PUT /api/chaos/{id}.
+func (d *Dashboard) handleChaosUpdate(w http.ResponseWriter, r *http.Request) {
+	c, ok := decodeChaosSchedule(w, r)
+	if !ok {
+		return
+	}
+	s, ok := d.chaos.replace(r.PathValue("id"), c, time.Now())
+	if !ok {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+	d.audit(AuditEntry{actor: requestActor(r), Action: "chaos-update", Probe: s.Probe, Detail: "schedule " + s.ID}, nil)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+// handleChaosDelete serves DELETE /api/chaos/{id}. Probes the schedule holds
+// failed are recovered before it returns.
+func (d *Dashboard) handleChaosDelete(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	releases, ok := d.chaos.remove(id)
+	if !ok {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+	d.audit(AuditEntry{actor: requestActor(r), Action: "chaos-delete", Detail: fmt.Sprintf("schedule %s, recovering %d pods", id, len(releases))}, nil)
+	d.releaseChaos(r.Context(), releases)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func decodeChaosSchedule(w http.ResponseWriter, r *http.Request) (*chaosSchedule, bool) {
+	var s ChaosSchedule
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid schedule: %v", err), http.StatusBadRequest)
+		return nil, false
+	}
+	c, err := compileChaosSchedule(s)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid schedule: %v", err), http.StatusBadRequest)
+		return nil, false
+	}
+	return c, true
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// CheckResult is the outcome of the dashboard running one of a pod's probes
+// itself, the way the kubelet would.
+type CheckResult struct {
+	Success bool `json:"success"`
+	// Skipped is set for probes the dashboard can't run, such as exec
+	// probes, with the reason in Detail.
+	Skipped         bool      `json:"skipped,omitempty"`
+	Detail          string    `json:"detail"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	Time            time.Time `json:"time"`
+}
+
+// SyntheticChecks are the dashboard's own results for the probes of the
+// monitored container. Probes that aren't configured are nil.
+type SyntheticChecks struct {
+	Startup   *CheckResult `json:"startup,omitempty"`
+	Liveness  *CheckResult `json:"liveness,omitempty"`
+	Readiness *CheckResult `json:"readiness,omitempty"`
+}
+
+// errNeedsDirectAccess skips probes that can't go through the API server
+// proxy.
+var errNeedsDirectAccess = errors.New("only plain HTTP probes can be checked through the API server proxy")
+
+// probeChecker runs HTTP, TCP and gRPC probes against pods from the
+// dashboard. Only direct access can open arbitrary connections to pods;
+// through the API server proxy just plain HTTP probes can be run.
+type probeChecker struct {
+	mode    string
+	family  string
+	fetcher podFetcher
+	// client skips certificate verification, as the kubelet does for
+	// HTTPS probes.
+	client *http.Client
+}
+
+func newProbeChecker(mode, family string, fetcher podFetcher) *probeChecker {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	transport.DisableKeepAlives = true
+	return &probeChecker{mode: mode, family: family, fetcher: fetcher, client: &http.Client{Transport: transport}}
+}
+
+// checkAll runs every probe configured on the monitored container.
+func (c *probeChecker) checkAll(ctx context.Context, pod *corev1.Pod) *SyntheticChecks {
+	container, _ := monitoredContainer(pod)
+	if container == nil {
+		return nil
+	}
+	run := func(p *corev1.Probe) *CheckResult {
+		if p == nil {
+			return nil
+		}
+		return c.check(ctx, pod, container, p)
+	}
+	return &SyntheticChecks{
+		Startup:   run(container.StartupProbe),
+		Liveness:  run(container.LivenessProbe),
+		Readiness: run(container.ReadinessProbe),
+	}
+}
+
+// check runs a single probe within its configured timeout.
+func (c *probeChecker) check(ctx context.Context, pod *corev1.Pod, container *corev1.Container, p *corev1.Probe) *CheckResult {
+	timeout := time.Duration(orDefault(p.TimeoutSeconds, 1)) * time.Second
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	var success bool
+	var detail string
+	var err error
+	switch {
+	case p.HTTPGet != nil:
+		success, detail, err = c.checkHTTP(ctx, pod, container, p.HTTPGet)
+	case p.TCPSocket != nil:
+		success, detail, err = c.checkTCP(ctx, pod, container, p.TCPSocket)
+	case p.GRPC != nil:
+		success, detail, err = c.checkGRPC(ctx, pod, p.GRPC)
+	default:
+		return &CheckResult{Skipped: true, Detail: "exec probes run inside the container and can't be checked", Time: start}
+	}
+
+	result := &CheckResult{
+		Success:         success,
+		Detail:          detail,
+		DurationSeconds: time.Since(start).Seconds(),
+		Time:            start,
+	}
+	if err != nil {
+		result.Success = false
+		result.Skipped = err == errNeedsDirectAccess
+		result.Detail = err.Error()
+	}
+	return result
+}
+
+// resolvePort turns a probe port into a number, looking named ports up in
+// the container spec.
+func resolvePort(port intstr.IntOrString, container *corev1.Container) (int, error) {
+	if port.Type == intstr.Int {
+		return port.IntValue(), nil
+	}
+	for _, p := range container.Ports {
+		if p.Name == port.StrVal {
+			return int(p.ContainerPort), nil
+		}
+	}
+	return 0, fmt.Errorf("named port %q not found in container %s", port.StrVal, container.Name)
+}
+
+func (c *probeChecker) checkHTTP(ctx context.Context, pod *corev1.Pod, container *corev1.Container, h *corev1.HTTPGetAction) (bool, string, error) {
+	port, err := resolvePort(h.Port, container)
+	if err != nil {
+		return false, "", err
+	}
+	path := h.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	// The kubelet treats any status from 200 to 399 as success.
+	var status int
+	if c.mode == AccessProxy {
+		if h.Scheme == corev1.URISchemeHTTPS || h.Host != "" || len(h.HTTPHeaders) > 0 {
+			return false, "", errNeedsDirectAccess
+		}
+		status, _, err = c.fetcher.fetch(ctx, pod, SchemeHTTP, port, http.MethodGet, path)
+		if err != nil {
+			return false, "", err
+		}
+	} else {
+		host := h.Host
+		if host == "" {
+			host = podIP(pod, c.family)
+		}
+		scheme := strings.ToLower(string(h.Scheme))
+		if scheme == "" {
+			scheme = "http"
+		}
+		url := scheme + "://" + net.JoinHostPort(host, strconv.Itoa(port)) + path
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return false, "", fmt.Errorf("failed to build request: %v", err)
+		}
+		req.Header.Set("User-Agent", "kube-probe/"+Version)
+		for _, header := range h.HTTPHeaders {
+			if strings.EqualFold(header.Name, "Host") {
+				req.Host = header.Value
+				continue
+			}
+			req.Header.Add(header.Name, header.Value)
+		}
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return false, "", fmt.Errorf("failed to connect: %v", err)
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 10<<10))
+		resp.Body.Close()
+		status = resp.StatusCode
+	}
+	return status >= 200 && status < 400, fmt.Sprintf("HTTP %d", status), nil
+}
+
+func (c *probeChecker) checkTCP(ctx context.Context, pod *corev1.Pod, container *corev1.Container, t *corev1.TCPSocketAction) (bool, string, error) {
+	if c.mode == AccessProxy {
+		return false, "", errNeedsDirectAccess
+	}
+	port, err := resolvePort(t.Port, container)
+	if err != nil {
+		return false, "", err
+	}
+	host := t.Host
+	if host == "" {
+		host = podIP(pod, c.family)
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return false, "", fmt.Errorf("failed to connect: %v", err)
+	}
+	conn.Close()
+	return true, "connected", nil
+}
+
+func (c *probeChecker) checkGRPC(ctx context.Context, pod *corev1.Pod, g *corev1.GRPCAction) (bool, string, error) {
+	if c.mode == AccessProxy {
+		return false, "", errNeedsDirectAccess
+	}
+	service := ""
+	if g.Service != nil {
+		service = *g.Service
+	}
+	status, err := grpcHealthCheck(ctx, net.JoinHostPort(podIP(pod, c.family), strconv.Itoa(int(g.Port))), service)
+	if err != nil {
+		return false, "", fmt.Errorf("health check failed: %v", err)
+	}
+	return status == healthpb.HealthCheckResponse_SERVING, status.String(), nil
+}
+
+// grpcHealthCheck calls grpc.health.v1.Health/Check on addr. Failed calls
+// return the RPC error as is, so callers can look at its status code.
+func grpcHealthCheck(ctx context.Context, addr, service string) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		return 0, err
+	}
+	return resp.Status, nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// cloudEventTypePrefix starts the types of the CloudEvents emitted.
+const cloudEventTypePrefix = "io.github.pascal71.probemonitor."
+
+// CloudEvents types emitted to the CloudEventsSink and the event bus.
+const (
+	cloudEventPodAdded        = cloudEventTypePrefix + "pod.added"
+	cloudEventPodRemoved      = cloudEventTypePrefix + "pod.removed"
+	cloudEventPodRestarted    = cloudEventTypePrefix + "pod.restarted"
+	cloudEventProbeTransition = cloudEventTypePrefix + "probe.transition"
+)
+
+// cloudEventBuffer is how many events may wait for delivery before the
+// publisher falls behind and loses some.
+const cloudEventBuffer = 1024
+
+// CloudEvent is an event in the CloudEvents 1.0 structured JSON format.
+type CloudEvent struct {
+	SpecVersion     string         `json:"specversion"`
+	ID              string         `json:"id"`
+	Source          string         `json:"source"`
+	Type            string         `json:"type"`
+	Subject         string         `json:"subject,omitempty"`
+	Time            time.Time      `json:"time"`
+	DataContentType string         `json:"datacontenttype"`
+	Data            CloudEventData `json:"data"`
+}
+
+// CloudEventData describes the pod an event is about.
+type CloudEventData struct {
+	Cluster   string `json:"cluster,omitempty"`
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Node      string `json:"node,omitempty"`
+	// Transition is set on probe transitions.
+	Transition *ProbeTransition `json:"transition,omitempty"`
+	// RestartCount and LastTermination are set on restarts.
+	RestartCount    int32        `json:"restartCount,omitempty"`
+	LastTermination *Termination `json:"lastTermination,omitempty"`
+}
+
+// cloudEventPublisher turns pod events into CloudEvents for the sink and the
+// event bus. It subscribes when created, so pods found while the informers
+// sync are announced too.
+type cloudEventPublisher struct {
+	d      *Dashboard
+	events <-chan PodEvent
+	cancel func()
+	// bus is the event bus, nil when disabled. Unlike the sink it is only
+	// configured at startup.
+	bus         eventBus
+	busEncoding string
+	// pods are the known pods by key, for the node of transitions and
+	// removals and to notice restarts.
+	pods map[string]*PodStatusInfo
+}
+
+func newCloudEventPublisher(d *Dashboard) *cloudEventPublisher {
+	events, cancel := d.events.subscribe(cloudEventBuffer)
+	cfg := d.cfg()
+	return &cloudEventPublisher{
+		d: d, events: events, cancel: cancel,
+		bus: newEventBus(cfg), busEncoding: cfg.EventBusEncoding,
+		pods: make(map[string]*PodStatusInfo),
+	}
+}
+
+// run delivers events to the configured sink and event bus until ctx is
+// done or the event hub closes. Events arriving while neither is configured
+// are dropped.
+func (p *cloudEventPublisher) run(ctx context.Context) {
+	defer func() { p.cancel() }()
+	if p.bus != nil {
+		defer p.bus.close()
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-p.events:
+			if !ok {
+				if p.d.events.isClosed() {
+					return
+				}
+				slog.Warn("CloudEvents sink or event bus is too slow; events were dropped")
+				p.events, p.cancel = p.d.events.subscribe(cloudEventBuffer)
+				continue
+			}
+			for _, ce := range p.cloudEvents(ev) {
+				if sink := p.d.cfg().CloudEventsSink; sink != "" {
+					if err := postCloudEvent(ctx, sink, ce); err != nil {
+						slog.Warn("Failed to deliver CloudEvent", "type", ce.Type, "subject", ce.Subject, "error", err)
+					}
+				}
+				if p.bus != nil {
+					p.publishToBus(ctx, ce)
+				}
+			}
+		}
+	}
+}
+
+// cloudEvents returns the CloudEvents of a pod event: additions, removals
+// and probe transitions, and restarts noticed in updates.
+func (p *cloudEventPublisher) cloudEvents(ev PodEvent) []CloudEvent {
+	key := ev.Key()
+	prev := p.pods[key]
+	data := CloudEventData{Cluster: ev.Cluster, Namespace: ev.Namespace, Pod: ev.Name}
+	if pod := ev.Pod; pod != nil {
+		data.Node = pod.Node
+	} else if prev != nil {
+		data.Node = prev.Node
+	}
+
+	var out []CloudEvent
+	emit := func(typ string, data CloudEventData, at time.Time) {
+		source := "/k8s-probe-monitor"
+		if ev.Cluster != "" {
+			source += "/" + ev.Cluster
+		}
+		out = append(out, CloudEvent{
+			SpecVersion:     "1.0",
+			ID:              cloudEventID(),
+			Source:          source,
+			Type:            typ,
+			Subject:         data.Namespace + "/" + data.Pod,
+			Time:            at,
+			DataContentType: "application/json",
+			Data:            data,
+		})
+	}
+	now := time.Now()
+	switch ev.Type {
+	case PodEventAdd:
+		p.pods[key] = ev.Pod
+		emit(cloudEventPodAdded, data, now)
+	case PodEventUpdate:
+		p.pods[key] = ev.Pod
+		if prev != nil && prev.Kubelet != nil && ev.Pod.Kubelet != nil && ev.Pod.Kubelet.RestartCount > prev.Kubelet.RestartCount {
+			data.RestartCount, data.LastTermination = ev.Pod.Kubelet.RestartCount, ev.Pod.Kubelet.LastTermination
+			emit(cloudEventPodRestarted, data, now)
+		}
+	case PodEventDelete:
+		delete(p.pods, key)
+		emit(cloudEventPodRemoved, data, now)
+	case PodEventTransition:
+		data.Transition = ev.Transition
+		emit(cloudEventProbeTransition, data, ev.Transition.Time)
+	}
+	return out
+}
+
+// publishToBus publishes ce on the event bus, keyed by cluster and pod.
+func (p *cloudEventPublisher) publishToBus(ctx context.Context, ce CloudEvent) {
+	payload, err := encodeBusEvent(ce, p.busEncoding)
+	if err != nil {
+		slog.Warn("Failed to encode event", "type", ce.Type, "error", err)
+		return
+	}
+	key := ce.Subject
+	if ce.Data.Cluster != "" {
+		key = ce.Data.Cluster + "/" + key
+	}
+	if err := p.bus.publish(ctx, key, payload); err != nil {
+		slog.Warn("Failed to publish to the event bus", "type", ce.Type, "subject", ce.Subject, "error", err)
+	}
+}
+
+func cloudEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// postCloudEvent delivers an event to an HTTP sink such as a Knative broker
+// in structured content mode.
+func postCloudEvent(ctx context.Context, sink string, ce CloudEvent) error {
+	body, err := json.Marshal(ce)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sink, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/cloudevents+json; charset=utf-8")
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+// Command probe-demo is the target application monitored by
+// k8s-probe-monitor in the teaching setup. It serves the /api/info contract,
+// lets the dashboard force its probes to fail and recover, and exposes the
+// endpoints its own startup, liveness and readiness probes call.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pascal71/k8s-probe-monitor/pkg/api"
+)
+
+// app holds the simulated probe state of this instance.
+type app struct {
+	podName, podIP, nodeName string
+	started                  time.Time
+	startupDelay             time.Duration
+
+	mu sync.Mutex
+	// failing holds the probes forced to fail by probe actions.
+	failing map[string]bool
+}
+
+func (a *app) status() api.ProbeStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	started := time.Since(a.started) >= a.startupDelay
+	live := !a.failing[api.ProbeLiveness]
+	return api.ProbeStatus{
+		Started: started && !a.failing[api.ProbeStartup],
+		Live:    live,
+		Ready:   started && live && !a.failing[api.ProbeReadiness],
+	}
+}
+
+func (a *app) info() api.PodInfo {
+	return api.PodInfo{
+		SchemaVersion: api.SchemaVersion,
+		PodName:       a.podName,
+		PodIP:         a.podIP,
+		NodeHostname:  a.nodeName,
+		ContainerAge:  time.Since(a.started).Nanoseconds(),
+		StartTime:     a.started.Format(time.RFC3339),
+		ProbeStatus:   a.status(),
+		StartupDelay:  int(a.startupDelay.Seconds()),
+		StartupReady:  a.started.Add(a.startupDelay).Format(time.RFC3339),
+	}
+}
+
+func (a *app) handleInfo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.info())
+}
+
+func (a *app) handleProbeAction(w http.ResponseWriter, r *http.Request) {
+	probe, action := r.PathValue("probe"), r.PathValue("action")
+	if !api.ValidProbe(probe) {
+		http.Error(w, "unknown probe", http.StatusNotFound)
+		return
+	}
+	if !api.ValidAction(action) {
+		http.Error(w, "unknown action", http.StatusNotFound)
+		return
+	}
+
+	a.mu.Lock()
+	a.failing[probe] = action == api.ActionFail
+	a.mu.Unlock()
+	slog.Info("Probe action", "probe", probe, "action", action)
+	a.handleInfo(w, r)
+}
+
+// probeHandler answers a kubelet probe with 200 while ok reports true and 503
+// otherwise.
+func (a *app) probeHandler(ok func(api.ProbeStatus) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !ok(a.status()) {
+			http.Error(w, "failing", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+func main() {
+	hostname, _ := os.Hostname()
+	port := flag.Int("port", envOrInt("PORT", 8080), "port to listen on")
+	startupDelay := flag.Duration("startup-delay", envOrDuration("STARTUP_DELAY", 10*time.Second), "how long the startup probe fails after the process starts")
+	flag.Parse()
+
+	a := &app{
+		podName:      envOr("POD_NAME", hostname),
+		podIP:        os.Getenv("POD_IP"),
+		nodeName:     envOr("NODE_NAME", hostname),
+		started:      time.Now(),
+		startupDelay: *startupDelay,
+		failing:      make(map[string]bool),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+api.InfoPath, a.handleInfo)
+	mux.HandleFunc("POST "+api.ProbeActionPath("{probe}", "{action}"), a.handleProbeAction)
+	mux.HandleFunc("GET /startup", a.probeHandler(func(s api.ProbeStatus) bool { return s.Started }))
+	mux.HandleFunc("GET /healthz", a.probeHandler(func(s api.ProbeStatus) bool { return s.Live }))
+	mux.HandleFunc("GET /ready", a.probeHandler(func(s api.ProbeStatus) bool { return s.Ready }))
+
+	addr := ":" + strconv.Itoa(*port)
+	slog.Info("Starting probe-demo", "addr", addr, "pod", a.podName, "startupDelay", a.startupDelay)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		slog.Error("Server failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// envOr returns the value of the environment variable key, or def when unset.
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envOrInt is like envOr for integer settings.
+func envOrInt(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+// envOrDuration is like envOr for duration settings.
+func envOrDuration(key string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
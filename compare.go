@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ReplicaSetAggregate summarizes the monitored pods of one ReplicaSet for a
+// side-by-side comparison with another revision.
+type ReplicaSetAggregate struct {
+	Namespace       string `json:"namespace"`
+	Name            string `json:"name"`
+	Revision        string `json:"revision,omitempty"`
+	PodTemplateHash string `json:"podTemplateHash,omitempty"`
+	Pods            int    `json:"pods"`
+	Ready           int    `json:"ready"`
+	// ReadyRatio is the share of the pods that are ready, as the
+	// application reports it.
+	ReadyRatio float64 `json:"readyRatio"`
+	// Restarts are the restarts of the monitored container over the pods.
+	Restarts int32 `json:"restarts"`
+	// StartupStarted and StartupReady are the times from pod creation to
+	// Started and Ready.
+	StartupStarted StartupStats `json:"startupStarted"`
+	StartupReady   StartupStats `json:"startupReady"`
+	// Scrape is the latency of the recent scrapes of all the pods.
+	Scrape LatencyStats `json:"scrape"`
+}
+
+// CompareResponse is the response of GET /api/compare.
+type CompareResponse struct {
+	Namespace   string                `json:"namespace"`
+	Deployment  string                `json:"deployment"`
+	ReplicaSets []ReplicaSetAggregate `json:"replicaSets"`
+}
+
+// replicaSetAggregate aggregates the monitored pods controlled by the
+// ReplicaSet name in namespace, and returns the Deployment that owns it. It
+// reports false if the ReplicaSet has neither monitored pods nor startup
+// samples and isn't in the informer caches either.
+func (d *Dashboard) replicaSetAggregate(namespace, name string) (ReplicaSetAggregate, *OwnerInfo, bool) {
+	agg := ReplicaSetAggregate{Namespace: namespace, Name: name}
+	var deployment *OwnerInfo
+	var uid types.UID
+	var pods []string
+
+	d.mu.RLock()
+	for _, p := range d.pods {
+		if p.Namespace != namespace || p.Owner == nil || p.Owner.Kind != "ReplicaSet" || p.Owner.Name != name {
+			continue
+		}
+		uid = p.Owner.UID
+		if p.Workload != nil && p.Workload.Kind == "Deployment" {
+			deployment = p.Workload
+		}
+		agg.PodTemplateHash = p.ReplicaSetID
+		agg.Pods++
+		pods = append(pods, p.Name)
+		ready := p.Info != nil && p.Info.ProbeStatus.Ready
+		if p.Effective != nil {
+			ready = p.Effective.Ready
+		}
+		if ready {
+			agg.Ready++
+		}
+		if p.Kubelet != nil {
+			agg.Restarts += p.Kubelet.RestartCount
+		}
+	}
+	d.mu.RUnlock()
+	if agg.Pods > 0 {
+		agg.ReadyRatio = float64(agg.Ready) / float64(agg.Pods)
+	}
+
+	found := agg.Pods > 0
+	if w := d.currentWatch(); w != nil {
+		replicaSets, _ := w.replicaSets(namespace)
+		for _, rs := range replicaSets {
+			if rs.Name != name {
+				continue
+			}
+			found = true
+			uid = rs.UID
+			agg.Revision = rs.Annotations[revisionAnnotation]
+			agg.PodTemplateHash = revisionHash(rs.Labels)
+			if ref := metav1.GetControllerOf(rs); ref != nil && ref.Kind == "Deployment" {
+				deployment = ownerFromRef(ref)
+			}
+		}
+	}
+	if rev := d.startup.revision(namespace, name, uid); rev != nil {
+		found = true
+		agg.StartupStarted, agg.StartupReady = rev.Started, rev.Ready
+		if deployment == nil && rev.Workload != nil && rev.Workload.Kind == "Deployment" {
+			deployment = rev.Workload
+		}
+	}
+	agg.Scrape = latencyStats(d.scrapes.latencies(pods))
+	return agg, deployment, found
+}
+
+// handleCompare serves GET /api/compare?rs=a,b, the aggregates of two
+// ReplicaSets of the same Deployment side by side.
+func (d *Dashboard) handleCompare(w http.ResponseWriter, r *http.Request) {
+	names := strings.Split(r.URL.Query().Get("rs"), ",")
+	if len(names) != 2 || names[0] == "" || names[1] == "" || names[0] == names[1] {
+		http.Error(w, "rs must name two ReplicaSets, separated by a comma", http.StatusBadRequest)
+		return
+	}
+	namespace := r.URL.Query().Get("namespace")
+	if namespace == "" {
+		namespaces := d.replicaSetNamespaces(names[0])
+		switch len(namespaces) {
+		case 0:
+			http.Error(w, fmt.Sprintf("ReplicaSet %s not found", names[0]), http.StatusNotFound)
+			return
+		case 1:
+			namespace = namespaces[0]
+		default:
+			http.Error(w, "ReplicaSet exists in several namespaces; set namespace", http.StatusConflict)
+			return
+		}
+	}
+
+	resp := CompareResponse{Namespace: namespace}
+	var deployments []*OwnerInfo
+	for _, name := range names {
+		agg, deployment, ok := d.replicaSetAggregate(namespace, name)
+		if !ok {
+			http.Error(w, fmt.Sprintf("ReplicaSet %s not found", name), http.StatusNotFound)
+			return
+		}
+		resp.ReplicaSets = append(resp.ReplicaSets, agg)
+		deployments = append(deployments, deployment)
+	}
+	if deployments[0] == nil || deployments[1] == nil || deployments[0].UID != deployments[1].UID {
+		http.Error(w, "The ReplicaSets don't belong to the same Deployment", http.StatusBadRequest)
+		return
+	}
+	resp.Deployment = deployments[0].Name
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// replicaSetNamespaces returns the namespaces with a monitored pod of a
+// ReplicaSet named name, or with such a ReplicaSet in the informer caches.
+func (d *Dashboard) replicaSetNamespaces(name string) []string {
+	seen := make(map[string]bool)
+	d.mu.RLock()
+	for _, p := range d.pods {
+		if p.Owner != nil && p.Owner.Kind == "ReplicaSet" && p.Owner.Name == name {
+			seen[p.Namespace] = true
+		}
+	}
+	w := d.watch
+	d.mu.RUnlock()
+	if w != nil {
+		for _, lister := range w.replicaSetListers {
+			replicaSets, _ := lister.List(labels.Everything())
+			for _, rs := range replicaSets {
+				if rs.Name == name {
+					seen[rs.Namespace] = true
+				}
+			}
+		}
+	}
+	var namespaces []string
+	for ns := range seen {
+		namespaces = append(namespaces, ns)
+	}
+	return namespaces
+}
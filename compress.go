@@ -0,0 +1,153 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+)
+
+// minCompressSize is the smallest response worth compressing.
+const minCompressSize = 1024
+
+var (
+	gzipWriters = sync.Pool{New: func() any { w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression); return w }}
+	zlibWriters = sync.Pool{New: func() any { w, _ := zlib.NewWriterLevel(nil, zlib.DefaultCompression); return w }}
+)
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header by
+// quality, preferring gzip on ties, or "" for none.
+func negotiateEncoding(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		switch coding = strings.ToLower(strings.TrimSpace(coding)); coding {
+		case "*":
+			coding = "gzip"
+		case "gzip", "deflate":
+		default:
+			continue
+		}
+		if q > bestQ || q == bestQ && q > 0 && coding == "gzip" {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// compressed compresses next's responses with gzip or deflate when the
+// client accepts them and they are large enough. The ETag of a compressed
+// response is made weak, so revalidation works across encodings.
+func compressed(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			next(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding, status: http.StatusOK}
+		defer cw.close()
+		next(cw, r)
+	}
+}
+
+// compressWriter buffers the start of a response to decide whether to
+// compress it.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	status   int
+	buf      []byte
+	decided  bool
+	enc      io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if !cw.decided {
+		cw.status = code
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < minCompressSize {
+			return len(p), nil
+		}
+		if err := cw.start(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// start sends the header and the buffered body, compressed if wanted and
+// the response isn't already encoded.
+func (cw *compressWriter) start(compress bool) error {
+	cw.decided = true
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" || cw.status == http.StatusNoContent || cw.status == http.StatusNotModified {
+		compress = false
+	}
+	if compress {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding)
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		switch cw.encoding {
+		case "gzip":
+			gw := gzipWriters.Get().(*gzip.Writer)
+			gw.Reset(cw.ResponseWriter)
+			cw.enc = gw
+		case "deflate":
+			zw := zlibWriters.Get().(*zlib.Writer)
+			zw.Reset(cw.ResponseWriter)
+			cw.enc = zw
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := cw.Write(buf)
+	return err
+}
+
+// close sends a response too small to compress, or finishes the compressed
+// one.
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		cw.start(false)
+		return
+	}
+	if cw.enc == nil {
+		return
+	}
+	cw.enc.Close()
+	switch enc := cw.enc.(type) {
+	case *gzip.Writer:
+		gzipWriters.Put(enc)
+	case *zlib.Writer:
+		zlibWriters.Put(enc)
+	}
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter { return cw.ResponseWriter }
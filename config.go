@@ -0,0 +1,1119 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pascal71/k8s-probe-monitor/pkg/api"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// Config holds every dashboard setting. Values are layered: built-in
+// defaults, then the YAML config file, then environment variables, then
+// command-line flags.
+type Config struct {
+	// ConfigFile is the YAML file the settings were loaded from, if any.
+	ConfigFile string
+
+	Selector string
+	// Namespaces limits monitoring to these namespaces; empty means all.
+	Namespaces []string
+	// Demo runs against a simulated cluster instead of a real one.
+	Demo bool
+	// Replay is a recording, a file or a name in RecordingsDir, to replay
+	// at ReplaySpeed instead of monitoring a cluster.
+	Replay      string
+	ReplaySpeed float64
+	// RecordingsDir is where recordings started with /api/recordings are
+	// saved.
+	RecordingsDir string
+	// Kubeconfig and Context select the cluster instead of the in-cluster
+	// config. Contexts are kubeconfig contexts of clusters to monitor side by
+	// side; empty monitors a single cluster.
+	Kubeconfig string
+	Context    string
+	Contexts   []string
+	// Service is the Service whose EndpointSlices are tracked; empty
+	// tracks every Service in the monitored namespaces.
+	Service string
+	// ResyncPeriod is how often the pod informers replay every cached pod
+	// as an update, refreshing the Kubernetes-side status; zero never does.
+	ResyncPeriod time.Duration
+	PollInterval time.Duration
+	// ScrapeSpread is the fraction of the poll interval a cycle's scrapes
+	// are spread over, so targets and the network see a steady load; zero
+	// scrapes every pod at the start of the cycle.
+	ScrapeSpread float64
+	// With adaptive polling, failing pods and pods whose probes changed
+	// within the last minute are polled every FastPollInterval, and healthy
+	// pods without a change for StableAfter every SlowPollInterval. Zero
+	// intervals disable either.
+	FastPollInterval time.Duration
+	SlowPollInterval time.Duration
+	StableAfter      time.Duration
+
+	TargetPort int
+	TargetPath string
+	SchemaMode string
+	// Protocol is how pods are monitored, http or grpc, unless their
+	// probe-monitor/protocol annotation says otherwise.
+	Protocol string
+	// TargetScheme is http or https unless a pod's probe-monitor/scheme
+	// annotation says otherwise. The TLS settings below apply to https
+	// targets reached directly; the API server proxy doesn't pass client
+	// certificates on.
+	TargetScheme             string
+	TargetCAFile             string
+	TargetCertFile           string
+	TargetKeyFile            string
+	TargetServerName         string
+	TargetInsecureSkipVerify bool
+	// Concurrency bounds how many pods are scraped at once and FetchTimeout
+	// how long a single scrape may take.
+	Concurrency  int
+	FetchTimeout time.Duration
+	// After FetchFailureThreshold consecutive scrapes that fail to reach a
+	// pod, its scrapes back off from twice the poll interval up to
+	// FetchBackoffMax. Zero disables the backoff.
+	FetchFailureThreshold int
+	FetchBackoffMax       time.Duration
+	// AccessMode selects how pods are reached: direct, proxy or auto.
+	AccessMode string
+	// IPFamily is the preferred family of dual-stack pod IPs, IPv4 or
+	// IPv6; empty uses the pod's primary IP.
+	IPFamily string
+	// SyntheticChecks makes the dashboard run the pods' probes itself.
+	SyntheticChecks bool
+	// UsageSource is where the pods' CPU and memory usage comes from:
+	// metrics-server, kubelet or none.
+	UsageSource string
+
+	Store          string
+	StorePath      string
+	StoreRetention time.Duration
+
+	SlackWebhook string
+	WebhookURL   string
+	// PagerDutyRoutingKey and OpsgenieAPIKey open and resolve incidents
+	// for probe and reachability changes and alerts; OpsgenieAPIURL selects
+	// the US or EU Opsgenie API.
+	PagerDutyRoutingKey string
+	OpsgenieAPIKey      string
+	OpsgenieAPIURL      string
+	// SMTPAddr enables email notifications from SMTPFrom to SMTPTo. They are
+	// batched for EmailBatchWindow and rendered with the html/template file
+	// EmailTemplate, or a built-in one when empty.
+	SMTPAddr         string
+	SMTPUsername     string
+	SMTPPassword     string
+	SMTPFrom         string
+	SMTPTo           []string
+	EmailBatchWindow time.Duration
+	EmailTemplate    string
+	// Digest is the health digest interval: daily, weekly, a duration or
+	// empty to disable digests.
+	Digest string
+	// NotifyDebounce is how long a probe or reachability change must hold
+	// before it is notified, and NotifyTemplate renders the message.
+	NotifyDebounce time.Duration
+	NotifyTemplate string
+	// A pod whose reported readiness changed FlapThreshold times within
+	// FlapWindow is flapping. A zero threshold disables flap detection.
+	FlapWindow    time.Duration
+	FlapThreshold int
+	// SLOTarget is the readiness objective in percent that error budgets
+	// are computed against.
+	SLOTarget float64
+	// AlertRules fire alerts through the notifiers when their conditions
+	// hold, and notify again when they resolve.
+	AlertRules []AlertRule
+	// RemoteWriteURL receives the metrics every RemoteWriteInterval with
+	// Prometheus remote write; basic auth credentials go in the URL.
+	RemoteWriteURL         string
+	RemoteWriteInterval    time.Duration
+	RemoteWriteBearerToken string
+	// InfluxURL is an InfluxDB write endpoint and StatsDAddr a StatsD or
+	// DogStatsD server that receive the monitor's metrics every
+	// MetricsPushInterval.
+	InfluxURL           string
+	InfluxToken         string
+	StatsDAddr          string
+	StatsDFlavor        string
+	MetricsPushInterval time.Duration
+	// OTLPEndpoint receives traces of the monitor loop, scrapes, Kubernetes
+	// API calls and dashboard requests over OTLP/HTTP, sending OTLPHeaders,
+	// for a TraceSampleRatio of the traces.
+	OTLPEndpoint     string
+	OTLPHeaders      map[string]string
+	TraceSampleRatio float64
+	// CloudEventsSink receives a CloudEvent for every probe transition, pod
+	// addition, removal and restart, for example a Knative broker.
+	CloudEventsSink string
+	// EventBus streams the same events to nats, kafka or kafka-rest, a
+	// Kafka REST proxy, at the EventBusBrokers on EventBusTopic, encoded as
+	// cloudevents or json.
+	EventBus         string
+	EventBusBrokers  []string
+	EventBusTopic    string
+	EventBusEncoding string
+
+	// AuthTokens are the bearer tokens accepted by mutating endpoints and
+	// the audit and recording reads, each either a bare token or user:token
+	// to name its holder in the audit log. AuthTokenFile adds the tokens
+	// listed in a file, one per line. When no tokens are set and OIDC is off
+	// those endpoints are open.
+	AuthTokens    []string
+	AuthTokenFile string
+	// OIDCIssuer enables OIDC login: the UI and API then require a session
+	// or a bearer token. OIDCAllowedUsers limits it to these emails or, for
+	// entries starting with @, email domains; empty allows every user of
+	// the issuer.
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCAllowedUsers []string
+	// KubeAuth accepts Kubernetes bearer tokens such as ServiceAccount
+	// tokens, validated with a TokenReview. Their mutating calls need RBAC
+	// permission to update the pods concerned, or to patch the node.
+	KubeAuth bool
+	// RateLimit bounds the API requests per second of each client, keyed by
+	// authenticated user or IP address, and ActionRateLimit its probe actions
+	// and other changes. Zero disables a limit; the bursts are the bucket
+	// sizes.
+	RateLimit       float64
+	RateBurst       int
+	ActionRateLimit float64
+	ActionRateBurst int
+	// ReadOnly disables probe actions, chaos schedules and every other
+	// mutating endpoint, and hides the probe toggles.
+	ReadOnly bool
+	// AllowMutations enables the endpoints that change cluster objects,
+	// such as deleting pods.
+	AllowMutations bool
+
+	// TLSCertFile and TLSKeyFile serve the dashboard over HTTPS; so does
+	// TLSSelfSigned with a generated certificate. TLSCipherSuites limits the
+	// TLS 1.2 cipher suites (default Go's). HTTPRedirectAddr is a plain HTTP
+	// address redirecting to HTTPS.
+	TLSCertFile      string
+	TLSKeyFile       string
+	TLSSelfSigned    bool
+	TLSMinVersion    string
+	TLSCipherSuites  []string
+	HTTPRedirectAddr string
+	// DebugAddr serves net/http/pprof and expvar, with goroutine, heap and
+	// scrape cycle stats, when set, e.g. to localhost:6060.
+	DebugAddr string
+	// ReadTimeout, WriteTimeout and IdleTimeout bound the dashboard's
+	// requests and keep-alive connections, 0 meaning no limit, and
+	// MaxHeaderBytes their headers. Streams and WebSockets have no write
+	// timeout.
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+	IdleTimeout    time.Duration
+	MaxHeaderBytes int
+
+	// TemplateDir holds *.html templates and static/ files overriding the
+	// built-in ones.
+	TemplateDir string
+	// Timezone is the IANA zone times are shown in on the page; empty uses
+	// the server's local time.
+	Timezone string
+
+	LogLevel  string
+	LogFormat string
+	// LogRequests logs every dashboard request with its status, latency
+	// and client.
+	LogRequests     bool
+	ShutdownTimeout time.Duration
+}
+
+// DefaultConfig returns the settings for the bundled probe-demo application.
+func DefaultConfig() Config {
+	return Config{
+		Selector:     "app=probe-demo",
+		PollInterval: 5 * time.Second,
+		ScrapeSpread: 0.8,
+		StableAfter:  5 * time.Minute,
+
+		TargetPort:   8080,
+		TargetPath:   api.InfoPath,
+		SchemaMode:   SchemaStrict,
+		Protocol:     ProtocolHTTP,
+		TargetScheme: SchemeHTTP,
+
+		Concurrency:  16,
+		FetchTimeout: 3 * time.Second,
+		AccessMode:   AccessAuto,
+		UsageSource:  UsageMetricsServer,
+
+		FetchFailureThreshold: 3,
+		FetchBackoffMax:       5 * time.Minute,
+
+		Store:          StoreMemory,
+		StorePath:      "probe-monitor.db",
+		StoreRetention: 7 * 24 * time.Hour,
+
+		NotifyDebounce: 30 * time.Second,
+		FlapWindow:     10 * time.Minute,
+		FlapThreshold:  4,
+		SLOTarget:      99.5,
+		ReplaySpeed:    1,
+		RecordingsDir:  "recordings",
+		NotifyTemplate: DefaultNotifyTemplate,
+		OpsgenieAPIURL: DefaultOpsgenieAPIURL,
+
+		EmailBatchWindow: time.Minute,
+
+		RemoteWriteInterval: 30 * time.Second,
+		StatsDFlavor:        StatsDPlain,
+		MetricsPushInterval: 30 * time.Second,
+		TraceSampleRatio:    1,
+
+		EventBusTopic:    "probe-monitor.events",
+		EventBusEncoding: EncodingCloudEvents,
+
+		RateBurst:       20,
+		ActionRateBurst: 5,
+
+		TLSMinVersion: "1.2",
+
+		LogLevel:        "info",
+		LogFormat:       "text",
+		ShutdownTimeout: 10 * time.Second,
+		ReadTimeout:     30 * time.Second,
+		WriteTimeout:    time.Minute,
+		IdleTimeout:     2 * time.Minute,
+		MaxHeaderBytes:  1 << 20,
+	}
+}
+
+// validate checks the config and returns the parsed label selector.
+func (c Config) validate() (labels.Selector, error) {
+	selector, err := labels.Parse(c.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector %q: %v", c.Selector, err)
+	}
+	for _, ns := range c.Namespaces {
+		if ns == "" {
+			return nil, fmt.Errorf("namespaces must not contain empty names")
+		}
+	}
+	if c.Context != "" && len(c.Contexts) > 0 {
+		return nil, fmt.Errorf("context and contexts are mutually exclusive")
+	}
+	seen := make(map[string]bool)
+	for _, name := range c.Contexts {
+		if name == "" || seen[name] {
+			return nil, fmt.Errorf("contexts must be non-empty and unique, got %q", c.Contexts)
+		}
+		seen[name] = true
+	}
+	if c.PollInterval <= 0 {
+		return nil, fmt.Errorf("poll interval must be positive, got %v", c.PollInterval)
+	}
+	if c.ResyncPeriod < 0 {
+		return nil, fmt.Errorf("resync period must not be negative, got %v", c.ResyncPeriod)
+	}
+	if c.ScrapeSpread < 0 || c.ScrapeSpread > 1 {
+		return nil, fmt.Errorf("scrape spread must be from 0 to 1, got %v", c.ScrapeSpread)
+	}
+	if c.FastPollInterval < 0 || c.FastPollInterval > c.PollInterval {
+		return nil, fmt.Errorf("fast poll interval %v must be from 0 to the poll interval %v", c.FastPollInterval, c.PollInterval)
+	}
+	if c.SlowPollInterval != 0 && c.SlowPollInterval < c.PollInterval {
+		return nil, fmt.Errorf("slow poll interval %v must be 0 or at least the poll interval %v", c.SlowPollInterval, c.PollInterval)
+	}
+	if c.SlowPollInterval > 0 && c.StableAfter <= 0 {
+		return nil, fmt.Errorf("stable-after duration must be positive, got %v", c.StableAfter)
+	}
+	if c.TargetPort < 1 || c.TargetPort > 65535 {
+		return nil, fmt.Errorf("invalid target port %d", c.TargetPort)
+	}
+	if !strings.HasPrefix(c.TargetPath, "/") {
+		return nil, fmt.Errorf("target path %q must start with /", c.TargetPath)
+	}
+	if c.SchemaMode != SchemaStrict && c.SchemaMode != SchemaLenient {
+		return nil, fmt.Errorf("invalid schema mode %q: must be %q or %q", c.SchemaMode, SchemaStrict, SchemaLenient)
+	}
+	if c.Protocol != ProtocolHTTP && c.Protocol != ProtocolGRPC {
+		return nil, fmt.Errorf("invalid protocol %q: must be %q or %q", c.Protocol, ProtocolHTTP, ProtocolGRPC)
+	}
+	if c.TargetScheme != SchemeHTTP && c.TargetScheme != SchemeHTTPS {
+		return nil, fmt.Errorf("invalid target scheme %q: must be %q or %q", c.TargetScheme, SchemeHTTP, SchemeHTTPS)
+	}
+	if (c.TargetCertFile == "") != (c.TargetKeyFile == "") {
+		return nil, fmt.Errorf("target client certificate and key must be set together")
+	}
+	if c.Concurrency < 1 {
+		return nil, fmt.Errorf("concurrency must be at least 1, got %d", c.Concurrency)
+	}
+	if c.FetchTimeout <= 0 {
+		return nil, fmt.Errorf("fetch timeout must be positive, got %v", c.FetchTimeout)
+	}
+	if c.FetchFailureThreshold < 0 {
+		return nil, fmt.Errorf("fetch failure threshold must not be negative, got %d", c.FetchFailureThreshold)
+	}
+	if c.FetchFailureThreshold > 0 && c.FetchBackoffMax < c.PollInterval {
+		return nil, fmt.Errorf("fetch backoff maximum %v must be at least the poll interval %v", c.FetchBackoffMax, c.PollInterval)
+	}
+	switch c.IPFamily {
+	case IPFamilyAny, IPFamilyV4, IPFamilyV6:
+	default:
+		return nil, fmt.Errorf("invalid IP family %q: must be %q or %q", c.IPFamily, IPFamilyV4, IPFamilyV6)
+	}
+	switch c.AccessMode {
+	case AccessDirect, AccessProxy, AccessAuto:
+	default:
+		return nil, fmt.Errorf("invalid access mode %q: must be %q, %q or %q", c.AccessMode, AccessDirect, AccessProxy, AccessAuto)
+	}
+	if c.StoreRetention <= 0 {
+		return nil, fmt.Errorf("store retention must be positive, got %v", c.StoreRetention)
+	}
+	if c.Digest != "" {
+		if _, err := parseDigestInterval(c.Digest); err != nil {
+			return nil, fmt.Errorf("invalid digest interval %q: %v", c.Digest, err)
+		}
+	}
+	if c.NotifyDebounce < 0 {
+		return nil, fmt.Errorf("notify debounce must not be negative, got %v", c.NotifyDebounce)
+	}
+	if _, err := template.New("notify").Parse(c.NotifyTemplate); err != nil {
+		return nil, fmt.Errorf("invalid notify template: %v", err)
+	}
+	if c.FlapThreshold < 0 {
+		return nil, fmt.Errorf("flap threshold must not be negative, got %d", c.FlapThreshold)
+	}
+	if c.FlapThreshold > 0 && c.FlapWindow <= 0 {
+		return nil, fmt.Errorf("flap window must be positive, got %v", c.FlapWindow)
+	}
+	if c.Demo && c.Replay != "" {
+		return nil, fmt.Errorf("demo mode and replay are exclusive")
+	}
+	if c.ReplaySpeed <= 0 {
+		return nil, fmt.Errorf("replay speed must be positive, got %v", c.ReplaySpeed)
+	}
+	switch c.UsageSource {
+	case UsageMetricsServer, UsageKubelet, UsageNone:
+	default:
+		return nil, fmt.Errorf("invalid usage source %q: must be %q, %q or %q", c.UsageSource, UsageMetricsServer, UsageKubelet, UsageNone)
+	}
+	if c.SLOTarget <= 0 || c.SLOTarget >= 100 {
+		return nil, fmt.Errorf("SLO target must be a percentage between 0 and 100, got %v", c.SLOTarget)
+	}
+	if c.RemoteWriteURL != "" {
+		if u, err := url.Parse(c.RemoteWriteURL); err != nil || u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("invalid remote-write URL %q: must be an http or https URL", c.RemoteWriteURL)
+		}
+		if c.RemoteWriteInterval <= 0 {
+			return nil, fmt.Errorf("remote-write interval must be positive, got %v", c.RemoteWriteInterval)
+		}
+	}
+	if err := c.validateMetricSinks(); err != nil {
+		return nil, err
+	}
+	if err := c.validateTracing(); err != nil {
+		return nil, err
+	}
+	if err := c.validateEmail(); err != nil {
+		return nil, err
+	}
+	if err := c.validateAlertRules(); err != nil {
+		return nil, err
+	}
+	if err := c.validateEventBus(); err != nil {
+		return nil, err
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: must be debug, info, warn or error", c.LogLevel)
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		return nil, fmt.Errorf("invalid log format %q: must be text or json", c.LogFormat)
+	}
+	if c.ReadTimeout < 0 || c.WriteTimeout < 0 || c.IdleTimeout < 0 {
+		return nil, fmt.Errorf("server timeouts must not be negative")
+	}
+	if c.MaxHeaderBytes < 0 {
+		return nil, fmt.Errorf("max header bytes must not be negative, got %d", c.MaxHeaderBytes)
+	}
+	if c.ShutdownTimeout < 0 {
+		return nil, fmt.Errorf("shutdown timeout must not be negative, got %v", c.ShutdownTimeout)
+	}
+	for _, token := range c.AuthTokens {
+		if user, secret := splitToken(token); user == "" || secret == "" {
+			return nil, fmt.Errorf("auth tokens must be token or user:token")
+		}
+	}
+	if c.OIDCIssuer != "" && (c.OIDCClientID == "" || c.OIDCRedirectURL == "") {
+		return nil, fmt.Errorf("OIDC needs a client ID and redirect URL")
+	}
+	if c.RateLimit < 0 || c.ActionRateLimit < 0 {
+		return nil, fmt.Errorf("rate limits must not be negative")
+	}
+	if c.RateLimit > 0 && c.RateBurst < 1 || c.ActionRateLimit > 0 && c.ActionRateBurst < 1 {
+		return nil, fmt.Errorf("rate limit bursts must be at least 1")
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return nil, fmt.Errorf("TLS certificate and key must be set together")
+	}
+	if c.TLSSelfSigned && c.TLSCertFile != "" {
+		return nil, fmt.Errorf("TLS certificate files and a self-signed certificate are mutually exclusive")
+	}
+	if _, ok := tlsVersions[c.TLSMinVersion]; !ok {
+		return nil, fmt.Errorf("invalid TLS minimum version %q: must be 1.2 or 1.3", c.TLSMinVersion)
+	}
+	if _, err := cipherSuiteIDs(c.TLSCipherSuites); err != nil {
+		return nil, err
+	}
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %v", c.Timezone, err)
+	}
+	if c.HTTPRedirectAddr != "" && !c.serveTLS() {
+		return nil, fmt.Errorf("the HTTP redirect needs TLS to be enabled")
+	}
+	return selector, nil
+}
+
+// notifiers returns the notifiers enabled by the config.
+func (c Config) notifiers() []Notifier {
+	var notifiers []Notifier
+	if c.SlackWebhook != "" {
+		notifiers = append(notifiers, &SlackNotifier{WebhookURL: c.SlackWebhook})
+	}
+	if c.WebhookURL != "" {
+		notifiers = append(notifiers, &WebhookNotifier{URL: c.WebhookURL})
+	}
+	if c.PagerDutyRoutingKey != "" {
+		notifiers = append(notifiers, &PagerDutyNotifier{RoutingKey: c.PagerDutyRoutingKey})
+	}
+	if c.OpsgenieAPIKey != "" {
+		notifiers = append(notifiers, &OpsgenieNotifier{APIKey: c.OpsgenieAPIKey, APIURL: c.OpsgenieAPIURL})
+	}
+	return notifiers
+}
+
+// bindFlags defines the command-line flags on fs. Each flag writes to cfg and
+// defaults to its environment variable, falling back to the value already in
+// cfg.
+func bindFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.ConfigFile, "config", envOr("CONFIG_FILE", cfg.ConfigFile), "YAML config file; reloaded on SIGHUP and when it changes")
+	fs.StringVar(&cfg.Selector, "selector", envOr("SELECTOR", cfg.Selector), "label selector of the pods to monitor")
+	fs.Var((*listFlag)(&cfg.Namespaces), "namespaces", "comma-separated namespaces to monitor (default all)")
+	if v := os.Getenv("NAMESPACES"); v != "" {
+		fs.Set("namespaces", v)
+	}
+	fs.BoolVar(&cfg.Demo, "demo", envOrBool("DEMO", cfg.Demo), "run against a simulated cluster of flapping probe-demo pods instead of a real one")
+	fs.StringVar(&cfg.Replay, "replay", envOr("REPLAY", cfg.Replay), "recording file or name to replay instead of monitoring a cluster")
+	fs.Float64Var(&cfg.ReplaySpeed, "replay-speed", envOrFloat("REPLAY_SPEED", cfg.ReplaySpeed), "how many times faster than recorded a recording is replayed")
+	fs.StringVar(&cfg.RecordingsDir, "recordings-dir", envOr("RECORDINGS_DIR", cfg.RecordingsDir), "directory recordings are saved to and replayed from")
+	fs.StringVar(&cfg.Kubeconfig, "kubeconfig", cfg.Kubeconfig, "kubeconfig file to use instead of the in-cluster config (default the KUBECONFIG list or ~/.kube/config)")
+	fs.StringVar(&cfg.Context, "context", envOr("KUBE_CONTEXT", cfg.Context), "kubeconfig context to use instead of the in-cluster config or current context")
+	fs.Var((*listFlag)(&cfg.Contexts), "contexts", "comma-separated kubeconfig contexts of clusters to monitor side by side (default the in-cluster or current context)")
+	if v := os.Getenv("KUBE_CONTEXTS"); v != "" {
+		fs.Set("contexts", v)
+	}
+	fs.StringVar(&cfg.Service, "service", envOr("SERVICE", cfg.Service), "Service whose endpoints are tracked (default all in the monitored namespaces)")
+	fs.DurationVar(&cfg.PollInterval, "poll-interval", envOrDuration("POLL_INTERVAL", cfg.PollInterval), "how often every pod is scraped")
+	fs.DurationVar(&cfg.ResyncPeriod, "resync-period", envOrDuration("RESYNC_PERIOD", cfg.ResyncPeriod), "how often the pod informers replay every cached pod, e.g. 10m (0 disables)")
+	fs.DurationVar(&cfg.FastPollInterval, "fast-poll-interval", envOrDuration("FAST_POLL_INTERVAL", cfg.FastPollInterval), "scrape interval of failing pods and pods whose probes just changed, e.g. 1s (0 disables)")
+	fs.DurationVar(&cfg.SlowPollInterval, "slow-poll-interval", envOrDuration("SLOW_POLL_INTERVAL", cfg.SlowPollInterval), "scrape interval of pods stable for --stable-after, e.g. 30s (0 disables)")
+	fs.DurationVar(&cfg.StableAfter, "stable-after", envOrDuration("STABLE_AFTER", cfg.StableAfter), "how long a healthy pod's probes must be unchanged before it is scraped at --slow-poll-interval")
+	fs.Float64Var(&cfg.ScrapeSpread, "scrape-spread", envOrFloat("SCRAPE_SPREAD", cfg.ScrapeSpread), "fraction of the poll interval each cycle's scrapes are spread over, from 0 (all at once) to 1")
+	fs.IntVar(&cfg.TargetPort, "target-port", envOrInt("TARGET_PORT", cfg.TargetPort), "port of the probe info endpoint on each pod")
+	fs.StringVar(&cfg.TargetPath, "target-path", envOr("TARGET_PATH", cfg.TargetPath), "path of the probe info endpoint on each pod")
+	fs.StringVar(&cfg.SchemaMode, "schema-mode", envOr("SCHEMA_MODE", cfg.SchemaMode), "validation of target responses: strict or lenient")
+	fs.StringVar(&cfg.Protocol, "protocol", envOr("PROTOCOL", cfg.Protocol), "how pods are monitored: http (info endpoint) or grpc (grpc.health.v1); the probe-monitor/protocol annotation overrides it per pod")
+	fs.StringVar(&cfg.TargetScheme, "target-scheme", envOr("TARGET_SCHEME", cfg.TargetScheme), "scheme of the probe info endpoint: http or https; the probe-monitor/scheme annotation overrides it per pod")
+	fs.StringVar(&cfg.TargetCAFile, "target-ca-file", envOr("TARGET_CA_FILE", cfg.TargetCAFile), "PEM CA bundle to verify https targets with (default system roots)")
+	fs.StringVar(&cfg.TargetCertFile, "target-cert-file", envOr("TARGET_CERT_FILE", cfg.TargetCertFile), "PEM client certificate presented to https targets (mTLS)")
+	fs.StringVar(&cfg.TargetKeyFile, "target-key-file", envOr("TARGET_KEY_FILE", cfg.TargetKeyFile), "PEM private key of the client certificate")
+	fs.StringVar(&cfg.TargetServerName, "target-server-name", envOr("TARGET_SERVER_NAME", cfg.TargetServerName), "name to verify target certificates against instead of the pod IP")
+	fs.BoolVar(&cfg.TargetInsecureSkipVerify, "target-insecure-skip-verify", envOrBool("TARGET_INSECURE_SKIP_VERIFY", cfg.TargetInsecureSkipVerify), "don't verify target certificates")
+	fs.IntVar(&cfg.Concurrency, "concurrency", envOrInt("FETCH_CONCURRENCY", cfg.Concurrency), "maximum number of pods scraped at once")
+	fs.StringVar(&cfg.AccessMode, "access-mode", envOr("ACCESS_MODE", cfg.AccessMode), "how pods are reached: direct (pod IPs), proxy (API server pods/proxy) or auto")
+	fs.StringVar(&cfg.IPFamily, "ip-family", envOr("IP_FAMILY", cfg.IPFamily), "preferred family of dual-stack pod IPs: IPv4 or IPv6 (default the pod's primary IP)")
+	fs.StringVar(&cfg.UsageSource, "usage-source", envOr("USAGE_SOURCE", cfg.UsageSource), "where pod CPU and memory usage comes from: metrics-server, kubelet (node /stats/summary through the API server proxy) or none")
+	fs.BoolVar(&cfg.SyntheticChecks, "synthetic-checks", envOrBool("SYNTHETIC_CHECKS", cfg.SyntheticChecks), "run the pods' HTTP, TCP and gRPC probes from the dashboard and report the results")
+	fs.DurationVar(&cfg.FetchTimeout, "fetch-timeout", envOrDuration("FETCH_TIMEOUT", cfg.FetchTimeout), "timeout of a single pod info request")
+	fs.DurationVar(&cfg.FetchTimeout, "scrape-timeout", envOrDuration("SCRAPE_TIMEOUT", cfg.FetchTimeout), "alias of --fetch-timeout")
+	fs.IntVar(&cfg.FetchFailureThreshold, "fetch-failure-threshold", envOrInt("FETCH_FAILURE_THRESHOLD", cfg.FetchFailureThreshold), "consecutive unreachable scrapes after which a pod's scrapes back off (0 disables)")
+	fs.DurationVar(&cfg.FetchBackoffMax, "fetch-backoff-max", envOrDuration("FETCH_BACKOFF_MAX", cfg.FetchBackoffMax), "longest delay between scrapes of an unreachable pod")
+	fs.StringVar(&cfg.Digest, "digest", envOr("DIGEST_INTERVAL", cfg.Digest), "send a health digest through the notifiers: daily, weekly or a duration (disabled when empty)")
+	fs.StringVar(&cfg.SlackWebhook, "slack-webhook", envOr("SLACK_WEBHOOK_URL", cfg.SlackWebhook), "Slack incoming webhook URL for notifications")
+	fs.StringVar(&cfg.WebhookURL, "webhook-url", envOr("NOTIFY_WEBHOOK_URL", cfg.WebhookURL), "generic JSON webhook URL for notifications")
+	fs.StringVar(&cfg.OpsgenieAPIURL, "opsgenie-api-url", envOr("OPSGENIE_API_URL", cfg.OpsgenieAPIURL), "Opsgenie API URL, https://api.eu.opsgenie.com for EU accounts")
+	fs.StringVar(&cfg.SMTPAddr, "smtp-addr", envOr("SMTP_ADDR", cfg.SMTPAddr), "SMTP server host:port; enables email notifications")
+	fs.StringVar(&cfg.SMTPUsername, "smtp-username", envOr("SMTP_USERNAME", cfg.SMTPUsername), "SMTP user name (password from SMTP_PASSWORD)")
+	fs.StringVar(&cfg.SMTPFrom, "smtp-from", envOr("SMTP_FROM", cfg.SMTPFrom), "sender address of notification emails")
+	fs.Var((*listFlag)(&cfg.SMTPTo), "smtp-to", "comma-separated recipients of notification emails")
+	if v := os.Getenv("SMTP_TO"); v != "" {
+		fs.Set("smtp-to", v)
+	}
+	fs.DurationVar(&cfg.EmailBatchWindow, "email-batch-window", envOrDuration("EMAIL_BATCH_WINDOW", cfg.EmailBatchWindow), "how long notifications are collected into one email")
+	fs.StringVar(&cfg.EmailTemplate, "email-template", envOr("EMAIL_TEMPLATE", cfg.EmailTemplate), "html/template file of notification emails; data: Cluster, From, To, Items, Omitted, Unreachable")
+	fs.DurationVar(&cfg.NotifyDebounce, "notify-debounce", envOrDuration("NOTIFY_DEBOUNCE", cfg.NotifyDebounce), "how long a probe or reachability change must hold before it is notified")
+	fs.DurationVar(&cfg.FlapWindow, "flap-window", envOrDuration("FLAP_WINDOW", cfg.FlapWindow), "window in which readiness transitions are counted for flap detection")
+	fs.Float64Var(&cfg.SLOTarget, "slo-target", envOrFloat("SLO_TARGET", cfg.SLOTarget), "readiness objective in percent the error budgets of /api/slo are computed against")
+	fs.IntVar(&cfg.FlapThreshold, "flap-threshold", envOrInt("FLAP_THRESHOLD", cfg.FlapThreshold), "readiness transitions within --flap-window that mark a pod as flapping (0 disables)")
+	fs.StringVar(&cfg.RemoteWriteURL, "remote-write-url", envOr("REMOTE_WRITE_URL", cfg.RemoteWriteURL), "Prometheus remote-write endpoint the metrics are shipped to (disabled when empty)")
+	fs.DurationVar(&cfg.RemoteWriteInterval, "remote-write-interval", envOrDuration("REMOTE_WRITE_INTERVAL", cfg.RemoteWriteInterval), "how often metrics are shipped with remote write")
+	fs.StringVar(&cfg.InfluxURL, "influx-url", envOr("INFLUX_URL", cfg.InfluxURL), "InfluxDB write endpoint, e.g. http://influxdb:8086/api/v2/write?org=acme&bucket=probes (token from INFLUX_TOKEN; disabled when empty)")
+	fs.StringVar(&cfg.StatsDAddr, "statsd-addr", envOr("STATSD_ADDR", cfg.StatsDAddr), "StatsD server host:port the metrics are sent to over UDP (disabled when empty)")
+	fs.StringVar(&cfg.StatsDFlavor, "statsd-flavor", envOr("STATSD_FLAVOR", cfg.StatsDFlavor), "statsd, with labels in the metric name, or dogstatsd, with labels as tags")
+	fs.DurationVar(&cfg.MetricsPushInterval, "metrics-push-interval", envOrDuration("METRICS_PUSH_INTERVAL", cfg.MetricsPushInterval), "how often metrics are sent to InfluxDB and StatsD")
+	fs.StringVar(&cfg.OTLPEndpoint, "otlp-endpoint", envOr("OTEL_EXPORTER_OTLP_ENDPOINT", cfg.OTLPEndpoint), "OTLP/HTTP endpoint, e.g. http://otel-collector:4318, traces are exported to (disabled when empty)")
+	fs.Float64Var(&cfg.TraceSampleRatio, "trace-sample-ratio", envOrFloat("TRACE_SAMPLE_RATIO", cfg.TraceSampleRatio), "fraction of traces to sample, from 0 to 1")
+	fs.StringVar(&cfg.CloudEventsSink, "cloudevents-sink", envOr("CLOUDEVENTS_SINK", cfg.CloudEventsSink), "HTTP sink, such as a Knative broker, receiving CloudEvents of probe transitions and pod lifecycle changes")
+	fs.StringVar(&cfg.EventBus, "event-bus", envOr("EVENT_BUS", cfg.EventBus), "stream pod events to an event bus: nats, kafka, or kafka-rest through a Kafka REST proxy (disabled when empty)")
+	fs.Var((*listFlag)(&cfg.EventBusBrokers), "event-bus-brokers", "comma-separated nats:// servers, Kafka host:port brokers or Kafka REST proxy URLs of the event bus")
+	if v := os.Getenv("EVENT_BUS_BROKERS"); v != "" {
+		fs.Set("event-bus-brokers", v)
+	}
+	fs.StringVar(&cfg.EventBusTopic, "event-bus-topic", envOr("EVENT_BUS_TOPIC", cfg.EventBusTopic), "NATS subject or Kafka topic of the event bus")
+	fs.StringVar(&cfg.EventBusEncoding, "event-bus-encoding", envOr("EVENT_BUS_ENCODING", cfg.EventBusEncoding), "encoding of event bus messages: cloudevents or json")
+	fs.StringVar(&cfg.NotifyTemplate, "notify-template", envOr("NOTIFY_TEMPLATE", cfg.NotifyTemplate), "Go template of state change notifications; fields: Cluster, Pod, Namespace, Node, Signal, From, To, Held, Time")
+	fs.StringVar(&cfg.Store, "store", envOr("STORE", cfg.Store), "history store backend: memory or bolt")
+	fs.StringVar(&cfg.StorePath, "store-path", envOr("STORE_PATH", cfg.StorePath), "database file of the bolt store")
+	fs.DurationVar(&cfg.StoreRetention, "store-retention", envOrDuration("STORE_RETENTION", cfg.StoreRetention), "how long stored snapshots and transitions are kept")
+	fs.StringVar(&cfg.AuthTokenFile, "auth-token-file", envOr("AUTH_TOKEN_FILE", cfg.AuthTokenFile), "file of bearer tokens accepted by mutating endpoints, one token or user:token per line")
+	fs.StringVar(&cfg.OIDCIssuer, "oidc-issuer", envOr("OIDC_ISSUER", cfg.OIDCIssuer), "OIDC issuer URL; enables login for the UI and API")
+	fs.StringVar(&cfg.OIDCClientID, "oidc-client-id", envOr("OIDC_CLIENT_ID", cfg.OIDCClientID), "OIDC client ID")
+	fs.StringVar(&cfg.OIDCRedirectURL, "oidc-redirect-url", envOr("OIDC_REDIRECT_URL", cfg.OIDCRedirectURL), "external URL of the dashboard's /auth/callback, registered with the OIDC provider")
+	fs.Var((*listFlag)(&cfg.OIDCAllowedUsers), "oidc-allowed-users", "comma-separated emails or @domains allowed to log in (default every user of the issuer)")
+	if v := os.Getenv("OIDC_ALLOWED_USERS"); v != "" {
+		fs.Set("oidc-allowed-users", v)
+	}
+	fs.BoolVar(&cfg.KubeAuth, "kube-auth", envOrBool("KUBE_AUTH", cfg.KubeAuth), "accept Kubernetes ServiceAccount tokens (TokenReview); mutating calls need RBAC permission to update the pods")
+	fs.Float64Var(&cfg.RateLimit, "rate-limit", envOrFloat("RATE_LIMIT", cfg.RateLimit), "API requests per second allowed per client, by user or IP (0 = unlimited)")
+	fs.IntVar(&cfg.RateBurst, "rate-burst", envOrInt("RATE_BURST", cfg.RateBurst), "API requests a client may make at once before --rate-limit applies")
+	fs.Float64Var(&cfg.ActionRateLimit, "action-rate-limit", envOrFloat("ACTION_RATE_LIMIT", cfg.ActionRateLimit), "probe actions and other changes per second allowed per client (0 = unlimited)")
+	fs.IntVar(&cfg.ActionRateBurst, "action-rate-burst", envOrInt("ACTION_RATE_BURST", cfg.ActionRateBurst), "changes a client may make at once before --action-rate-limit applies")
+	fs.BoolVar(&cfg.ReadOnly, "read-only", envOrBool("READ_ONLY", cfg.ReadOnly), "disable probe actions and every other mutating endpoint, for dashboards shown to a wide audience")
+	fs.BoolVar(&cfg.AllowMutations, "allow-mutations", envOrBool("ALLOW_MUTATIONS", cfg.AllowMutations), "enable the endpoints that change cluster objects, such as deleting pods")
+	fs.StringVar(&cfg.TLSCertFile, "tls-cert", envOr("TLS_CERT_FILE", cfg.TLSCertFile), "PEM certificate to serve the dashboard over HTTPS with; reloaded when it changes")
+	fs.StringVar(&cfg.TLSKeyFile, "tls-key", envOr("TLS_KEY_FILE", cfg.TLSKeyFile), "PEM private key of the TLS certificate")
+	fs.BoolVar(&cfg.TLSSelfSigned, "tls-self-signed", envOrBool("TLS_SELF_SIGNED", cfg.TLSSelfSigned), "serve HTTPS with a generated self-signed certificate")
+	fs.StringVar(&cfg.TLSMinVersion, "tls-min-version", envOr("TLS_MIN_VERSION", cfg.TLSMinVersion), "minimum TLS version: 1.2 or 1.3")
+	fs.Var((*listFlag)(&cfg.TLSCipherSuites), "tls-cipher-suites", "comma-separated TLS 1.2 cipher suites, such as TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 (default Go's secure suites)")
+	if v := os.Getenv("TLS_CIPHER_SUITES"); v != "" {
+		fs.Set("tls-cipher-suites", v)
+	}
+	fs.StringVar(&cfg.HTTPRedirectAddr, "http-redirect-addr", envOr("HTTP_REDIRECT_ADDR", cfg.HTTPRedirectAddr), "plain HTTP address, such as :8080, redirecting to HTTPS")
+	fs.StringVar(&cfg.TemplateDir, "template-dir", envOr("TEMPLATE_DIR", cfg.TemplateDir), "directory of *.html templates and static/ files overriding the built-in ones")
+	fs.StringVar(&cfg.Timezone, "timezone", envOr("TIMEZONE", cfg.Timezone), "IANA timezone, such as Europe/Amsterdam, of the times shown on the page (default the server's)")
+	fs.StringVar(&cfg.LogLevel, "log-level", envOr("LOG_LEVEL", cfg.LogLevel), "minimum log level: debug, info, warn or error")
+	fs.StringVar(&cfg.LogFormat, "log-format", envOr("LOG_FORMAT", cfg.LogFormat), "log output format: text or json")
+	fs.BoolVar(&cfg.LogRequests, "log-requests", envOrBool("LOG_REQUESTS", cfg.LogRequests), "log every dashboard request")
+	fs.DurationVar(&cfg.ReadTimeout, "read-timeout", envOrDuration("READ_TIMEOUT", cfg.ReadTimeout), "maximum time to read a dashboard request, including its body (0 = none)")
+	fs.DurationVar(&cfg.WriteTimeout, "write-timeout", envOrDuration("WRITE_TIMEOUT", cfg.WriteTimeout), "maximum time to write a dashboard response, except streams (0 = none)")
+	fs.DurationVar(&cfg.IdleTimeout, "idle-timeout", envOrDuration("IDLE_TIMEOUT", cfg.IdleTimeout), "how long idle keep-alive connections are kept open (0 = read timeout)")
+	fs.IntVar(&cfg.MaxHeaderBytes, "max-header-bytes", envOrInt("MAX_HEADER_BYTES", cfg.MaxHeaderBytes), "maximum size of a request's headers")
+	fs.StringVar(&cfg.DebugAddr, "debug-addr", envOr("DEBUG_ADDR", cfg.DebugAddr), "address, such as localhost:6060, serving pprof and expvar (disabled when empty)")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", envOrDuration("SHUTDOWN_TIMEOUT", cfg.ShutdownTimeout), "grace period for in-flight requests on shutdown")
+
+	// Tokens, the client secret and the incident tools' keys are secrets, so
+	// they are only read from the environment and files, never from the
+	// command line.
+	if v := os.Getenv("AUTH_TOKENS"); v != "" {
+		(*listFlag)(&cfg.AuthTokens).Set(v)
+	}
+	if v := os.Getenv("OIDC_CLIENT_SECRET"); v != "" {
+		cfg.OIDCClientSecret = v
+	}
+	if v := os.Getenv("PAGERDUTY_ROUTING_KEY"); v != "" {
+		cfg.PagerDutyRoutingKey = v
+	}
+	if v := os.Getenv("OPSGENIE_API_KEY"); v != "" {
+		cfg.OpsgenieAPIKey = v
+	}
+	if v := os.Getenv("SMTP_PASSWORD"); v != "" {
+		cfg.SMTPPassword = v
+	}
+	if v := os.Getenv("REMOTE_WRITE_BEARER_TOKEN"); v != "" {
+		cfg.RemoteWriteBearerToken = v
+	}
+	if v := os.Getenv("INFLUX_TOKEN"); v != "" {
+		cfg.InfluxToken = v
+	}
+	// The OTLP headers usually carry an API key.
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"); v != "" {
+		cfg.OTLPHeaders = make(map[string]string)
+		for _, header := range strings.Split(v, ",") {
+			if name, value, ok := strings.Cut(header, "="); ok {
+				value, _ = url.QueryUnescape(strings.TrimSpace(value))
+				cfg.OTLPHeaders[strings.TrimSpace(name)] = value
+			}
+		}
+	}
+}
+
+// loadConfig builds the config from the defaults, the config file named by
+// --config or CONFIG_FILE, the environment and args. Usage errors are
+// written to usage, which may be io.Discard.
+func loadConfig(args []string, usage io.Writer) (Config, error) {
+	// Flags and environment take precedence over the file, so the file
+	// name is looked up in a first pass and everything is bound again on
+	// top of the file's values.
+	located := DefaultConfig()
+	fs := flag.NewFlagSet("k8s-probe-monitor", flag.ContinueOnError)
+	fs.SetOutput(usage)
+	bindFlags(fs, &located)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	cfg := DefaultConfig()
+	if located.ConfigFile != "" {
+		if err := readConfigFile(located.ConfigFile, &cfg); err != nil {
+			return Config{}, err
+		}
+	}
+	fs = flag.NewFlagSet("k8s-probe-monitor", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	bindFlags(fs, &cfg)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	cfg.ConfigFile = located.ConfigFile
+	if cfg.AuthTokenFile != "" {
+		tokens, err := readTokenFile(cfg.AuthTokenFile)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.AuthTokens = append(slices.Clip(cfg.AuthTokens), tokens...)
+	}
+
+	if _, err := cfg.validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// fileConfig is the layout of the YAML config file.
+type fileConfig struct {
+	Selector     string   `json:"selector"`
+	Namespaces   []string `json:"namespaces"`
+	Kubeconfig   string   `json:"kubeconfig"`
+	Context      string   `json:"context"`
+	Contexts     []string `json:"contexts"`
+	Service      string   `json:"service"`
+	ReadOnly     bool     `json:"readOnly"`
+	ResyncPeriod duration `json:"resyncPeriod"`
+	PollInterval duration `json:"pollInterval"`
+	ScrapeSpread float64  `json:"scrapeSpread"`
+	AdaptivePoll struct {
+		Fast        duration `json:"fast"`
+		Slow        duration `json:"slow"`
+		StableAfter duration `json:"stableAfter"`
+	} `json:"adaptivePolling"`
+	Concurrency int `json:"concurrency"`
+	Target      struct {
+		Port       int    `json:"port"`
+		Path       string `json:"path"`
+		SchemaMode string `json:"schemaMode"`
+		Protocol   string `json:"protocol"`
+		Scheme     string `json:"scheme"`
+		TLS        struct {
+			CAFile             string `json:"caFile"`
+			CertFile           string `json:"certFile"`
+			KeyFile            string `json:"keyFile"`
+			ServerName         string `json:"serverName"`
+			InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+		} `json:"tls"`
+		Timeout duration `json:"timeout"`
+		Backoff struct {
+			Failures int      `json:"failures"`
+			Max      duration `json:"max"`
+		} `json:"backoff"`
+		AccessMode      string `json:"accessMode"`
+		IPFamily        string `json:"ipFamily"`
+		SyntheticChecks bool   `json:"syntheticChecks"`
+	} `json:"target"`
+	Store struct {
+		Backend   string   `json:"backend"`
+		Path      string   `json:"path"`
+		Retention duration `json:"retention"`
+	} `json:"store"`
+	Notifications struct {
+		SlackWebhook string   `json:"slackWebhook"`
+		WebhookURL   string   `json:"webhookURL"`
+		Digest       string   `json:"digest"`
+		Debounce     duration `json:"debounce"`
+		Template     string   `json:"template"`
+		PagerDuty    struct {
+			RoutingKey string `json:"routingKey"`
+		} `json:"pagerDuty"`
+		Opsgenie struct {
+			APIKey string `json:"apiKey"`
+			APIURL string `json:"apiURL"`
+		} `json:"opsgenie"`
+		Email struct {
+			SMTPAddr    string   `json:"smtpAddr"`
+			Username    string   `json:"username"`
+			Password    string   `json:"password"`
+			From        string   `json:"from"`
+			To          []string `json:"to"`
+			BatchWindow duration `json:"batchWindow"`
+			Template    string   `json:"template"`
+		} `json:"email"`
+		CloudEvents struct {
+			Sink string `json:"sink"`
+		} `json:"cloudEvents"`
+	} `json:"notifications"`
+	Flapping struct {
+		Window      duration `json:"window"`
+		Transitions int      `json:"transitions"`
+	} `json:"flapping"`
+	SLO struct {
+		Target float64 `json:"target"`
+	} `json:"slo"`
+	Recordings struct {
+		Dir string `json:"dir"`
+	} `json:"recordings"`
+	Usage struct {
+		Source string `json:"source"`
+	} `json:"usage"`
+	Alerts struct {
+		Rules []AlertRule `json:"rules"`
+	} `json:"alerts"`
+	RemoteWrite struct {
+		URL         string   `json:"url"`
+		Interval    duration `json:"interval"`
+		BearerToken string   `json:"bearerToken"`
+	} `json:"remoteWrite"`
+	MetricSinks struct {
+		Interval duration `json:"interval"`
+		InfluxDB struct {
+			URL   string `json:"url"`
+			Token string `json:"token"`
+		} `json:"influxDB"`
+		StatsD struct {
+			Addr   string `json:"addr"`
+			Flavor string `json:"flavor"`
+		} `json:"statsd"`
+	} `json:"metricSinks"`
+	Tracing struct {
+		OTLPEndpoint string            `json:"otlpEndpoint"`
+		Headers      map[string]string `json:"headers"`
+		SampleRatio  float64           `json:"sampleRatio"`
+	} `json:"tracing"`
+	EventBus struct {
+		Kind     string   `json:"kind"`
+		Brokers  []string `json:"brokers"`
+		Topic    string   `json:"topic"`
+		Encoding string   `json:"encoding"`
+	} `json:"eventBus"`
+	Auth struct {
+		Tokens         []string `json:"tokens"`
+		TokenFile      string   `json:"tokenFile"`
+		AllowMutations bool     `json:"allowMutations"`
+		Kubernetes     bool     `json:"kubernetes"`
+		OIDC           struct {
+			Issuer       string   `json:"issuer"`
+			ClientID     string   `json:"clientID"`
+			ClientSecret string   `json:"clientSecret"`
+			RedirectURL  string   `json:"redirectURL"`
+			AllowedUsers []string `json:"allowedUsers"`
+		} `json:"oidc"`
+	} `json:"auth"`
+	RateLimit struct {
+		Requests    float64 `json:"requests"`
+		Burst       int     `json:"burst"`
+		Actions     float64 `json:"actions"`
+		ActionBurst int     `json:"actionBurst"`
+	} `json:"rateLimit"`
+	Server struct {
+		TLS struct {
+			CertFile     string   `json:"certFile"`
+			KeyFile      string   `json:"keyFile"`
+			SelfSigned   bool     `json:"selfSigned"`
+			MinVersion   string   `json:"minVersion"`
+			CipherSuites []string `json:"cipherSuites"`
+		} `json:"tls"`
+		HTTPRedirectAddr string   `json:"httpRedirectAddr"`
+		DebugAddr        string   `json:"debugAddr"`
+		ReadTimeout      duration `json:"readTimeout"`
+		WriteTimeout     duration `json:"writeTimeout"`
+		IdleTimeout      duration `json:"idleTimeout"`
+		MaxHeaderBytes   int      `json:"maxHeaderBytes"`
+		TemplateDir      string   `json:"templateDir"`
+		Timezone         string   `json:"timezone"`
+	} `json:"server"`
+	Log struct {
+		Level    string `json:"level"`
+		Format   string `json:"format"`
+		Requests bool   `json:"requests"`
+	} `json:"log"`
+	ShutdownTimeout duration `json:"shutdownTimeout"`
+}
+
+// readConfigFile overlays the settings in the YAML file at path onto cfg.
+// Settings missing from the file keep their current value; unknown keys are
+// rejected to catch typos.
+func readConfigFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var f fileConfig
+	f.Selector = cfg.Selector
+	f.Namespaces = cfg.Namespaces
+	f.Kubeconfig = cfg.Kubeconfig
+	f.Context = cfg.Context
+	f.Contexts = cfg.Contexts
+	f.Service = cfg.Service
+	f.ReadOnly = cfg.ReadOnly
+	f.ResyncPeriod = duration(cfg.ResyncPeriod)
+	f.PollInterval = duration(cfg.PollInterval)
+	f.ScrapeSpread = cfg.ScrapeSpread
+	f.AdaptivePoll.Fast = duration(cfg.FastPollInterval)
+	f.AdaptivePoll.Slow = duration(cfg.SlowPollInterval)
+	f.AdaptivePoll.StableAfter = duration(cfg.StableAfter)
+	f.Concurrency = cfg.Concurrency
+	f.Target.Port = cfg.TargetPort
+	f.Target.Path = cfg.TargetPath
+	f.Target.SchemaMode = cfg.SchemaMode
+	f.Target.Protocol = cfg.Protocol
+	f.Target.Scheme = cfg.TargetScheme
+	f.Target.TLS.CAFile = cfg.TargetCAFile
+	f.Target.TLS.CertFile = cfg.TargetCertFile
+	f.Target.TLS.KeyFile = cfg.TargetKeyFile
+	f.Target.TLS.ServerName = cfg.TargetServerName
+	f.Target.TLS.InsecureSkipVerify = cfg.TargetInsecureSkipVerify
+	f.Target.Timeout = duration(cfg.FetchTimeout)
+	f.Target.Backoff.Failures = cfg.FetchFailureThreshold
+	f.Target.Backoff.Max = duration(cfg.FetchBackoffMax)
+	f.Target.AccessMode = cfg.AccessMode
+	f.Target.IPFamily = cfg.IPFamily
+	f.Target.SyntheticChecks = cfg.SyntheticChecks
+	f.Store.Backend = cfg.Store
+	f.Store.Path = cfg.StorePath
+	f.Store.Retention = duration(cfg.StoreRetention)
+	f.Notifications.SlackWebhook = cfg.SlackWebhook
+	f.Notifications.WebhookURL = cfg.WebhookURL
+	f.Notifications.Digest = cfg.Digest
+	f.Notifications.Debounce = duration(cfg.NotifyDebounce)
+	f.Notifications.Template = cfg.NotifyTemplate
+	f.Notifications.PagerDuty.RoutingKey = cfg.PagerDutyRoutingKey
+	f.Notifications.Opsgenie.APIKey = cfg.OpsgenieAPIKey
+	f.Notifications.Opsgenie.APIURL = cfg.OpsgenieAPIURL
+	f.Notifications.Email.SMTPAddr = cfg.SMTPAddr
+	f.Notifications.Email.Username = cfg.SMTPUsername
+	f.Notifications.Email.Password = cfg.SMTPPassword
+	f.Notifications.Email.From = cfg.SMTPFrom
+	f.Notifications.Email.To = cfg.SMTPTo
+	f.Notifications.Email.BatchWindow = duration(cfg.EmailBatchWindow)
+	f.Notifications.Email.Template = cfg.EmailTemplate
+	f.Notifications.CloudEvents.Sink = cfg.CloudEventsSink
+	f.Flapping.Window = duration(cfg.FlapWindow)
+	f.Flapping.Transitions = cfg.FlapThreshold
+	f.SLO.Target = cfg.SLOTarget
+	f.Recordings.Dir = cfg.RecordingsDir
+	f.Usage.Source = cfg.UsageSource
+	f.Alerts.Rules = cfg.AlertRules
+	f.RemoteWrite.URL = cfg.RemoteWriteURL
+	f.RemoteWrite.Interval = duration(cfg.RemoteWriteInterval)
+	f.RemoteWrite.BearerToken = cfg.RemoteWriteBearerToken
+	f.MetricSinks.Interval = duration(cfg.MetricsPushInterval)
+	f.MetricSinks.InfluxDB.URL = cfg.InfluxURL
+	f.MetricSinks.InfluxDB.Token = cfg.InfluxToken
+	f.MetricSinks.StatsD.Addr = cfg.StatsDAddr
+	f.MetricSinks.StatsD.Flavor = cfg.StatsDFlavor
+	f.Tracing.OTLPEndpoint = cfg.OTLPEndpoint
+	f.Tracing.Headers = cfg.OTLPHeaders
+	f.Tracing.SampleRatio = cfg.TraceSampleRatio
+	f.EventBus.Kind = cfg.EventBus
+	f.EventBus.Brokers = cfg.EventBusBrokers
+	f.EventBus.Topic = cfg.EventBusTopic
+	f.EventBus.Encoding = cfg.EventBusEncoding
+	f.Auth.Tokens = cfg.AuthTokens
+	f.Auth.TokenFile = cfg.AuthTokenFile
+	f.Auth.AllowMutations = cfg.AllowMutations
+	f.Auth.Kubernetes = cfg.KubeAuth
+	f.Auth.OIDC.Issuer = cfg.OIDCIssuer
+	f.Auth.OIDC.ClientID = cfg.OIDCClientID
+	f.Auth.OIDC.ClientSecret = cfg.OIDCClientSecret
+	f.Auth.OIDC.RedirectURL = cfg.OIDCRedirectURL
+	f.Auth.OIDC.AllowedUsers = cfg.OIDCAllowedUsers
+	f.RateLimit.Requests = cfg.RateLimit
+	f.RateLimit.Burst = cfg.RateBurst
+	f.RateLimit.Actions = cfg.ActionRateLimit
+	f.RateLimit.ActionBurst = cfg.ActionRateBurst
+	f.Server.TLS.CertFile = cfg.TLSCertFile
+	f.Server.TLS.KeyFile = cfg.TLSKeyFile
+	f.Server.TLS.SelfSigned = cfg.TLSSelfSigned
+	f.Server.TLS.MinVersion = cfg.TLSMinVersion
+	f.Server.TLS.CipherSuites = cfg.TLSCipherSuites
+	f.Server.HTTPRedirectAddr = cfg.HTTPRedirectAddr
+	f.Server.DebugAddr = cfg.DebugAddr
+	f.Server.ReadTimeout = duration(cfg.ReadTimeout)
+	f.Server.WriteTimeout = duration(cfg.WriteTimeout)
+	f.Server.IdleTimeout = duration(cfg.IdleTimeout)
+	f.Server.MaxHeaderBytes = cfg.MaxHeaderBytes
+	f.Server.TemplateDir = cfg.TemplateDir
+	f.Server.Timezone = cfg.Timezone
+	f.Log.Level = cfg.LogLevel
+	f.Log.Format = cfg.LogFormat
+	f.Log.Requests = cfg.LogRequests
+	f.ShutdownTimeout = duration(cfg.ShutdownTimeout)
+
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+
+	cfg.Selector = f.Selector
+	cfg.Namespaces = f.Namespaces
+	cfg.Kubeconfig = f.Kubeconfig
+	cfg.Context = f.Context
+	cfg.Contexts = f.Contexts
+	cfg.Service = f.Service
+	cfg.ReadOnly = f.ReadOnly
+	cfg.ResyncPeriod = time.Duration(f.ResyncPeriod)
+	cfg.PollInterval = time.Duration(f.PollInterval)
+	cfg.ScrapeSpread = f.ScrapeSpread
+	cfg.FastPollInterval = time.Duration(f.AdaptivePoll.Fast)
+	cfg.SlowPollInterval = time.Duration(f.AdaptivePoll.Slow)
+	cfg.StableAfter = time.Duration(f.AdaptivePoll.StableAfter)
+	cfg.Concurrency = f.Concurrency
+	cfg.TargetPort = f.Target.Port
+	cfg.TargetPath = f.Target.Path
+	cfg.SchemaMode = f.Target.SchemaMode
+	cfg.Protocol = f.Target.Protocol
+	cfg.TargetScheme = f.Target.Scheme
+	cfg.TargetCAFile = f.Target.TLS.CAFile
+	cfg.TargetCertFile = f.Target.TLS.CertFile
+	cfg.TargetKeyFile = f.Target.TLS.KeyFile
+	cfg.TargetServerName = f.Target.TLS.ServerName
+	cfg.TargetInsecureSkipVerify = f.Target.TLS.InsecureSkipVerify
+	cfg.FetchTimeout = time.Duration(f.Target.Timeout)
+	cfg.FetchFailureThreshold = f.Target.Backoff.Failures
+	cfg.FetchBackoffMax = time.Duration(f.Target.Backoff.Max)
+	cfg.AccessMode = f.Target.AccessMode
+	cfg.IPFamily = f.Target.IPFamily
+	cfg.SyntheticChecks = f.Target.SyntheticChecks
+	cfg.Store = f.Store.Backend
+	cfg.StorePath = f.Store.Path
+	cfg.StoreRetention = time.Duration(f.Store.Retention)
+	cfg.SlackWebhook = f.Notifications.SlackWebhook
+	cfg.WebhookURL = f.Notifications.WebhookURL
+	cfg.Digest = f.Notifications.Digest
+	cfg.NotifyDebounce = time.Duration(f.Notifications.Debounce)
+	cfg.NotifyTemplate = f.Notifications.Template
+	cfg.PagerDutyRoutingKey = f.Notifications.PagerDuty.RoutingKey
+	cfg.OpsgenieAPIKey = f.Notifications.Opsgenie.APIKey
+	cfg.OpsgenieAPIURL = f.Notifications.Opsgenie.APIURL
+	cfg.SMTPAddr = f.Notifications.Email.SMTPAddr
+	cfg.SMTPUsername = f.Notifications.Email.Username
+	cfg.SMTPPassword = f.Notifications.Email.Password
+	cfg.SMTPFrom = f.Notifications.Email.From
+	cfg.SMTPTo = f.Notifications.Email.To
+	cfg.EmailBatchWindow = time.Duration(f.Notifications.Email.BatchWindow)
+	cfg.EmailTemplate = f.Notifications.Email.Template
+	cfg.CloudEventsSink = f.Notifications.CloudEvents.Sink
+	cfg.FlapWindow = time.Duration(f.Flapping.Window)
+	cfg.FlapThreshold = f.Flapping.Transitions
+	cfg.SLOTarget = f.SLO.Target
+	cfg.RecordingsDir = f.Recordings.Dir
+	cfg.UsageSource = f.Usage.Source
+	cfg.AlertRules = f.Alerts.Rules
+	cfg.RemoteWriteURL = f.RemoteWrite.URL
+	cfg.RemoteWriteInterval = time.Duration(f.RemoteWrite.Interval)
+	cfg.RemoteWriteBearerToken = f.RemoteWrite.BearerToken
+	cfg.MetricsPushInterval = time.Duration(f.MetricSinks.Interval)
+	cfg.InfluxURL = f.MetricSinks.InfluxDB.URL
+	cfg.InfluxToken = f.MetricSinks.InfluxDB.Token
+	cfg.StatsDAddr = f.MetricSinks.StatsD.Addr
+	cfg.StatsDFlavor = f.MetricSinks.StatsD.Flavor
+	cfg.OTLPEndpoint = f.Tracing.OTLPEndpoint
+	cfg.OTLPHeaders = f.Tracing.Headers
+	cfg.TraceSampleRatio = f.Tracing.SampleRatio
+	cfg.EventBus = f.EventBus.Kind
+	cfg.EventBusBrokers = f.EventBus.Brokers
+	cfg.EventBusTopic = f.EventBus.Topic
+	cfg.EventBusEncoding = f.EventBus.Encoding
+	cfg.AuthTokens = f.Auth.Tokens
+	cfg.AuthTokenFile = f.Auth.TokenFile
+	cfg.AllowMutations = f.Auth.AllowMutations
+	cfg.KubeAuth = f.Auth.Kubernetes
+	cfg.OIDCIssuer = f.Auth.OIDC.Issuer
+	cfg.OIDCClientID = f.Auth.OIDC.ClientID
+	cfg.OIDCClientSecret = f.Auth.OIDC.ClientSecret
+	cfg.OIDCRedirectURL = f.Auth.OIDC.RedirectURL
+	cfg.OIDCAllowedUsers = f.Auth.OIDC.AllowedUsers
+	cfg.RateLimit = f.RateLimit.Requests
+	cfg.RateBurst = f.RateLimit.Burst
+	cfg.ActionRateLimit = f.RateLimit.Actions
+	cfg.ActionRateBurst = f.RateLimit.ActionBurst
+	cfg.TLSCertFile = f.Server.TLS.CertFile
+	cfg.TLSKeyFile = f.Server.TLS.KeyFile
+	cfg.TLSSelfSigned = f.Server.TLS.SelfSigned
+	cfg.TLSMinVersion = f.Server.TLS.MinVersion
+	cfg.TLSCipherSuites = f.Server.TLS.CipherSuites
+	cfg.HTTPRedirectAddr = f.Server.HTTPRedirectAddr
+	cfg.DebugAddr = f.Server.DebugAddr
+	cfg.ReadTimeout = time.Duration(f.Server.ReadTimeout)
+	cfg.WriteTimeout = time.Duration(f.Server.WriteTimeout)
+	cfg.IdleTimeout = time.Duration(f.Server.IdleTimeout)
+	cfg.MaxHeaderBytes = f.Server.MaxHeaderBytes
+	cfg.TemplateDir = f.Server.TemplateDir
+	cfg.Timezone = f.Server.Timezone
+	cfg.LogLevel = f.Log.Level
+	cfg.LogFormat = f.Log.Format
+	cfg.LogRequests = f.Log.Requests
+	cfg.ShutdownTimeout = time.Duration(f.ShutdownTimeout)
+	return nil
+}
+
+// duration is a time.Duration written as a string such as "30s" in the
+// config file.
+type duration time.Duration
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("durations must be strings like \"30s\": %v", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// listFlag is a comma-separated list flag.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(v string) error {
+	*l = nil
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
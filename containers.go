@@ -0,0 +1,97 @@
+package main
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Kinds of containers. Sidecars are native sidecars: init containers with
+// restartPolicy Always, which keep running next to the app containers.
+const (
+	ContainerInit    = "init"
+	ContainerSidecar = "sidecar"
+	ContainerApp     = "app"
+)
+
+// ContainerState is a container of the pod as the kubelet reports it.
+type ContainerState struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	// State is waiting, running or terminated, and empty before the
+	// kubelet reports the container.
+	State        string `json:"state,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+	ExitCode     *int32 `json:"exitCode,omitempty"`
+	Started      bool   `json:"started"`
+	Ready        bool   `json:"ready"`
+	RestartCount int32  `json:"restartCount"`
+	// Blocking marks the containers holding up the pod: the init container
+	// or sidecar the init sequence waits for, or once that completed, the
+	// sidecars and app containers that aren't ready.
+	Blocking bool `json:"blocking,omitempty"`
+}
+
+// containerStates lists the pod's containers in the order they start: init
+// containers and sidecars, then the app containers.
+func containerStates(pod *corev1.Pod) []ContainerState {
+	statuses := make(map[string]corev1.ContainerStatus)
+	for _, cs := range pod.Status.InitContainerStatuses {
+		statuses["init/"+cs.Name] = cs
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		statuses["app/"+cs.Name] = cs
+	}
+	state := func(c corev1.Container, kind, prefix string) ContainerState {
+		s := ContainerState{Name: c.Name, Kind: kind}
+		cs, ok := statuses[prefix+c.Name]
+		if !ok {
+			return s
+		}
+		s.Started = cs.Started != nil && *cs.Started
+		s.Ready = cs.Ready
+		s.RestartCount = cs.RestartCount
+		switch {
+		case cs.State.Waiting != nil:
+			s.State, s.Reason = "waiting", cs.State.Waiting.Reason
+		case cs.State.Running != nil:
+			s.State = "running"
+		case cs.State.Terminated != nil:
+			s.State, s.Reason = "terminated", cs.State.Terminated.Reason
+			s.ExitCode = &cs.State.Terminated.ExitCode
+		}
+		return s
+	}
+
+	out := make([]ContainerState, 0, len(pod.Spec.InitContainers)+len(pod.Spec.Containers))
+	initialized := true
+	for _, c := range pod.Spec.InitContainers {
+		kind := ContainerInit
+		if c.RestartPolicy != nil && *c.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			kind = ContainerSidecar
+		}
+		s := state(c, kind, "init/")
+		if initialized {
+			// The next init container only starts once an init container
+			// completed or a sidecar started.
+			done := s.Started
+			if kind == ContainerInit {
+				done = s.State == "terminated" && *s.ExitCode == 0
+			}
+			if !done {
+				s.Blocking = true
+				initialized = false
+			}
+		}
+		out = append(out, s)
+	}
+	for i := range out {
+		if initialized && out[i].Kind == ContainerSidecar && !out[i].Ready {
+			out[i].Blocking = true
+		}
+	}
+	for _, c := range pod.Spec.Containers {
+		s := state(c, ContainerApp, "app/")
+		s.Blocking = initialized && !s.Ready && pod.Status.Phase != corev1.PodSucceeded
+		out = append(out, s)
+	}
+	return out
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{expr: "* * * * *"},
+		{expr: "*/15 9-17 * * 1-5"},
+		{expr: "0,30 0-23/6 1,15 */3 0"},
+		{expr: "0 0 * * 7"},
+		{expr: "* * * *", wantErr: true},
+		{expr: "* * * * * *", wantErr: true},
+		{expr: "60 * * * *", wantErr: true},
+		{expr: "* 24 * * *", wantErr: true},
+		{expr: "* * 0 * *", wantErr: true},
+		{expr: "* * * 13 *", wantErr: true},
+		{expr: "* * * * 8", wantErr: true},
+		{expr: "5-1 * * * *", wantErr: true},
+		{expr: "*/0 * * * *", wantErr: true},
+		{expr: "a * * * *", wantErr: true},
+		{expr: "1-b * * * *", wantErr: true},
+	}
+	for _, tt := range tests {
+		_, err := parseCron(tt.expr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCron(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 2025-01-01 is a Wednesday.
+	from := time.Date(2025, 1, 1, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2025, 1, 1, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{"7 * * * *", time.Date(2025, 1, 1, 11, 7, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2025, 1, 2, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2025, 1, 2, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2025, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2025, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{"30 12 15 * *", time.Date(2025, 1, 15, 12, 30, 0, 0, time.UTC)},
+		{"0 0 1 3 *", time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 1-12/2 *", time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)},
+		// With both day fields restricted either matches: the 10th or the
+		// next Friday.
+		{"0 0 10 * 5", time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		c, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q) error = %v", tt.expr, err)
+		}
+		if got := c.next(from); !got.Equal(tt.want) {
+			t.Errorf("next(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
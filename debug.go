@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// scrapeCycles publishes each cluster's scrape cycle durations on
+// /debug/vars, next to the memstats expvar publishes itself.
+var scrapeCycles = expvar.NewMap("scrapeCycles")
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() any { return runtime.NumGoroutine() }))
+}
+
+// cycleStats summarizes how long a dashboard's scrape cycles take.
+type cycleStats struct {
+	mu    sync.Mutex
+	count int64
+	last  time.Duration
+	max   time.Duration
+	total time.Duration
+	at    time.Time
+}
+
+// observeScrapeCycle records a cycle of cluster's monitor loop.
+func observeScrapeCycle(cluster string, took time.Duration, now time.Time) {
+	if cluster == "" {
+		cluster = "default"
+	}
+	s, _ := scrapeCycles.Get(cluster).(*cycleStats)
+	if s == nil {
+		// Each cluster has a single monitor loop, so there is no race.
+		s = &cycleStats{}
+		scrapeCycles.Set(cluster, s)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count++
+	s.last = took
+	s.max = max(s.max, took)
+	s.total += took
+	s.at = now
+}
+
+// String renders the stats as JSON for expvar.
+func (s *cycleStats) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := struct {
+		Count       int64     `json:"count"`
+		LastSeconds float64   `json:"lastSeconds"`
+		MaxSeconds  float64   `json:"maxSeconds"`
+		MeanSeconds float64   `json:"meanSeconds"`
+		LastAt      time.Time `json:"lastAt"`
+	}{Count: s.count, LastSeconds: s.last.Seconds(), MaxSeconds: s.max.Seconds(), LastAt: s.at}
+	if s.count > 0 {
+		out.MeanSeconds = s.total.Seconds() / float64(s.count)
+	}
+	b, _ := json.Marshal(out)
+	return string(b)
+}
+
+// debugHandler serves net/http/pprof and expvar for the debug port. They are
+// kept off the dashboard's port, which may be exposed more widely.
+func debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// tombstoneTTL is how long deleted pods are remembered for
+// /api/pods?since=. Clients polling less often get a full resync.
+const tombstoneTTL = 10 * time.Minute
+
+// maxPollWait bounds how long /api/pods?since= waits for a change.
+const maxPollWait = time.Minute
+
+// podChange is the latest change to a pod.
+type podChange struct {
+	revision uint64
+	time     time.Time
+	deleted  bool
+}
+
+// changeLog numbers the changes to the pod set, so clients can ask for the
+// pods changed after a revision. It is kept by the event hub, which sees
+// every change of every cluster.
+type changeLog struct {
+	revision uint64
+	changes  map[string]podChange
+	// Changes up to prunedRevision and prunedTime may have been forgotten.
+	prunedRevision uint64
+	prunedTime     time.Time
+	// changed is closed and replaced on every change, waking long polls.
+	changed chan struct{}
+}
+
+func newChangeLog() changeLog {
+	return changeLog{
+		changes:    make(map[string]podChange),
+		prunedTime: time.Now(),
+		changed:    make(chan struct{}),
+	}
+}
+
+// record numbers a pod event. The caller holds h.mu.
+func (h *eventHub) record(ev PodEvent) {
+	now := time.Now()
+	l := &h.log
+	l.revision++
+	l.changes[ev.Key()] = podChange{revision: l.revision, time: now, deleted: ev.Type == PodEventDelete}
+
+	if ev.Type == PodEventDelete {
+		for k, c := range l.changes {
+			if c.deleted && now.Sub(c.time) > tombstoneTTL {
+				delete(l.changes, k)
+				l.prunedRevision = max(l.prunedRevision, c.revision)
+				if c.time.After(l.prunedTime) {
+					l.prunedTime = c.time
+				}
+			}
+		}
+	}
+	if !h.closed {
+		close(l.changed)
+		l.changed = make(chan struct{})
+	}
+}
+
+// revision returns the current revision.
+func (h *eventHub) revision() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.log.revision
+}
+
+// sincePoint is a revision or, when time is set, a point in time.
+type sincePoint struct {
+	revision uint64
+	time     time.Time
+}
+
+// parseSince parses a revision number or an RFC 3339 time.
+func parseSince(s string) (sincePoint, error) {
+	if rev, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return sincePoint{revision: rev}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return sincePoint{}, fmt.Errorf("since must be a revision or an RFC 3339 time")
+	}
+	return sincePoint{time: t}, nil
+}
+
+// changesSince returns the current revision and the pods changed after
+// since, mapped to whether they were deleted. It reports false when some of
+// those changes were forgotten, or since is a revision of an earlier run,
+// and the client must resync. The returned channel is closed on the next
+// change.
+func (h *eventHub) changesSince(since sincePoint) (uint64, map[string]bool, bool, <-chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	l := &h.log
+	var complete bool
+	if since.time.IsZero() {
+		complete = since.revision >= l.prunedRevision && since.revision <= l.revision
+	} else {
+		complete = !since.time.Before(l.prunedTime)
+	}
+
+	changed := make(map[string]bool)
+	for key, c := range l.changes {
+		if since.time.IsZero() && c.revision > since.revision || !since.time.IsZero() && c.time.After(since.time) {
+			changed[key] = c.deleted
+		}
+	}
+	return l.revision, changed, complete, l.changed
+}
+
+// PodDelta is the /api/pods?since= response.
+type PodDelta struct {
+	// Revision is passed as since to the next request.
+	Revision uint64 `json:"revision"`
+	// Full is set when the changes asked for are no longer known. Pods then
+	// holds every pod and clients drop the ones they have.
+	Full    bool                      `json:"full"`
+	Pods    map[string]*PodStatusInfo `json:"pods"`
+	Deleted []string                  `json:"deleted"`
+}
+
+// handlePodDelta serves /api/pods?since=, the pods added or changed and the
+// keys of those deleted after a revision or time. With wait=<duration> the
+// request waits up to that long, at most a minute, for a change when there
+// is none yet.
+func (d *Dashboard) handlePodDelta(w http.ResponseWriter, r *http.Request) {
+	since, err := parseSince(r.URL.Query().Get("since"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var wait time.Duration
+	if s := r.URL.Query().Get("wait"); s != "" {
+		if wait, err = time.ParseDuration(s); err != nil || wait < 0 {
+			http.Error(w, "wait must be a duration such as 30s", http.StatusBadRequest)
+			return
+		}
+		wait = min(wait, maxPollWait)
+	}
+
+	revision, changed, complete, next := d.events.changesSince(since)
+	if complete && len(changed) == 0 && wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-next:
+			revision, changed, complete, _ = d.events.changesSince(since)
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	delta := PodDelta{Revision: revision, Full: !complete, Pods: make(map[string]*PodStatusInfo), Deleted: []string{}}
+	for _, pod := range d.sortedPods() {
+		if deleted, ok := changed[pod.Key()]; !complete || ok && !deleted {
+			delta.Pods[pod.Key()] = pod
+		}
+	}
+	if complete {
+		for key, deleted := range changed {
+			if deleted {
+				delta.Deleted = append(delta.Deleted, key)
+			}
+		}
+		sort.Strings(delta.Deleted)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(delta)
+}
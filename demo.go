@@ -0,0 +1,607 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/pascal71/k8s-probe-monitor/pkg/api"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const (
+	// demoPods is the number of simulated pods in demo mode.
+	demoPods = 6
+	// demoFlapPeriod is the schedule on which simulated readiness flaps.
+	demoFlapPeriod = 90 * time.Second
+	// demoNodes is the number of simulated nodes the pods are spread over.
+	demoNodes = 3
+	// demoKubeletDelay is how long the simulated kubelet takes to notice a
+	// probe change, so propagation and discrepancies show up too.
+	demoKubeletDelay = 3 * time.Second
+)
+
+// demoTarget is a simulated probe-demo pod. It serves the /api/info and
+// probe action contract; its startup finishes after a delay and its
+// readiness, and for some pods liveness, flap on a schedule unless forced by
+// a probe action.
+type demoTarget struct {
+	index        int
+	pod          *corev1.Pod
+	started      time.Time
+	startupDelay time.Duration
+	server       *httptest.Server
+
+	mu sync.Mutex
+	// failing holds the probes forced to fail by probe actions.
+	failing map[string]bool
+}
+
+func (t *demoTarget) status(now time.Time) ProbeStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Every pod flaps in its own slot of the period so they don't move in
+	// lockstep.
+	phase := (now.Sub(t.started) + time.Duration(t.index)*demoFlapPeriod/demoPods) % demoFlapPeriod
+	started := now.Sub(t.started) >= t.startupDelay
+	live := !t.failing[api.ProbeLiveness] && !(t.index%3 == 2 && phase < 10*time.Second)
+	ready := started && live && !t.failing[api.ProbeReadiness] && phase < demoFlapPeriod*2/3
+	return ProbeStatus{
+		Started: started && !t.failing[api.ProbeStartup],
+		Live:    live,
+		Ready:   ready,
+	}
+}
+
+// usage simulates the target's CPU and memory usage: CPU is high while it
+// starts, and the pods whose liveness flaps leak memory towards their limit
+// until they fail.
+func (t *demoTarget) usage(now time.Time) (cpuMillis, memoryBytes int64) {
+	phase := (now.Sub(t.started) + time.Duration(t.index)*demoFlapPeriod/demoPods) % demoFlapPeriod
+	cpuMillis = int64(20 + 5*(t.index%demoPods))
+	if now.Sub(t.started) < t.startupDelay {
+		cpuMillis = 150
+	}
+	memoryBytes = 48 << 20
+	if t.index%3 == 2 {
+		memoryBytes += int64(72<<20) * int64(phase) / int64(demoFlapPeriod)
+	}
+	return cpuMillis, memoryBytes
+}
+
+func (t *demoTarget) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		probe, action := r.PathValue("probe"), r.PathValue("action")
+		if !api.ValidProbe(probe) || !api.ValidAction(action) {
+			http.Error(w, "unknown probe or action", http.StatusNotFound)
+			return
+		}
+		t.mu.Lock()
+		t.failing[probe] = action == api.ActionFail
+		t.mu.Unlock()
+	}
+
+	info := PodInfo{
+		SchemaVersion: api.SchemaVersion,
+		PodName:       t.pod.Name,
+		PodIP:         t.pod.Status.PodIP,
+		NodeHostname:  t.pod.Spec.NodeName,
+		ContainerAge:  time.Since(t.started).Nanoseconds(),
+		StartTime:     t.started.Format(time.RFC3339),
+		StartupDelay:  int(t.startupDelay.Seconds()),
+		StartupReady:  t.started.Add(t.startupDelay).Format(time.RFC3339),
+		ProbeStatus:   t.status(time.Now()),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// demoCluster is the fake cluster of demo mode: a Deployment with simulated
+// pods in a fake clientset, each backed by an in-process target server. The
+// cluster keeps the pod count at the Deployment's replicas, so scaling it or
+// deleting pods works like in a real cluster.
+type demoCluster struct {
+	clientset  *fake.Clientset
+	deployment *appsv1.Deployment
+	replicaSet *appsv1.ReplicaSet
+	targetPath string
+
+	mu sync.Mutex
+	// targets are the live demo pods by name and routes maps their IPs to
+	// the addresses of their target servers.
+	targets map[string]*demoTarget
+	routes  map[string]string
+	// lastIndex numbers the pods created so far.
+	lastIndex int
+}
+
+func newDemoCluster(cfg Config) *demoCluster {
+	namespace := "default"
+	if len(cfg.Namespaces) > 0 {
+		namespace = cfg.Namespaces[0]
+	}
+	labels := map[string]string{"app": "probe-demo", appsv1.DefaultDeploymentUniqueLabelKey: "5d9c7b8f4"}
+	if selector, err := metav1.ParseToLabelSelector(cfg.Selector); err == nil {
+		for k, v := range selector.MatchLabels {
+			labels[k] = v
+		}
+	}
+
+	replicas := int32(demoPods)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "probe-demo", Namespace: namespace, UID: types.UID("demo-deployment"), Generation: 1,
+			Annotations: map[string]string{revisionAnnotation: "1"},
+		},
+		Spec:   appsv1.DeploymentSpec{Replicas: &replicas},
+		Status: appsv1.DeploymentStatus{ObservedGeneration: 1},
+	}
+	controller := true
+	replicaSet := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "probe-demo-" + labels[appsv1.DefaultDeploymentUniqueLabelKey], Namespace: namespace,
+			UID: types.UID("demo-replicaset"), Labels: labels,
+			Annotations: map[string]string{revisionAnnotation: "1"},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "apps/v1", Kind: "Deployment", Name: deployment.Name, UID: deployment.UID, Controller: &controller,
+			}},
+		},
+		Spec: appsv1.ReplicaSetSpec{Replicas: &replicas},
+	}
+
+	objects := []k8sruntime.Object{deployment, replicaSet}
+	for i := range demoNodes {
+		objects = append(objects, demoNode(i))
+	}
+	c := &demoCluster{
+		clientset:  fake.NewClientset(objects...),
+		deployment: deployment,
+		replicaSet: replicaSet,
+		targetPath: cfg.TargetPath,
+		targets:    make(map[string]*demoTarget),
+		routes:     make(map[string]string),
+	}
+	c.clientset.PrependReactor("get", "deployments", c.getScale)
+	c.clientset.PrependReactor("update", "deployments", c.updateScale)
+	c.clientset.PrependReactor("create", "pods", c.evict)
+	c.reconcile(context.Background())
+	return c
+}
+
+// getScale and updateScale serve the Deployment's scale subresource, which
+// the fake clientset doesn't implement.
+func (c *demoCluster) getScale(action k8stesting.Action) (bool, k8sruntime.Object, error) {
+	if action.GetSubresource() != "scale" {
+		return false, nil, nil
+	}
+	dep, err := c.getDeployment(action.GetNamespace(), action.(k8stesting.GetAction).GetName())
+	if err != nil {
+		return true, nil, err
+	}
+	return true, &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: dep.Name, Namespace: dep.Namespace, ResourceVersion: dep.ResourceVersion},
+		Spec:       autoscalingv1.ScaleSpec{Replicas: *dep.Spec.Replicas},
+		Status:     autoscalingv1.ScaleStatus{Replicas: dep.Status.Replicas},
+	}, nil
+}
+
+func (c *demoCluster) updateScale(action k8stesting.Action) (bool, k8sruntime.Object, error) {
+	if action.GetSubresource() != "scale" {
+		return false, nil, nil
+	}
+	scale := action.(k8stesting.UpdateAction).GetObject().(*autoscalingv1.Scale)
+	dep, err := c.getDeployment(scale.Namespace, scale.Name)
+	if err != nil {
+		return true, nil, err
+	}
+	replicas := scale.Spec.Replicas
+	dep.Spec.Replicas = &replicas
+	dep.Generation++
+	if err := c.clientset.Tracker().Update(appsv1.SchemeGroupVersion.WithResource("deployments"), dep, dep.Namespace); err != nil {
+		return true, nil, err
+	}
+	return true, scale, nil
+}
+
+// evict serves the Eviction API, which the fake clientset doesn't
+// implement, under a simulated disruption budget of maxUnavailable 1 like
+// the one shipped with cmd/probe-demo: a ready pod can only be evicted while
+// every other pod is ready.
+func (c *demoCluster) evict(action k8stesting.Action) (bool, k8sruntime.Object, error) {
+	if action.GetSubresource() != "eviction" {
+		return false, nil, nil
+	}
+	eviction := action.(k8stesting.CreateAction).GetObject().(*policyv1.Eviction)
+	podsResource := corev1.SchemeGroupVersion.WithResource("pods")
+	obj, err := c.clientset.Tracker().Get(podsResource, eviction.Namespace, eviction.Name)
+	if err != nil {
+		return true, nil, err
+	}
+	dep, err := c.getDeployment(c.deployment.Namespace, c.deployment.Name)
+	if err != nil {
+		return true, nil, err
+	}
+	list, err := c.clientset.Tracker().List(podsResource, corev1.SchemeGroupVersion.WithKind("Pod"), eviction.Namespace)
+	if err != nil {
+		return true, nil, err
+	}
+	healthy := 0
+	for _, p := range list.(*corev1.PodList).Items {
+		if podReady(&p) {
+			healthy++
+		}
+	}
+	desiredHealthy := int(*dep.Spec.Replicas) - 1
+	if podReady(obj.(*corev1.Pod)) && healthy <= desiredHealthy {
+		err := apierrors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 0)
+		err.ErrStatus.Details.Causes = []metav1.StatusCause{{
+			Type:    policyv1.DisruptionBudgetCause,
+			Message: fmt.Sprintf("The disruption budget probe-demo needs %d healthy pods and has %d currently", desiredHealthy, healthy),
+		}}
+		return true, nil, err
+	}
+	return true, nil, c.clientset.Tracker().Delete(podsResource, eviction.Namespace, eviction.Name)
+}
+
+func (c *demoCluster) getDeployment(namespace, name string) (*appsv1.Deployment, error) {
+	obj, err := c.clientset.Tracker().Get(appsv1.SchemeGroupVersion.WithResource("deployments"), namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*appsv1.Deployment), nil
+}
+
+// reconcile plays the ReplicaSet controller: it forgets targets whose pods
+// were deleted, creates or deletes pods to match the Deployment's replicas
+// and updates the Deployment and ReplicaSet status.
+func (c *demoCluster) reconcile(ctx context.Context) error {
+	dep, err := c.getDeployment(c.deployment.Namespace, c.deployment.Name)
+	if err != nil {
+		return err
+	}
+	pods := c.clientset.CoreV1().Pods(c.deployment.Namespace)
+	list, err := pods.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	live := make(map[string]*corev1.Pod, len(list.Items))
+	for i := range list.Items {
+		live[list.Items[i].Name] = &list.Items[i]
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, t := range c.targets {
+		if live[name] == nil {
+			c.removeTarget(t)
+		}
+	}
+	desired := int(*dep.Spec.Replicas)
+	for len(c.targets) < desired {
+		pod := c.addTarget()
+		if _, err := pods.Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+			c.removeTarget(c.targets[pod.Name])
+			return err
+		}
+	}
+	// Scale down like the ReplicaSet controller: newest pods first.
+	for len(c.targets) > desired {
+		var newest *demoTarget
+		for _, t := range c.targets {
+			if newest == nil || t.index > newest.index {
+				newest = t
+			}
+		}
+		if err := pods.Delete(ctx, newest.pod.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		c.removeTarget(newest)
+	}
+
+	var ready int32
+	for _, t := range c.targets {
+		if p := live[t.pod.Name]; p != nil && podReady(p) {
+			ready++
+		}
+	}
+	replicas := int32(len(c.targets))
+	if dep.Status.Replicas == replicas && dep.Status.ReadyReplicas == ready && dep.Status.ObservedGeneration == dep.Generation {
+		return nil
+	}
+	dep.Status = appsv1.DeploymentStatus{
+		ObservedGeneration: dep.Generation, Replicas: replicas, UpdatedReplicas: replicas,
+		ReadyReplicas: ready, AvailableReplicas: ready,
+	}
+	if _, err := c.clientset.AppsV1().Deployments(dep.Namespace).UpdateStatus(ctx, dep, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+	rs := c.replicaSet.DeepCopy()
+	rs.Spec.Replicas = &replicas
+	rs.Status = appsv1.ReplicaSetStatus{Replicas: replicas, ReadyReplicas: ready, AvailableReplicas: ready}
+	_, err = c.clientset.AppsV1().ReplicaSets(rs.Namespace).Update(ctx, rs, metav1.UpdateOptions{})
+	return err
+}
+
+// podReady reports whether a pod's Ready condition is true.
+func podReady(pod *corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func demoNodeName(i int) string {
+	return fmt.Sprintf("demo-node-%d", i)
+}
+
+// demoNode is a simulated node, each in its own zone.
+func demoNode(i int) *corev1.Node {
+	booted := metav1.NewTime(time.Now().Add(-24 * time.Hour))
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: demoNodeName(i),
+			Labels: map[string]string{
+				corev1.LabelTopologyRegion: "demo-region",
+				corev1.LabelTopologyZone:   fmt.Sprintf("demo-zone-%c", 'a'+i),
+			},
+		},
+		Status: corev1.NodeStatus{
+			NodeInfo: corev1.NodeSystemInfo{KubeletVersion: "v1.33.0"},
+			Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: corev1.ConditionTrue, Reason: "KubeletReady", LastTransitionTime: booted},
+				{Type: corev1.NodeMemoryPressure, Status: corev1.ConditionFalse, Reason: "KubeletHasSufficientMemory", LastTransitionTime: booted},
+				{Type: corev1.NodeDiskPressure, Status: corev1.ConditionFalse, Reason: "KubeletHasNoDiskPressure", LastTransitionTime: booted},
+				{Type: corev1.NodePIDPressure, Status: corev1.ConditionFalse, Reason: "KubeletHasSufficientPID", LastTransitionTime: booted},
+			},
+		},
+	}
+}
+
+// scheduleNode plays the scheduler: the i-th pod goes to the next node in
+// turn that isn't cordoned, or to that node when all are.
+func (c *demoCluster) scheduleNode(i int) string {
+	for j := range demoNodes {
+		name := demoNodeName((i + j) % demoNodes)
+		obj, err := c.clientset.Tracker().Get(corev1.SchemeGroupVersion.WithResource("nodes"), "", name)
+		if err == nil && !obj.(*corev1.Node).Spec.Unschedulable {
+			return name
+		}
+	}
+	return demoNodeName(i % demoNodes)
+}
+
+// podMetrics serves the simulated usage of every demo pod, as metrics-server
+// would or, with filesystem usage, the kubelets.
+func (c *demoCluster) podMetrics(kubelet bool) podMetricsLister {
+	return func(ctx context.Context, key string) ([]podMetrics, error) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		now := time.Now()
+		var items []podMetrics
+		for _, t := range c.targets {
+			cpu, memory := t.usage(now)
+			usage := corev1.ResourceList{
+				corev1.ResourceCPU:    *resource.NewMilliQuantity(cpu, resource.DecimalSI),
+				corev1.ResourceMemory: *resource.NewQuantity(memory, resource.BinarySI),
+			}
+			m := podMetrics{
+				Metadata:   metav1.ObjectMeta{Name: t.pod.Name, Namespace: t.pod.Namespace},
+				Timestamp:  metav1.NewTime(now),
+				Containers: []containerMetrics{{Name: t.pod.Spec.Containers[0].Name, Usage: usage}},
+			}
+			if kubelet {
+				usage[corev1.ResourceEphemeralStorage] = *resource.NewQuantity(int64(12<<20+t.index<<20), resource.BinarySI)
+			} else {
+				m.Window = metav1.Duration{Duration: 15 * time.Second}
+			}
+			items = append(items, m)
+		}
+		return items, nil
+	}
+}
+
+// addTarget starts the target server of a new demo pod and returns the pod
+// to create. It is called with mu held.
+func (c *demoCluster) addTarget() *corev1.Pod {
+	i := c.lastIndex
+	c.lastIndex++
+	controller := true
+	rs := c.replicaSet
+	pod := syntheticPod(i)
+	// A random-looking five letter suffix; multiplying by a number coprime
+	// to 26 keeps it unique.
+	suffix := make([]byte, 5)
+	for j, n := 0, (i*7919+190125)%11881376; j < len(suffix); j, n = j+1, n/26 {
+		suffix[j] = byte('a' + n%26)
+	}
+	pod.Name = rs.Name + "-" + string(suffix)
+	pod.Namespace = rs.Namespace
+	pod.UID = types.UID(fmt.Sprintf("demo-pod-%d", i))
+	pod.Labels = rs.Labels
+	pod.Spec.NodeName = c.scheduleNode(i)
+	pod.OwnerReferences = []metav1.OwnerReference{{
+		APIVersion: "apps/v1", Kind: "ReplicaSet", Name: rs.Name, UID: rs.UID, Controller: &controller,
+	}}
+	// The pods start when they are created, and the startup probe allows
+	// for the slowest startup delay like a real probe-demo deployment.
+	started := metav1.Now()
+	pod.CreationTimestamp = started
+	pod.Status.StartTime = &started
+	pod.Status.ContainerStatuses[0].State.Running.StartedAt = started
+	pod.Spec.Containers[0].StartupProbe.FailureThreshold = 30
+	pod.Spec.Containers[0].Resources = corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("50m"), corev1.ResourceMemory: resource.MustParse("64Mi")},
+		Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("200m"), corev1.ResourceMemory: resource.MustParse("128Mi")},
+	}
+	pod.Status.Conditions = []corev1.PodCondition{
+		{Type: corev1.PodScheduled, Status: corev1.ConditionTrue, LastTransitionTime: started},
+		{Type: corev1.PodReady, Status: corev1.ConditionFalse, LastTransitionTime: started},
+	}
+	pod.Status.QOSClass = corev1.PodQOSBurstable
+	// An init container that completed and a native sidecar that runs next
+	// to the app, for the per-container view.
+	always, sidecarReady := corev1.ContainerRestartPolicyAlways, true
+	pod.Spec.InitContainers = []corev1.Container{{Name: "wait-for-config"}, {Name: "log-shipper", RestartPolicy: &always}}
+	pod.Status.InitContainerStatuses = []corev1.ContainerStatus{
+		{Name: "wait-for-config", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+			Reason: "Completed", StartedAt: started, FinishedAt: started,
+		}}},
+		{Name: "log-shipper", Started: &sidecarReady, Ready: true, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: started}}},
+	}
+
+	target := &demoTarget{
+		index:        i,
+		pod:          pod,
+		started:      started.Time,
+		startupDelay: time.Duration(20+10*(i%demoPods)) * time.Second,
+		failing:      make(map[string]bool),
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET "+c.targetPath, target)
+	mux.Handle("POST "+api.ProbeActionPath("{probe}", "{action}"), target)
+	target.server = httptest.NewServer(mux)
+
+	c.targets[pod.Name] = target
+	c.routes[pod.Status.PodIP] = target.server.Listener.Addr().String()
+	return pod
+}
+
+// removeTarget stops the target server of a demo pod. It is called with mu
+// held.
+func (c *demoCluster) removeTarget(t *demoTarget) {
+	t.server.Close()
+	delete(c.targets, t.pod.Name)
+	delete(c.routes, t.pod.Status.PodIP)
+}
+
+// client returns an HTTP client that sends requests for pod IPs to their
+// target servers.
+func (c *demoCluster) client() *http.Client {
+	return &http.Client{Transport: routedTransport(func(host string) (string, bool) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		target, ok := c.routes[host]
+		return target, ok
+	})}
+}
+
+// routedTransport dials the address that route returns for a request's host
+// instead of the host itself.
+func routedTransport(route func(host string) (string, bool)) *http.Transport {
+	return &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			target, ok := route(host)
+			if !ok {
+				return nil, fmt.Errorf("no fake target for %s", host)
+			}
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, target)
+		},
+	}
+}
+
+// simulateKubelet plays the kubelet and ReplicaSet controller for the demo
+// pods until ctx is done: it reconciles the pods with the Deployment and
+// mirrors the targets' probe states into the pods' container statuses and
+// Ready condition, a little behind the targets.
+func (c *demoCluster) simulateKubelet(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := c.reconcile(ctx); err != nil {
+			slog.Warn("Failed to reconcile demo pods", "error", err)
+		}
+		c.mu.Lock()
+		targets := make([]*demoTarget, 0, len(c.targets))
+		for _, t := range c.targets {
+			targets = append(targets, t)
+		}
+		c.mu.Unlock()
+		for _, t := range targets {
+			if err := c.syncPod(ctx, t, t.status(time.Now().Add(-demoKubeletDelay))); err != nil && !apierrors.IsNotFound(err) {
+				slog.Warn("Failed to update demo pod", "pod", t.pod.Name, "error", err)
+			}
+		}
+	}
+}
+
+func (c *demoCluster) syncPod(ctx context.Context, t *demoTarget, probes ProbeStatus) error {
+	pods := c.clientset.CoreV1().Pods(t.pod.Namespace)
+	pod, err := pods.Get(ctx, t.pod.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	cs := &pod.Status.ContainerStatuses[0]
+	if cs.Started != nil && *cs.Started == probes.Started && cs.Ready == probes.Ready {
+		return nil
+	}
+
+	started := probes.Started
+	cs.Started = &started
+	cs.Ready = probes.Ready
+	status := corev1.ConditionFalse
+	if probes.Ready {
+		status = corev1.ConditionTrue
+	}
+	for i := range pod.Status.Conditions {
+		if cond := &pod.Status.Conditions[i]; cond.Type == corev1.PodReady && cond.Status != status {
+			cond.Status = status
+			cond.LastTransitionTime = metav1.Now()
+		}
+	}
+	_, err = pods.UpdateStatus(ctx, pod, metav1.UpdateOptions{})
+	return err
+}
+
+// dashboard creates the dashboard of the demo cluster. Pods are always
+// reached directly, through the routed client.
+func (c *demoCluster) dashboard(cfg Config) (*Dashboard, error) {
+	cfg.AccessMode = AccessDirect
+	cfg.Contexts = nil
+	d, err := newDashboard(c.clientset, c.client(), cfg, newDashboardMetrics())
+	if err != nil {
+		return nil, err
+	}
+	d.usage = newUsageCache(map[string]podMetricsLister{
+		UsageMetricsServer: c.podMetrics(false),
+		UsageKubelet:       c.podMetrics(true),
+	})
+	return d, nil
+}
+
+// close stops the target servers.
+func (c *demoCluster) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, t := range c.targets {
+		c.removeTarget(t)
+	}
+}
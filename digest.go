@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// digestTopN is the number of pods listed per ranking in a digest.
+const digestTopN = 5
+
+// maxDigestGap caps the time credited between two observations of a pod so
+// that dashboard downtime does not count towards uptime.
+const maxDigestGap = 30 * time.Second
+
+// DigestEntry ranks a single pod, by namespace/name, in a digest.
+type DigestEntry struct {
+	Pod   string `json:"pod"`
+	Count int    `json:"count"`
+}
+
+// DigestReport summarizes pod health over one digest period.
+type DigestReport struct {
+	From            time.Time     `json:"from"`
+	To              time.Time     `json:"to"`
+	Pods            int           `json:"pods"`
+	Incidents       int           `json:"incidents"`
+	IncidentLeaders []DigestEntry `json:"incidentLeaders"`
+	FlapLeaders     []DigestEntry `json:"flapLeaders"`
+	Restarts        int           `json:"restarts"`
+	RestartLeaders  []DigestEntry `json:"restartLeaders"`
+	Uptime          float64       `json:"uptime"`
+	PreviousUptime  float64       `json:"previousUptime"`
+}
+
+// digestPod accumulates one pod's activity during the current period.
+type digestPod struct {
+	lastSeen     time.Time
+	ready        bool
+	reachable    bool
+	restartCount int32
+
+	transitions int
+	incidents   int
+	restarts    int
+	readyTime   time.Duration
+	observed    time.Duration
+}
+
+// digestCollector gathers the data behind periodic digests. It is fed once per
+// pod per monitor cycle and reset whenever a digest is sent.
+type digestCollector struct {
+	mu             sync.Mutex
+	periodStart    time.Time
+	pods           map[string]*digestPod
+	previousUptime float64
+}
+
+func newDigestCollector(now time.Time) *digestCollector {
+	return &digestCollector{
+		periodStart:    now,
+		pods:           make(map[string]*digestPod),
+		previousUptime: -1,
+	}
+}
+
+// observe records the state of the pod with key at time now.
+func (c *digestCollector) observe(key string, ready, reachable bool, restartCount int32, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.pods[key]
+	if !ok {
+		c.pods[key] = &digestPod{lastSeen: now, ready: ready, reachable: reachable, restartCount: restartCount}
+		return
+	}
+
+	gap := min(now.Sub(p.lastSeen), maxDigestGap)
+	p.observed += gap
+	if p.ready {
+		p.readyTime += gap
+	}
+
+	if p.ready != ready {
+		p.transitions++
+	}
+	if (p.ready && !ready) || (p.reachable && !reachable) {
+		p.incidents++
+	}
+	if restartCount > p.restartCount {
+		p.restarts += int(restartCount - p.restartCount)
+	}
+
+	p.lastSeen, p.ready, p.reachable, p.restartCount = now, ready, reachable, restartCount
+}
+
+// started returns when the current period began.
+func (c *digestCollector) started() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.periodStart
+}
+
+// rotate closes the current period, returning its report, and starts a new one.
+// Pods that were not observed during the period are forgotten.
+func (c *digestCollector) rotate(now time.Time) DigestReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	report := DigestReport{From: c.periodStart, To: now, Uptime: -1, PreviousUptime: c.previousUptime}
+	var incidents, flaps, restarts []DigestEntry
+	var readyTime, observed time.Duration
+
+	for key, p := range c.pods {
+		if p.lastSeen.Before(c.periodStart) {
+			delete(c.pods, key)
+			continue
+		}
+		report.Pods++
+		report.Incidents += p.incidents
+		report.Restarts += p.restarts
+		if p.incidents > 0 {
+			incidents = append(incidents, DigestEntry{key, p.incidents})
+		}
+		if p.transitions > 0 {
+			flaps = append(flaps, DigestEntry{key, p.transitions})
+		}
+		if p.restarts > 0 {
+			restarts = append(restarts, DigestEntry{key, p.restarts})
+		}
+		readyTime += p.readyTime
+		observed += p.observed
+
+		p.transitions, p.incidents, p.restarts = 0, 0, 0
+		p.readyTime, p.observed = 0, 0
+	}
+
+	report.IncidentLeaders = topDigestEntries(incidents)
+	report.FlapLeaders = topDigestEntries(flaps)
+	report.RestartLeaders = topDigestEntries(restarts)
+	if observed > 0 {
+		report.Uptime = 100 * readyTime.Seconds() / observed.Seconds()
+		c.previousUptime = report.Uptime
+	}
+	c.periodStart = now
+	return report
+}
+
+func topDigestEntries(entries []DigestEntry) []DigestEntry {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count == entries[j].Count {
+			return entries[i].Pod < entries[j].Pod
+		}
+		return entries[i].Count > entries[j].Count
+	})
+	if len(entries) > digestTopN {
+		entries = entries[:digestTopN]
+	}
+	return entries
+}
+
+// notification renders the report as a compact, chat-friendly summary.
+func (r DigestReport) notification() Notification {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d pods monitored from %s to %s\n", r.Pods, r.From.Format(time.RFC1123), r.To.Format(time.RFC1123))
+
+	switch {
+	case r.Uptime < 0:
+		b.WriteString("Readiness uptime: no data\n")
+	case r.PreviousUptime < 0:
+		fmt.Fprintf(&b, "Readiness uptime: %.2f%%\n", r.Uptime)
+	default:
+		fmt.Fprintf(&b, "Readiness uptime: %.2f%% (%+.2f points vs previous period)\n", r.Uptime, r.Uptime-r.PreviousUptime)
+	}
+	fmt.Fprintf(&b, "Incidents: %d, container restarts: %d\n", r.Incidents, r.Restarts)
+
+	writeLeaders := func(title string, entries []DigestEntry) {
+		if len(entries) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "%s:\n", title)
+		for _, e := range entries {
+			fmt.Fprintf(&b, "  • %s (%d)\n", e.Pod, e.Count)
+		}
+	}
+	writeLeaders("Most incidents", r.IncidentLeaders)
+	writeLeaders("Flap leaders (readiness transitions)", r.FlapLeaders)
+	writeLeaders("Most restarts", r.RestartLeaders)
+
+	return Notification{
+		Kind:  "digest",
+		Title: "Pod Monitor digest",
+		Text:  b.String(),
+		Fields: map[string]string{
+			"pods":      fmt.Sprint(r.Pods),
+			"incidents": fmt.Sprint(r.Incidents),
+			"restarts":  fmt.Sprint(r.Restarts),
+			"uptime":    fmt.Sprintf("%.2f", r.Uptime),
+		},
+		Time: r.To,
+	}
+}
+
+// parseDigestInterval accepts "daily", "weekly" or a Go duration.
+func parseDigestInterval(s string) (time.Duration, error) {
+	switch s {
+	case "daily":
+		return 24 * time.Hour, nil
+	case "weekly":
+		return 7 * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("expected daily, weekly or a duration: %v", err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("interval must be positive")
+	}
+	return d, nil
+}
+
+// runDigests sends a digest through the configured notifiers every digest
+// interval until ctx is cancelled. The interval and notifiers are re-read on
+// every configuration reload, which doesn't postpone the next digest: it is
+// due one interval after the current period began. Digests are independent
+// of any real-time alerting.
+func (d *Dashboard) runDigests(ctx context.Context) {
+	announced := ""
+	for {
+		cfg := d.cfg()
+		var timer *time.Timer
+		var tick <-chan time.Time
+		if cfg.Digest != "" {
+			// The interval was checked when the config was validated.
+			interval, _ := parseDigestInterval(cfg.Digest)
+			if cfg.Digest != announced {
+				if len(d.notifiers()) == 0 {
+					slog.Warn("Digest enabled but no notifiers configured; digests will not be delivered")
+				}
+				slog.Info("Sending health digests", "interval", interval)
+			}
+			timer = time.NewTimer(time.Until(d.digest.started().Add(interval)))
+			tick = timer.C
+		}
+		announced = cfg.Digest
+
+		select {
+		case <-ctx.Done():
+		case <-d.configChanged():
+		case now := <-tick:
+			report := d.digest.rotate(now)
+			notifyAll(ctx, d.notifiers(), report.notification())
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// NodeActionResponse is the response of a node cordon or uncordon.
+type NodeActionResponse struct {
+	Node          string `json:"node"`
+	Action        string `json:"action"`
+	Unschedulable bool   `json:"unschedulable"`
+}
+
+// DrainRefusal is a pod a drain couldn't evict.
+type DrainRefusal struct {
+	Pod       string `json:"pod"`
+	Namespace string `json:"namespace"`
+	Reason    string `json:"reason"`
+}
+
+// DrainReport is the response of POST /api/nodes/{name}/drain.
+type DrainReport struct {
+	Node string `json:"node"`
+	// Evicted are the monitored pods evicted, Refused those the API server
+	// refused to evict, usually for their disruption budget, and Skipped
+	// the DaemonSet pods, which would come back on the same node.
+	Evicted []string       `json:"evicted"`
+	Refused []DrainRefusal `json:"refused"`
+	Skipped []string       `json:"skipped"`
+}
+
+// setUnschedulable cordons or uncordons a node.
+func (d *Dashboard) setUnschedulable(ctx context.Context, node string, unschedulable bool) error {
+	patch := fmt.Appendf(nil, `{"spec":{"unschedulable":%t}}`, unschedulable)
+	_, err := d.clientset.CoreV1().Nodes().Patch(ctx, node, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// nodeActionError answers a failed node change.
+func nodeActionError(w http.ResponseWriter, action string, err error) {
+	switch {
+	case apierrors.IsNotFound(err):
+		http.Error(w, "Node not found", http.StatusNotFound)
+	case apierrors.IsForbidden(err):
+		http.Error(w, fmt.Sprintf("Not allowed to %s the node: %v", action, err), http.StatusForbidden)
+	default:
+		http.Error(w, fmt.Sprintf("Failed to %s the node: %v", action, err), http.StatusBadGateway)
+	}
+}
+
+// handleNodeCordon serves POST /api/nodes/{name}/cordon, which marks a node
+// unschedulable. Pods already on the node keep running.
+func (d *Dashboard) handleNodeCordon(w http.ResponseWriter, r *http.Request) {
+	d.cordon(w, r, true)
+}
+
+// handleNodeUncordon serves POST /api/nodes/{name}/uncordon.
+func (d *Dashboard) handleNodeUncordon(w http.ResponseWriter, r *http.Request) {
+	d.cordon(w, r, false)
+}
+
+func (d *Dashboard) cordon(w http.ResponseWriter, r *http.Request, unschedulable bool) {
+	action := "uncordon"
+	if unschedulable {
+		action = "cordon"
+	}
+	node := r.PathValue("name")
+	ctx, cancel := context.WithTimeout(r.Context(), d.cfg().FetchTimeout)
+	defer cancel()
+	err := d.setUnschedulable(ctx, node, unschedulable)
+	d.audit(AuditEntry{actor: requestActor(r), Action: action, Node: node}, err)
+	if err != nil {
+		nodeActionError(w, action, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(NodeActionResponse{node, action, unschedulable})
+}
+
+// handleNodeDrain serves POST /api/nodes/{name}/drain. Like kubectl drain it
+// cordons the node, then evicts the monitored pods on it through the
+// Eviction API, leaving DaemonSet pods be. Evictions refused by a
+// disruption budget aren't retried; drain again once the replacements are
+// ready.
+func (d *Dashboard) handleNodeDrain(w http.ResponseWriter, r *http.Request) {
+	node := r.PathValue("name")
+	cfg := d.cfg()
+	ctx, cancel := context.WithTimeout(r.Context(), cfg.FetchTimeout)
+	err := d.setUnschedulable(ctx, node, true)
+	cancel()
+	d.audit(AuditEntry{actor: requestActor(r), Action: "cordon", Node: node, Detail: "drain"}, err)
+	if err != nil {
+		nodeActionError(w, "cordon", err)
+		return
+	}
+
+	var pods []*corev1.Pod
+	watch := d.currentWatch()
+	d.mu.RLock()
+	for _, p := range d.pods {
+		if p.Node != node {
+			continue
+		}
+		if pod, err := watch.get(p.Namespace, p.Name); err == nil {
+			pods = append(pods, pod)
+		}
+	}
+	d.mu.RUnlock()
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+
+	report := DrainReport{Node: node, Evicted: []string{}, Refused: []DrainRefusal{}, Skipped: []string{}}
+	for _, pod := range pods {
+		if ref := metav1.GetControllerOf(pod); ref != nil && ref.Kind == "DaemonSet" {
+			report.Skipped = append(report.Skipped, pod.Name)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), cfg.FetchTimeout)
+		err := d.evictPod(ctx, pod)
+		cancel()
+		d.audit(AuditEntry{actor: requestActor(r), Action: "evict", Namespace: pod.Namespace, Pod: pod.Name, Node: node, Detail: "drain"}, err)
+		switch {
+		case err == nil:
+			report.Evicted = append(report.Evicted, pod.Name)
+		case apierrors.IsNotFound(err) || apierrors.IsConflict(err):
+			// Gone or replaced meanwhile.
+		case apierrors.IsTooManyRequests(err):
+			report.Refused = append(report.Refused, DrainRefusal{pod.Name, pod.Namespace, evictionRefusal(err)})
+		default:
+			report.Refused = append(report.Refused, DrainRefusal{pod.Name, pod.Namespace, err.Error()})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// emailTimeout bounds delivering one email.
+const emailTimeout = 30 * time.Second
+
+// maxEmailItems caps the changes listed in one email.
+const maxEmailItems = 200
+
+// defaultEmailTemplate renders an EmailSummary.
+const defaultEmailTemplate = `<!DOCTYPE html>
+<html><body style="font-family: sans-serif; font-size: 14px;">
+<h2>Pod Monitor{{if .Cluster}} ({{.Cluster}}){{end}}</h2>
+<p>{{len .Items}} change{{if ne (len .Items) 1}}s{{end}} from {{.From.Format "15:04:05"}} to {{.To.Format "15:04:05 MST"}}{{if .Omitted}}, {{.Omitted}} more not shown{{end}}.</p>
+<table cellpadding="6" style="border-collapse: collapse;">
+<tr style="background: #eee; text-align: left;"><th>Time</th><th>What</th><th>Details</th></tr>
+{{range .Items}}<tr style="border-top: 1px solid #ddd;{{if .Resolved}} color: #2a7d2a;{{end}}">
+<td>{{.Time.Format "15:04:05"}}</td>
+<td><b>{{.Title}}</b>{{if gt .Count 1}}<br><small>changed {{.Count}} times, latest shown</small>{{end}}</td>
+<td style="white-space: pre-wrap;">{{.Text}}</td>
+</tr>
+{{end}}</table>
+{{if .Unreachable}}<h3>Unreachable pods</h3>
+<ul>{{range .Unreachable}}<li><b>{{.Name}}</b> in {{.Namespace}} on {{.Node}}: {{.Error}}</li>{{end}}</ul>
+{{end}}</body></html>
+`
+
+// EmailItem is a change listed in an email. Notifications with the same key
+// in one batch, such as a flapping probe, are merged into their latest.
+type EmailItem struct {
+	Kind     string
+	Title    string
+	Text     string
+	Time     time.Time
+	Resolved bool
+	// Count is the number of notifications merged into this item.
+	Count int
+}
+
+// EmailSummary is the data of the email template.
+type EmailSummary struct {
+	// Cluster is set when monitoring several clusters.
+	Cluster  string
+	From, To time.Time
+	Items    []EmailItem
+	// Omitted is the number of items left out beyond the cap.
+	Omitted int
+	// Unreachable are the pods that can't be reached when the email is sent.
+	Unreachable []*PodStatusInfo
+}
+
+// emailBatcher collects notifications and mails them together once the
+// batch window has passed since the first, so flapping pods don't cause a
+// mail storm. It is a Notifier of the dashboard when SMTP is configured.
+type emailBatcher struct {
+	d *Dashboard
+
+	mu      sync.Mutex
+	pending []Notification
+	timer   *time.Timer
+}
+
+func newEmailBatcher(d *Dashboard) *emailBatcher {
+	return &emailBatcher{d: d}
+}
+
+func (b *emailBatcher) Name() string { return "email" }
+
+// Notify adds n to the batch; it never fails.
+func (b *emailBatcher) Notify(ctx context.Context, n Notification) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = append(b.pending, n)
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.d.cfg().EmailBatchWindow, func() { b.flush(context.Background()) })
+	}
+	return nil
+}
+
+// flush mails the pending notifications, if any.
+func (b *emailBatcher) flush(ctx context.Context) {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.mu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	cfg := b.d.cfg()
+	if cfg.SMTPAddr == "" {
+		return
+	}
+	summary := b.summarize(pending)
+	subject := fmt.Sprintf("Pod Monitor: %d change%s", len(summary.Items)+summary.Omitted, plural(len(summary.Items)+summary.Omitted))
+	if n := len(summary.Unreachable); n > 0 {
+		subject += fmt.Sprintf(", %d pod%s unreachable", n, plural(n))
+	}
+	if summary.Cluster != "" {
+		subject = "[" + summary.Cluster + "] " + subject
+	}
+
+	tmpl, err := emailTemplate(cfg.EmailTemplate)
+	if err != nil {
+		slog.Error("Failed to load email template", "path", cfg.EmailTemplate, "error", err)
+		return
+	}
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, summary); err != nil {
+		slog.Error("Failed to render email", "error", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, emailTimeout)
+	defer cancel()
+	if err := sendMail(ctx, cfg, subject, body.Bytes()); err != nil {
+		slog.Error("Error sending notification", "notifier", b.Name(), "changes", len(pending), "error", err)
+	}
+}
+
+// summarize merges notifications with the same key, oldest first, and
+// lists the unreachable pods.
+func (b *emailBatcher) summarize(pending []Notification) EmailSummary {
+	summary := EmailSummary{Cluster: b.d.cluster, From: pending[0].Time, To: pending[0].Time}
+	byKey := make(map[string]int)
+	for _, n := range pending {
+		if n.Time.Before(summary.From) {
+			summary.From = n.Time
+		}
+		if n.Time.After(summary.To) {
+			summary.To = n.Time
+		}
+		item := EmailItem{Kind: n.Kind, Title: n.Title, Text: n.Text, Time: n.Time, Resolved: n.Resolved, Count: 1}
+		if i, ok := byKey[n.Key]; ok && n.Key != "" {
+			item.Count += summary.Items[i].Count
+			summary.Items[i] = item
+			continue
+		}
+		byKey[n.Key] = len(summary.Items)
+		summary.Items = append(summary.Items, item)
+	}
+	sort.SliceStable(summary.Items, func(i, j int) bool { return summary.Items[i].Time.Before(summary.Items[j].Time) })
+	if len(summary.Items) > maxEmailItems {
+		summary.Omitted = len(summary.Items) - maxEmailItems
+		summary.Items = summary.Items[len(summary.Items)-maxEmailItems:]
+	}
+
+	b.d.mu.RLock()
+	for _, pod := range b.d.pods {
+		if pod.Info == nil && pod.ErrorKind == ErrorKindConnection {
+			summary.Unreachable = append(summary.Unreachable, pod)
+		}
+	}
+	b.d.mu.RUnlock()
+	sort.Slice(summary.Unreachable, func(i, j int) bool { return summary.Unreachable[i].Name < summary.Unreachable[j].Name })
+	return summary
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+// emailTemplate parses the template file at path, or the built-in template
+// when path is empty.
+func emailTemplate(path string) (*template.Template, error) {
+	if path == "" {
+		return template.New("email").Parse(defaultEmailTemplate)
+	}
+	return template.ParseFiles(path)
+}
+
+// sendMail delivers an HTML email through the SMTP server. Port 465 uses
+// implicit TLS; on other ports STARTTLS is used when the server offers it.
+func sendMail(ctx context.Context, cfg Config, subject string, html []byte) error {
+	host, port, _ := net.SplitHostPort(cfg.SMTPAddr) // Validated with the config.
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", cfg.SMTPAddr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %v", cfg.SMTPAddr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if port == "465" {
+		conn = tls.Client(conn, &tls.Config{ServerName: host})
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP handshake failed: %v", err)
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok && port != "465" {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("STARTTLS failed: %v", err)
+		}
+	}
+	if cfg.SMTPUsername != "" {
+		if err := c.Auth(smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %v", err)
+		}
+	}
+	if err := c.Mail(cfg.SMTPFrom); err != nil {
+		return fmt.Errorf("SMTP server refused sender %s: %v", cfg.SMTPFrom, err)
+	}
+	for _, to := range cfg.SMTPTo {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("SMTP server refused recipient %s: %v", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %v", err)
+	}
+	fmt.Fprintf(w, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n", cfg.SMTPFrom, strings.Join(cfg.SMTPTo, ", "),
+		mime.QEncoding.Encode("utf-8", subject), time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(w, "MIME-Version: 1.0\r\nContent-Type: text/html; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(w)
+	qp.Write(html)
+	qp.Close()
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP server refused the message: %v", err)
+	}
+	return c.Quit()
+}
+
+// validateEmail checks the email settings.
+func (c Config) validateEmail() error {
+	if c.SMTPAddr == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(c.SMTPAddr); err != nil {
+		return fmt.Errorf("invalid SMTP address %q: must be host:port", c.SMTPAddr)
+	}
+	if c.SMTPFrom == "" || len(c.SMTPTo) == 0 {
+		return fmt.Errorf("email notifications need a sender and recipients")
+	}
+	if c.EmailBatchWindow <= 0 {
+		return fmt.Errorf("email batch window must be positive, got %v", c.EmailBatchWindow)
+	}
+	if _, err := emailTemplate(c.EmailTemplate); err != nil {
+		return fmt.Errorf("invalid email template: %v", err)
+	}
+	return nil
+}
+
+// notifiers returns the configured notifiers, including email when SMTP is
+// configured.
+func (d *Dashboard) notifiers() []Notifier {
+	cfg := d.cfg()
+	notifiers := cfg.notifiers()
+	if cfg.SMTPAddr != "" {
+		notifiers = append(notifiers, d.email)
+	}
+	return notifiers
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+// EndpointMembership is whether a pod is among the ready endpoints of a
+// Service, according to its EndpointSlices.
+type EndpointMembership struct {
+	Service     string `json:"service"`
+	Ready       bool   `json:"ready"`
+	Serving     bool   `json:"serving"`
+	Terminating bool   `json:"terminating"`
+	// Since is when Ready last changed, as observed by the dashboard.
+	Since time.Time `json:"since"`
+}
+
+// sliceEndpoint is one pod's endpoint in an EndpointSlice.
+type sliceEndpoint struct {
+	ready, serving, terminating bool
+}
+
+type endpointSlice struct {
+	service string
+	// pods is keyed by podKey.
+	pods map[string]sliceEndpoint
+}
+
+// endpointTracker follows the EndpointSlices of one pod watch. Endpoints are
+// matched to pods by their target reference, which the EndpointSlice
+// controller sets for every Service with a selector.
+type endpointTracker struct {
+	mu     sync.Mutex
+	slices map[string]endpointSlice
+	// pods holds the memberships of each pod by Service.
+	pods map[string]map[string]EndpointMembership
+}
+
+func newEndpointTracker() *endpointTracker {
+	return &endpointTracker{
+		slices: make(map[string]endpointSlice),
+		pods:   make(map[string]map[string]EndpointMembership),
+	}
+}
+
+func newEndpointSlice(s *discoveryv1.EndpointSlice) endpointSlice {
+	out := endpointSlice{
+		service: s.Labels[discoveryv1.LabelServiceName],
+		pods:    make(map[string]sliceEndpoint),
+	}
+	for _, ep := range s.Endpoints {
+		if ep.TargetRef == nil || ep.TargetRef.Kind != "Pod" {
+			continue
+		}
+		// Unset conditions are to be read as true, except terminating.
+		isTrue := func(b *bool) bool { return b == nil || *b }
+		namespace := ep.TargetRef.Namespace
+		if namespace == "" {
+			namespace = s.Namespace
+		}
+		out.pods[podKey(namespace, ep.TargetRef.Name)] = sliceEndpoint{
+			ready:       isTrue(ep.Conditions.Ready),
+			serving:     isTrue(ep.Conditions.Serving),
+			terminating: ep.Conditions.Terminating != nil && *ep.Conditions.Terminating,
+		}
+	}
+	return out
+}
+
+// update replaces the slice stored under key, or removes it when s is nil,
+// and returns the pods whose memberships changed.
+func (t *endpointTracker) update(key string, s *discoveryv1.EndpointSlice, now time.Time) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	affected := make(map[string]bool)
+	for pod := range t.slices[key].pods {
+		affected[pod] = true
+	}
+	if s == nil {
+		delete(t.slices, key)
+	} else {
+		slice := newEndpointSlice(s)
+		t.slices[key] = slice
+		for pod := range slice.pods {
+			affected[pod] = true
+		}
+	}
+
+	var changed []string
+	for pod := range affected {
+		if t.recompute(pod, now) {
+			changed = append(changed, pod)
+		}
+	}
+	return changed
+}
+
+// recompute merges the pod's endpoints across all slices of each Service. A
+// Service may spread its endpoints over several slices, and during updates
+// a pod can briefly appear in more than one of them.
+func (t *endpointTracker) recompute(pod string, now time.Time) bool {
+	merged := make(map[string]EndpointMembership)
+	for _, slice := range t.slices {
+		ep, ok := slice.pods[pod]
+		if !ok {
+			continue
+		}
+		m := merged[slice.service]
+		m.Service = slice.service
+		m.Ready = m.Ready || ep.ready
+		m.Serving = m.Serving || ep.serving
+		m.Terminating = m.Terminating || ep.terminating
+		merged[slice.service] = m
+	}
+
+	prev := t.pods[pod]
+	changed := len(prev) != len(merged)
+	for svc, m := range merged {
+		old, ok := prev[svc]
+		switch {
+		case !ok || old.Ready != m.Ready:
+			m.Since = now
+			changed = true
+		default:
+			m.Since = old.Since
+			changed = changed || old != m
+		}
+		merged[svc] = m
+	}
+	if len(merged) == 0 {
+		delete(t.pods, pod)
+	} else {
+		t.pods[pod] = merged
+	}
+	return changed
+}
+
+// get returns a pod's memberships.
+func (t *endpointTracker) get(pod string) []EndpointMembership {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var out []EndpointMembership
+	for _, m := range t.pods[pod] {
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Service < out[j].Service
+	})
+	return out
+}
+
+// onEndpointSlice applies an EndpointSlice change of the watch w and pushes
+// the new memberships of the affected pods right away, so the readiness to
+// endpoints propagation can be watched live.
+func (d *Dashboard) onEndpointSlice(w *podWatch, key string, s *discoveryv1.EndpointSlice) {
+	changed := w.endpoints.update(key, s, time.Now())
+	if len(changed) == 0 || w.ctx.Err() != nil {
+		return
+	}
+
+	var updates []*PodStatusInfo
+	d.mu.Lock()
+	if d.watch == w {
+		for _, key := range changed {
+			status, ok := d.pods[key]
+			if !ok {
+				continue
+			}
+			// Published statuses are shared with subscribers, so they are
+			// replaced rather than modified.
+			updated := *status
+			updated.Endpoints = w.endpoints.get(key)
+			d.pods[key] = &updated
+			updates = append(updates, &updated)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, status := range updates {
+		if ready, tracked := endpointsReady(status.Endpoints); tracked {
+			d.propagation.observe(podKey(status.Namespace, status.Name), StageEndpoints, ready, time.Now())
+		}
+		d.publish(PodEvent{Type: PodEventUpdate, Namespace: status.Namespace, Name: status.Name, Pod: status})
+	}
+}
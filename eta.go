@@ -0,0 +1,165 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// maxStartupSamples bounds the startup-time history kept per workload.
+const maxStartupSamples = 50
+
+// ReadyETA predicts when a starting pod will become ready.
+type ReadyETA struct {
+	ExpectedReady    time.Time `json:"expectedReady"`
+	RemainingSeconds float64   `json:"remainingSeconds"`
+	Source           string    `json:"source"`
+	Samples          int       `json:"samples"`
+}
+
+// workloadKey names the workload a pod belongs to, so that startup samples of
+// successive ReplicaSets of one Deployment are pooled together.
+func workloadKey(pod *corev1.Pod) string {
+	for _, ref := range pod.OwnerReferences {
+		if ref.Controller == nil || !*ref.Controller {
+			continue
+		}
+		name := ref.Name
+		if hash := pod.Labels["pod-template-hash"]; ref.Kind == "ReplicaSet" && hash != "" {
+			name = strings.TrimSuffix(name, "-"+hash)
+		}
+		return pod.Namespace + "/" + name
+	}
+	// Without owner references fall back to the name minus the ReplicaSet
+	// hash and pod suffix.
+	parts := strings.Split(pod.Name, "-")
+	if len(parts) > 2 {
+		parts = parts[:len(parts)-2]
+	}
+	return pod.Namespace + "/" + strings.Join(parts, "-")
+}
+
+// recordStartup stores how long a container took from start to ready. It is
+// called once per container start, the first time the pod is seen ready.
+func (d *Dashboard) recordStartup(pod *corev1.Pod, took time.Duration) {
+	key := workloadKey(pod)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	samples := append(d.startupSamples[key], took)
+	if len(samples) > maxStartupSamples {
+		samples = samples[len(samples)-maxStartupSamples:]
+	}
+	d.startupSamples[key] = samples
+}
+
+// trackStartup records a startup sample the first time a container that was
+// seen starting reports ready, and otherwise returns a ready ETA for the
+// still-starting pod.
+func (d *Dashboard) trackStartup(pod *corev1.Pod, info *PodInfo, effective *EffectiveStatus, now time.Time) *ReadyETA {
+	container, containerStart := monitoredContainer(pod)
+	if containerStart.IsZero() {
+		containerStart = pod.CreationTimestamp.Time
+	}
+
+	ready := effective != nil && effective.Ready
+	if effective == nil && info != nil {
+		ready = info.ProbeStatus.Ready
+	}
+
+	// Only the first transition to ready after a container start counts as
+	// startup; later readiness failures are not a startup phase.
+	d.mu.Lock()
+	cp := d.probeStates[podKey(pod.Namespace, pod.Name)]
+	if ready {
+		sample := cp != nil && cp.sawStarting && !cp.seenReady
+		if cp != nil {
+			cp.seenReady = true
+		}
+		d.mu.Unlock()
+		if sample {
+			d.recordStartup(pod, now.Sub(containerStart))
+		}
+		return nil
+	}
+	if cp != nil {
+		if cp.seenReady {
+			d.mu.Unlock()
+			return nil
+		}
+		cp.sawStarting = true
+	}
+	d.mu.Unlock()
+
+	if pod.DeletionTimestamp != nil || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return nil
+	}
+
+	eta := &ReadyETA{}
+	expected := time.Time{}
+	if container != nil {
+		startupDelay := time.Duration(0)
+		if info != nil {
+			startupDelay = time.Duration(info.StartupDelay) * time.Second
+		}
+		expected = specReadyTime(container, containerStart, startupDelay)
+		eta.Source = "spec"
+	}
+
+	d.mu.RLock()
+	samples := append([]time.Duration(nil), d.startupSamples[workloadKey(pod)]...)
+	d.mu.RUnlock()
+
+	if len(samples) > 0 {
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+		historical := containerStart.Add(samples[len(samples)/2])
+		eta.Samples = len(samples)
+		switch {
+		case expected.IsZero():
+			expected, eta.Source = historical, "history"
+		case historical.After(expected):
+			expected, eta.Source = historical, "spec+history"
+		}
+	}
+	if expected.IsZero() {
+		return nil
+	}
+
+	// An overdue pod is clamped to now rather than shown a negative countdown.
+	if expected.Before(now) {
+		expected = now
+	}
+	eta.ExpectedReady = expected
+	eta.RemainingSeconds = expected.Sub(now).Seconds()
+	return eta
+}
+
+// specReadyTime aligns the application's startup delay to the probe schedule:
+// the first startup probe tick after the app is up marks Started, and the
+// readiness probe needs successThreshold passing ticks after that.
+func specReadyTime(c *corev1.Container, containerStart time.Time, startupDelay time.Duration) time.Time {
+	appUp := containerStart.Add(startupDelay)
+	started := appUp
+	if p := c.StartupProbe; p != nil {
+		started = nextTick(containerStart, p, appUp)
+	}
+	if p := c.ReadinessProbe; p != nil {
+		first := nextTick(containerStart, p, started)
+		period := time.Duration(orDefault(p.PeriodSeconds, 10)) * time.Second
+		return first.Add(time.Duration(orDefault(p.SuccessThreshold, 1)-1) * period)
+	}
+	return started
+}
+
+// nextTick returns the first run of probe p at or after t.
+func nextTick(containerStart time.Time, p *corev1.Probe, t time.Time) time.Time {
+	first := containerStart.Add(time.Duration(p.InitialDelaySeconds) * time.Second)
+	if !first.Before(t) {
+		return first
+	}
+	period := time.Duration(orDefault(p.PeriodSeconds, 10)) * time.Second
+	n := (t.Sub(first) + period - 1) / period
+	return first.Add(n * period)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// podsBody caches the encoded /api/pods response of the latest revision, so
+// frequent pollers cost one encoding per change rather than per request.
+type podsBody struct {
+	mu       sync.Mutex
+	revision uint64
+	body     []byte
+	etag     string
+}
+
+// get returns the body and ETag of the pods at revision, encoding the ones
+// returned by pods when the cache holds another revision.
+func (c *podsBody) get(revision uint64, pods func() map[string]*PodStatusInfo) ([]byte, string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.body != nil && c.revision == revision {
+		return c.body, c.etag, nil
+	}
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(pods()); err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	c.revision, c.body, c.etag = revision, buf.Bytes(), `"`+hex.EncodeToString(sum[:16])+`"`
+	return c.body, c.etag, nil
+}
+
+// etagMatches reports whether an If-None-Match header lists etag. Weak tags
+// match too, as the comparison for GET is weak.
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
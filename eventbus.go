@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Event bus kinds.
+const (
+	EventBusNATS  = "nats"
+	EventBusKafka = "kafka"
+	// EventBusKafkaREST produces through a Kafka REST proxy, for clusters
+	// only reachable over HTTP.
+	EventBusKafkaREST = "kafka-rest"
+)
+
+// Encodings of events on the event bus.
+const (
+	EncodingCloudEvents = "cloudevents"
+	EncodingJSON        = "json"
+)
+
+// eventBusTimeout bounds connecting to and publishing on the event bus.
+const eventBusTimeout = 10 * time.Second
+
+// eventBusRetryDelay is how long publishing fails fast after a connection
+// attempt failed, so an unreachable bus doesn't hold up every event.
+const eventBusRetryDelay = 5 * time.Second
+
+// eventBus publishes events to the configured topic.
+type eventBus interface {
+	// publish sends payload keyed by the pod it is about.
+	publish(ctx context.Context, key string, payload []byte) error
+	close()
+}
+
+// newEventBus returns the configured event bus, or nil when it is disabled.
+func newEventBus(c Config) eventBus {
+	switch c.EventBus {
+	case EventBusNATS:
+		return &natsBus{servers: c.EventBusBrokers, subject: c.EventBusTopic}
+	case EventBusKafka:
+		return newKafkaBus(c.EventBusBrokers, c.EventBusTopic)
+	case EventBusKafkaREST:
+		return &kafkaRESTBus{proxies: c.EventBusBrokers, topic: c.EventBusTopic}
+	}
+	return nil
+}
+
+// validateEventBus checks the event bus settings.
+func (c Config) validateEventBus() error {
+	switch c.EventBus {
+	case "":
+		return nil
+	case EventBusNATS, EventBusKafka, EventBusKafkaREST:
+	default:
+		return fmt.Errorf("invalid event bus %q: must be %q, %q or %q", c.EventBus, EventBusNATS, EventBusKafka, EventBusKafkaREST)
+	}
+	if len(c.EventBusBrokers) == 0 {
+		return fmt.Errorf("the %s event bus needs brokers", c.EventBus)
+	}
+	for _, broker := range c.EventBusBrokers {
+		if c.EventBus == EventBusKafka {
+			addr, _ := strings.CutPrefix(broker, "tls://")
+			if _, _, err := net.SplitHostPort(addr); err != nil || strings.Contains(addr, "/") {
+				return fmt.Errorf("invalid Kafka broker %q: must be host:port or tls://host:port", broker)
+			}
+			if strings.HasPrefix(broker, "tls://") != strings.HasPrefix(c.EventBusBrokers[0], "tls://") {
+				return fmt.Errorf("invalid Kafka brokers: either all or none must use tls://")
+			}
+			continue
+		}
+		u, err := url.Parse(broker)
+		if err != nil {
+			return fmt.Errorf("invalid event bus broker %q: %v", broker, err)
+		}
+		switch {
+		case c.EventBus == EventBusNATS && u.Scheme != "nats" && u.Scheme != "tls":
+			return fmt.Errorf("invalid NATS server %q: must be a nats:// or tls:// URL", broker)
+		case c.EventBus == EventBusKafkaREST && u.Scheme != "http" && u.Scheme != "https":
+			return fmt.Errorf("invalid Kafka REST proxy %q: must be an http:// or https:// URL", broker)
+		}
+	}
+	if c.EventBusTopic == "" {
+		return fmt.Errorf("event bus topic must not be empty")
+	}
+	if c.EventBusEncoding != EncodingCloudEvents && c.EventBusEncoding != EncodingJSON {
+		return fmt.Errorf("invalid event bus encoding %q: must be %q or %q", c.EventBusEncoding, EncodingCloudEvents, EncodingJSON)
+	}
+	return nil
+}
+
+// BusEvent is the json encoding of events on the event bus.
+type BusEvent struct {
+	// Type is the CloudEvents type without its prefix, e.g. probe.transition.
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	CloudEventData
+}
+
+// encodeBusEvent encodes ce as a structured CloudEvent or a BusEvent.
+func encodeBusEvent(ce CloudEvent, encoding string) ([]byte, error) {
+	if encoding == EncodingJSON {
+		return json.Marshal(BusEvent{Type: strings.TrimPrefix(ce.Type, cloudEventTypePrefix), Time: ce.Time, CloudEventData: ce.Data})
+	}
+	return json.Marshal(ce)
+}
+
+// natsBus publishes to a subject over the NATS client protocol. It connects
+// on first use and reconnects, trying the servers in turn, after a failure.
+type natsBus struct {
+	servers []string
+	subject string
+
+	mu      sync.Mutex
+	conn    net.Conn
+	next    int
+	retryAt time.Time
+}
+
+func (b *natsBus) publish(ctx context.Context, key string, payload []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn == nil {
+		if time.Now().Before(b.retryAt) {
+			return fmt.Errorf("not connected to NATS")
+		}
+		if err := b.connect(ctx); err != nil {
+			b.retryAt = time.Now().Add(eventBusRetryDelay)
+			return err
+		}
+	}
+	b.conn.SetWriteDeadline(time.Now().Add(eventBusTimeout))
+	msg := fmt.Appendf(nil, "PUB %s %d\r\n", b.subject, len(payload))
+	msg = append(append(msg, payload...), "\r\n"...)
+	if _, err := b.conn.Write(msg); err != nil {
+		b.conn.Close()
+		b.conn = nil
+		return fmt.Errorf("failed to publish to NATS: %v", err)
+	}
+	return nil
+}
+
+// connect dials the next server and completes the handshake. The caller
+// holds b.mu.
+func (b *natsBus) connect(ctx context.Context) error {
+	server := b.servers[b.next%len(b.servers)]
+	b.next++
+	u, _ := url.Parse(server) // Validated with the config.
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	ctx, cancel := context.WithTimeout(ctx, eventBusTimeout)
+	defer cancel()
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", host)
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS server %s: %v", host, err)
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	r := bufio.NewReader(conn)
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to read NATS server info: %v", err)
+	}
+	infoJSON, ok := strings.CutPrefix(line, "INFO ")
+	if !ok {
+		conn.Close()
+		return fmt.Errorf("unexpected NATS greeting %q", strings.TrimSpace(line))
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	json.Unmarshal([]byte(infoJSON), &info)
+	if u.Scheme == "tls" || info.TLSRequired {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return fmt.Errorf("NATS TLS handshake failed: %v", err)
+		}
+		conn, r = tlsConn, bufio.NewReader(tlsConn)
+	}
+
+	// Credentials come from the URL: user:password or a bare token.
+	connectOpts := map[string]any{"verbose": false, "pedantic": false, "lang": "go", "name": "k8s-probe-monitor"}
+	if user := u.User; user != nil {
+		if password, ok := user.Password(); ok {
+			connectOpts["user"], connectOpts["pass"] = user.Username(), password
+		} else {
+			connectOpts["auth_token"] = user.Username()
+		}
+	}
+	opts, _ := json.Marshal(connectOpts)
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", opts); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to send NATS connect: %v", err)
+	}
+	// The server answers the PING with PONG once it accepted the connection.
+	if line, err = r.ReadString('\n'); err != nil || !strings.HasPrefix(line, "PONG") {
+		conn.Close()
+		if err != nil {
+			return fmt.Errorf("failed to connect to NATS: %v", err)
+		}
+		return fmt.Errorf("NATS server refused the connection: %s", strings.TrimSpace(line))
+	}
+	conn.SetDeadline(time.Time{})
+	b.conn = conn
+	slog.Info("Connected to NATS", "server", host, "subject", b.subject)
+	go b.readLoop(conn, r)
+	return nil
+}
+
+// readLoop answers the server's keepalive PINGs and drops the connection
+// when the server closes it or reports an error.
+func (b *natsBus) readLoop(conn net.Conn, r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		if err == nil && strings.HasPrefix(line, "PING") {
+			b.mu.Lock()
+			conn.SetWriteDeadline(time.Now().Add(eventBusTimeout))
+			_, err = io.WriteString(conn, "PONG\r\n")
+			b.mu.Unlock()
+		} else if err == nil && strings.HasPrefix(line, "-ERR") {
+			slog.Warn("NATS server reported an error", "error", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+		if err != nil {
+			b.mu.Lock()
+			if b.conn == conn {
+				b.conn = nil
+			}
+			b.mu.Unlock()
+			conn.Close()
+			return
+		}
+	}
+}
+
+func (b *natsBus) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn != nil {
+		b.conn.Close()
+		b.conn = nil
+	}
+}
+
+// kafkaBus produces records to a Kafka topic over the Kafka protocol, keyed
+// by pod so a pod's events stay in order on one partition. The writer finds
+// the partition leaders through the brokers and reconnects on its own.
+type kafkaBus struct {
+	writer *kafka.Writer
+}
+
+// newKafkaBus returns a bus producing to brokers, which are host:port or all
+// tls://host:port.
+func newKafkaBus(brokers []string, topic string) *kafkaBus {
+	transport := &kafka.Transport{DialTimeout: eventBusTimeout}
+	addrs := make([]string, len(brokers))
+	for i, broker := range brokers {
+		var secure bool
+		if addrs[i], secure = strings.CutPrefix(broker, "tls://"); secure {
+			transport.TLS = &tls.Config{}
+		}
+	}
+	return &kafkaBus{writer: &kafka.Writer{
+		Addr:         kafka.TCP(addrs...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireOne,
+		// Events are published one at a time, so each is sent right away.
+		BatchSize:    1,
+		MaxAttempts:  3,
+		WriteTimeout: eventBusTimeout,
+		Transport:    transport,
+	}}
+}
+
+func (b *kafkaBus) publish(ctx context.Context, key string, payload []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, eventBusTimeout)
+	defer cancel()
+	if err := b.writer.WriteMessages(ctx, kafka.Message{Key: []byte(key), Value: payload}); err != nil {
+		return fmt.Errorf("failed to produce to Kafka: %v", err)
+	}
+	return nil
+}
+
+func (b *kafkaBus) close() {
+	if err := b.writer.Close(); err != nil {
+		slog.Warn("Failed to close the Kafka writer", "error", err)
+	}
+}
+
+// kafkaRESTBus produces records to a Kafka topic through a Kafka REST proxy,
+// such as the Confluent REST Proxy or Redpanda's HTTP proxy, keyed by pod
+// like kafkaBus.
+type kafkaRESTBus struct {
+	proxies []string
+	topic   string
+
+	mu   sync.Mutex
+	next int
+}
+
+func (b *kafkaRESTBus) publish(ctx context.Context, key string, payload []byte) error {
+	body, err := json.Marshal(map[string]any{
+		"records": []map[string]any{{"key": key, "value": json.RawMessage(payload)}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode record: %v", err)
+	}
+	// On failure the next proxy is tried, once each.
+	var lastErr error
+	for range b.proxies {
+		b.mu.Lock()
+		proxy := b.proxies[b.next%len(b.proxies)]
+		b.mu.Unlock()
+		if lastErr = b.produce(ctx, proxy, body); lastErr == nil {
+			return nil
+		}
+		b.mu.Lock()
+		b.next++
+		b.mu.Unlock()
+	}
+	return lastErr
+}
+
+func (b *kafkaRESTBus) produce(ctx context.Context, proxy string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, eventBusTimeout)
+	defer cancel()
+	endpoint := strings.TrimSuffix(proxy, "/") + "/topics/" + url.PathEscape(b.topic)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to produce to %s: %v", proxy, err)
+	}
+	defer resp.Body.Close()
+	// The proxy reports per-record errors in a 200 response.
+	var result struct {
+		Offsets []struct {
+			ErrorCode *int   `json:"error_code"`
+			Error     string `json:"error"`
+		} `json:"offsets"`
+		Message string `json:"message"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&result)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %d: %s", proxy, resp.StatusCode, result.Message)
+	}
+	for _, offset := range result.Offsets {
+		if offset.ErrorCode != nil {
+			return fmt.Errorf("%s failed to produce the record: %s", proxy, offset.Error)
+		}
+	}
+	return nil
+}
+
+func (b *kafkaRESTBus) close() {}
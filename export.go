@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Formats of /api/export.
+const (
+	ExportCSV   = "csv"
+	ExportJSONL = "jsonl"
+)
+
+// Types of exported records.
+const (
+	ExportTransition = "transition"
+	ExportScrape     = "scrape"
+)
+
+// exportChunk is the time range read from the store at a time, so exporting
+// a long range holds only one chunk of records in memory.
+const exportChunk = time.Hour
+
+// defaultExportRange is exported when from isn't set.
+const defaultExportRange = 24 * time.Hour
+
+// ExportRecord is a probe transition or a stored scrape result, one line of
+// /api/export. Fields that don't apply to the record's type are empty.
+type ExportRecord struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	Namespace string    `json:"namespace,omitempty"`
+	Pod       string    `json:"pod"`
+	// Probe, From and To are the probe flag of a transition and its values.
+	// Event is set instead for lifecycle events such as a replacement.
+	Probe  string `json:"probe,omitempty"`
+	From   *bool  `json:"from,omitempty"`
+	To     *bool  `json:"to,omitempty"`
+	Event  string `json:"event,omitempty"`
+	Detail string `json:"detail,omitempty"`
+	// Status and the probe flags are those of a scrape; the flags are
+	// unset when the scrape failed.
+	Node          string  `json:"node,omitempty"`
+	Status        string  `json:"status,omitempty"`
+	Started       *bool   `json:"started,omitempty"`
+	Live          *bool   `json:"live,omitempty"`
+	Ready         *bool   `json:"ready,omitempty"`
+	ErrorKind     string  `json:"errorKind,omitempty"`
+	Error         string  `json:"error,omitempty"`
+	ScrapeSeconds float64 `json:"scrapeSeconds,omitempty"`
+}
+
+var exportColumns = []string{"time", "type", "namespace", "pod", "probe", "from", "to", "event", "detail",
+	"node", "status", "started", "live", "ready", "errorKind", "error", "scrapeSeconds"}
+
+func (e ExportRecord) csvRow() []string {
+	flag := func(b *bool) string {
+		if b == nil {
+			return ""
+		}
+		return strconv.FormatBool(*b)
+	}
+	seconds := ""
+	if e.ScrapeSeconds > 0 {
+		seconds = strconv.FormatFloat(e.ScrapeSeconds, 'f', -1, 64)
+	}
+	return []string{e.Time.Format(time.RFC3339Nano), e.Type, e.Namespace, e.Pod, e.Probe, flag(e.From), flag(e.To), e.Event, e.Detail,
+		e.Node, e.Status, flag(e.Started), flag(e.Live), flag(e.Ready), e.ErrorKind, e.Error, seconds}
+}
+
+func transitionRecord(t StoredTransition) ExportRecord {
+	r := ExportRecord{Time: t.Time, Type: ExportTransition, Namespace: t.Namespace, Pod: t.Pod, Event: t.Event, Detail: t.Detail}
+	if t.Event == "" {
+		from, to := t.From, t.To
+		r.Probe, r.From, r.To = t.Probe, &from, &to
+	}
+	return r
+}
+
+func scrapeRecord(s PodStatusInfo) ExportRecord {
+	r := ExportRecord{Time: s.LastCheck, Type: ExportScrape, Namespace: s.Namespace, Pod: s.Name, Node: s.Node,
+		Status: s.Status, ErrorKind: s.ErrorKind, Error: s.Error}
+	if s.Info != nil {
+		p := s.Info.ProbeStatus
+		r.Started, r.Live, r.Ready = &p.Started, &p.Live, &p.Ready
+	}
+	if s.Scrape != nil {
+		r.ScrapeSeconds = s.Scrape.LastSeconds
+	}
+	return r
+}
+
+// exportRecords returns the transitions and scrape results of pod in
+// namespace, with empty ones matching all, from from up to to, ordered by
+// time.
+func (d *Dashboard) exportRecords(namespace, pod string, from, to time.Time) ([]ExportRecord, error) {
+	transitions, err := d.store.Transitions(namespace, pod, from, to)
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := d.store.Snapshots(namespace, pod, from, to)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]ExportRecord, 0, len(transitions)+len(snapshots))
+	for _, t := range transitions {
+		records = append(records, transitionRecord(t))
+	}
+	for _, s := range snapshots {
+		records = append(records, scrapeRecord(s))
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+	return records, nil
+}
+
+// handleExport serves GET /api/export, the stored transitions and scrape
+// results from from to to (RFC 3339; the last day by default) as CSV or JSON
+// lines. The range is read and written an hour at a time, flushing each, so
+// large exports stream rather than build up in memory.
+func (d *Dashboard) handleExport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = ExportCSV
+	}
+	if format != ExportCSV && format != ExportJSONL {
+		http.Error(w, fmt.Sprintf("Invalid format %q: must be %q or %q", format, ExportCSV, ExportJSONL), http.StatusBadRequest)
+		return
+	}
+	to := time.Now()
+	from := to.Add(-defaultExportRange)
+	for _, bound := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		if v := query.Get(bound.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid %s: %v", bound.name, err), http.StatusBadRequest)
+				return
+			}
+			*bound.dst = t
+		}
+	}
+	if !from.Before(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+	namespace, pod := query.Get("namespace"), query.Get("pod")
+
+	// An export outlives the server's write timeout.
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	filename := "probe-history-" + from.UTC().Format("20060102T150405Z") + "." + format
+	if format == ExportCSV {
+		w.Header().Set("Content-Type", "text/csv")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	var write func(ExportRecord) error
+	var flush func() error
+	if format == ExportCSV {
+		cw := csv.NewWriter(w)
+		if err := cw.Write(exportColumns); err != nil {
+			return
+		}
+		write = func(e ExportRecord) error { return cw.Write(e.csvRow()) }
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	} else {
+		enc := json.NewEncoder(w)
+		write = func(e ExportRecord) error { return enc.Encode(e) }
+		flush = func() error { return nil }
+	}
+
+	flushed := false
+	for start := from; start.Before(to); start = start.Add(exportChunk) {
+		if r.Context().Err() != nil {
+			return
+		}
+		records, err := d.exportRecords(namespace, pod, start, minTime(start.Add(exportChunk), to))
+		if err != nil && !flushed {
+			http.Error(w, fmt.Sprintf("Failed to read history: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if err != nil {
+			// The status has been sent; aborting the response is what
+			// tells the client the export is incomplete.
+			slog.Error("Failed to read history for export", "from", start, "error", err)
+			panic(http.ErrAbortHandler)
+		}
+		for _, e := range records {
+			if err := write(e); err != nil {
+				return
+			}
+		}
+		if err := flush(); err != nil {
+			return
+		}
+		rc.Flush()
+		flushed = true
+	}
+}
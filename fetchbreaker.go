@@ -0,0 +1,102 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// FetchBackoff is set on a pod whose scrapes keep failing to reach it, such
+// as when a NetworkPolicy blocks the dashboard or the port is wrong. Its
+// circuit is open: scrapes are skipped until RetryAt instead of waiting out
+// the fetch timeout every cycle. The scrape at RetryAt is a half-open trial
+// that closes the circuit on success or opens it again for twice as long.
+type FetchBackoff struct {
+	Failures int       `json:"failures"`
+	RetryAt  time.Time `json:"retryAt"`
+}
+
+type fetchCircuit struct {
+	// target is the address the failures were counted against; a new one
+	// starts over.
+	target   string
+	failures int
+	retryAt  time.Time
+}
+
+// fetchBreaker counts each pod's consecutive unreachable scrapes and opens a
+// circuit after FetchFailureThreshold of them.
+type fetchBreaker struct {
+	mu   sync.Mutex
+	pods map[string]*fetchCircuit
+}
+
+func newFetchBreaker() *fetchBreaker {
+	return &fetchBreaker{pods: make(map[string]*fetchCircuit)}
+}
+
+// allow reports whether a pod's target may be scraped now. Once an open
+// circuit's retry time has passed, one trial scrape is let through; the
+// retry time moves on meanwhile so concurrent scrapes keep waiting.
+func (b *fetchBreaker) allow(pod, target string, cfg Config, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.pods[pod]
+	if c == nil || c.target != target || !c.open(cfg) {
+		return true
+	}
+	if now.Before(c.retryAt) {
+		return false
+	}
+	c.retryAt = now.Add(c.delay(cfg))
+	return true
+}
+
+// observe records whether a scrape reached the pod and returns the backoff
+// state that follows, nil while the circuit is closed.
+func (b *fetchBreaker) observe(pod, target string, reachable bool, cfg Config, now time.Time) *FetchBackoff {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.pods[pod]
+	if reachable {
+		if c != nil && c.open(cfg) {
+			slog.Info("Pod reachable again, resuming scrapes", "pod", pod, "failures", c.failures)
+		}
+		delete(b.pods, pod)
+		return nil
+	}
+	if c == nil || c.target != target {
+		c = &fetchCircuit{target: target}
+		b.pods[pod] = c
+	}
+	c.failures++
+	if !c.open(cfg) {
+		return nil
+	}
+	delay := c.delay(cfg)
+	c.retryAt = now.Add(delay)
+	if c.failures == cfg.FetchFailureThreshold {
+		slog.Warn("Pod unreachable, backing off its scrapes", "pod", pod, "target", target, "failures", c.failures, "retryIn", delay)
+	}
+	return &FetchBackoff{Failures: c.failures, RetryAt: c.retryAt}
+}
+
+// open reports whether the circuit has seen enough failures to open.
+func (c *fetchCircuit) open(cfg Config) bool {
+	return cfg.FetchFailureThreshold > 0 && c.failures >= cfg.FetchFailureThreshold
+}
+
+// delay is the backoff after the current failures: twice the poll interval,
+// doubled with every failed trial, up to the maximum.
+func (c *fetchCircuit) delay(cfg Config) time.Duration {
+	if n := c.failures - cfg.FetchFailureThreshold + 1; n < 16 {
+		return min(cfg.PollInterval<<n, cfg.FetchBackoffMax)
+	}
+	return cfg.FetchBackoffMax
+}
+
+func (b *fetchBreaker) forget(pod string) {
+	b.mu.Lock()
+	delete(b.pods, pod)
+	b.mu.Unlock()
+}
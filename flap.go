@@ -0,0 +1,104 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// FlapState counts a pod's readiness transitions within the flap window. A
+// pod with at least FlapThreshold of them is flapping: its readiness at any
+// one moment says little about its health.
+type FlapState struct {
+	Flapping      bool    `json:"flapping"`
+	Transitions   int     `json:"transitions"`
+	WindowSeconds float64 `json:"windowSeconds"`
+	// Since is when the pod started flapping.
+	Since *time.Time `json:"since,omitempty"`
+}
+
+type podFlaps struct {
+	ready bool
+	// toggles are the times of the readiness transitions within the window,
+	// oldest first.
+	toggles []time.Time
+	since   time.Time
+}
+
+// flapTracker follows the readiness each pod reports to detect flapping.
+type flapTracker struct {
+	mu   sync.Mutex
+	pods map[string]*podFlaps
+}
+
+func newFlapTracker() *flapTracker {
+	return &flapTracker{pods: make(map[string]*podFlaps)}
+}
+
+// observe records a pod's reported readiness and returns its flap state, nil
+// until it has had a transition within the window or if detection is
+// disabled.
+func (t *flapTracker) observe(pod string, ready bool, cfg Config, now time.Time) *FlapState {
+	if cfg.FlapThreshold <= 0 {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p := t.pods[pod]
+	if p == nil {
+		t.pods[pod] = &podFlaps{ready: ready}
+		return nil
+	}
+	if p.ready != ready {
+		p.ready = ready
+		p.toggles = append(p.toggles, now)
+	}
+	return p.state(pod, cfg, now)
+}
+
+// state returns a pod's flap state without a new observation.
+func (t *flapTracker) state(pod string, cfg Config, now time.Time) *FlapState {
+	if cfg.FlapThreshold <= 0 {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if p := t.pods[pod]; p != nil {
+		return p.state(pod, cfg, now)
+	}
+	return nil
+}
+
+// state drops the transitions that left the window and logs when the pod
+// starts or stops flapping. t.mu must be held.
+func (p *podFlaps) state(pod string, cfg Config, now time.Time) *FlapState {
+	i := 0
+	for i < len(p.toggles) && now.Sub(p.toggles[i]) > cfg.FlapWindow {
+		i++
+	}
+	p.toggles = p.toggles[i:]
+	switch flapping := len(p.toggles) >= cfg.FlapThreshold; {
+	case flapping && p.since.IsZero():
+		p.since = now
+		slog.Warn("Pod is flapping", "pod", pod, "transitions", len(p.toggles), "window", cfg.FlapWindow)
+	case !flapping && !p.since.IsZero():
+		slog.Info("Pod stopped flapping", "pod", pod)
+		p.since = time.Time{}
+	}
+	if len(p.toggles) == 0 {
+		return nil
+	}
+
+	state := &FlapState{Transitions: len(p.toggles), WindowSeconds: cfg.FlapWindow.Seconds()}
+	if !p.since.IsZero() {
+		since := p.since
+		state.Flapping, state.Since = true, &since
+	}
+	return state
+}
+
+func (t *flapTracker) forget(pod string) {
+	t.mu.Lock()
+	delete(t.pods, pod)
+	t.mu.Unlock()
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Aggregate series of the Grafana datasource. Per-pod series are named
+// <probe>:<namespace>/<pod>, e.g. ready:default/web-5d9c7b8f4-czgla.
+const (
+	grafanaPods        = "pods"
+	grafanaReadyPods   = "ready_pods"
+	grafanaUnreadyPods = "unready_pods"
+	grafanaTransitions = "transitions"
+)
+
+// grafanaProbes are the probes with per-pod series.
+var grafanaProbes = []string{"started", "live", "ready"}
+
+// grafanaQuery is a query of Grafana's SimpleJSON and JSON datasources.
+type grafanaQuery struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	IntervalMs    int64 `json:"intervalMs"`
+	MaxDataPoints int   `json:"maxDataPoints"`
+	Targets       []struct {
+		Target string `json:"target"`
+		RefID  string `json:"refId"`
+		// Type is timeserie or table.
+		Type string `json:"type"`
+	} `json:"targets"`
+}
+
+type grafanaSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+type grafanaColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+type grafanaTable struct {
+	Type    string          `json:"type"`
+	Columns []grafanaColumn `json:"columns"`
+	Rows    [][]any         `json:"rows"`
+}
+
+// grafanaAnnotation marks a probe transition on Grafana panels.
+type grafanaAnnotation struct {
+	Annotation json.RawMessage `json:"annotation"`
+	Time       int64           `json:"time"`
+	Title      string          `json:"title"`
+	Text       string          `json:"text"`
+	Tags       []string        `json:"tags"`
+}
+
+// handleGrafanaTest answers the datasource's connection test.
+func (d *Dashboard) handleGrafanaTest(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleGrafanaSearch lists the series containing the requested target.
+func (d *Dashboard) handleGrafanaSearch(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Target string `json:"target"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid search: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	targets := []string{grafanaPods, grafanaReadyPods, grafanaUnreadyPods, grafanaTransitions}
+	d.mu.RLock()
+	keys := make([]string, 0, len(d.pods))
+	for key := range d.pods {
+		keys = append(keys, key)
+	}
+	d.mu.RUnlock()
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, probe := range grafanaProbes {
+			targets = append(targets, probe+":"+key)
+		}
+	}
+
+	out := []string{}
+	for _, t := range targets {
+		if strings.Contains(t, req.Target) {
+			out = append(out, t)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// handleGrafanaQuery serves the requested series from the store: the pod
+// counts, each pod's probe flags, and the transitions as a count per
+// interval or, for table panels, a table.
+func (d *Dashboard) handleGrafanaQuery(w http.ResponseWriter, r *http.Request) {
+	var q grafanaQuery
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid query: %v", err), http.StatusBadRequest)
+		return
+	}
+	from, to := q.Range.From, q.Range.To
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() || !from.Before(to) {
+		from = to.Add(-time.Hour)
+	}
+	step := grafanaStep(from, to, q.IntervalMs, q.MaxDataPoints)
+
+	out := []any{}
+	for _, t := range q.Targets {
+		if t.Target == "" {
+			continue
+		}
+		var result any
+		var err error
+		switch {
+		case t.Target == grafanaTransitions && t.Type == "table":
+			result, err = d.grafanaTransitionTable(from, to)
+		case t.Target == grafanaTransitions:
+			result, err = d.grafanaTransitionSeries(from, to, step)
+		case t.Target == grafanaPods || t.Target == grafanaReadyPods || t.Target == grafanaUnreadyPods:
+			result, err = d.grafanaPodSeries(t.Target, from, to, step)
+		default:
+			probe, pod, ok := strings.Cut(t.Target, ":")
+			if !ok || !slices.Contains(grafanaProbes, probe) {
+				http.Error(w, fmt.Sprintf("Unknown target %q", t.Target), http.StatusBadRequest)
+				return
+			}
+			result, err = d.grafanaProbeSeries(t.Target, probe, pod, from, to)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to query the store: %v", err), http.StatusInternalServerError)
+			return
+		}
+		out = append(out, result)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// handleGrafanaAnnotations serves the probe transitions in range as
+// annotations. The annotation query, if any, selects pods whose name
+// contains it.
+func (d *Dashboard) handleGrafanaAnnotations(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Range struct {
+			From time.Time `json:"from"`
+			To   time.Time `json:"to"`
+		} `json:"range"`
+		Annotation json.RawMessage `json:"annotation"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid annotation query: %v", err), http.StatusBadRequest)
+		return
+	}
+	var annotation struct {
+		Query string `json:"query"`
+	}
+	json.Unmarshal(req.Annotation, &annotation)
+
+	transitions, err := d.store.Transitions("", "", req.Range.From, req.Range.To)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to query the store: %v", err), http.StatusInternalServerError)
+		return
+	}
+	out := []grafanaAnnotation{}
+	for _, t := range transitions {
+		if !strings.Contains(t.Pod, annotation.Query) {
+			continue
+		}
+		a := grafanaAnnotation{
+			Annotation: req.Annotation,
+			Time:       t.Time.UnixMilli(),
+			Title:      fmt.Sprintf("%s %s: %t → %t", t.Pod, t.Probe, t.From, t.To),
+			Text:       fmt.Sprintf("after %.0fs", t.PreviousStateSeconds),
+			Tags:       []string{t.Probe, t.Pod},
+		}
+		if t.Event != "" {
+			a.Title, a.Text, a.Tags = t.Pod+" "+t.Event, t.Detail, []string{t.Event, t.Pod}
+		}
+		out = append(out, a)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// grafanaStep is the interval of aggregate series: Grafana's interval, but
+// at least the snapshot interval and coarse enough for maxDataPoints.
+func grafanaStep(from, to time.Time, intervalMs int64, maxDataPoints int) time.Duration {
+	step := max(time.Duration(intervalMs)*time.Millisecond, snapshotInterval)
+	if maxDataPoints > 0 {
+		step = max(step, to.Sub(from)/time.Duration(maxDataPoints))
+	}
+	return step
+}
+
+// grafanaBuckets returns the ends of the steps from from to to; the last one
+// ends at to.
+func grafanaBuckets(from, to time.Time, step time.Duration) []time.Time {
+	var ends []time.Time
+	for t := from.Add(step); t.Before(to); t = t.Add(step) {
+		ends = append(ends, t)
+	}
+	return append(ends, to)
+}
+
+// grafanaPodSeries counts the pods, ready or not, at the end of each step
+// from the stored snapshots. A pod counts while its latest snapshot is at
+// most two snapshot intervals old.
+func (d *Dashboard) grafanaPodSeries(target string, from, to time.Time, step time.Duration) (grafanaSeries, error) {
+	snapshots, err := d.store.Snapshots("", "", from.Add(-2*snapshotInterval), to)
+	if err != nil {
+		return grafanaSeries{}, err
+	}
+	series := grafanaSeries{Target: target, Datapoints: [][2]float64{}}
+	latest := make(map[string]*PodStatusInfo)
+	i := 0
+	for _, t := range grafanaBuckets(from, to, step) {
+		for ; i < len(snapshots) && !snapshots[i].LastCheck.After(t); i++ {
+			latest[snapshots[i].Name] = &snapshots[i]
+		}
+		var pods, ready int
+		for _, s := range latest {
+			if t.Sub(s.LastCheck) > 2*snapshotInterval {
+				continue
+			}
+			pods++
+			if s.Info != nil && s.Info.ProbeStatus.Ready {
+				ready++
+			}
+		}
+		value := map[string]int{grafanaPods: pods, grafanaReadyPods: ready, grafanaUnreadyPods: pods - ready}[target]
+		series.Datapoints = append(series.Datapoints, [2]float64{float64(value), float64(t.UnixMilli())})
+	}
+	return series, nil
+}
+
+// grafanaProbeSeries is a pod's probe flag, 1 or 0, at each stored
+// snapshot. Snapshots of unreachable pods are left out.
+func (d *Dashboard) grafanaProbeSeries(target, probe, pod string, from, to time.Time) (grafanaSeries, error) {
+	namespace, name := splitPodKey(pod)
+	snapshots, err := d.store.Snapshots(namespace, name, from, to)
+	if err != nil {
+		return grafanaSeries{}, err
+	}
+	series := grafanaSeries{Target: target, Datapoints: [][2]float64{}}
+	for _, s := range snapshots {
+		if s.Info == nil {
+			continue
+		}
+		on := map[string]bool{"started": s.Info.ProbeStatus.Started, "live": s.Info.ProbeStatus.Live, "ready": s.Info.ProbeStatus.Ready}[probe]
+		value := 0.0
+		if on {
+			value = 1
+		}
+		series.Datapoints = append(series.Datapoints, [2]float64{value, float64(s.LastCheck.UnixMilli())})
+	}
+	return series, nil
+}
+
+// grafanaTransitionSeries counts the probe transitions in each step.
+func (d *Dashboard) grafanaTransitionSeries(from, to time.Time, step time.Duration) (grafanaSeries, error) {
+	transitions, err := d.store.Transitions("", "", from, to)
+	if err != nil {
+		return grafanaSeries{}, err
+	}
+	series := grafanaSeries{Target: grafanaTransitions, Datapoints: [][2]float64{}}
+	i := 0
+	for _, t := range grafanaBuckets(from, to, step) {
+		n := 0
+		for ; i < len(transitions) && transitions[i].Time.Before(t); i++ {
+			if transitions[i].Event == "" {
+				n++
+			}
+		}
+		series.Datapoints = append(series.Datapoints, [2]float64{float64(n), float64(t.UnixMilli())})
+	}
+	return series, nil
+}
+
+// grafanaTransitionTable lists the probe transitions and pod lifecycle
+// events, newest first.
+func (d *Dashboard) grafanaTransitionTable(from, to time.Time) (grafanaTable, error) {
+	transitions, err := d.store.Transitions("", "", from, to)
+	if err != nil {
+		return grafanaTable{}, err
+	}
+	table := grafanaTable{
+		Type: "table",
+		Columns: []grafanaColumn{
+			{Text: "Time", Type: "time"},
+			{Text: "Pod", Type: "string"},
+			{Text: "Probe", Type: "string"},
+			{Text: "From", Type: "string"},
+			{Text: "To", Type: "string"},
+			{Text: "Held (s)", Type: "number"},
+		},
+		Rows: [][]any{},
+	}
+	for i := len(transitions) - 1; i >= 0; i-- {
+		t := transitions[i]
+		if t.Event != "" {
+			table.Rows = append(table.Rows, []any{t.Time.UnixMilli(), t.Pod, t.Event, "", t.Detail, nil})
+			continue
+		}
+		table.Rows = append(table.Rows, []any{t.Time.UnixMilli(), t.Pod, t.Probe, fmt.Sprint(t.From), fmt.Sprint(t.To), t.PreviousStateSeconds})
+	}
+	return table, nil
+}
@@ -0,0 +1,1197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The GraphQL endpoint implements queries without a schema library: fields
+// are resolved by reflection on the types the REST API returns, matching
+// their JSON names case-insensitively, so { pods { name info { probeStatus
+// { ready } } } } reads PodStatusInfo.Name and so on. Computed fields such
+// as a pod's history are added in gqlComputedFields. Fragments, aliases and
+// variables are supported; mutations, subscriptions, directives and
+// introspection are not.
+
+// GraphQLRequest is the body of POST /api/graphql.
+type GraphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// GraphQLResponse is the response of /api/graphql.
+type GraphQLResponse struct {
+	Data   any            `json:"data"`
+	Errors []GraphQLError `json:"errors,omitempty"`
+}
+
+// GraphQLError is an error of a GraphQL request, with the path of the field
+// that failed.
+type GraphQLError struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+// maxGraphQLRequest bounds the size of a GraphQL request body.
+const maxGraphQLRequest = 1 << 20
+
+// Limits of a query. maxGraphQLDepth bounds the nesting of selections,
+// argument values and types; maxGraphQLFields the fields selected, counting
+// each alias and fragment spread; maxGraphQLResolved the fields resolved,
+// which multiplies with the length of the lists selected from.
+const (
+	maxGraphQLDepth    = 12
+	maxGraphQLFields   = 500
+	maxGraphQLResolved = 50000
+)
+
+// handleGraphQL serves /api/graphql: GET with the query, variables and
+// operationName parameters, or POST with a GraphQLRequest.
+func (d *Dashboard) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req GraphQLRequest
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		req.Query, req.OperationName = query.Get("query"), query.Get("operationName")
+		if v := query.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid variables: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+	} else if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphQLRequest)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	data, err := d.executeGraphQL(req)
+	if err != nil {
+		gqlErr, ok := err.(*GraphQLError)
+		if !ok {
+			gqlErr = &GraphQLError{Message: err.Error()}
+		}
+		if gqlErr.Path == nil {
+			// The request itself is invalid rather than a field.
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		json.NewEncoder(w).Encode(GraphQLResponse{Errors: []GraphQLError{*gqlErr}})
+		return
+	}
+	json.NewEncoder(w).Encode(GraphQLResponse{Data: data})
+}
+
+func (e *GraphQLError) Error() string { return e.Message }
+
+// executeGraphQL parses and runs a query.
+func (d *Dashboard) executeGraphQL(req GraphQLRequest) (any, error) {
+	if strings.TrimSpace(req.Query) == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	doc, err := parseGraphQL(req.Query)
+	if err != nil {
+		return nil, err
+	}
+	var op *gqlOperation
+	for _, o := range doc.operations {
+		if req.OperationName == "" && len(doc.operations) > 1 {
+			return nil, fmt.Errorf("operationName is required for documents with several operations")
+		}
+		if req.OperationName == "" || o.name == req.OperationName {
+			op = o
+			break
+		}
+	}
+	if op == nil {
+		return nil, fmt.Errorf("unknown operation %q", req.OperationName)
+	}
+
+	vars := make(map[string]any)
+	for _, def := range op.variables {
+		v, ok := req.Variables[def.name]
+		switch {
+		case ok:
+		case def.hasDefault:
+			v = def.value
+		case def.required:
+			return nil, fmt.Errorf("variable $%s is required", def.name)
+		}
+		vars[def.name] = v
+	}
+	e := &gqlExecutor{d: d, fragments: doc.fragments, vars: vars}
+	if _, err := e.measure(op.selections, 1, 0, nil); err != nil {
+		return nil, err
+	}
+	return e.value(reflect.ValueOf(gqlQuery{}), op.selections, nil)
+}
+
+// gqlQuery is the root of queries; its fields are all computed.
+type gqlQuery struct{}
+
+// gqlDeployment is a Deployment with the cluster it is in.
+type gqlDeployment struct {
+	DeploymentStatus
+	Cluster string `json:"cluster,omitempty"`
+	d       *Dashboard
+}
+
+// gqlResolver computes a field from its parent and arguments.
+type gqlResolver struct {
+	args    []string
+	resolve func(e *gqlExecutor, parent reflect.Value, args gqlArgs) (any, error)
+}
+
+// gqlComputedFields are the fields of types that aren't read from their
+// JSON fields, by type and name.
+var gqlComputedFields map[reflect.Type]map[string]gqlResolver
+
+func init() {
+	podArgs := []string{"cluster", "namespace", "node", "replicaSet", "status", "ready", "sort", "limit", "offset"}
+	gqlComputedFields = map[reflect.Type]map[string]gqlResolver{
+		reflect.TypeFor[gqlQuery](): {
+			"pods": {podArgs, func(e *gqlExecutor, _ reflect.Value, args gqlArgs) (any, error) {
+				return e.pods(args)
+			}},
+			"pod": {[]string{"name", "namespace", "cluster"}, func(e *gqlExecutor, _ reflect.Value, args gqlArgs) (any, error) {
+				c, key, err := e.podArgs(args, "name")
+				if err != nil {
+					return nil, err
+				}
+				c.mu.RLock()
+				defer c.mu.RUnlock()
+				return c.pods[key], nil
+			}},
+			"deployments": {[]string{"cluster", "namespace"}, func(e *gqlExecutor, _ reflect.Value, args gqlArgs) (any, error) {
+				return e.deployments(args)
+			}},
+			"history": {[]string{"pod", "namespace", "cluster"}, func(e *gqlExecutor, _ reflect.Value, args gqlArgs) (any, error) {
+				c, key, err := e.podArgs(args, "pod")
+				if err != nil {
+					return nil, err
+				}
+				entries, _, err := c.podHistory(key)
+				return entries, err
+			}},
+			"events": {[]string{"pod", "namespace", "cluster"}, func(e *gqlExecutor, _ reflect.Value, args gqlArgs) (any, error) {
+				c, key, err := e.podArgs(args, "pod")
+				if err != nil {
+					return nil, err
+				}
+				return c.kubeEvents.get(key), nil
+			}},
+		},
+		reflect.TypeFor[PodStatusInfo](): {
+			"history": {nil, func(e *gqlExecutor, parent reflect.Value, _ gqlArgs) (any, error) {
+				pod := parent.Interface().(PodStatusInfo)
+				entries, _, err := e.d.clusterNamed(pod.Cluster).podHistory(podKey(pod.Namespace, pod.Name))
+				return entries, err
+			}},
+			"events": {nil, func(e *gqlExecutor, parent reflect.Value, _ gqlArgs) (any, error) {
+				pod := parent.Interface().(PodStatusInfo)
+				return e.d.clusterNamed(pod.Cluster).kubeEvents.get(podKey(pod.Namespace, pod.Name)), nil
+			}},
+		},
+		reflect.TypeFor[gqlDeployment](): {
+			"pods": {nil, func(e *gqlExecutor, parent reflect.Value, _ gqlArgs) (any, error) {
+				dep := parent.Interface().(gqlDeployment)
+				var pods []*PodStatusInfo
+				dep.d.mu.RLock()
+				for _, p := range dep.d.pods {
+					if p.Workload != nil && p.Workload.Kind == "Deployment" && p.Workload.Name == dep.Name && p.Namespace == dep.Namespace {
+						pods = append(pods, p)
+					}
+				}
+				dep.d.mu.RUnlock()
+				sort.Slice(pods, func(i, j int) bool { return pods[i].SortKey() < pods[j].SortKey() })
+				return pods, nil
+			}},
+		},
+	}
+}
+
+// gqlTypeNames are the __typename of types named differently in Go.
+var gqlTypeNames = map[reflect.Type]string{
+	reflect.TypeFor[gqlQuery]():      "Query",
+	reflect.TypeFor[gqlDeployment](): "Deployment",
+	reflect.TypeFor[PodStatusInfo](): "Pod",
+}
+
+// gqlExecutor runs one operation.
+type gqlExecutor struct {
+	d         *Dashboard
+	fragments map[string][]gqlSelection
+	vars      map[string]any
+	// resolved counts the fields resolved so far.
+	resolved int
+}
+
+// measure checks the selections at depth against maxGraphQLDepth and adds
+// their fields, with fragments expanded, to count, failing once it exceeds
+// maxGraphQLFields. Unknown and cyclic fragments are left to collect.
+func (e *gqlExecutor) measure(selections []gqlSelection, depth, count int, visiting map[string]bool) (int, error) {
+	if depth > maxGraphQLDepth {
+		return count, fmt.Errorf("the query is nested more than %d levels deep", maxGraphQLDepth)
+	}
+	for _, s := range selections {
+		var err error
+		switch {
+		case s.field != nil:
+			if count++; count > maxGraphQLFields {
+				return count, fmt.Errorf("the query selects more than %d fields", maxGraphQLFields)
+			}
+			if s.field.selections != nil {
+				count, err = e.measure(s.field.selections, depth+1, count, visiting)
+			}
+		case s.spread != "":
+			if visiting[s.spread] {
+				continue
+			}
+			if visiting == nil {
+				visiting = make(map[string]bool)
+			}
+			visiting[s.spread] = true
+			count, err = e.measure(e.fragments[s.spread], depth, count, visiting)
+			delete(visiting, s.spread)
+		default:
+			count, err = e.measure(s.inline, depth, count, visiting)
+		}
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// pods resolves Query.pods, the pods filtered and sorted as by /api/pods.
+func (e *gqlExecutor) pods(args gqlArgs) (any, error) {
+	var filter podFilter
+	for name, dst := range map[string]*string{
+		"cluster": &filter.cluster, "namespace": &filter.namespace, "node": &filter.node,
+		"replicaSet": &filter.replicaSet, "status": &filter.status,
+	} {
+		v, err := args.string(name)
+		if err != nil {
+			return nil, err
+		}
+		*dst = v
+	}
+	// ready may be given as a Boolean or as "unknown".
+	if b, ok := args["ready"].(bool); ok {
+		filter.ready = strconv.FormatBool(b)
+	} else if ready, err := args.string("ready"); err != nil || !validReady(ready) {
+		return nil, fmt.Errorf("argument ready must be true, false or \"unknown\"")
+	} else {
+		filter.ready = ready
+	}
+	sortParam, err := args.string("sort")
+	if err != nil {
+		return nil, err
+	}
+	limit, err := args.int("limit")
+	if err != nil {
+		return nil, err
+	}
+	offset, err := args.int("offset")
+	if err != nil {
+		return nil, err
+	}
+
+	matched, err := e.d.listPods(filter, sortParam)
+	if err != nil {
+		return nil, fmt.Errorf("argument sort %v", err)
+	}
+	matched = matched[min(offset, len(matched)):]
+	if limit > 0 {
+		matched = matched[:min(limit, len(matched))]
+	}
+	pods := make([]*PodStatusInfo, len(matched))
+	for i, m := range matched {
+		pods[i] = m.pod
+	}
+	return pods, nil
+}
+
+// deployments resolves Query.deployments.
+func (e *gqlExecutor) deployments(args gqlArgs) (any, error) {
+	cluster, err := args.string("cluster")
+	if err != nil {
+		return nil, err
+	}
+	namespace, err := args.string("namespace")
+	if err != nil {
+		return nil, err
+	}
+	clusters := e.d.clusters()
+	if cluster != "" {
+		c := e.d.clusterNamed(cluster)
+		if c == nil {
+			return nil, fmt.Errorf("unknown cluster %q", cluster)
+		}
+		clusters = []*Dashboard{c}
+	}
+	var deployments []gqlDeployment
+	for _, c := range clusters {
+		for _, dep := range c.deployments() {
+			if namespace == "" || dep.Namespace == namespace {
+				deployments = append(deployments, gqlDeployment{dep, c.cluster, c})
+			}
+		}
+	}
+	return deployments, nil
+}
+
+// podArgs returns the dashboard of the cluster argument and the key of the
+// pod named by the argument name, which is required, in the namespace
+// argument.
+func (e *gqlExecutor) podArgs(args gqlArgs, name string) (*Dashboard, string, error) {
+	pod, err := args.string(name)
+	if err != nil {
+		return nil, "", err
+	}
+	if pod == "" {
+		return nil, "", fmt.Errorf("argument %s is required", name)
+	}
+	namespace, err := args.string("namespace")
+	if err != nil {
+		return nil, "", err
+	}
+	cluster, err := args.string("cluster")
+	if err != nil {
+		return nil, "", err
+	}
+	c := e.d.clusterNamed(cluster)
+	if c == nil {
+		return nil, "", fmt.Errorf("unknown cluster %q", cluster)
+	}
+	key, err := c.podKeyNamed(namespace, pod)
+	if err != nil {
+		return nil, "", fmt.Errorf("pod %s exists in several namespaces; set namespace", pod)
+	}
+	return c, key, nil
+}
+
+// gqlArgs are the arguments of a field with variables substituted.
+type gqlArgs map[string]any
+
+func (a gqlArgs) string(name string) (string, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+	return "", fmt.Errorf("argument %s must be a string", name)
+}
+
+func (a gqlArgs) int(name string) (int, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		if v >= 0 {
+			return int(v), nil
+		}
+	case float64:
+		// From JSON variables.
+		if v >= 0 && v == float64(int(v)) {
+			return int(v), nil
+		}
+	}
+	return 0, fmt.Errorf("argument %s must be a non-negative integer", name)
+}
+
+// value resolves the selections on v. Leaf values are returned as they are
+// and encoded like the REST API encodes them.
+func (e *gqlExecutor) value(v reflect.Value, selections []gqlSelection, path []any) (any, error) {
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil, nil
+	}
+	t := v.Type()
+	if gqlLeaf(t) {
+		if selections != nil {
+			return nil, &GraphQLError{Message: fmt.Sprintf("field of type %s has no subfields", gqlTypeName(t)), Path: path}
+		}
+		return v.Interface(), nil
+	}
+	if selections == nil {
+		return nil, &GraphQLError{Message: fmt.Sprintf("field of type %s must have a selection of subfields", gqlTypeName(t)), Path: path}
+	}
+
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		list := make([]any, v.Len())
+		for i := range list {
+			item, err := e.value(v.Index(i), selections, append(path[:len(path):len(path)], i))
+			if err != nil {
+				return nil, err
+			}
+			list[i] = item
+		}
+		return list, nil
+	}
+
+	fields, err := e.collect(selections, nil)
+	if err != nil {
+		return nil, &GraphQLError{Message: err.Error(), Path: path}
+	}
+	obj := make(gqlObject, 0, len(fields))
+	for _, f := range fields {
+		if e.resolved++; e.resolved > maxGraphQLResolved {
+			return nil, &GraphQLError{Message: fmt.Sprintf("the query resolves more than %d fields; select fewer fields or pods", maxGraphQLResolved)}
+		}
+		fieldPath := append(path[:len(path):len(path)], f.key())
+		args := make(gqlArgs, len(f.args))
+		for name, arg := range f.args {
+			value, err := substitute(arg, e.vars)
+			if err != nil {
+				return nil, &GraphQLError{Message: err.Error(), Path: fieldPath}
+			}
+			args[name] = value
+		}
+
+		var result any
+		if f.name == "__typename" {
+			result = gqlTypeName(t)
+		} else if r, ok := gqlComputedFields[t][f.name]; ok {
+			for name := range args {
+				if !slices.Contains(r.args, name) {
+					return nil, &GraphQLError{Message: fmt.Sprintf("unknown argument %q of field %s", name, f.name), Path: fieldPath}
+				}
+			}
+			resolved, err := r.resolve(e, v, args)
+			if err != nil {
+				if _, ok := err.(*GraphQLError); !ok {
+					err = &GraphQLError{Message: err.Error(), Path: fieldPath}
+				}
+				return nil, err
+			}
+			if result, err = e.value(reflect.ValueOf(resolved), f.selections, fieldPath); err != nil {
+				return nil, err
+			}
+		} else if index, ok := gqlFieldIndex(t, f.name); ok {
+			if len(args) > 0 {
+				return nil, &GraphQLError{Message: fmt.Sprintf("field %s takes no arguments", f.name), Path: fieldPath}
+			}
+			if result, err = e.value(v.FieldByIndex(index), f.selections, fieldPath); err != nil {
+				return nil, err
+			}
+		} else {
+			return nil, &GraphQLError{Message: fmt.Sprintf("cannot query field %q on type %s", f.name, gqlTypeName(t)), Path: fieldPath}
+		}
+		obj = append(obj, gqlEntry{f.key(), result})
+	}
+	return obj, nil
+}
+
+// collect flattens fragments into the fields of a selection set, merging
+// the subselections of fields with the same response key.
+func (e *gqlExecutor) collect(selections []gqlSelection, visiting map[string]bool) ([]*gqlField, error) {
+	var fields []*gqlField
+	byKey := make(map[string]*gqlField)
+	var add func(selections []gqlSelection) error
+	add = func(selections []gqlSelection) error {
+		for _, s := range selections {
+			switch {
+			case s.field != nil:
+				if prev, ok := byKey[s.field.key()]; ok {
+					if prev.name != s.field.name {
+						return fmt.Errorf("fields %s and %s conflict as both are named %s", prev.name, s.field.name, s.field.key())
+					}
+					merged := *prev
+					merged.selections = append(append([]gqlSelection(nil), prev.selections...), s.field.selections...)
+					*prev = merged
+					continue
+				}
+				f := *s.field
+				byKey[f.key()] = &f
+				fields = append(fields, &f)
+			case s.spread != "":
+				fragment, ok := e.fragments[s.spread]
+				if !ok {
+					return fmt.Errorf("unknown fragment %q", s.spread)
+				}
+				if visiting[s.spread] {
+					return fmt.Errorf("fragment %q spreads itself", s.spread)
+				}
+				if visiting == nil {
+					visiting = make(map[string]bool)
+				}
+				visiting[s.spread] = true
+				if err := add(fragment); err != nil {
+					return err
+				}
+				delete(visiting, s.spread)
+			default:
+				if err := add(s.inline); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return fields, add(selections)
+}
+
+// gqlLeaf reports whether values of t are returned whole rather than
+// selected from.
+func gqlLeaf(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		return t == timeType || t.Implements(reflect.TypeFor[json.Marshaler]())
+	case reflect.Slice, reflect.Array:
+		return t.Elem().Kind() == reflect.Uint8 || gqlLeaf(t.Elem())
+	}
+	return true
+}
+
+func gqlTypeName(t reflect.Type) string {
+	if name, ok := gqlTypeNames[t]; ok {
+		return name
+	}
+	if t.Kind() == reflect.Slice {
+		return "[" + gqlTypeName(t.Elem()) + "]"
+	}
+	if t.Name() == "" {
+		return t.Kind().String()
+	}
+	return t.Name()
+}
+
+// gqlFieldIndex finds the field of a struct whose JSON name is name,
+// ignoring case.
+func gqlFieldIndex(t reflect.Type, name string) ([]int, bool) {
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous && f.Tag.Get("json") == "" && f.Type.Kind() == reflect.Struct {
+			continue
+		}
+		// Skip fields promoted from unexported embedded structs, whose
+		// values reflection won't hand out.
+		exported, parent := true, t
+		for _, i := range f.Index[:len(f.Index)-1] {
+			embedded := parent.Field(i)
+			exported, parent = exported && embedded.IsExported(), embedded.Type
+		}
+		tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !exported || tag == "-" {
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		if strings.EqualFold(tag, name) {
+			return f.Index, true
+		}
+	}
+	return nil, false
+}
+
+// gqlObject is a result object, keeping its fields in the query's order.
+type gqlObject []gqlEntry
+
+type gqlEntry struct {
+	key   string
+	value any
+}
+
+func (o gqlObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, entry := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(entry.key)
+		value, err := json.Marshal(entry.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Parsed GraphQL documents.
+type (
+	gqlDocument struct {
+		operations []*gqlOperation
+		fragments  map[string][]gqlSelection
+	}
+	gqlOperation struct {
+		name       string
+		variables  []gqlVariableDef
+		selections []gqlSelection
+	}
+	gqlVariableDef struct {
+		name                 string
+		required, hasDefault bool
+		value                any
+	}
+	// gqlSelection is a field, a fragment spread or an inline fragment.
+	gqlSelection struct {
+		field  *gqlField
+		spread string
+		inline []gqlSelection
+	}
+	gqlField struct {
+		alias, name string
+		args        map[string]any
+		selections  []gqlSelection
+	}
+	// gqlVariable is a reference to a variable in an argument.
+	gqlVariable string
+)
+
+// key is the name of the field in the response.
+func (f *gqlField) key() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+// substitute replaces the variables in an argument value.
+func substitute(v any, vars map[string]any) (any, error) {
+	switch v := v.(type) {
+	case gqlVariable:
+		value, ok := vars[string(v)]
+		if !ok {
+			return nil, fmt.Errorf("variable $%s is not defined", v)
+		}
+		return value, nil
+	case []any:
+		list := make([]any, len(v))
+		for i, item := range v {
+			var err error
+			if list[i], err = substitute(item, vars); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case map[string]any:
+		obj := make(map[string]any, len(v))
+		for k, item := range v {
+			var err error
+			if obj[k], err = substitute(item, vars); err != nil {
+				return nil, err
+			}
+		}
+		return obj, nil
+	}
+	return v, nil
+}
+
+// Token kinds of the GraphQL lexer.
+const (
+	gqlEOF = iota
+	gqlPunct
+	gqlName
+	gqlInt
+	gqlFloat
+	gqlString
+)
+
+type gqlToken struct {
+	kind int
+	text string
+	pos  int
+}
+
+// gqlParser parses the executable subset of GraphQL documents.
+type gqlParser struct {
+	src string
+	pos int
+	tok gqlToken
+	// depth is the nesting of the selection set, value or type being
+	// parsed.
+	depth int
+}
+
+func parseGraphQL(src string) (*gqlDocument, error) {
+	p := &gqlParser{src: src}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	doc := &gqlDocument{fragments: make(map[string][]gqlSelection)}
+	for p.tok.kind != gqlEOF {
+		switch {
+		case p.is(gqlPunct, "{"):
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &gqlOperation{selections: selections})
+		case p.is(gqlName, "query"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		case p.is(gqlName, "mutation"), p.is(gqlName, "subscription"):
+			return nil, fmt.Errorf("only queries are supported")
+		case p.is(gqlName, "fragment"):
+			if err := p.fragment(doc); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, p.unexpected("an operation or fragment")
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, fmt.Errorf("the document has no query")
+	}
+	return doc, nil
+}
+
+func (p *gqlParser) operation() (*gqlOperation, error) {
+	op := &gqlOperation{}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == gqlName {
+		op.name = p.tok.text
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	if p.is(gqlPunct, "(") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		for !p.is(gqlPunct, ")") {
+			def, err := p.variableDef()
+			if err != nil {
+				return nil, err
+			}
+			op.variables = append(op.variables, def)
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	var err error
+	op.selections, err = p.selectionSet()
+	return op, err
+}
+
+func (p *gqlParser) variableDef() (gqlVariableDef, error) {
+	var def gqlVariableDef
+	if err := p.expect(gqlPunct, "$"); err != nil {
+		return def, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return def, err
+	}
+	def.name = name
+	if err := p.expect(gqlPunct, ":"); err != nil {
+		return def, err
+	}
+	if def.required, err = p.typeRef(); err != nil {
+		return def, err
+	}
+	if p.is(gqlPunct, "=") {
+		if err := p.next(); err != nil {
+			return def, err
+		}
+		def.hasDefault = true
+		if def.value, err = p.value(true); err != nil {
+			return def, err
+		}
+	}
+	return def, nil
+}
+
+// typeRef skips a type, reporting whether it is non-null.
+func (p *gqlParser) typeRef() (bool, error) {
+	if err := p.enter(); err != nil {
+		return false, err
+	}
+	defer p.leave()
+	if p.is(gqlPunct, "[") {
+		if err := p.next(); err != nil {
+			return false, err
+		}
+		if _, err := p.typeRef(); err != nil {
+			return false, err
+		}
+		if err := p.expect(gqlPunct, "]"); err != nil {
+			return false, err
+		}
+	} else if _, err := p.name(); err != nil {
+		return false, err
+	}
+	if p.is(gqlPunct, "!") {
+		return true, p.next()
+	}
+	return false, nil
+}
+
+func (p *gqlParser) fragment(doc *gqlDocument) error {
+	if err := p.next(); err != nil {
+		return err
+	}
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	if !p.is(gqlName, "on") {
+		return p.unexpected(`"on"`)
+	}
+	if err := p.next(); err != nil {
+		return err
+	}
+	if _, err := p.name(); err != nil {
+		return err
+	}
+	if _, ok := doc.fragments[name]; ok {
+		return fmt.Errorf("fragment %q is defined twice", name)
+	}
+	doc.fragments[name], err = p.selectionSet()
+	return err
+}
+
+func (p *gqlParser) selectionSet() ([]gqlSelection, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	if err := p.expect(gqlPunct, "{"); err != nil {
+		return nil, err
+	}
+	var selections []gqlSelection
+	for !p.is(gqlPunct, "}") {
+		s, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, s)
+	}
+	if len(selections) == 0 {
+		return nil, p.unexpected("a field")
+	}
+	return selections, p.next()
+}
+
+func (p *gqlParser) selection() (gqlSelection, error) {
+	if p.is(gqlPunct, "@") {
+		return gqlSelection{}, fmt.Errorf("directives are not supported")
+	}
+	if p.is(gqlPunct, "...") {
+		if err := p.next(); err != nil {
+			return gqlSelection{}, err
+		}
+		if p.tok.kind == gqlName && p.tok.text != "on" {
+			name := p.tok.text
+			return gqlSelection{spread: name}, p.next()
+		}
+		// Inline fragment; the schema has no interfaces or unions, so
+		// the type condition is irrelevant.
+		if p.is(gqlName, "on") {
+			if err := p.next(); err != nil {
+				return gqlSelection{}, err
+			}
+			if _, err := p.name(); err != nil {
+				return gqlSelection{}, err
+			}
+		}
+		inline, err := p.selectionSet()
+		return gqlSelection{inline: inline}, err
+	}
+
+	f := &gqlField{}
+	name, err := p.name()
+	if err != nil {
+		return gqlSelection{}, err
+	}
+	f.name = name
+	if p.is(gqlPunct, ":") {
+		if err := p.next(); err != nil {
+			return gqlSelection{}, err
+		}
+		f.alias = name
+		if f.name, err = p.name(); err != nil {
+			return gqlSelection{}, err
+		}
+	}
+	if p.is(gqlPunct, "(") {
+		if err := p.next(); err != nil {
+			return gqlSelection{}, err
+		}
+		f.args = make(map[string]any)
+		for !p.is(gqlPunct, ")") {
+			name, err := p.name()
+			if err != nil {
+				return gqlSelection{}, err
+			}
+			if err := p.expect(gqlPunct, ":"); err != nil {
+				return gqlSelection{}, err
+			}
+			if f.args[name], err = p.value(false); err != nil {
+				return gqlSelection{}, err
+			}
+		}
+		if err := p.next(); err != nil {
+			return gqlSelection{}, err
+		}
+	}
+	if p.is(gqlPunct, "@") {
+		return gqlSelection{}, fmt.Errorf("directives are not supported")
+	}
+	if p.is(gqlPunct, "{") {
+		if f.selections, err = p.selectionSet(); err != nil {
+			return gqlSelection{}, err
+		}
+	}
+	return gqlSelection{field: f}, nil
+}
+
+// value parses an argument value. Enum values are returned as strings.
+func (p *gqlParser) value(constant bool) (any, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	tok := p.tok
+	switch {
+	case !constant && p.is(gqlPunct, "$"):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return gqlVariable(name), err
+	case tok.kind == gqlInt:
+		n, err := strconv.ParseInt(tok.text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %s", tok.text)
+		}
+		return n, p.next()
+	case tok.kind == gqlFloat:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", tok.text)
+		}
+		return f, p.next()
+	case tok.kind == gqlString:
+		return tok.text, p.next()
+	case tok.kind == gqlName:
+		var v any = tok.text
+		switch tok.text {
+		case "true", "false":
+			v = tok.text == "true"
+		case "null":
+			v = nil
+		}
+		return v, p.next()
+	case p.is(gqlPunct, "["):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		list := []any{}
+		for !p.is(gqlPunct, "]") {
+			item, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		return list, p.next()
+	case p.is(gqlPunct, "{"):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		obj := make(map[string]any)
+		for !p.is(gqlPunct, "}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(gqlPunct, ":"); err != nil {
+				return nil, err
+			}
+			if obj[name], err = p.value(constant); err != nil {
+				return nil, err
+			}
+		}
+		return obj, p.next()
+	}
+	return nil, p.unexpected("a value")
+}
+
+// enter descends into a nested selection set, value or type, failing past
+// maxGraphQLDepth; leave returns from it.
+func (p *gqlParser) enter() error {
+	if p.depth++; p.depth > maxGraphQLDepth {
+		return fmt.Errorf("the query is nested more than %d levels deep", maxGraphQLDepth)
+	}
+	return nil
+}
+
+func (p *gqlParser) leave() { p.depth-- }
+
+func (p *gqlParser) is(kind int, text string) bool {
+	return p.tok.kind == kind && p.tok.text == text
+}
+
+func (p *gqlParser) expect(kind int, text string) error {
+	if !p.is(kind, text) {
+		return p.unexpected(strconv.Quote(text))
+	}
+	return p.next()
+}
+
+func (p *gqlParser) name() (string, error) {
+	if p.tok.kind != gqlName {
+		return "", p.unexpected("a name")
+	}
+	name := p.tok.text
+	return name, p.next()
+}
+
+func (p *gqlParser) unexpected(want string) error {
+	found := strconv.Quote(p.tok.text)
+	if p.tok.kind == gqlEOF {
+		found = "end of query"
+	}
+	line := 1 + strings.Count(p.src[:p.tok.pos], "\n")
+	col := p.tok.pos - strings.LastIndex(p.src[:p.tok.pos], "\n")
+	return fmt.Errorf("syntax error at %d:%d: expected %s, found %s", line, col, want, found)
+}
+
+// next reads the next token. Commas are insignificant in GraphQL and
+// skipped like whitespace.
+func (p *gqlParser) next() error {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' && p.src[p.pos] != '\r' {
+				p.pos++
+			}
+			continue
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' && c != ',' {
+			break
+		}
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.src) {
+		p.tok = gqlToken{kind: gqlEOF, pos: start}
+		return nil
+	}
+
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		p.tok = gqlToken{gqlPunct, "...", start}
+	case strings.IndexByte("!$():=@[]{}|", c) >= 0:
+		p.pos++
+		p.tok = gqlToken{gqlPunct, string(c), start}
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		for p.pos < len(p.src) && isNameChar(p.src[p.pos]) {
+			p.pos++
+		}
+		p.tok = gqlToken{gqlName, p.src[start:p.pos], start}
+	case c == '-' || c >= '0' && c <= '9':
+		kind := gqlInt
+		p.pos++
+		for p.pos < len(p.src) {
+			c := p.src[p.pos]
+			if c == '.' || c == 'e' || c == 'E' || (c == '+' || c == '-') && kind == gqlFloat {
+				kind = gqlFloat
+			} else if c < '0' || c > '9' {
+				break
+			}
+			p.pos++
+		}
+		p.tok = gqlToken{kind, p.src[start:p.pos], start}
+	case c == '"':
+		s, err := p.string()
+		if err != nil {
+			return err
+		}
+		p.tok = gqlToken{gqlString, s, start}
+	default:
+		r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+		return fmt.Errorf("syntax error at offset %d: unexpected character %q", start, r)
+	}
+	return nil
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// string reads a string or block string literal.
+func (p *gqlParser) string() (string, error) {
+	if strings.HasPrefix(p.src[p.pos:], `"""`) {
+		end := strings.Index(p.src[p.pos+3:], `"""`)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated block string")
+		}
+		s := p.src[p.pos+3 : p.pos+3+end]
+		p.pos += end + 6
+		return strings.TrimSpace(s), nil
+	}
+	var b strings.Builder
+	for i := p.pos + 1; i < len(p.src); i++ {
+		c := p.src[i]
+		switch {
+		case c == '"':
+			p.pos = i + 1
+			return b.String(), nil
+		case c == '\n' || c == '\r':
+			return "", fmt.Errorf("unterminated string")
+		case c == '\\' && i+1 < len(p.src):
+			i++
+			switch e := p.src[i]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'u':
+				if i+4 >= len(p.src) {
+					return "", fmt.Errorf("invalid unicode escape")
+				}
+				r, err := strconv.ParseUint(p.src[i+1:i+5], 16, 32)
+				if err != nil {
+					return "", fmt.Errorf("invalid unicode escape")
+				}
+				b.WriteRune(rune(r))
+				i += 4
+			case '"', '\\', '/':
+				b.WriteByte(e)
+			default:
+				return "", fmt.Errorf("invalid escape \\%c", e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unterminated string")
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseGraphQL(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  *gqlDocument
+	}{
+		{
+			name:  "shorthand",
+			query: "{ pods { name } }",
+			want: &gqlDocument{
+				operations: []*gqlOperation{{selections: []gqlSelection{
+					{field: &gqlField{name: "pods", selections: []gqlSelection{{field: &gqlField{name: "name"}}}}},
+				}}},
+				fragments: map[string][]gqlSelection{},
+			},
+		},
+		{
+			name: "operation with variables, aliases and arguments",
+			query: `query Ready($ns: String! = "default", $limit: Int) {
+				# Comments and commas are ignored.
+				ready: pods(namespace: $ns, ready: "true", limit: $limit, sort: name, filter: {in: [1, -2.5e1, null, true]}) { name, }
+			}`,
+			want: &gqlDocument{
+				operations: []*gqlOperation{{
+					name: "Ready",
+					variables: []gqlVariableDef{
+						{name: "ns", required: true, hasDefault: true, value: "default"},
+						{name: "limit"},
+					},
+					selections: []gqlSelection{{field: &gqlField{
+						alias: "ready", name: "pods",
+						args: map[string]any{
+							"namespace": gqlVariable("ns"), "ready": "true", "limit": gqlVariable("limit"), "sort": "name",
+							"filter": map[string]any{"in": []any{int64(1), -25.0, nil, true}},
+						},
+						selections: []gqlSelection{{field: &gqlField{name: "name"}}},
+					}}},
+				}},
+				fragments: map[string][]gqlSelection{},
+			},
+		},
+		{
+			name:  "fragments",
+			query: `{ pods { ...names ... on Pod { node } } } fragment names on Pod { name namespace }`,
+			want: &gqlDocument{
+				operations: []*gqlOperation{{selections: []gqlSelection{
+					{field: &gqlField{name: "pods", selections: []gqlSelection{
+						{spread: "names"},
+						{inline: []gqlSelection{{field: &gqlField{name: "node"}}}},
+					}}},
+				}}},
+				fragments: map[string][]gqlSelection{
+					"names": {{field: &gqlField{name: "name"}}, {field: &gqlField{name: "namespace"}}},
+				},
+			},
+		},
+		{
+			name:  "strings",
+			query: `{ pod(name: "a\"bé\n", namespace: """  block "quoted"  """) { name } }`,
+			want: &gqlDocument{
+				operations: []*gqlOperation{{selections: []gqlSelection{
+					{field: &gqlField{
+						name:       "pod",
+						args:       map[string]any{"name": "a\"bé\n", "namespace": `block "quoted"`},
+						selections: []gqlSelection{{field: &gqlField{name: "name"}}},
+					}},
+				}}},
+				fragments: map[string][]gqlSelection{},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseGraphQL(tt.query)
+			if err != nil {
+				t.Fatalf("parseGraphQL() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseGraphQL() = %s, want %s", dumpGraphQL(got), dumpGraphQL(tt.want))
+			}
+		})
+	}
+}
+
+// dumpGraphQL formats a parsed document for failure messages.
+func dumpGraphQL(doc *gqlDocument) string {
+	var b strings.Builder
+	for _, op := range doc.operations {
+		fmt.Fprintf(&b, "op %q %+v %s; ", op.name, op.variables, dumpSelections(op.selections))
+	}
+	for name, fragment := range doc.fragments {
+		fmt.Fprintf(&b, "fragment %s %s; ", name, dumpSelections(fragment))
+	}
+	return b.String()
+}
+
+func dumpSelections(selections []gqlSelection) string {
+	parts := make([]string, len(selections))
+	for i, s := range selections {
+		switch {
+		case s.field != nil:
+			parts[i] = fmt.Sprintf("%s:%s%v%s", s.field.alias, s.field.name, s.field.args, dumpSelections(s.field.selections))
+		case s.spread != "":
+			parts[i] = "..." + s.spread
+		default:
+			parts[i] = "..." + dumpSelections(s.inline)
+		}
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
+
+func TestParseGraphQLErrors(t *testing.T) {
+	tests := []struct {
+		name, query, wantErr string
+	}{
+		{"empty selection", "{ }", "expected a field"},
+		{"unclosed", "{ pods { name }", "found end of query"},
+		{"missing argument value", "{ pods(limit:) { name } }", "expected a value"},
+		{"mutation", "mutation { pods { name } }", "only queries are supported"},
+		{"directive", "{ pods @skip(if: true) { name } }", "directives are not supported"},
+		{"duplicate fragment", "{ pods { ...a } } fragment a on Pod { name } fragment a on Pod { node }", `fragment "a" is defined twice`},
+		{"fragment without type", "{ pods { ...a } } fragment a { name }", `expected "on"`},
+		{"only fragments", "fragment a on Pod { name }", "the document has no query"},
+		{"unterminated string", `{ pod(name: "web) { name } }`, "unterminated string"},
+		{"invalid escape", `{ pod(name: "\q") { name } }`, `invalid escape \q`},
+		{"unexpected character", "{ pods { name ? } }", "unexpected character '?'"},
+		{"nested selections", "{ a" + strings.Repeat(" { a", maxGraphQLDepth) + strings.Repeat(" }", maxGraphQLDepth+1), "nested more than"},
+		{"nested values", "{ pods(a: " + strings.Repeat("[", maxGraphQLDepth) + strings.Repeat("]", maxGraphQLDepth) + ") { name } }", "nested more than"},
+		{"nested types", "query($a: " + strings.Repeat("[", 2*maxGraphQLDepth) + "Int" + strings.Repeat("]", 2*maxGraphQLDepth) + ") { pods { name } }", "nested more than"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseGraphQL(tt.query)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseGraphQL() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExecuteGraphQL(t *testing.T) {
+	d, _ := newTestDashboard(t, testPods(3)...)
+	tests := []struct {
+		name    string
+		req     GraphQLRequest
+		want    string
+		wantErr string
+	}{
+		{
+			name: "aliases and arguments",
+			req:  GraphQLRequest{Query: `{ first: pods(sort: "name", limit: 1) { name } others: pods(namespace: "other") { namespace } }`},
+			want: `{"first":[{"name":"probe-demo-00000000-00000"}],"others":[{"namespace":"other"}]}`,
+		},
+		{
+			name: "fragments and variables",
+			req: GraphQLRequest{
+				Query:     `query($ns: String) { pods(namespace: $ns, sort: "-name") { ...id __typename } } fragment id on Pod { name namespace }`,
+				Variables: map[string]any{"ns": "default"},
+			},
+			want: `{"pods":[{"name":"probe-demo-00000000-00002","namespace":"default","__typename":"Pod"},{"name":"probe-demo-00000000-00000","namespace":"default","__typename":"Pod"}]}`,
+		},
+		{
+			name: "pod by name",
+			req:  GraphQLRequest{Query: `{ pod(name: "probe-demo-00000000-00001") { namespace } }`},
+			want: `{"pod":{"namespace":"other"}}`,
+		},
+		{
+			name:    "unknown field",
+			req:     GraphQLRequest{Query: `{ pods { size } }`},
+			wantErr: `cannot query field "size" on type Pod`,
+		},
+		{
+			name:    "missing variable",
+			req:     GraphQLRequest{Query: `query($ns: String!) { pods(namespace: $ns) { name } }`},
+			wantErr: "variable $ns is required",
+		},
+		{
+			name:    "fragment cycle",
+			req:     GraphQLRequest{Query: `{ pods { ...a } } fragment a on Pod { name ...b } fragment b on Pod { ...a }`},
+			wantErr: `fragment "a" spreads itself`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := d.executeGraphQL(tt.req)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("executeGraphQL() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("executeGraphQL() error = %v", err)
+			}
+			got, _ := json.Marshal(data)
+			if string(got) != tt.want {
+				t.Errorf("executeGraphQL() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	d, _ := newTestDashboard(t, testPods(120)...)
+	fields := func(n int, field string) string {
+		aliases := make([]string, n)
+		for i := range aliases {
+			aliases[i] = fmt.Sprintf("a%d: %s", i, field)
+		}
+		return strings.Join(aliases, " ")
+	}
+	tests := []struct {
+		name    string
+		query   string
+		wantErr string
+	}{
+		{
+			name:  "within the limits",
+			query: "{ pods(limit: 50) { " + fields(maxGraphQLFields-1, "name") + " } }",
+		},
+		{
+			name:    "alias fan-out",
+			query:   "{ " + fields(maxGraphQLFields+1, "pods { name }") + " }",
+			wantErr: "selects more than",
+		},
+		{
+			name:    "fragment fan-out",
+			query:   "{ pods { ...f1 } } " + fragmentChain(12),
+			wantErr: "selects more than",
+		},
+		{
+			name:    "nested through fragments",
+			query:   "{ ...q } fragment q on Query { pods { ...p } } fragment p on Pod { info" + strings.Repeat(" { a", maxGraphQLDepth) + strings.Repeat(" }", maxGraphQLDepth+1),
+			wantErr: "nested more than",
+		},
+		{
+			name:    "list fan-out",
+			query:   "{ pods { " + fields(450, "name") + " } }",
+			wantErr: "resolves more than",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := d.executeGraphQL(GraphQLRequest{Query: tt.query})
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("executeGraphQL() error = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("executeGraphQL() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// fragmentChain returns n fragments f1 to fn each spreading the next twice,
+// which select 2^n fields in all.
+func fragmentChain(n int) string {
+	var b strings.Builder
+	for i := 1; i < n; i++ {
+		fmt.Fprintf(&b, "fragment f%d on Pod { ...f%d ...f%d } ", i, i+1, i+1)
+	}
+	fmt.Fprintf(&b, "fragment f%d on Pod { name }", n)
+	return b.String()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Protocols spoken to the monitored pods.
+const (
+	// ProtocolHTTP scrapes the JSON info endpoint at the target path.
+	ProtocolHTTP = "http"
+	// ProtocolGRPC calls grpc.health.v1.Health/Check on the target port.
+	ProtocolGRPC = "grpc"
+)
+
+// getGRPCPodInfo builds the pod's info from the gRPC health service. The
+// health protocol only reports whether the server is serving, so an answer
+// of any kind means started and live, and SERVING means ready. The rest of
+// the info comes from the pod object.
+func (d *Dashboard) getGRPCPodInfo(ctx context.Context, pod *corev1.Pod, target scrapeTarget, cfg Config) (*PodInfo, error) {
+	if cfg.AccessMode == AccessProxy {
+		return nil, &fetchError{ErrorKindConnection, errNeedsDirectAccess}
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.FetchTimeout)
+	defer cancel()
+
+	ip := podIP(pod, cfg.IPFamily)
+	addr := net.JoinHostPort(ip, strconv.Itoa(target.Port))
+	serving, err := grpcHealthCheck(ctx, addr, target.GRPCService)
+	if err != nil {
+		kind := ErrorKindGRPC
+		if code := status.Code(err); code == codes.Unavailable || code == codes.DeadlineExceeded {
+			kind = ErrorKindConnection
+		}
+		return nil, &fetchError{kind, fmt.Errorf("health check failed: %v", err)}
+	}
+
+	info := &PodInfo{
+		PodName:      pod.Name,
+		PodIP:        ip,
+		NodeHostname: pod.Spec.NodeName,
+		ProbeStatus: ProbeStatus{
+			Started: true,
+			Live:    true,
+			Ready:   serving == healthpb.HealthCheckResponse_SERVING,
+		},
+	}
+	if _, started := monitoredContainer(pod); !started.IsZero() {
+		info.StartTime = started.Format(time.RFC3339)
+		info.ContainerAge = time.Since(started).Nanoseconds()
+	}
+	return info, nil
+}
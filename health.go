@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// readyzTimeout bounds the Kubernetes API check of /readyz.
+const readyzTimeout = 2 * time.Second
+
+// handleHealthz serves /healthz. Answering at all shows the process is alive.
+func (d *Dashboard) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReadyz serves /readyz. The dashboard is ready once the pod informer
+// completed its initial list, the first scrape cycle has completed and the
+// Kubernetes API server is reachable, for every monitored cluster.
+func (d *Dashboard) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	for _, c := range d.clusters() {
+		if err := c.ready(r.Context()); err != nil {
+			if c.cluster != "" {
+				err = fmt.Errorf("cluster %s: %v", c.cluster, err)
+			}
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (d *Dashboard) ready(ctx context.Context) error {
+	if watch := d.currentWatch(); watch == nil || !watch.hasSynced() {
+		return fmt.Errorf("pod informer has not synced")
+	}
+	if !d.isLoaded() {
+		return fmt.Errorf("first scrape cycle has not completed")
+	}
+
+	if err := d.pingAPI(ctx); err != nil {
+		return fmt.Errorf("kubernetes API unreachable: %v", err)
+	}
+	return nil
+}
+
+// markLoaded records that the first scrape cycle has completed.
+func (d *Dashboard) markLoaded() {
+	d.loadedOnce.Do(func() { close(d.loaded) })
+}
+
+// isLoaded reports whether the first scrape cycle has completed.
+func (d *Dashboard) isLoaded() bool {
+	select {
+	case <-d.loaded:
+		return true
+	default:
+		return false
+	}
+}
+
+// allLoaded reports whether every cluster completed its first scrape cycle.
+func (d *Dashboard) allLoaded() bool {
+	for _, c := range d.clusters() {
+		if !c.isLoaded() {
+			return false
+		}
+	}
+	return true
+}
+
+// handleLoading serves the loading page in place of the dashboard until
+// the first scrape cycle completes. It refreshes itself, and the 503 keeps
+// crawlers and uptime checks from taking it for the dashboard.
+func (d *Dashboard) handleLoading(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Retry-After", "2")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	data := struct{ Version string }{Version}
+	if err := d.template().ExecuteTemplate(w, loadingTemplate, data); err != nil {
+		slog.Error("Failed to render the loading page", "error", err)
+	}
+}
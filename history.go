@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// historySize is the number of transitions kept per pod.
+const historySize = 256
+
+// ProbeTransition records a flip of one of the probe flags a pod reports.
+type ProbeTransition struct {
+	Probe string    `json:"probe"`
+	From  bool      `json:"from"`
+	To    bool      `json:"to"`
+	Time  time.Time `json:"time"`
+}
+
+// probeTransitions compares two scrape results of a pod. Nothing is reported
+// unless both scrapes succeeded.
+func probeTransitions(prev, cur *PodInfo, at time.Time) []ProbeTransition {
+	if prev == nil || cur == nil {
+		return nil
+	}
+	var out []ProbeTransition
+	check := func(probe string, from, to bool) {
+		if from != to {
+			out = append(out, ProbeTransition{Probe: probe, From: from, To: to, Time: at})
+		}
+	}
+	check("started", prev.ProbeStatus.Started, cur.ProbeStatus.Started)
+	check("live", prev.ProbeStatus.Live, cur.ProbeStatus.Live)
+	check("ready", prev.ProbeStatus.Ready, cur.ProbeStatus.Ready)
+	return out
+}
+
+// HistoryEntry is one recorded probe transition. PreviousStateSeconds is how
+// long the probe held its previous value, measured from the previous
+// transition or from when the pod was first observed. Pod lifecycle events
+// are recorded as entries with Event and Detail set instead of the probe.
+type HistoryEntry struct {
+	ProbeTransition
+	PreviousStateSeconds float64 `json:"previousStateSeconds"`
+	Event                string  `json:"event,omitempty"`
+	Detail               string  `json:"detail,omitempty"`
+}
+
+// podHistory is a fixed-size ring buffer of one pod's transitions together
+// with the last probe state that was observed.
+type podHistory struct {
+	entries    []HistoryEntry
+	next       int
+	full       bool
+	last       *PodInfo
+	lastChange map[string]time.Time
+}
+
+func (h *podHistory) add(e HistoryEntry) {
+	if h.entries == nil {
+		h.entries = make([]HistoryEntry, historySize)
+	}
+	h.entries[h.next] = e
+	h.next = (h.next + 1) % historySize
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// list returns the entries oldest first.
+func (h *podHistory) list() []HistoryEntry {
+	if !h.full {
+		return append([]HistoryEntry(nil), h.entries[:h.next]...)
+	}
+	out := make([]HistoryEntry, 0, historySize)
+	out = append(out, h.entries[h.next:]...)
+	return append(out, h.entries[:h.next]...)
+}
+
+// historyStore keeps the in-memory transition history of every pod, by
+// podKey.
+type historyStore struct {
+	mu   sync.RWMutex
+	pods map[string]*podHistory
+}
+
+func newHistoryStore() *historyStore {
+	return &historyStore{pods: make(map[string]*podHistory)}
+}
+
+// observe compares a scrape result with the last successful one for the pod,
+// records any transitions and returns the new entries. Failed scrapes (nil info) are
+// skipped so a flip hidden behind an error is still caught afterwards.
+func (s *historyStore) observe(name string, info *PodInfo, now time.Time) []HistoryEntry {
+	if info == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h := s.pods[name]
+	if h == nil {
+		h = &podHistory{lastChange: map[string]time.Time{"started": now, "live": now, "ready": now}}
+		s.pods[name] = h
+	}
+
+	var entries []HistoryEntry
+	for _, t := range probeTransitions(h.last, info, now) {
+		e := HistoryEntry{
+			ProbeTransition:      t,
+			PreviousStateSeconds: now.Sub(h.lastChange[t.Probe]).Seconds(),
+		}
+		h.add(e)
+		h.lastChange[t.Probe] = now
+		entries = append(entries, e)
+	}
+	h.last = info
+	return entries
+}
+
+// restore seeds the ring buffers with transitions loaded from a Store, oldest
+// first. The last probe state is not restored, so the first scrape after a
+// restart only establishes a baseline.
+func (s *historyStore) restore(transitions []StoredTransition, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range transitions {
+		key := podKey(t.Namespace, t.Pod)
+		h := s.pods[key]
+		if h == nil {
+			h = &podHistory{lastChange: map[string]time.Time{"started": now, "live": now, "ready": now}}
+			s.pods[key] = h
+		}
+		h.add(t.HistoryEntry)
+		if t.Event == "" {
+			h.lastChange[t.Probe] = t.Time
+		}
+	}
+}
+
+// record adds lifecycle events to a pod's history.
+func (s *historyStore) record(name string, entries []HistoryEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := s.pods[name]
+	if h == nil {
+		now := entries[0].Time
+		h = &podHistory{lastChange: map[string]time.Time{"started": now, "live": now, "ready": now}}
+		s.pods[name] = h
+	}
+	for _, e := range entries {
+		h.add(e)
+	}
+}
+
+// rebase makes the next scrape of a replaced pod a new baseline, keeping the
+// recorded entries.
+func (s *historyStore) rebase(name string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if h := s.pods[name]; h != nil {
+		h.last = nil
+		h.lastChange = map[string]time.Time{"started": now, "live": now, "ready": now}
+	}
+}
+
+// get returns a pod's recorded transitions, oldest first.
+func (s *historyStore) get(name string) ([]HistoryEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, ok := s.pods[name]
+	if !ok {
+		return nil, false
+	}
+	return h.list(), true
+}
+
+// lastTransition returns when a pod's probes last changed, or when the pod
+// was first observed; now for pods not observed yet.
+func (s *historyStore) lastTransition(name string, now time.Time) time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, ok := s.pods[name]
+	if !ok {
+		return now
+	}
+	var last time.Time
+	for _, t := range h.lastChange {
+		if t.After(last) {
+			last = t
+		}
+	}
+	return last
+}
+
+func (s *historyStore) forget(name string) {
+	s.mu.Lock()
+	delete(s.pods, name)
+	s.mu.Unlock()
+}
+
+// HistoryResponse is the response of GET /api/pods/{name}/history.
+type HistoryResponse struct {
+	Pod         string         `json:"pod"`
+	Transitions []HistoryEntry `json:"transitions"`
+}
+
+// podHistory returns the transitions of the pod with key, reporting false
+// for pods without any.
+func (d *Dashboard) podHistory(key string) ([]HistoryEntry, bool, error) {
+	entries, ok := d.history.get(key)
+	if ok {
+		return entries, true, nil
+	}
+	// Pods that are gone may still have transitions in the store.
+	namespace, name := splitPodKey(key)
+	stored, err := d.store.Transitions(namespace, name, time.Time{}, time.Time{})
+	if err != nil {
+		return nil, false, err
+	}
+	for _, t := range stored {
+		entries = append(entries, t.HistoryEntry)
+	}
+	return entries, len(entries) > 0, nil
+}
+
+// handleHistory serves GET /api/pods/{name}/history.
+func (d *Dashboard) handleHistory(w http.ResponseWriter, r *http.Request) {
+	key, err := d.requestPodKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	entries, ok, err := d.podHistory(key)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read history: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Pod not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HistoryResponse{r.PathValue("name"), entries})
+}
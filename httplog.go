@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requestRoute returns the pattern of mux that r matches, without its
+// method, e.g. /api/pods/{name}/history.
+func requestRoute(mux *http.ServeMux, r *http.Request) string {
+	_, route := mux.Handler(r)
+	if _, path, ok := strings.Cut(route, " "); ok {
+		route = path
+	}
+	return route
+}
+
+// longLived are the routes whose requests last as long as the client stays
+// connected; their durations would drown the latency histogram.
+var longLived = map[string]bool{"/api/stream": true, "/ws": true}
+
+// observeRequests records every request's latency by route, method and
+// status code and, with LogRequests, logs it.
+func (d *Dashboard) observeRequests(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		took := time.Since(start)
+
+		route := requestRoute(mux, r)
+		if !longLived[route] {
+			d.metrics.httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Observe(took.Seconds())
+		}
+		if d.cfg().LogRequests {
+			client, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				client = r.RemoteAddr
+			}
+			args := []any{"method", r.Method, "path", r.URL.Path, "status", rec.status, "duration", took, "client", client}
+			if span := trace.SpanContextFromContext(r.Context()); span.IsValid() {
+				args = append(args, "trace", span.TraceID().String())
+			}
+			slog.Info("Request", args...)
+		}
+	})
+}
+
+// statusRecorder remembers the response status. It passes flushes and
+// hijacks through for the event stream and WebSockets.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("hijacking not supported")
+	}
+	return h.Hijack()
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
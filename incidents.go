@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultOpsgenieAPIURL is Opsgenie's US API; EU accounts use
+// https://api.eu.opsgenie.com.
+const DefaultOpsgenieAPIURL = "https://api.opsgenie.com"
+
+// pagerDutyEventsURL is the PagerDuty Events API v2 endpoint.
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// notificationSeverity returns the severity of an alert notification, or
+// fallback for state changes and alerts without one.
+func notificationSeverity(n Notification, fallback string) string {
+	if severity := n.Fields["severity"]; severity != "" {
+		return strings.ToLower(severity)
+	}
+	return fallback
+}
+
+// PagerDutyNotifier triggers and resolves PagerDuty incidents through the
+// Events API v2, deduplicated by the notification key. Notifications
+// without a key are skipped.
+type PagerDutyNotifier struct {
+	RoutingKey string
+	// URL overrides the Events API endpoint.
+	URL    string
+	Client *http.Client
+}
+
+func (p *PagerDutyNotifier) Name() string { return "pagerduty" }
+
+func (p *PagerDutyNotifier) Notify(ctx context.Context, n Notification) error {
+	if n.Key == "" {
+		return nil
+	}
+	event := map[string]any{
+		"routing_key":  p.RoutingKey,
+		"event_action": "trigger",
+		"dedup_key":    n.Key,
+	}
+	if n.Resolved {
+		event["event_action"] = "resolve"
+	} else {
+		// PagerDuty only accepts these severities.
+		severity := notificationSeverity(n, "error")
+		switch severity {
+		case "critical", "error", "warning", "info":
+		default:
+			severity = "error"
+		}
+		source := n.Fields["pod"]
+		if source == "" {
+			source = n.Fields["subject"]
+		}
+		event["payload"] = map[string]any{
+			"summary":        truncate(n.Title+": "+n.Text, 1024),
+			"source":         source,
+			"severity":       severity,
+			"timestamp":      n.Time,
+			"component":      n.Fields["namespace"],
+			"class":          n.Kind,
+			"custom_details": n.Fields,
+		}
+	}
+	u := p.URL
+	if u == "" {
+		u = pagerDutyEventsURL
+	}
+	return postJSON(ctx, p.Client, u, event)
+}
+
+// OpsgenieNotifier creates Opsgenie alerts and closes them on recovery,
+// using the notification key as the alert alias. Notifications without a key
+// are skipped.
+type OpsgenieNotifier struct {
+	APIKey string
+	APIURL string
+	Client *http.Client
+}
+
+func (o *OpsgenieNotifier) Name() string { return "opsgenie" }
+
+func (o *OpsgenieNotifier) Notify(ctx context.Context, n Notification) error {
+	if n.Key == "" {
+		return nil
+	}
+	base := strings.TrimSuffix(o.APIURL, "/")
+	if base == "" {
+		base = DefaultOpsgenieAPIURL
+	}
+	header := http.Header{"Authorization": {"GenieKey " + o.APIKey}}
+	// Opsgenie limits aliases to 512 characters.
+	alias := truncate(n.Key, 512)
+	if n.Resolved {
+		closeURL := fmt.Sprintf("%s/v2/alerts/%s/close?identifierType=alias", base, url.PathEscape(alias))
+		return postJSONHeader(ctx, o.Client, closeURL, header, map[string]string{
+			"source": "k8s-probe-monitor",
+			"note":   n.Text,
+		})
+	}
+	priority := map[string]string{"critical": "P1", "error": "P2", "warning": "P3", "info": "P5"}[notificationSeverity(n, "warning")]
+	if priority == "" {
+		priority = "P3"
+	}
+	return postJSONHeader(ctx, o.Client, base+"/v2/alerts", header, map[string]any{
+		"message":     truncate(n.Title, 130),
+		"alias":       alias,
+		"description": truncate(n.Text, 15000),
+		"details":     n.Fields,
+		"priority":    priority,
+		"source":      "k8s-probe-monitor",
+		"tags":        []string{"k8s-probe-monitor", n.Kind},
+	})
+}
+
+// truncate shortens s to at most n bytes without splitting a character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
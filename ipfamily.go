@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/netip"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// IP families selectable with --ip-family.
+const (
+	IPFamilyAny = ""
+	IPFamilyV4  = "IPv4"
+	IPFamilyV6  = "IPv6"
+)
+
+// podIP returns the pod IP to connect to: the first of the pod's IPs in the
+// preferred family, or its primary IP when it has none in that family.
+func podIP(pod *corev1.Pod, family string) string {
+	if family == IPFamilyAny {
+		return pod.Status.PodIP
+	}
+	for _, ip := range pod.Status.PodIPs {
+		addr, err := netip.ParseAddr(ip.IP)
+		if err != nil {
+			continue
+		}
+		if addr.Is4() == (family == IPFamilyV4) {
+			return ip.IP
+		}
+	}
+	return pod.Status.PodIP
+}
+
+// podIPs lists all IPs of a dual-stack pod; single-stack pods get nil.
+func podIPs(pod *corev1.Pod) []string {
+	if len(pod.Status.PodIPs) < 2 {
+		return nil
+	}
+	ips := make([]string, len(pod.Status.PodIPs))
+	for i, ip := range pod.Status.PodIPs {
+		ips[i] = ip.IP
+	}
+	return ips
+}
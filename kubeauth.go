@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// kubeAuthTTL is how long TokenReview and SubjectAccessReview results are
+// reused, sparing the API server a review per request. RBAC changes apply
+// after at most this long.
+const kubeAuthTTL = 30 * time.Second
+
+// kubeAuthCache remembers recent review results.
+type kubeAuthCache struct {
+	mu sync.Mutex
+	// users maps token hashes to the reviewed user, nil when the token was
+	// rejected; allowed maps users and resource attributes to decisions.
+	users   map[[sha256.Size]byte]kubeCached[*authenticationv1.UserInfo]
+	allowed map[string]kubeCached[bool]
+}
+
+type kubeCached[T any] struct {
+	value   T
+	expires time.Time
+}
+
+func newKubeAuthCache() *kubeAuthCache {
+	return &kubeAuthCache{
+		users:   make(map[[sha256.Size]byte]kubeCached[*authenticationv1.UserInfo]),
+		allowed: make(map[string]kubeCached[bool]),
+	}
+}
+
+// reviewToken validates a bearer token with a TokenReview by the API server
+// of d's cluster and returns its user, or nil when the server doesn't accept
+// it.
+func (d *Dashboard) reviewToken(ctx context.Context, token string) (*authenticationv1.UserInfo, error) {
+	key := sha256.Sum256([]byte(token))
+	c := d.kubeAuth
+	c.mu.Lock()
+	cached, ok := c.users[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.value, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.cfg().FetchTimeout)
+	defer cancel()
+	review, err := d.clientset.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("token review failed: %v", err)
+	}
+	var user *authenticationv1.UserInfo
+	if review.Status.Authenticated {
+		user = &review.Status.User
+	}
+
+	c.mu.Lock()
+	now := time.Now()
+	for k, v := range c.users {
+		if now.After(v.expires) {
+			delete(c.users, k)
+		}
+	}
+	c.users[key] = kubeCached[*authenticationv1.UserInfo]{user, now.Add(kubeAuthTTL)}
+	c.mu.Unlock()
+	return user, nil
+}
+
+// authorizeKube checks with SubjectAccessReviews by d's cluster, which must
+// be the one the request addresses, that user may do what a mutating request
+// does through the dashboard's service account: update the named pod for pod
+// endpoints, or the pods of every watched namespace (or all pods) for bulk
+// actions, chaos schedules and scaling. Node actions need patch on the node,
+// and a drain also the evictions of the pods.
+func (d *Dashboard) authorizeKube(r *http.Request, user *authenticationv1.UserInfo) (bool, error) {
+	namespaces := func(verb, resource, subresource string) []authorizationv1.ResourceAttributes {
+		attrs := authorizationv1.ResourceAttributes{Verb: verb, Resource: resource, Subresource: subresource}
+		nss := d.cfg().Namespaces
+		if len(nss) == 0 {
+			return []authorizationv1.ResourceAttributes{attrs}
+		}
+		checks := make([]authorizationv1.ResourceAttributes, 0, len(nss))
+		for _, ns := range nss {
+			attrs.Namespace = ns
+			checks = append(checks, attrs)
+		}
+		return checks
+	}
+
+	var checks []authorizationv1.ResourceAttributes
+	if node := r.PathValue("name"); node != "" && strings.HasPrefix(r.URL.Path, "/api/nodes/") {
+		checks = append(checks, authorizationv1.ResourceAttributes{Verb: "patch", Resource: "nodes", Name: node})
+		if strings.HasSuffix(r.URL.Path, "/drain") {
+			checks = append(checks, namespaces("create", "pods", "eviction")...)
+		}
+	} else if pod := d.requestPod(r); pod != nil {
+		checks = append(checks, authorizationv1.ResourceAttributes{Verb: "update", Resource: "pods", Namespace: pod.Namespace, Name: pod.Name})
+	} else {
+		checks = namespaces("update", "pods", "")
+	}
+
+	for _, attrs := range checks {
+		allowed, err := d.reviewAccess(r.Context(), user, attrs)
+		if err != nil || !allowed {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// requestPod returns the pod named by a /api/pods/{name}/... request in the
+// cluster it addresses, or nil for other requests.
+func (d *Dashboard) requestPod(r *http.Request) *PodStatusInfo {
+	name := r.PathValue("name")
+	if name == "" || !strings.HasPrefix(r.URL.Path, "/api/pods/") {
+		return nil
+	}
+	c := d.clusterNamed(r.URL.Query().Get("cluster"))
+	if c == nil {
+		return nil
+	}
+	key, err := c.requestPodKey(r)
+	if err != nil {
+		return nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.pods[key]
+}
+
+func (d *Dashboard) reviewAccess(ctx context.Context, user *authenticationv1.UserInfo, attrs authorizationv1.ResourceAttributes) (bool, error) {
+	key := strings.Join([]string{user.UID, user.Username, attrs.Verb, attrs.Resource, attrs.Subresource, attrs.Namespace, attrs.Name}, "\x00")
+	c := d.kubeAuth
+	c.mu.Lock()
+	cached, ok := c.allowed[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.value, nil
+	}
+
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	ctx, cancel := context.WithTimeout(ctx, d.cfg().FetchTimeout)
+	defer cancel()
+	review, err := d.clientset.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &attrs,
+			User:               user.Username,
+			Groups:             user.Groups,
+			UID:                user.UID,
+			Extra:              extra,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return false, fmt.Errorf("access review failed: %v", err)
+	}
+	if !review.Status.Allowed {
+		slog.Info("Access denied by RBAC", "user", user.Username, "verb", attrs.Verb, "resource", attrs.Resource, "subresource", attrs.Subresource,
+			"namespace", attrs.Namespace, "name", attrs.Name, "reason", review.Status.Reason)
+	}
+
+	c.mu.Lock()
+	now := time.Now()
+	for k, v := range c.allowed {
+		if now.After(v.expires) {
+			delete(c.allowed, k)
+		}
+	}
+	c.allowed[key] = kubeCached[bool]{review.Status.Allowed, now.Add(kubeAuthTTL)}
+	c.mu.Unlock()
+	return review.Status.Allowed, nil
+}
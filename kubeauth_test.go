@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// fakeKubeAuth makes clientset accept the tokens of users, which map tokens to
+// user names, and allow the users in allowed to update pods.
+func fakeKubeAuth(clientset *fake.Clientset, users map[string]string, allowed ...string) {
+	clientset.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, k8sruntime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		if user, ok := users[review.Spec.Token]; ok {
+			review.Status = authenticationv1.TokenReviewStatus{Authenticated: true, User: authenticationv1.UserInfo{Username: user}}
+		}
+		return true, review, nil
+	})
+	clientset.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, k8sruntime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		for _, user := range allowed {
+			if review.Spec.User == user && review.Spec.ResourceAttributes.Verb == "update" && review.Spec.ResourceAttributes.Resource == "pods" {
+				review.Status.Allowed = true
+			}
+		}
+		return true, review, nil
+	})
+}
+
+func TestKubeAuthByCluster(t *testing.T) {
+	// Alice may update pods in a only; bob is only known to b.
+	clientsetA, clientsetB := newTestClientset(testPods(1)...), newTestClientset(testPods(1)...)
+	fakeKubeAuth(clientsetA, map[string]string{"alice-token": "alice"}, "alice")
+	fakeKubeAuth(clientsetB, map[string]string{"alice-token": "alice", "bob-token": "bob"}, "bob")
+	a, b := startTestDashboard(t, clientsetA), startTestDashboard(t, clientsetB)
+	a.cluster, b.cluster = "a", "b"
+	a.peers = []*Dashboard{a, b}
+	b.peers = a.peers
+	for _, d := range a.peers {
+		d.cfgMu.Lock()
+		d.config.KubeAuth = true
+		d.cfgMu.Unlock()
+	}
+
+	// Authorized actions reach the fake target, which has no probe actions
+	// and answers 404, turned into 502.
+	tests := []struct {
+		name, token, cluster string
+		want                 int
+	}{
+		{name: "first cluster", token: "alice-token", want: http.StatusBadGateway},
+		{name: "allowed cluster", token: "alice-token", cluster: "a", want: http.StatusBadGateway},
+		{name: "denied cluster", token: "alice-token", cluster: "b", want: http.StatusForbidden},
+		{name: "user of the second cluster", token: "bob-token", cluster: "b", want: http.StatusBadGateway},
+		{name: "unknown to the cluster", token: "bob-token", cluster: "a", want: http.StatusUnauthorized},
+		{name: "unknown cluster", token: "alice-token", cluster: "c", want: http.StatusNotFound},
+	}
+	routes := a.routes()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := "/api/pods/" + testPods(1)[0].Name + "/probes/readiness/fail"
+			if tt.cluster != "" {
+				url += "?cluster=" + tt.cluster
+			}
+			req := httptest.NewRequest(http.MethodPost, url, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			routes.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("POST %s = %d %s, want %d", url, rec.Code, rec.Body, tt.want)
+			}
+		})
+	}
+}
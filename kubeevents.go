@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// kubeEventsSize is the number of Kubernetes events kept per pod.
+const kubeEventsSize = 50
+
+// kubeEventReasons are the event reasons that show how the kubelet reacts to
+// probe results.
+var kubeEventReasons = map[string]bool{
+	"Unhealthy":    true,
+	"ProbeWarning": true,
+	"Killing":      true,
+	"BackOff":      true,
+	"Started":      true,
+	"Failed":       true,
+}
+
+// KubeEvent is a Kubernetes event about a monitored pod.
+type KubeEvent struct {
+	UID       types.UID `json:"uid"`
+	Type      string    `json:"type"`
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message"`
+	Source    string    `json:"source,omitempty"`
+	Count     int32     `json:"count"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+func newKubeEvent(ev *corev1.Event) KubeEvent {
+	first, last := ev.FirstTimestamp.Time, ev.LastTimestamp.Time
+	if first.IsZero() {
+		first = ev.EventTime.Time
+	}
+	if last.IsZero() {
+		last = first
+	}
+	if first.IsZero() {
+		first = last
+	}
+	source := ev.Source.Component
+	if source == "" {
+		source = ev.ReportingController
+	}
+	count := ev.Count
+	if ev.Series != nil {
+		count = ev.Series.Count
+		last = ev.Series.LastObservedTime.Time
+	}
+	return KubeEvent{
+		UID:       ev.UID,
+		Type:      ev.Type,
+		Reason:    ev.Reason,
+		Message:   ev.Message,
+		Source:    source,
+		Count:     max(count, 1),
+		FirstSeen: first,
+		LastSeen:  last,
+	}
+}
+
+// kubeEventLog keeps the most recent probe-related events of every pod.
+type kubeEventLog struct {
+	mu   sync.RWMutex
+	pods map[string][]KubeEvent
+}
+
+func newKubeEventLog() *kubeEventLog {
+	return &kubeEventLog{pods: make(map[string][]KubeEvent)}
+}
+
+// add records an event, replacing an earlier version of it. Only the newest
+// kubeEventsSize events are kept.
+func (l *kubeEventLog) add(pod string, ev KubeEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	events := l.pods[pod]
+	replaced := false
+	for i := range events {
+		if events[i].UID == ev.UID {
+			events[i] = ev
+			replaced = true
+		}
+	}
+	if !replaced {
+		events = append(events, ev)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].LastSeen.Before(events[j].LastSeen)
+	})
+	if len(events) > kubeEventsSize {
+		events = events[len(events)-kubeEventsSize:]
+	}
+	l.pods[pod] = events
+}
+
+// get returns a pod's events, oldest first.
+func (l *kubeEventLog) get(pod string) []KubeEvent {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return append([]KubeEvent(nil), l.pods[pod]...)
+}
+
+func (l *kubeEventLog) forget(pod string) {
+	l.mu.Lock()
+	delete(l.pods, pod)
+	l.mu.Unlock()
+}
+
+// onKubeEvent records an event if it is about a pod of the watch w.
+func (d *Dashboard) onKubeEvent(w *podWatch, ev *corev1.Event) {
+	if w.ctx.Err() != nil || ev.InvolvedObject.Kind != "Pod" || !kubeEventReasons[ev.Reason] {
+		return
+	}
+	// Events outlive their pod; skip those of an earlier pod with the
+	// same name.
+	pod, err := w.get(ev.InvolvedObject.Namespace, ev.InvolvedObject.Name)
+	if err != nil || pod.UID != ev.InvolvedObject.UID {
+		return
+	}
+	d.kubeEvents.add(podKey(pod.Namespace, pod.Name), newKubeEvent(ev))
+}
+
+// KubeEventsResponse is the response of GET /api/pods/{name}/events.
+type KubeEventsResponse struct {
+	Pod    string      `json:"pod"`
+	Events []KubeEvent `json:"events"`
+}
+
+// handleKubeEvents serves GET /api/pods/{name}/events.
+func (d *Dashboard) handleKubeEvents(w http.ResponseWriter, r *http.Request) {
+	key, err := d.requestPodKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	d.mu.RLock()
+	_, known := d.pods[key]
+	d.mu.RUnlock()
+	if !known {
+		http.Error(w, "Pod not found", http.StatusNotFound)
+		return
+	}
+
+	events := d.kubeEvents.get(key)
+	if events == nil {
+		events = []KubeEvent{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(KubeEventsResponse{r.PathValue("name"), events})
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// KubeletStatus is what the kubelet has published in the pod status for the
+// monitored container. The kubelet doesn't publish liveness results; a failed
+// liveness probe only shows up as a restart.
+type KubeletStatus struct {
+	Started bool `json:"started"`
+	Ready   bool `json:"ready"`
+	// PodReady is the pod's Ready condition, which also accounts for the
+	// other containers and readiness gates.
+	PodReady      bool      `json:"podReady"`
+	PodReadySince time.Time `json:"podReadySince,omitempty"`
+	RestartCount  int32     `json:"restartCount"`
+	// LastTermination is how the previous instance of the container ended.
+	LastTermination *Termination `json:"lastTermination,omitempty"`
+}
+
+// Termination describes a terminated container, e.g. one killed after
+// failing its liveness probe or by the OOM killer.
+type Termination struct {
+	ExitCode   int32     `json:"exitCode"`
+	Signal     int32     `json:"signal,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+// kubeletStatus reads the kubelet's view of the monitored container from the
+// pod status, or returns nil when the container has no status yet.
+func kubeletStatus(pod *corev1.Pod) *KubeletStatus {
+	container, _ := monitoredContainer(pod)
+	if container == nil {
+		return nil
+	}
+
+	var status *KubeletStatus
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name == container.Name {
+			status = &KubeletStatus{
+				Started:      cs.Started != nil && *cs.Started,
+				Ready:        cs.Ready,
+				RestartCount: cs.RestartCount,
+			}
+			if t := cs.LastTerminationState.Terminated; t != nil {
+				status.LastTermination = &Termination{
+					ExitCode:   t.ExitCode,
+					Signal:     t.Signal,
+					Reason:     t.Reason,
+					Message:    t.Message,
+					StartedAt:  t.StartedAt.Time,
+					FinishedAt: t.FinishedAt.Time,
+				}
+			}
+		}
+	}
+	if status == nil {
+		return nil
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			status.PodReady = cond.Status == corev1.ConditionTrue
+			status.PodReadySince = cond.LastTransitionTime.Time
+		}
+	}
+	return status
+}
+
+// Discrepancy is a probe whose result as reported by the application differs
+// from what the kubelet has published. Short-lived discrepancies are expected
+// while the kubelet works through its probe periods and thresholds; Since
+// shows how long the propagation has been lagging.
+type Discrepancy struct {
+	Probe   string    `json:"probe"`
+	App     bool      `json:"app"`
+	Kubelet bool      `json:"kubelet"`
+	Since   time.Time `json:"since"`
+}
+
+// compareKubelet sets p.Discrepancies from the scraped probe flags and the
+// kubelet status. Discrepancies that were already present in prev keep their
+// original Since.
+func (p *PodStatusInfo) compareKubelet(prev *PodStatusInfo, now time.Time) {
+	p.Discrepancies = nil
+	if p.Info == nil || p.Kubelet == nil {
+		return
+	}
+
+	compare := func(probe string, app, kubelet bool) {
+		if app == kubelet {
+			return
+		}
+		since := now
+		if prev != nil {
+			for _, old := range prev.Discrepancies {
+				if old.Probe == probe && old.App == app {
+					since = old.Since
+				}
+			}
+		}
+		p.Discrepancies = append(p.Discrepancies, Discrepancy{Probe: probe, App: app, Kubelet: kubelet, Since: since})
+	}
+	compare("startup", p.Info.ProbeStatus.Started, p.Kubelet.Started)
+	compare("readiness", p.Info.ProbeStatus.Ready, p.Kubelet.Ready)
+}
+
+// Classes of waiting containers.
+const (
+	WaitingCrashLoop = "crash-loop"
+	WaitingImage     = "image"
+	WaitingConfig    = "config"
+	WaitingStarting  = "starting"
+)
+
+// WaitingState is a container that the kubelet can't get running, such as
+// one in CrashLoopBackOff or ImagePullBackOff.
+type WaitingState struct {
+	Container string `json:"container"`
+	Init      bool   `json:"init,omitempty"`
+	Reason    string `json:"reason"`
+	Message   string `json:"message,omitempty"`
+	Class     string `json:"class"`
+}
+
+// waitingClass classifies a container waiting reason.
+func waitingClass(reason string) string {
+	switch reason {
+	case "CrashLoopBackOff", "RunContainerError":
+		return WaitingCrashLoop
+	case "ImagePullBackOff", "ErrImagePull", "ErrImageNeverPull", "InvalidImageName", "ImageInspectError":
+		return WaitingImage
+	case "CreateContainerConfigError", "CreateContainerError", "PreCreateHookError", "PostStartHookError":
+		return WaitingConfig
+	}
+	return WaitingStarting
+}
+
+// waitingState returns the first container of the pod that is stuck waiting,
+// init containers first. Containers that are merely starting are only
+// reported when nothing is stuck.
+func waitingState(pod *corev1.Pod) *WaitingState {
+	var starting *WaitingState
+	check := func(statuses []corev1.ContainerStatus, init bool) *WaitingState {
+		for _, cs := range statuses {
+			w := cs.State.Waiting
+			if w == nil || w.Reason == "" {
+				continue
+			}
+			state := &WaitingState{
+				Container: cs.Name,
+				Init:      init,
+				Reason:    w.Reason,
+				Message:   w.Message,
+				Class:     waitingClass(w.Reason),
+			}
+			if state.Class != WaitingStarting {
+				return state
+			}
+			if starting == nil {
+				starting = state
+			}
+		}
+		return nil
+	}
+	if state := check(pod.Status.InitContainerStatuses, true); state != nil {
+		return state
+	}
+	if state := check(pod.Status.ContainerStatuses, false); state != nil {
+		return state
+	}
+	return starting
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Pod lifecycle events recorded in the history next to the probe
+// transitions, in HistoryEntry.Event.
+const (
+	// EventPodReplaced is a pod recreated under the same name, as
+	// StatefulSets do, or replaced while the watch was interrupted.
+	EventPodReplaced = "pod-replaced"
+	// EventIPChanged is a pod that got a new IP without being replaced.
+	EventIPChanged = "ip-changed"
+	// EventContainerRestarted is a restart of the monitored container.
+	EventContainerRestarted = "container-restarted"
+)
+
+// replacedWindow is how long a deleted pod is remembered, so a new pod under
+// its name is recorded as a replacement rather than as a new pod.
+const replacedWindow = 10 * time.Minute
+
+type departedPod struct {
+	uid types.UID
+	ip  string
+	at  time.Time
+}
+
+// departedPods remembers recently deleted pods by podKey. Their history is kept
+// as long, so it carries over to a replacement.
+type departedPods struct {
+	mu   sync.Mutex
+	pods map[string]departedPod
+}
+
+func newDepartedPods() *departedPods {
+	return &departedPods{pods: make(map[string]departedPod)}
+}
+
+// add remembers a deleted pod and returns the keys of those deleted longer
+// than the window ago, which are forgotten.
+func (p *departedPods) add(key string, gone departedPod) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var expired []string
+	for n, d := range p.pods {
+		if gone.at.Sub(d.at) > replacedWindow {
+			delete(p.pods, n)
+			expired = append(expired, n)
+		}
+	}
+	p.pods[key] = gone
+	return expired
+}
+
+// take returns and forgets the pod deleted under key. recent is false if
+// it was deleted longer than the window ago.
+func (p *departedPods) take(key string, now time.Time) (gone departedPod, found, recent bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	gone, found = p.pods[key]
+	delete(p.pods, key)
+	return gone, found, found && now.Sub(gone.at) <= replacedWindow
+}
+
+// lifecycleEvents compares a pod's new status with the one it replaces in
+// d.pods, prev, which is nil for pods not seen yet: a different UID is a
+// replacement, else a different IP or a higher restart count of the
+// monitored container are reported.
+func (d *Dashboard) lifecycleEvents(prev, status *PodStatusInfo, now time.Time) []HistoryEntry {
+	event := func(name, detail string) HistoryEntry {
+		return HistoryEntry{ProbeTransition: ProbeTransition{Time: now}, Event: name, Detail: detail}
+	}
+	if prev == nil {
+		key := podKey(status.Namespace, status.Name)
+		gone, found, recent := d.departed.take(key, now)
+		if found && !recent {
+			d.history.forget(key)
+		}
+		if !recent || gone.uid == status.UID {
+			return nil
+		}
+		prev = &PodStatusInfo{UID: gone.uid, IP: gone.ip}
+	}
+	if prev.UID != "" && status.UID != "" && prev.UID != status.UID {
+		return []HistoryEntry{event(EventPodReplaced, fmt.Sprintf("UID %s → %s, IP %s → %s", prev.UID, status.UID, orNone(prev.IP), orNone(status.IP)))}
+	}
+
+	var out []HistoryEntry
+	if prev.IP != "" && status.IP != "" && prev.IP != status.IP {
+		out = append(out, event(EventIPChanged, fmt.Sprintf("%s → %s", prev.IP, status.IP)))
+	}
+	if prev.Kubelet != nil && status.Kubelet != nil && status.Kubelet.RestartCount > prev.Kubelet.RestartCount {
+		detail := fmt.Sprintf("restart count %d → %d", prev.Kubelet.RestartCount, status.Kubelet.RestartCount)
+		if t := status.Kubelet.LastTermination; t != nil && t.Reason != "" {
+			detail += fmt.Sprintf(", last exit %s (%d)", t.Reason, t.ExitCode)
+		}
+		out = append(out, event(EventContainerRestarted, detail))
+	}
+	return out
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// recordLifecycle logs and records a pod's lifecycle events. A replaced pod
+// starts over: its probe state machines, scrape statistics, backoff and
+// history baseline belong to the old pod.
+func (d *Dashboard) recordLifecycle(status *PodStatusInfo, entries []HistoryEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	key := podKey(status.Namespace, status.Name)
+	for _, e := range entries {
+		slog.Info("Pod lifecycle event", "pod", status.Name, "namespace", status.Namespace, "event", e.Event, "detail", e.Detail)
+		if e.Event == EventPodReplaced {
+			d.mu.Lock()
+			delete(d.probeStates, key)
+			d.mu.Unlock()
+			d.history.rebase(key, e.Time)
+			d.scrapes.forget(key)
+			d.breaker.forget(key)
+			d.polls.forget(key)
+			d.flaps.forget(key)
+			d.propagation.forget(key)
+		}
+	}
+	d.history.record(key, entries)
+	d.persist(status, entries)
+}
@@ -2,20 +2,24 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"flag"
 	"fmt"
-	"html/template"
-	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
-	"path/filepath"
-	"sort"
+	"os/signal"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"github.com/pascal71/k8s-probe-monitor/pkg/api"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -28,766 +32,1025 @@ var (
 	BuildTime = "unknown"
 )
 
-func init() {
-	// Log version info at startup
-	log.Printf("Version info - Version: %s, Commit: %s, BuildTime: %s", Version, GitCommit, BuildTime)
-}
-
-type PodInfo struct {
-	PodName      string      `json:"podName"`
-	PodIP        string      `json:"podIP"`
-	NodeHostname string      `json:"nodeHostname"`
-	ContainerAge int64       `json:"containerAge"`
-	StartTime    string      `json:"startTime"`
-	ProbeStatus  ProbeStatus `json:"probeStatus"`
-	StartupDelay int         `json:"startupDelay"`
-	StartupReady string      `json:"startupReady"`
-}
-
-type ProbeStatus struct {
-	Started bool `json:"started"`
-	Live    bool `json:"live"`
-	Ready   bool `json:"ready"`
-}
+// PodInfo and ProbeStatus are the contract with the monitored pods, shared
+// with target applications such as cmd/probe-demo.
+type (
+	PodInfo     = api.PodInfo
+	ProbeStatus = api.ProbeStatus
+)
 
 type PodStatusInfo struct {
-	Name         string
-	IP           string
-	Node         string
+	// Cluster is the kubeconfig context of the pod when monitoring several
+	// clusters.
+	Cluster   string
+	Name      string
+	Namespace string
+	// UID tells a pod apart from an earlier one of the same name.
+	UID types.UID
+	IP  string
+	// IPs are all addresses of a dual-stack pod; IP is the one scraped.
+	IPs []string
+	// Target is the address the pod is scraped at.
+	Target string
+	Node   string
+	// Zone and Region are the topology labels of the pod's node.
+	Zone         string
+	Region       string
 	Status       string
 	Info         *PodInfo
 	Error        string
-	LastCheck    time.Time
+	ErrorKind    string
+	SchemaErrors []FieldError
+	Effective    *EffectiveStatus
+	ETA          *ReadyETA
+	Scrape       *ScrapeStats
+	// Backoff is set while the pod's scrapes are skipped for failing to
+	// reach it.
+	Backoff *FetchBackoff
+	// Flap counts the pod's recent readiness transitions.
+	Flap *FlapState
+	// Checks are the dashboard's own runs of the pod's probes.
+	Checks    *SyntheticChecks
+	LastCheck time.Time
+	// Owner is the pod's direct controller and Workload the object at the
+	// top of its owner chain, such as the Deployment above a ReplicaSet.
+	Owner    *OwnerInfo
+	Workload *OwnerInfo
+	// ReplicaSetID is the pod-template-hash of the owning ReplicaSet.
 	ReplicaSetID string
+	// Ordinal is the pod's index in its StatefulSet.
+	Ordinal *int
+	// Probes are the probes configured for the monitored container.
+	Probes *ProbeSpecs
+	// Waiting is set while a container is waiting to run. Status then
+	// shows the waiting reason instead of the phase when the container is
+	// stuck, as kubectl does.
+	Waiting *WaitingState
+	// Endpoints are the pod's memberships in Service EndpointSlices.
+	Endpoints []EndpointMembership
+	// Kubelet is what the kubelet has published for the pod, and
+	// Discrepancies where that disagrees with the scraped flags.
+	Kubelet       *KubeletStatus
+	Discrepancies []Discrepancy
+	// Resources are the monitored container's requests, limits and usage.
+	Resources  *ResourceUsage
+	Scheduling *SchedulingInfo
+	// Containers are all containers of the pod, init containers and
+	// sidecars first, marking those that block its startup or readiness.
+	Containers []ContainerState
+}
+
+// Key identifies the pod across clusters.
+func (p *PodStatusInfo) Key() string {
+	if p.Cluster == "" {
+		return podKey(p.Namespace, p.Name)
+	}
+	return p.Cluster + "/" + podKey(p.Namespace, p.Name)
+}
+
+// podKey identifies a pod within its cluster. d.pods and the per-pod
+// trackers are keyed by it, as pod names are only unique per namespace.
+func podKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// splitPodKey returns the namespace and name of a pod key. A bare name, as
+// stored before pods were keyed by namespace, has an empty namespace.
+func splitPodKey(key string) (namespace, name string) {
+	namespace, name, ok := strings.Cut(key, "/")
+	if !ok {
+		return "", key
+	}
+	return namespace, name
+}
+
+// podKeyNamed returns the key of the pod name in namespace. Without a
+// namespace the name must not belong to known pods of several namespaces;
+// the key of a pod that isn't known has an empty namespace.
+func (d *Dashboard) podKeyNamed(namespace, name string) (string, error) {
+	if namespace != "" {
+		return podKey(namespace, name), nil
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	key := podKey("", name)
+	found := false
+	for k, p := range d.pods {
+		if p.Name != name {
+			continue
+		}
+		if found {
+			return "", &actionError{http.StatusConflict, "Pod exists in several namespaces; set namespace"}
+		}
+		key, found = k, true
+	}
+	return key, nil
+}
+
+// requestPodKey returns the key of the pod a /api/pods/{name}/... request
+// names, in the namespace given by its namespace query parameter.
+func (d *Dashboard) requestPodKey(r *http.Request) (string, error) {
+	return d.podKeyNamed(r.URL.Query().Get("namespace"), r.PathValue("name"))
+}
+
+// SortKey orders pods by cluster and workload, then within the workload by
+// ReplicaSet, StatefulSet ordinal or DaemonSet node, then by name.
+func (p *PodStatusInfo) SortKey() string {
+	workload, group := "", p.ReplicaSetID
+	if p.Workload != nil {
+		workload = p.Workload.Kind + "/" + p.Workload.Name
+		if p.Workload.Kind == "DaemonSet" {
+			group = p.Node
+		}
+	}
+	if p.Ordinal != nil {
+		group = fmt.Sprintf("%06d", *p.Ordinal)
+	}
+	return p.Cluster + "/" + workload + "/" + group + "/" + p.Name
 }
 
 type Dashboard struct {
-	pods      map[string]*PodStatusInfo
+	// pods and probeStates are keyed by podKey.
+	pods        map[string]*PodStatusInfo
+	probeStates map[string]*containerProbes
+	// startupSamples holds recent start-to-ready durations per workload.
+	startupSamples map[string][]time.Duration
+	startup        *startupTracker
+	rollouts       *rolloutTracker
+	flaps          *flapTracker
+	sloCache       sloCache
+	digest         *digestCollector
+	events         *eventHub
+	history        *historyStore
+	owners         *ownerResolver
+	alerts         *alerter
+	rules          *ruleEngine
+	email          *emailBatcher
+	kubeEvents     *kubeEventLog
+	propagation    *propagationTracker
+	scrapes        *scrapeTracker
+	breaker        *fetchBreaker
+	polls          *pollSchedule
+	departed       *departedPods
+	chaos          *chaosScheduler
+	recorder       *recorder
+	usage          *usageCache
+	store          Store
+	// oidc is set on the serving dashboard when OIDC login is enabled, and
+	// kubeAuth caches its reviews of Kubernetes tokens.
+	oidc     *oidcProvider
+	kubeAuth *kubeAuthCache
+	// templates render the page, from the embedded files and the
+	// --template-dir overrides.
+	templates *pageTemplates
+	// apiLimiter and actionLimiter hold the per-client rate limits.
+	apiLimiter    *clientLimiter
+	actionLimiter *clientLimiter
+	// podsBody caches the /api/pods response.
+	podsBody *podsBody
+	// lastSnapshot is when each pod's status was last written to the store.
+	lastSnapshot map[string]time.Time
+	metrics      *dashboardMetrics
+	// cluster is the kubeconfig context monitored by this dashboard, and
+	// peers the dashboards of all clusters when monitoring several.
+	cluster   string
+	peers     []*Dashboard
 	mu        sync.RWMutex
-	clientset *kubernetes.Clientset
+	clientset kubernetes.Interface
+	// watch is the active set of pod informers, guarded by mu.
+	watch     *podWatch
+	apiHealth *apiHealth
+	// loaded is closed once the first scrape cycle has completed.
+	loaded     chan struct{}
+	loadedOnce sync.Once
+	client     *http.Client
+	fetcher    podFetcher
+	checker    *probeChecker
+	// inflight tracks scrapes started from informer events and notification
+	// deliveries, which Close waits for.
+	inflight sync.WaitGroup
+
+	// cfgMu guards config and reloaded, which is closed and replaced on
+	// every configuration reload.
+	cfgMu    sync.RWMutex
+	config   Config
+	reloaded chan struct{}
 }
 
-func NewDashboard() (*Dashboard, error) {
-	config, err := getKubeConfig()
+// NewDashboard creates a dashboard for the cluster of a kubeconfig context,
+// or for the in-cluster or current context when kubeContext is empty.
+func NewDashboard(cfg Config, kubeContext string, metrics *dashboardMetrics) (*Dashboard, error) {
+	config, inCluster, err := getKubeConfig(cfg.Kubeconfig, kubeContext)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get kubernetes config: %v", err)
 	}
+	if cfg.AccessMode == AccessAuto {
+		cfg.AccessMode = AccessProxy
+		if inCluster {
+			cfg.AccessMode = AccessDirect
+		}
+	}
+
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &tracingTransport{next: &instrumentedTransport{next: rt, metrics: metrics}, name: "kubernetes"}
+	})
 
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create kubernetes client: %v", err)
 	}
 
-	return &Dashboard{
-		pods:      make(map[string]*PodStatusInfo),
-		clientset: clientset,
-	}, nil
+	client, err := newFetchClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newDashboard(clientset, client, cfg, metrics)
 }
 
-func getKubeConfig() (*rest.Config, error) {
-	// Try in-cluster config first
-	config, err := rest.InClusterConfig()
-	if err == nil {
-		return config, nil
+// newFetchClient returns the HTTP client shared by all scrapes. Timeouts are
+// applied per request, and enough idle connections are kept for every worker
+// to reuse one.
+func newFetchClient(cfg Config) (*http.Client, error) {
+	tlsConfig, err := targetTLSConfig(cfg)
+	if err != nil {
+		return nil, err
 	}
-
-	// Fall back to kubeconfig file (for local development)
-	kubeconfig := filepath.Join(os.Getenv("HOME"), ".kube", "config")
-	if envConfig := os.Getenv("KUBECONFIG"); envConfig != "" {
-		kubeconfig = envConfig
+	if cfg.TargetCertFile != "" && cfg.AccessMode == AccessProxy {
+		slog.Warn("Target client certificates are not used through the API server proxy")
 	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 4 * cfg.Concurrency
+	transport.MaxIdleConnsPerHost = 1
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: &tracingTransport{next: transport, name: "scrape"}}, nil
+}
 
-	config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+// newDashboard wires a Dashboard to an existing clientset, HTTP client and
+// metrics. It is used by NewDashboard and by the bench subcommand, which
+// substitutes a fake clientset and a client that dials in-process target
+// servers.
+func newDashboard(clientset kubernetes.Interface, client *http.Client, cfg Config, metrics *dashboardMetrics) (*Dashboard, error) {
+	if _, err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	store, err := openStore(cfg.Store, cfg.StorePath)
 	if err != nil {
 		return nil, err
 	}
 
-	return config, nil
+	d := &Dashboard{
+		pods:           make(map[string]*PodStatusInfo),
+		probeStates:    make(map[string]*containerProbes),
+		startupSamples: make(map[string][]time.Duration),
+		startup:        newStartupTracker(),
+		rollouts:       newRolloutTracker(),
+		flaps:          newFlapTracker(),
+		digest:         newDigestCollector(time.Now()),
+		events:         newEventHub(),
+		history:        newHistoryStore(),
+		owners:         newOwnerResolver(clientset),
+		alerts:         newAlerter(),
+		rules:          newRuleEngine(),
+		kubeEvents:     newKubeEventLog(),
+		propagation:    newPropagationTracker(),
+		scrapes:        newScrapeTracker(),
+		breaker:        newFetchBreaker(),
+		polls:          newPollSchedule(),
+		departed:       newDepartedPods(),
+		chaos:          newChaosScheduler(),
+		recorder:       &recorder{},
+		usage:          newUsageCache(usageListers(clientset)),
+		apiHealth:      newAPIHealth(),
+		kubeAuth:       newKubeAuthCache(),
+		templates:      embeddedTemplates,
+		apiLimiter:     newClientLimiter(),
+		actionLimiter:  newClientLimiter(),
+		podsBody:       &podsBody{},
+		store:          store,
+		lastSnapshot:   make(map[string]time.Time),
+		metrics:        metrics,
+		clientset:      clientset,
+		client:         client,
+		fetcher:        newPodFetcher(cfg.AccessMode, cfg.IPFamily, clientset, client),
+		config:         cfg,
+		reloaded:       make(chan struct{}),
+		loaded:         make(chan struct{}),
+	}
+	d.checker = newProbeChecker(cfg.AccessMode, cfg.IPFamily, d.fetcher)
+	d.email = newEmailBatcher(d)
+	if err := d.restoreHistory(time.Now()); err != nil {
+		store.Close()
+		return nil, err
+	}
+	return d, nil
 }
 
-func (d *Dashboard) monitorPods(ctx context.Context) {
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
+// Close waits for scrapes started from informer events and pending
+// notifications, mails the batched ones, then closes the history store,
+// flushing pending writes. The informers must have been stopped first.
+func (d *Dashboard) Close() error {
+	d.inflight.Wait()
+	d.email.flush(context.Background())
+	return d.store.Close()
+}
+
+// getKubeConfig loads the client config and reports whether the dashboard
+// runs inside the cluster. The in-cluster config is only used when neither a
+// kubeconfig file nor a context is given explicitly.
+func getKubeConfig(kubeconfig, kubeContext string) (*rest.Config, bool, error) {
+	// Try in-cluster config first
+	if kubeconfig == "" && kubeContext == "" {
+		config, err := rest.InClusterConfig()
+		if err == nil {
+			return config, true, nil
+		}
+	}
+
+	// Fall back to the kubeconfig files (for local development): the
+	// explicit file, or the KUBECONFIG list merged like kubectl does, or
+	// ~/.kube/config.
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		rules,
+		&clientcmd.ConfigOverrides{CurrentContext: kubeContext},
+	).ClientConfig()
+	if err != nil {
+		return nil, false, err
+	}
+
+	return config, false, nil
+}
+
+// onPodEvent reflects a pod add or update immediately. Kubernetes-side fields
+// are replaced while the last scrape result is kept; a pod that has just become
+// reachable is scraped right away instead of waiting for the next tick.
+func (d *Dashboard) onPodEvent(ctx context.Context, pod *corev1.Pod) {
+	status := d.newPodStatus(ctx, pod)
+	key := podKey(pod.Namespace, pod.Name)
+
+	d.mu.Lock()
+	if ctx.Err() != nil {
+		// The pod's watch was replaced or the dashboard is shutting down.
+		d.mu.Unlock()
+		return
+	}
+	prev := d.pods[key]
+	lifecycle := d.lifecycleEvents(prev, status, time.Now())
+	if prev != nil && prev.UID == status.UID && prev.IP == status.IP {
+		status.Info = prev.Info
+		status.Error = prev.Error
+		status.ErrorKind = prev.ErrorKind
+		status.SchemaErrors = prev.SchemaErrors
+		status.Effective = prev.Effective
+		status.ETA = prev.ETA
+		status.Scrape = prev.Scrape
+		status.Backoff = prev.Backoff
+		status.Flap = prev.Flap
+		status.Checks = prev.Checks
+		status.LastCheck = prev.LastCheck
+	}
+	status.compareKubelet(prev, time.Now())
+	d.pods[key] = status
+	d.mu.Unlock()
+	d.recordLifecycle(status, lifecycle)
+
+	if status.Kubelet != nil {
+		d.propagation.observe(key, StageKubelet, status.Kubelet.PodReady, time.Now())
+	}
+
+	eventType := PodEventUpdate
+	if prev == nil {
+		eventType = PodEventAdd
+	}
+	d.publish(PodEvent{Type: eventType, Namespace: pod.Namespace, Name: pod.Name, Pod: status})
+
+	becameReachable := prev == nil || prev.UID != status.UID || prev.IP != status.IP || prev.Status != status.Status
+	if becameReachable && scrapeable(pod) {
+		d.inflight.Add(1)
+		go func() {
+			defer d.inflight.Done()
+			d.refreshPod(ctx, pod)
+		}()
+	}
+}
+
+// removePod forgets a pod that no longer exists.
+func (d *Dashboard) removePod(namespace, name string) {
+	key := podKey(namespace, name)
+	d.mu.Lock()
+	gone := d.pods[key]
+	if gone != nil && gone.Owner != nil && !d.ownedLocked(gone.Owner.UID, key) {
+		d.owners.forget(gone.Owner.UID)
+	}
+	var expired []string
+	if gone != nil {
+		d.startup.forget(gone.UID)
+		expired = d.departed.add(key, departedPod{gone.UID, gone.IP, time.Now()})
+	}
+	delete(d.pods, key)
+	delete(d.probeStates, key)
+	delete(d.lastSnapshot, key)
+	d.mu.Unlock()
+	for _, k := range expired {
+		d.history.forget(k)
+	}
+	d.alerts.forget(key)
+	d.kubeEvents.forget(key)
+	d.propagation.forget(key)
+	d.scrapes.forget(key)
+	d.breaker.forget(key)
+	d.polls.forget(key)
+	d.flaps.forget(key)
+	d.metrics.forgetPod(namespace, name)
+	d.publish(PodEvent{Type: PodEventDelete, Namespace: namespace, Name: name})
+}
 
+// ownedLocked reports whether a pod other than except is controlled by uid.
+// d.mu must be held.
+func (d *Dashboard) ownedLocked(uid types.UID, except string) bool {
+	for key, p := range d.pods {
+		if key != except && p.Owner != nil && p.Owner.UID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// monitorPods scrapes every pod right away, marking the dashboard loaded,
+// then starts a cycle every poll interval, or every fast poll interval with
+// adaptive polling, until ctx is cancelled. A cycle's scrapes are spread over
+// ScrapeSpread of the interval; a cycle that overruns the interval is
+// followed by the next at once.
+func (d *Dashboard) monitorPods(ctx context.Context) {
+	d.updatePodStatuses(ctx, 0)
+	d.markLoaded()
+	last := time.Now()
 	for {
+		cfg := d.cfg()
+		interval := cfg.cycleInterval()
+		timer := time.NewTimer(time.Until(last.Add(interval)))
 		select {
 		case <-ctx.Done():
+			timer.Stop()
 			return
-		case <-ticker.C:
-			d.updatePodStatuses(ctx)
+		case <-d.configChanged():
+			// Restart the wait with the new interval.
+			timer.Stop()
+		case <-timer.C:
+			last = time.Now()
+			// Scrapes through the API server's proxy can't succeed
+			// while it is unreachable.
+			if _, proxied := d.fetcher.(*proxyFetcher); proxied && d.apiDegraded() {
+				slog.Debug("Skipping scrape cycle while the Kubernetes API is unreachable", "cluster", d.cluster)
+				continue
+			}
+			d.updatePodStatuses(ctx, time.Duration(float64(interval)*cfg.ScrapeSpread))
 		}
 	}
 }
 
-func (d *Dashboard) updatePodStatuses(ctx context.Context) {
-	// Get pods with label app=probe-demo
-	pods, err := d.clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{
-		LabelSelector: "app=probe-demo",
-	})
+// updatePodStatuses scrapes the pods in the informer cache that are due,
+// spread over window.
+func (d *Dashboard) updatePodStatuses(ctx context.Context, window time.Duration) {
+	ctx, span := tracer.Start(ctx, "monitor.cycle", trace.WithAttributes(attribute.String("cluster", d.cluster)))
+	pods, err := d.currentWatch().list()
 	if err != nil {
-		log.Printf("Error listing pods: %v", err)
+		slog.Error("Error listing pods", "error", err)
+		endSpan(span, err)
 		return
 	}
+	start := time.Now()
+	pods = d.duePods(pods, d.cfg(), start)
+	span.SetAttributes(attribute.Int("pods", len(pods)))
+	defer span.End()
+	defer func() { observeScrapeCycle(d.cluster, time.Since(start), time.Now()) }()
+
+	// Fan the scrapes out over a bounded pool of workers so a few slow or
+	// unreachable pods don't hold up the whole cycle.
+	work := make(chan *corev1.Pod)
+	var wg sync.WaitGroup
+	for i := 0; i < min(d.cfg().Concurrency, len(pods)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pod := range work {
+				d.refreshPod(ctx, pod)
+			}
+		}()
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+dispatch:
+	for _, s := range spreadScrapes(pods, window) {
+		if wait := time.Until(start.Add(s.offset)); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-ctx.Done():
+				break dispatch
+			case <-timer.C:
+			}
+		}
+		work <- s.pod
+	}
+	close(work)
+	wg.Wait()
+}
 
-	currentPods := make(map[string]bool)
+// newPodStatus builds the Kubernetes-side part of a pod's status.
+func (d *Dashboard) newPodStatus(ctx context.Context, pod *corev1.Pod) *PodStatusInfo {
+	owner, workload := d.owners.resolve(ctx, pod)
+	replicaSetID := ""
+	if owner != nil && owner.Kind == "ReplicaSet" {
+		replicaSetID = pod.Labels["pod-template-hash"]
+	}
 
-	for _, pod := range pods.Items {
-		currentPods[pod.Name] = true
+	var endpoints []EndpointMembership
+	if w := d.currentWatch(); w != nil {
+		endpoints = w.endpoints.get(podKey(pod.Namespace, pod.Name))
+	}
+	status := string(pod.Status.Phase)
+	waiting := waitingState(pod)
+	if waiting != nil && waiting.Class != WaitingStarting {
+		status = waiting.Reason
+	}
 
-		// Extract ReplicaSet ID from pod name (format: name-replicasetid-podid)
-		replicaSetID := ""
-		parts := strings.Split(pod.Name, "-")
-		if len(parts) >= 2 {
-			// Get the second-to-last part as replica set ID
-			replicaSetID = parts[len(parts)-2]
+	var zone, region string
+	if pod.Spec.NodeName != "" {
+		if node, err := d.currentWatch().node(pod.Spec.NodeName); err == nil {
+			zone, region = node.Labels[corev1.LabelTopologyZone], node.Labels[corev1.LabelTopologyRegion]
 		}
+	}
 
-		podStatus := &PodStatusInfo{
-			Name:         pod.Name,
-			IP:           pod.Status.PodIP,
-			Node:         pod.Spec.NodeName,
-			Status:       string(pod.Status.Phase),
-			LastCheck:    time.Now(),
-			ReplicaSetID: replicaSetID,
-		}
+	cfg := d.cfg()
+	ip := podIP(pod, cfg.IPFamily)
+	target := ""
+	if t, err := podTarget(pod, cfg); err == nil && ip != "" {
+		target = t.url(ip)
+	}
+
+	return &PodStatusInfo{
+		Cluster:      d.cluster,
+		Name:         pod.Name,
+		Namespace:    pod.Namespace,
+		UID:          pod.UID,
+		IP:           ip,
+		IPs:          podIPs(pod),
+		Target:       target,
+		Node:         pod.Spec.NodeName,
+		Zone:         zone,
+		Region:       region,
+		Status:       status,
+		LastCheck:    time.Now(),
+		Owner:        owner,
+		Workload:     workload,
+		ReplicaSetID: replicaSetID,
+		Ordinal:      statefulSetOrdinal(pod, owner),
+		Waiting:      waiting,
+		Endpoints:    endpoints,
+		Probes:       probeSpecs(pod),
+		Kubelet:      kubeletStatus(pod),
+		Resources:    d.resourceUsage(pod),
+		Scheduling:   schedulingInfo(pod),
+		Containers:   containerStates(pod),
+	}
+}
 
-		// Only query running pods with an IP
-		if pod.Status.Phase == "Running" && pod.Status.PodIP != "" {
-			info, err := d.getPodInfo(pod.Status.PodIP)
-			if err != nil {
-				podStatus.Error = err.Error()
-			} else {
-				podStatus.Info = info
+// scrapeable reports whether the pod's info endpoint can be queried.
+func scrapeable(pod *corev1.Pod) bool {
+	return pod.Status.Phase == corev1.PodRunning && pod.Status.PodIP != ""
+}
+
+// refreshPod scrapes a single pod and stores its complete status. Pods whose
+// scrapes are backing off keep their last status.
+func (d *Dashboard) refreshPod(ctx context.Context, pod *corev1.Pod) {
+	podStatus := d.newPodStatus(ctx, pod)
+	key := podKey(pod.Namespace, pod.Name)
+	if scrapeable(pod) && !d.breaker.allow(key, podStatus.Target, d.cfg(), time.Now()) {
+		return
+	}
+
+	// Only query running pods with an IP
+	if scrapeable(pod) {
+		// In lenient schema mode info may be partially filled even
+		// though err reports the fields that failed validation.
+		fetchCtx, span := tracer.Start(ctx, "pod.fetch", trace.WithAttributes(
+			semconv.K8SNamespaceName(pod.Namespace),
+			semconv.K8SPodName(pod.Name),
+			semconv.K8SNodeName(pod.Spec.NodeName),
+		))
+		start := time.Now()
+		info, err := d.getPodInfo(fetchCtx, pod)
+		took := time.Since(start)
+		if err != nil {
+			span.SetAttributes(attribute.String("error.kind", errorKind(err)))
+		}
+		endSpan(span, err)
+		podStatus.Info = info
+		if err != nil {
+			podStatus.Error = err.Error()
+			podStatus.ErrorKind = errorKind(err)
+			if schemaErr, ok := err.(*SchemaError); ok {
+				podStatus.SchemaErrors = schemaErr.Fields
 			}
 		}
+		if info != nil {
+			podStatus.Effective = d.observeProbes(pod, info.ProbeStatus, podStatus.LastCheck)
+			podStatus.Flap = d.flaps.observe(key, info.ProbeStatus.Ready, d.cfg(), podStatus.LastCheck)
+		} else {
+			podStatus.Flap = d.flaps.state(key, d.cfg(), podStatus.LastCheck)
+		}
+		podStatus.Scrape = d.scrapes.observe(key, took, podStatus.ErrorKind != ErrorKindConnection)
+		if ctx.Err() == nil {
+			podStatus.Backoff = d.breaker.observe(key, podStatus.Target, podStatus.ErrorKind != ErrorKindConnection, d.cfg(), time.Now())
+		}
+		d.metrics.observeScrape(podStatus, took)
+		if d.cfg().SyntheticChecks {
+			podStatus.Checks = d.checker.checkAll(ctx, pod)
+		}
 
-		d.mu.Lock()
-		d.pods[pod.Name] = podStatus
-		d.mu.Unlock()
+		logger := slog.With("pod", pod.Name, "namespace", pod.Namespace, "node", pod.Spec.NodeName,
+			"phase", pod.Status.Phase, "duration", took)
+		if err != nil {
+			logger.Warn("Scrape failed", "kind", podStatus.ErrorKind, "error", err)
+		} else {
+			logger.Debug("Scraped pod", "started", info.ProbeStatus.Started, "live", info.ProbeStatus.Live, "ready", info.ProbeStatus.Ready)
+		}
+	}
+	podStatus.ETA = d.trackStartup(pod, podStatus.Info, podStatus.Effective, podStatus.LastCheck)
+
+	ready := podStatus.Info != nil && podStatus.Info.ProbeStatus.Ready
+	if podStatus.Effective != nil {
+		ready = podStatus.Effective.Ready
+	}
+	var restarts int32
+	for _, cs := range pod.Status.ContainerStatuses {
+		restarts += cs.RestartCount
 	}
+	d.digest.observe(key, ready, podStatus.Info != nil, restarts, podStatus.LastCheck)
 
-	// Remove pods that no longer exist
+	// The pod may have been deleted or left the watch while it was being
+	// scraped, and an aborted scrape says nothing about the pod.
+	if ctx.Err() != nil {
+		return
+	}
+	// A pod replaced under the same name meanwhile is scraped on its own.
 	d.mu.Lock()
-	for name := range d.pods {
-		if !currentPods[name] {
-			delete(d.pods, name)
+	if d.watch != nil {
+		if current, err := d.watch.get(pod.Namespace, pod.Name); err != nil || current.UID != pod.UID {
+			d.mu.Unlock()
+			return
 		}
 	}
+	prev := d.pods[key]
+	lifecycle := d.lifecycleEvents(prev, podStatus, podStatus.LastCheck)
+	podStatus.compareKubelet(prev, podStatus.LastCheck)
+	d.pods[key] = podStatus
 	d.mu.Unlock()
-}
+	d.recordLifecycle(podStatus, lifecycle)
+	if info := podStatus.Info; info != nil {
+		started, ready := info.ProbeStatus.Started, info.ProbeStatus.Ready
+		if e := podStatus.Effective; e != nil {
+			started, ready = e.Started, e.Ready
+		}
+		d.startup.observe(podStatus, pod.CreationTimestamp.Time, revisionHash(pod.Labels), started, ready, podStatus.LastCheck)
+	}
 
-func (d *Dashboard) getPodInfo(podIP string) (*PodInfo, error) {
-	url := fmt.Sprintf("http://%s:8080/api/info", podIP)
+	entries := d.history.observe(key, podStatus.Info, podStatus.LastCheck)
+	for _, e := range entries {
+		if e.Probe == "ready" {
+			d.propagation.appChanged(podStatus, e.To, e.Time)
+		}
+	}
+	d.persist(podStatus, entries)
+	d.notifyChanges(podStatus)
 
-	client := &http.Client{
-		Timeout: 3 * time.Second,
+	d.publish(PodEvent{Type: PodEventUpdate, Namespace: pod.Namespace, Name: pod.Name, Pod: podStatus})
+	for i := range entries {
+		d.publish(PodEvent{Type: PodEventTransition, Namespace: pod.Namespace, Name: pod.Name, Transition: &entries[i].ProbeTransition})
 	}
+}
 
-	resp, err := client.Get(url)
+func (d *Dashboard) getPodInfo(ctx context.Context, pod *corev1.Pod) (*PodInfo, error) {
+	cfg := d.cfg()
+	target, err := podTarget(pod, cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect: %v", err)
+		return nil, &fetchError{ErrorKindAnnotation, err}
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	if target.Protocol == ProtocolGRPC {
+		return d.getGRPCPodInfo(ctx, pod, target, cfg)
 	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.FetchTimeout)
+	defer cancel()
 
-	body, err := io.ReadAll(resp.Body)
+	status, body, err := d.fetcher.fetch(ctx, pod, target.Scheme, target.Port, http.MethodGet, target.Path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %v", err)
+		return nil, &fetchError{ErrorKindConnection, err}
 	}
-
-	var info PodInfo
-	if err := json.Unmarshal(body, &info); err != nil {
-		return nil, fmt.Errorf("failed to parse JSON: %v", err)
+	if status != http.StatusOK {
+		return nil, &fetchError{ErrorKindHTTP, fmt.Errorf("unexpected status code: %d", status)}
 	}
 
-	return &info, nil
+	return decodePodInfo(body, cfg.SchemaMode)
 }
 
 func (d *Dashboard) handleIndex(w http.ResponseWriter, r *http.Request) {
-	tmpl := `<!DOCTYPE html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Pod Monitor Dashboard</title>
-    <style>
-        * {
-            margin: 0;
-            padding: 0;
-            box-sizing: border-box;
-        }
-        
-        body {
-            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, Oxygen, Ubuntu, Cantarell, sans-serif;
-            background: #0a0a0a;
-            color: #e0e0e0;
-            line-height: 1.6;
-        }
-        
-        .container {
-            max-width: 1400px;
-            margin: 0 auto;
-            padding: 20px;
-        }
-        
-        h1 {
-            text-align: center;
-            color: #ffffff;
-            margin-bottom: 20px;
-            font-size: 2.5em;
-            text-shadow: 0 0 20px rgba(100, 200, 255, 0.5);
-        }
-        
-        .version-info {
-            text-align: center;
-            color: #fff;
-            font-size: 1em;
-            margin-bottom: 20px;
-            background: rgba(0, 212, 255, 0.2);
-            border: 2px solid rgba(0, 212, 255, 0.5);
-            border-radius: 25px;
-            padding: 10px 30px;
-            display: inline-block;
-            left: 50%;
-            transform: translateX(-50%);
-            position: relative;
-            box-shadow: 0 4px 20px rgba(0, 212, 255, 0.3);
-        }
-        
-        .version-info span {
-            margin: 0 15px;
-            color: #fff;
-            font-weight: 500;
-        }
-        
-        .controls {
-            text-align: center;
-            margin-bottom: 30px;
-            padding: 20px;
-            background: rgba(255, 255, 255, 0.05);
-            border-radius: 15px;
-            border: 2px solid rgba(0, 212, 255, 0.3);
-        }
-        
-        .refresh-control {
-            display: inline-flex;
-            align-items: center;
-            gap: 20px;
-            background: rgba(0, 255, 136, 0.1);
-            border: 2px solid rgba(0, 255, 136, 0.5);
-            border-radius: 30px;
-            padding: 15px 30px;
-            box-shadow: 0 6px 25px rgba(0, 255, 136, 0.3);
-        }
-        
-        .refresh-control label {
-            color: #00ff88;
-            font-size: 1.2em;
-            font-weight: 600;
-            text-shadow: 0 0 10px rgba(0, 255, 136, 0.5);
-        }
-        
-        .refresh-control input[type="range"] {
-            width: 150px;
-            height: 8px;
-            background: linear-gradient(to right, #444 0%, #666 100%);
-            outline: none;
-            border-radius: 10px;
-            -webkit-appearance: none;
-            cursor: pointer;
-            box-shadow: inset 0 2px 4px rgba(0, 0, 0, 0.3);
-        }
-        
-        .refresh-control input[type="range"]::-webkit-slider-thumb {
-            -webkit-appearance: none;
-            width: 24px;
-            height: 24px;
-            background: radial-gradient(circle, #00ff88 0%, #00d4ff 100%);
-            border-radius: 50%;
-            cursor: pointer;
-            box-shadow: 0 0 20px rgba(0, 255, 136, 0.8);
-            transition: all 0.2s ease;
-            border: 2px solid #fff;
-        }
-        
-        .refresh-control input[type="range"]::-webkit-slider-thumb:hover {
-            transform: scale(1.3);
-            box-shadow: 0 0 30px rgba(0, 255, 136, 1);
-        }
-        
-        .refresh-control input[type="range"]::-moz-range-thumb {
-            width: 24px;
-            height: 24px;
-            background: radial-gradient(circle, #00ff88 0%, #00d4ff 100%);
-            border-radius: 50%;
-            cursor: pointer;
-            border: 2px solid #fff;
-            box-shadow: 0 0 20px rgba(0, 255, 136, 0.8);
-            transition: all 0.2s ease;
-        }
-        
-        .refresh-control input[type="range"]::-moz-range-thumb:hover {
-            transform: scale(1.3);
-            box-shadow: 0 0 30px rgba(0, 255, 136, 1);
-        }
-        
-        .refresh-control span {
-            color: #00ff88;
-            font-weight: bold;
-            font-size: 1.1em;
-            min-width: 35px;
-            text-align: center;
-        }
-        
-        .grid {
-            display: grid;
-            grid-template-columns: repeat(auto-fill, minmax(400px, 1fr));
-            gap: 20px;
-        }
-        
-        .pod-card {
-            background: linear-gradient(135deg, #1a1a2e 0%, #16213e 100%);
-            border-radius: 15px;
-            padding: 25px;
-            box-shadow: 0 8px 32px rgba(0, 0, 0, 0.3), 0 0 0 1px rgba(255, 255, 255, 0.1);
-            transition: transform 0.3s ease, box-shadow 0.3s ease;
-            position: relative;
-            overflow: hidden;
-        }
-        
-        .pod-card:hover {
-            transform: translateY(-5px);
-            box-shadow: 0 12px 40px rgba(0, 0, 0, 0.4), 0 0 0 1px rgba(255, 255, 255, 0.2);
-        }
-        
-        .pod-card::before {
-            content: '';
-            position: absolute;
-            top: 0;
-            left: 0;
-            right: 0;
-            height: 4px;
-            background: linear-gradient(90deg, #00ff88, #00d4ff);
-        }
-        
-        .pod-card.error::before {
-            background: linear-gradient(90deg, #ff4444, #ff6666);
-        }
-        
-        .pod-card.not-ready::before {
-            background: linear-gradient(90deg, #ff9800, #ffc107);
-        }
-        
-        .pod-name {
-            font-size: 1.4em;
-            font-weight: bold;
-            color: #00d4ff;
-            margin-bottom: 15px;
-            word-break: break-all;
-        }
-        
-        .replica-set-id {
-            font-size: 0.8em;
-            color: #888;
-            margin-top: -10px;
-            margin-bottom: 15px;
-        }
-        
-        .info-grid {
-            display: grid;
-            gap: 10px;
-        }
-        
-        .info-row {
-            display: flex;
-            justify-content: space-between;
-            padding: 8px 0;
-            border-bottom: 1px solid rgba(255, 255, 255, 0.1);
-        }
-        
-        .info-label {
-            color: #888;
-            font-size: 0.9em;
-        }
-        
-        .info-value {
-            color: #fff;
-            font-weight: 500;
-            text-align: right;
-            word-break: break-all;
-        }
-        
-        .probe-status {
-            display: flex;
-            gap: 15px;
-            margin-top: 15px;
-            padding-top: 15px;
-            border-top: 1px solid rgba(255, 255, 255, 0.1);
-        }
-        
-        .probe-indicator {
-            display: flex;
-            align-items: center;
-            gap: 5px;
-            font-size: 0.9em;
-            cursor: pointer;
-            padding: 5px 10px;
-            border-radius: 15px;
-            transition: all 0.2s ease;
-            user-select: none;
-        }
-        
-        .probe-indicator:hover {
-            background: rgba(255, 255, 255, 0.1);
-            transform: scale(1.05);
-        }
-        
-        .probe-indicator:active {
-            transform: scale(0.95);
-        }
-        
-        .probe-dot {
-            width: 12px;
-            height: 12px;
-            border-radius: 50%;
-            background: #444;
-            transition: all 0.3s ease;
-            box-shadow: inset 0 2px 4px rgba(0, 0, 0, 0.3);
-        }
-        
-        .probe-dot.active {
-            background: #00ff88;
-            box-shadow: 0 0 15px rgba(0, 255, 136, 0.8), inset 0 -2px 4px rgba(0, 0, 0, 0.2);
-        }
-        
-        .error-message {
-            background: rgba(255, 68, 68, 0.1);
-            border: 1px solid rgba(255, 68, 68, 0.3);
-            border-radius: 8px;
-            padding: 10px;
-            margin-top: 15px;
-            color: #ff6666;
-            font-size: 0.9em;
-        }
-        
-        .last-check {
-            text-align: center;
-            color: #666;
-            font-size: 0.8em;
-            margin-top: 15px;
-        }
-        
-        .refresh-indicator {
-            position: fixed;
-            top: 20px;
-            right: 20px;
-            background: rgba(0, 212, 255, 0.1);
-            border: 1px solid rgba(0, 212, 255, 0.3);
-            border-radius: 50%;
-            width: 40px;
-            height: 40px;
-            display: flex;
-            align-items: center;
-            justify-content: center;
-            animation: pulse 2s infinite;
-        }
-        
-        @keyframes pulse {
-            0% { transform: scale(1); opacity: 1; }
-            50% { transform: scale(1.1); opacity: 0.7; }
-            100% { transform: scale(1); opacity: 1; }
-        }
-        
-        .no-pods {
-            text-align: center;
-            color: #666;
-            font-size: 1.2em;
-            margin-top: 100px;
-        }
-    </style>
-    <script>
-        let refreshInterval = 1000; // Default 1 second
-        let refreshTimer;
-        
-        function formatDuration(ms) {
-            const seconds = Math.floor(ms / 1000);
-            const minutes = Math.floor(seconds / 60);
-            const hours = Math.floor(minutes / 60);
-            const days = Math.floor(hours / 24);
-            
-            if (days > 0) return days + 'd ' + (hours % 24) + 'h';
-            if (hours > 0) return hours + 'h ' + (minutes % 60) + 'm';
-            if (minutes > 0) return minutes + 'm ' + (seconds % 60) + 's';
-            return seconds + 's';
-        }
-        
-        function formatTime(dateStr) {
-            return new Date(dateStr).toLocaleString();
-        }
-        
-        function updateRefreshInterval(value) {
-            refreshInterval = value * 1000;
-            document.getElementById('refresh-value').textContent = value + 's';
-            
-            // Clear existing timer and set new one
-            if (refreshTimer) {
-                clearInterval(refreshTimer);
-            }
-            refreshTimer = setInterval(refreshPage, refreshInterval);
-            
-            // Save preference
-            localStorage.setItem('refreshInterval', value);
-        }
-        
-        function refreshPage() {
-            location.reload();
-        }
-        
-        async function toggleProbe(podIP, probeType, currentState) {
-            const action = currentState ? 'fail' : 'recover';
-            const url = ` + "`" + `http://${podIP}:8080/api/probes/${probeType}/${action}` + "`" + `;
-            
-            try {
-                // Make the API call through a proxy endpoint on our server
-                const response = await fetch(` + "`" + `/api/proxy` + "`" + `, {
-                    method: 'POST',
-                    headers: {
-                        'Content-Type': 'application/json',
-                    },
-                    body: JSON.stringify({
-                        url: url,
-                        method: 'POST'
-                    })
-                });
-                
-                if (response.ok) {
-                    // Refresh the page after a short delay to see the change
-                    setTimeout(refreshPage, 500);
-                } else {
-                    console.error('Failed to toggle probe:', await response.text());
-                }
-            } catch (error) {
-                console.error('Error toggling probe:', error);
-            }
-        }
-        
-        // Initialize on page load
-        window.onload = function() {
-            // Restore saved refresh interval or use default of 1 second
-            const savedInterval = localStorage.getItem('refreshInterval');
-            const defaultInterval = savedInterval || '1';
-            const slider = document.getElementById('refresh-slider');
-            slider.value = defaultInterval;
-            updateRefreshInterval(parseInt(defaultInterval));
-        };
-    </script>
-</head>
-<body>
-    <div class="container">
-        <h1>🚀 Pod Monitor Dashboard</h1>
-        <div class="version-info">
-            <span>Version: {{.Version}}</span>
-            <span>•</span>
-            <span>Commit: {{.GitCommit}}</span>
-            <span>•</span>
-            <span>Built: {{.BuildTime}}</span>
-        </div>
-        <div class="controls">
-            <div class="refresh-control">
-                <label for="refresh-slider">Refresh Interval:</label>
-                <input type="range" id="refresh-slider" min="1" max="10" value="1" onchange="updateRefreshInterval(this.value)">
-                <span id="refresh-value">1s</span>
-            </div>
-        </div>
-        <div class="refresh-indicator">🔄</div>
-        
-        {{if .Pods}}
-        <div class="grid">
-            {{range .Pods}}
-            <div class="pod-card {{if .Error}}error{{else if not .Info.ProbeStatus.Ready}}not-ready{{end}}">
-                <div class="pod-name">{{.Name}}</div>
-                <div class="replica-set-id">ReplicaSet: {{.ReplicaSetID}}</div>
-                
-                <div class="info-grid">
-                    <div class="info-row">
-                        <span class="info-label">Status</span>
-                        <span class="info-value">{{.Status}}</span>
-                    </div>
-                    <div class="info-row">
-                        <span class="info-label">Pod IP</span>
-                        <span class="info-value"><a href="http://{{.IP}}:8080" target="_self" style="color: #00d4ff; text-decoration: none; border-bottom: 1px dotted #00d4ff;">{{.IP}}</a></span>
-                    </div>
-                    <div class="info-row">
-                        <span class="info-label">Node</span>
-                        <span class="info-value">{{.Node}}</span>
-                    </div>
-                    
-                    {{if .Info}}
-                    <div class="info-row">
-                        <span class="info-label">Container Age</span>
-                        <span class="info-value"><script>document.write(formatDuration({{.Info.ContainerAge}} / 1000000))</script></span>
-                    </div>
-                    <div class="info-row">
-                        <span class="info-label">Start Time</span>
-                        <span class="info-value"><script>document.write(formatTime('{{.Info.StartTime}}'))</script></span>
-                    </div>
-                    <div class="info-row">
-                        <span class="info-label">Startup Delay</span>
-                        <span class="info-value">{{.Info.StartupDelay}}s</span>
-                    </div>
-                    {{end}}
-                </div>
-                
-                {{if .Info}}
-                <div class="probe-status">
-                    <div class="probe-indicator" onclick="toggleProbe('{{.IP}}', 'startup', {{.Info.ProbeStatus.Started}})" title="Click to toggle startup probe">
-                        <div class="probe-dot {{if .Info.ProbeStatus.Started}}active{{end}}"></div>
-                        <span>Started</span>
-                    </div>
-                    <div class="probe-indicator" onclick="toggleProbe('{{.IP}}', 'liveness', {{.Info.ProbeStatus.Live}})" title="Click to toggle liveness probe">
-                        <div class="probe-dot {{if .Info.ProbeStatus.Live}}active{{end}}"></div>
-                        <span>Live</span>
-                    </div>
-                    <div class="probe-indicator" onclick="toggleProbe('{{.IP}}', 'readiness', {{.Info.ProbeStatus.Ready}})" title="Click to toggle readiness probe">
-                        <div class="probe-dot {{if .Info.ProbeStatus.Ready}}active{{end}}"></div>
-                        <span>Ready</span>
-                    </div>
-                </div>
-                {{end}}
-                
-                {{if .Error}}
-                <div class="error-message">{{.Error}}</div>
-                {{end}}
-                
-                <div class="last-check">Last check: {{.LastCheck.Format "15:04:05"}}</div>
-            </div>
-            {{end}}
-        </div>
-        {{else}}
-        <div class="no-pods">No pods found with label app=probe-demo</div>
-        {{end}}
-    </div>
-</body>
-</html>`
-
-	t, err := template.New("dashboard").Parse(tmpl)
-	if err != nil {
-		http.Error(w, "Template error", http.StatusInternalServerError)
+	cfg := d.cfg()
+	if !d.allLoaded() {
+		d.handleLoading(w, r)
 		return
 	}
-
-	d.mu.RLock()
-	pods := make([]*PodStatusInfo, 0, len(d.pods))
-	for _, pod := range d.pods {
-		pods = append(pods, pod)
-	}
-	d.mu.RUnlock()
-
-	// Sort pods by ReplicaSetID, then by Name
-	sort.Slice(pods, func(i, j int) bool {
-		if pods[i].ReplicaSetID == pods[j].ReplicaSetID {
-			return pods[i].Name < pods[j].Name
-		}
-		return pods[i].ReplicaSetID < pods[j].ReplicaSetID
-	})
-
+	pods := d.sortedPods()
 	data := struct {
 		Pods      []*PodStatusInfo
+		Selector  string
 		Version   string
 		GitCommit string
 		BuildTime string
 	}{
 		Pods:      pods,
+		Selector:  cfg.Selector,
 		Version:   Version,
 		GitCommit: GitCommit,
 		BuildTime: BuildTime,
 	}
 
 	// Debug log
-	log.Printf("Rendering template with Version: %s, GitCommit: %s, BuildTime: %s", data.Version, data.GitCommit, data.BuildTime)
+	slog.Debug("Rendering template", "version", data.Version, "commit", data.GitCommit, "buildTime", data.BuildTime)
 
 	w.Header().Set("Content-Type", "text/html")
-	if err := t.Execute(w, data); err != nil {
+	if err := d.template().ExecuteTemplate(w, pageTemplate, data); err != nil {
 		http.Error(w, "Template execution error", http.StatusInternalServerError)
 	}
 }
 
-func (d *Dashboard) handleAPI(w http.ResponseWriter, r *http.Request) {
-	d.mu.RLock()
-	defer d.mu.RUnlock()
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(d.pods)
-}
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		if err := runBench(os.Args[2:]); err != nil {
+			fatal("Benchmark failed", "error", err)
+		}
+		return
+	}
 
-func (d *Dashboard) handleProxy(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	cfg, err := loadConfig(os.Args[1:], os.Stderr)
+	if err == flag.ErrHelp {
 		return
 	}
+	if err != nil {
+		fatal("Invalid configuration", "error", err)
+	}
+	if err := setupLogging(cfg.LogLevel, cfg.LogFormat); err != nil {
+		fatal("Invalid logging configuration", "error", err)
+	}
+	// Logged once the configured handler is installed, in its format.
+	slog.Info("Pod Monitor Dashboard", "version", Version, "commit", GitCommit, "buildTime", BuildTime)
+	shutdownTracing := setupTracing(cfg)
 
-	var req struct {
-		URL    string `json:"url"`
-		Method string `json:"method"`
+	var dashboards []*Dashboard
+	var demo *demoCluster
+	var replay *replaySession
+	switch {
+	case cfg.Demo:
+		demo = newDemoCluster(cfg)
+		defer demo.close()
+		var d *Dashboard
+		d, err = demo.dashboard(cfg)
+		dashboards = []*Dashboard{d}
+		slog.Info("Running in demo mode against a simulated cluster", "pods", demoPods)
+	case cfg.Replay != "":
+		var d *Dashboard
+		replay, d, err = newReplaySession(cfg)
+		dashboards = []*Dashboard{d}
+	default:
+		dashboards, err = newDashboards(cfg)
+	}
+	if err != nil {
+		fatal("Failed to create dashboard", "error", err)
+	}
+	// The first dashboard serves the pods of every cluster.
+	dashboard := dashboards[0]
+	cfg = dashboard.cfg()
+	if len(cfg.Contexts) > 0 {
+		slog.Info("Monitoring clusters", "contexts", cfg.Contexts)
+	}
+	slog.Info("Monitoring pods", "selector", cfg.Selector, "namespaces", cfg.Namespaces, "port", cfg.TargetPort, "path", cfg.TargetPath, "access", cfg.AccessMode)
+	if cfg.Store == StoreBolt {
+		slog.Info("Persisting history", "path", cfg.StorePath, "retention", cfg.StoreRetention)
+	}
+	if cfg.ConfigFile != "" {
+		slog.Info("Loaded config file", "path", cfg.ConfigFile)
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
+	// SIGINT and SIGTERM cancel ctx, which stops the informers and every
+	// background loop and starts the shutdown below.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Serve right away: the page shows a loading state and /readyz fails
+	// until the informers have synced and the first scrape cycle completed.
+	if cfg.TemplateDir != "" || cfg.Timezone != "" {
+		// Validated with the config.
+		loc, _ := time.LoadLocation(cfg.Timezone)
+		dashboard.templates, err = loadTemplates(cfg.TemplateDir, loc)
+		if err != nil {
+			fatal("Invalid template overrides", "dir", cfg.TemplateDir, "error", err)
+		}
+		if cfg.TemplateDir != "" {
+			slog.Info("Using template overrides", "dir", cfg.TemplateDir)
+		}
+	}
+	if cfg.OIDCIssuer != "" {
+		dashboard.oidc, err = newOIDCProvider(ctx, cfg)
+		if err != nil {
+			fatal("Failed to set up OIDC login", "error", err)
+		}
+		slog.Info("OIDC login enabled", "issuer", cfg.OIDCIssuer, "allowedUsers", cfg.OIDCAllowedUsers)
 	}
 
-	client := &http.Client{
-		Timeout: 3 * time.Second,
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8090"
 	}
 
-	proxyReq, err := http.NewRequest(req.Method, req.URL, nil)
-	if err != nil {
-		http.Error(w, "Failed to create request", http.StatusInternalServerError)
-		return
+	handler := dashboard.handler()
+	server := newServer(cfg, ":"+port, handler)
+	// Streams never finish on their own; closing the hub ends them so
+	// Shutdown only waits for regular requests.
+	server.RegisterOnShutdown(dashboard.events.close)
+	var redirect *http.Server
+	if cfg.serveTLS() {
+		server.TLSConfig, err = serverTLSConfig(cfg)
+		if err != nil {
+			fatal("Invalid TLS configuration", "error", err)
+		}
+		if cfg.HTTPRedirectAddr != "" {
+			redirect = newServer(cfg, cfg.HTTPRedirectAddr, httpsRedirect(port, handler))
+		}
 	}
 
-	resp, err := client.Do(proxyReq)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to call pod API: %v", err), http.StatusInternalServerError)
-		return
+	serveErr := make(chan error, 2)
+	go func() {
+		if server.TLSConfig != nil {
+			slog.Info("Starting dashboard server", "port", port, "tls", true, "selfSigned", cfg.TLSSelfSigned)
+			serveErr <- server.ListenAndServeTLS("", "")
+			return
+		}
+		slog.Info("Starting dashboard server", "port", port)
+		serveErr <- server.ListenAndServe()
+	}()
+	if cfg.DebugAddr != "" {
+		// No write timeout: CPU profiles and traces run for their duration.
+		debug := &http.Server{Addr: cfg.DebugAddr, Handler: debugHandler(), ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			slog.Info("Serving pprof and expvar", "addr", cfg.DebugAddr)
+			if err := debug.ListenAndServe(); err != http.ErrServerClosed {
+				slog.Error("Debug server failed", "addr", cfg.DebugAddr, "error", err)
+			}
+		}()
+		// Profiles may be in progress; they are cut short.
+		defer debug.Close()
+	}
+	if redirect != nil {
+		go func() {
+			slog.Info("Redirecting HTTP to HTTPS", "addr", cfg.HTTPRedirectAddr)
+			if err := redirect.ListenAndServe(); err != http.ErrServerClosed {
+				serveErr <- err
+			}
+		}()
 	}
-	defer resp.Body.Close()
 
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
-}
+	// Subscribed before the informers start so the first pods are announced.
+	cloudEvents := newCloudEventPublisher(dashboard)
 
-func main() {
-	log.Printf("Pod Monitor Dashboard %s (commit: %s, built: %s)", Version, GitCommit, BuildTime)
+	var background sync.WaitGroup
+	runBackground := func(fn func(context.Context)) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			fn(ctx)
+		}()
+	}
+	// Retrying an unreachable API starts with the informers' initial list.
+	for _, d := range dashboards {
+		runBackground(d.reconnectAPI)
+	}
 
-	dashboard, err := NewDashboard()
-	if err != nil {
-		log.Fatalf("Failed to create dashboard: %v", err)
+	// Watch pods and start scraping them in the background
+	for _, d := range dashboards {
+		if err := d.startInformers(ctx); err != nil {
+			fatal("Failed to start pod informer", "cluster", d.cluster, "error", err)
+		}
+	}
+	if demo != nil {
+		runBackground(demo.simulateKubelet)
+	}
+	if replay != nil {
+		runBackground(func(ctx context.Context) { dashboard.replay(ctx, replay, cfg.ReplaySpeed) })
+	}
+	runBackground(cloudEvents.run)
+	runBackground(dashboard.runRemoteWrite)
+	runBackground(dashboard.runMetricSinks)
+	for _, d := range dashboards {
+		runBackground(d.monitorPods)
+		runBackground(d.pruneStore)
+		runBackground(d.runDigests)
+		runBackground(d.runAlertRules)
+		runBackground(d.runChaos)
+		runBackground(d.runUsage)
+		runBackground(func(ctx context.Context) { d.watchConfig(ctx, os.Args[1:]) })
 	}
 
-	ctx := context.Background()
+	select {
+	case err := <-serveErr:
+		fatal("Failed to start server", "error", err)
+	case <-ctx.Done():
+	}
+	stop()
 
-	// Start monitoring pods in the background
-	go dashboard.monitorPods(ctx)
+	shutdownTimeout := dashboard.cfg().ShutdownTimeout
+	slog.Info("Shutting down", "gracePeriod", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("Failed to drain HTTP requests", "error", err)
+	}
+	if redirect != nil {
+		redirect.Shutdown(shutdownCtx)
+	}
+	background.Wait()
+	for _, d := range dashboards {
+		if err := d.Close(); err != nil {
+			slog.Error("Failed to close history store", "cluster", d.cluster, "error", err)
+		}
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Warn("Failed to flush traces", "error", err)
+	}
+	slog.Info("Shutdown complete")
+}
 
-	// Give the monitor a moment to collect initial data
-	time.Sleep(2 * time.Second)
+// envOr returns the value of the environment variable key, or def when unset.
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
 
-	// Setup HTTP routes
-	http.HandleFunc("/", dashboard.handleIndex)
-	http.HandleFunc("/api/pods", dashboard.handleAPI)
-	http.HandleFunc("/api/proxy", dashboard.handleProxy)
+// envOrInt is like envOr for integer settings. Unparsable values fall back to
+// def with a warning.
+func envOrInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		slog.Warn("Ignoring invalid environment variable", "name", key, "value", v, "error", err)
+		return def
+	}
+	return n
+}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8090"
+func envOrFloat(key string, def float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		slog.Warn("Ignoring invalid environment variable", "name", key, "value", v, "error", err)
+		return def
+	}
+	return f
+}
+
+// envOrBool is like envOr for boolean settings. Unparsable values fall back
+// to def with a warning.
+func envOrBool(key string, def bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		slog.Warn("Ignoring invalid environment variable", "name", key, "value", v, "error", err)
+		return def
 	}
+	return b
+}
 
-	log.Printf("Starting dashboard server on port %s", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+// envOrDuration is like envOr for duration settings. Unparsable values fall
+// back to def with a warning.
+func envOrDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		slog.Warn("Ignoring invalid environment variable", "name", key, "value", v, "error", err)
+		return def
 	}
+	return d
 }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSplitPodKey(t *testing.T) {
+	tests := []struct {
+		key, wantNamespace, wantName string
+	}{
+		{"default/web-1", "default", "web-1"},
+		{podKey("other", "web-1"), "other", "web-1"},
+		{"/web-1", "", "web-1"},
+		{"web-1", "", "web-1"},
+	}
+	for _, tt := range tests {
+		namespace, name := splitPodKey(tt.key)
+		if namespace != tt.wantNamespace || name != tt.wantName {
+			t.Errorf("splitPodKey(%q) = %q, %q; want %q, %q", tt.key, namespace, name, tt.wantNamespace, tt.wantName)
+		}
+	}
+}
+
+func TestSameNamedPods(t *testing.T) {
+	pods := testPods(3)
+	twin := pods[0].DeepCopy()
+	twin.Namespace = "other"
+	d, clientset := newTestDashboard(t, append(pods, twin)...)
+	name := pods[0].Name
+
+	d.mu.RLock()
+	_, inDefault := d.pods[podKey("default", name)]
+	_, inOther := d.pods[podKey("other", name)]
+	d.mu.RUnlock()
+	if !inDefault || !inOther {
+		t.Fatalf("pods in default %v and other %v, want both", inDefault, inOther)
+	}
+
+	tests := []struct {
+		name, namespace, pod string
+		wantKey              string
+		wantStatus           int
+	}{
+		{name: "ambiguous", pod: name, wantStatus: http.StatusConflict},
+		{name: "namespaced", namespace: "other", pod: name, wantKey: podKey("other", name)},
+		{name: "unique", pod: pods[1].Name, wantKey: podKey("other", pods[1].Name)},
+		{name: "unknown", pod: "gone", wantKey: podKey("", "gone")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := d.podKeyNamed(tt.namespace, tt.pod)
+			if tt.wantStatus != 0 {
+				if actionErr, ok := err.(*actionError); !ok || actionErr.status != tt.wantStatus {
+					t.Errorf("podKeyNamed() error = %v, want status %d", err, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil || key != tt.wantKey {
+				t.Errorf("podKeyNamed() = %q, %v; want %q", key, err, tt.wantKey)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	d.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/pods/"+name+"/history", nil))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("GET history without a namespace = %d, want 409", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	d.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/pods/"+name+"/history?namespace=other", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET history in other = %d, want 200", rec.Code)
+	}
+
+	// Removing one leaves its twin.
+	if err := clientset.CoreV1().Pods("default").Delete(context.Background(), name, metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the pod to be removed", func() bool {
+		d.mu.RLock()
+		defer d.mu.RUnlock()
+		_, ok := d.pods[podKey("default", name)]
+		return !ok
+	})
+	if key, err := d.podKeyNamed("", name); err != nil || key != podKey("other", name) {
+		t.Errorf("podKeyNamed() after the removal = %q, %v; want the pod in other", key, err)
+	}
+}
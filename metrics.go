@@ -0,0 +1,227 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "probe_monitor"
+
+// dashboardMetrics holds the Prometheus collectors of one Dashboard. Each
+// dashboard uses its own registry so bench runs and tests don't collide, except
+// that the dashboards of several clusters share one.
+type dashboardMetrics struct {
+	registry *prometheus.Registry
+
+	probeStarted *prometheus.GaugeVec
+	probeLive    *prometheus.GaugeVec
+	probeReady   *prometheus.GaugeVec
+	scrapeErrors *prometheus.CounterVec
+	fetchLatency *prometheus.HistogramVec
+	podLatency   *prometheus.SummaryVec
+	podReachable *prometheus.GaugeVec
+	apiRequests  *prometheus.CounterVec
+	apiErrors    *prometheus.CounterVec
+	apiDegraded  prometheus.Gauge
+	apiBackoff   prometheus.Gauge
+	apiRetries   *prometheus.CounterVec
+	rateLimited  *prometheus.CounterVec
+	httpRequests *prometheus.HistogramVec
+}
+
+func newDashboardMetrics() *dashboardMetrics {
+	return newClusterMetrics(newMetricsRegistry(), "")
+}
+
+// newMetricsRegistry returns a registry with the Go runtime and process
+// collectors.
+func newMetricsRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return registry
+}
+
+// newClusterMetrics registers a dashboard's collectors on registry. A
+// non-empty cluster is added as a label to every series, so the dashboards of
+// several clusters can share the registry.
+func newClusterMetrics(registry *prometheus.Registry, cluster string) *dashboardMetrics {
+	podLabels := []string{"namespace", "pod"}
+	m := &dashboardMetrics{
+		registry: registry,
+		probeStarted: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "probe_started",
+			Help:      "Startup probe state reported by the pod (1 = started).",
+		}, podLabels),
+		probeLive: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "probe_live",
+			Help:      "Liveness probe state reported by the pod (1 = live).",
+		}, podLabels),
+		probeReady: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "probe_ready",
+			Help:      "Readiness probe state reported by the pod (1 = ready).",
+		}, podLabels),
+		scrapeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "scrape_errors_total",
+			Help:      "Failed pod info scrapes by pod and error kind.",
+		}, []string{"namespace", "pod", "kind"}),
+		fetchLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "pod_info_fetch_duration_seconds",
+			Help:      "Duration of pod info requests by result.",
+			Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"result"}),
+		podLatency: prometheus.NewSummaryVec(prometheus.SummaryOpts{
+			Namespace:  metricsNamespace,
+			Name:       "pod_scrape_duration_seconds",
+			Help:       "Round-trip time of pod info requests that reached the pod, by pod and node.",
+			Objectives: map[float64]float64{0.5: 0.05, 0.95: 0.01},
+			MaxAge:     10 * time.Minute,
+		}, []string{"namespace", "pod", "node"}),
+		podReachable: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "pod_reachable",
+			Help:      "Whether the last pod info request reached the pod (1 = reachable), by pod and node.",
+		}, []string{"namespace", "pod", "node"}),
+		apiRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "kubernetes_requests_total",
+			Help:      "Requests made to the Kubernetes API by operation (read, watch, write) and status code.",
+		}, []string{"operation", "code"}),
+		apiErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "kubernetes_errors_total",
+			Help:      "Failed Kubernetes API requests by operation (read, watch, write).",
+		}, []string{"operation"}),
+		apiDegraded: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "kubernetes_degraded",
+			Help:      "Whether the Kubernetes API is unreachable and being retried with backoff (1 = degraded).",
+		}),
+		apiBackoff: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "kubernetes_retry_backoff_seconds",
+			Help:      "Delay before the next attempt to reach the Kubernetes API while degraded.",
+		}),
+		apiRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "kubernetes_retries_total",
+			Help:      "Attempts to reach the Kubernetes API while degraded, by result (success, failure).",
+		}, []string{"result"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "rate_limited_requests_total",
+			Help:      "Dashboard requests refused by the per-client rate limits, by limit (api, actions).",
+		}, []string{"limit"}),
+		httpRequests: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of the dashboard's own requests by route, method and status code, except streams and WebSockets.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "code"}),
+	}
+
+	var registerer prometheus.Registerer = registry
+	if cluster != "" {
+		registerer = prometheus.WrapRegistererWith(prometheus.Labels{"cluster": cluster}, registry)
+	}
+	registerer.MustRegister(
+		m.probeStarted, m.probeLive, m.probeReady,
+		m.scrapeErrors, m.fetchLatency,
+		m.podLatency, m.podReachable,
+		m.apiRequests, m.apiErrors,
+		m.apiDegraded, m.apiBackoff, m.apiRetries,
+		m.rateLimited, m.httpRequests,
+	)
+	return m
+}
+
+func (m *dashboardMetrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// observeScrape records the outcome of one pod info fetch.
+func (m *dashboardMetrics) observeScrape(status *PodStatusInfo, took time.Duration) {
+	result := "success"
+	if status.Error != "" {
+		result = status.ErrorKind
+		m.scrapeErrors.WithLabelValues(status.Namespace, status.Name, status.ErrorKind).Inc()
+	}
+	m.fetchLatency.WithLabelValues(result).Observe(took.Seconds())
+
+	reachable := status.ErrorKind != ErrorKindConnection
+	if reachable {
+		m.podLatency.WithLabelValues(status.Namespace, status.Name, status.Node).Observe(took.Seconds())
+	}
+	m.podReachable.WithLabelValues(status.Namespace, status.Name, status.Node).Set(boolGauge(reachable))
+
+	if status.Info == nil {
+		m.deleteProbeGauges(status.Namespace, status.Name)
+		return
+	}
+	m.probeStarted.WithLabelValues(status.Namespace, status.Name).Set(boolGauge(status.Info.ProbeStatus.Started))
+	m.probeLive.WithLabelValues(status.Namespace, status.Name).Set(boolGauge(status.Info.ProbeStatus.Live))
+	m.probeReady.WithLabelValues(status.Namespace, status.Name).Set(boolGauge(status.Info.ProbeStatus.Ready))
+}
+
+// forgetPod drops every per-pod series of a pod that no longer exists.
+func (m *dashboardMetrics) forgetPod(namespace, name string) {
+	m.deleteProbeGauges(namespace, name)
+	m.scrapeErrors.DeletePartialMatch(prometheus.Labels{"namespace": namespace, "pod": name})
+	m.podLatency.DeletePartialMatch(prometheus.Labels{"namespace": namespace, "pod": name})
+	m.podReachable.DeletePartialMatch(prometheus.Labels{"namespace": namespace, "pod": name})
+}
+
+func (m *dashboardMetrics) deleteProbeGauges(namespace, name string) {
+	m.probeStarted.DeleteLabelValues(namespace, name)
+	m.probeLive.DeleteLabelValues(namespace, name)
+	m.probeReady.DeleteLabelValues(namespace, name)
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// instrumentedTransport counts Kubernetes API requests and failures by
+// operation: "read" (list and get), "watch" and "write". Watches are told apart
+// from lists by their watch query parameter.
+type instrumentedTransport struct {
+	next    http.RoundTripper
+	metrics *dashboardMetrics
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	operation := "write"
+	switch {
+	case req.URL.Query().Get("watch") == "true" || req.URL.Query().Get("watch") == "1":
+		operation = "watch"
+	case req.Method == http.MethodGet:
+		operation = "read"
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.metrics.apiRequests.WithLabelValues(operation, "error").Inc()
+		t.metrics.apiErrors.WithLabelValues(operation).Inc()
+		return nil, err
+	}
+	t.metrics.apiRequests.WithLabelValues(operation, strconv.Itoa(resp.StatusCode)).Inc()
+	if resp.StatusCode >= 400 {
+		t.metrics.apiErrors.WithLabelValues(operation).Inc()
+	}
+	return resp, err
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// StatsD flavors: plain StatsD has no tags, so label values are appended to
+// the metric name; DogStatsD sends them as tags.
+const (
+	StatsDPlain = "statsd"
+	StatsDDog   = "dogstatsd"
+)
+
+// maxStatsDPacket keeps StatsD datagrams within a typical MTU.
+const maxStatsDPacket = 1432
+
+// metricSample is a time series with one sample.
+type metricSample struct {
+	// labels are sorted by name and include __name__.
+	labels    [][2]string
+	value     float64
+	timestamp int64
+}
+
+func (s metricSample) name() string {
+	for _, l := range s.labels {
+		if l[0] == "__name__" {
+			return l[1]
+		}
+	}
+	return ""
+}
+
+// gatherMetricSamples flattens the registry's metrics into series the way
+// Prometheus scrapes them: summaries and histograms become their quantile or
+// bucket series plus _sum and _count.
+func gatherMetricSamples(registry prometheus.Gatherer, now time.Time) ([]metricSample, error) {
+	families, err := registry.Gather()
+	if err != nil {
+		return nil, err
+	}
+	ts := now.UnixMilli()
+	var out []metricSample
+	for _, family := range families {
+		name := family.GetName()
+		for _, m := range family.GetMetric() {
+			add := func(suffix string, value float64, extra ...string) {
+				labels := [][2]string{{"__name__", name + suffix}, {"job", "k8s-probe-monitor"}}
+				for _, l := range m.GetLabel() {
+					labels = append(labels, [2]string{l.GetName(), l.GetValue()})
+				}
+				for i := 0; i+1 < len(extra); i += 2 {
+					labels = append(labels, [2]string{extra[i], extra[i+1]})
+				}
+				sort.Slice(labels, func(i, j int) bool { return labels[i][0] < labels[j][0] })
+				out = append(out, metricSample{labels: labels, value: value, timestamp: ts})
+			}
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add("", m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add("", m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add("", m.GetUntyped().GetValue())
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add("", q.GetValue(), "quantile", strconv.FormatFloat(q.GetQuantile(), 'g', -1, 64))
+				}
+				add("_sum", s.GetSampleSum())
+				add("_count", float64(s.GetSampleCount()))
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, b := range h.GetBucket() {
+					add("_bucket", float64(b.GetCumulativeCount()), "le", strconv.FormatFloat(b.GetUpperBound(), 'g', -1, 64))
+				}
+				add("_bucket", float64(h.GetSampleCount()), "le", "+Inf")
+				add("_sum", h.GetSampleSum())
+				add("_count", float64(h.GetSampleCount()))
+			}
+		}
+	}
+	return out, nil
+}
+
+// metricSink receives the monitor's metrics every push interval, for shops
+// that don't run Prometheus.
+type metricSink interface {
+	Name() string
+	Write(ctx context.Context, samples []metricSample) error
+}
+
+// metricSinks returns the configured metric sinks.
+func (c Config) metricSinks() []metricSink {
+	var sinks []metricSink
+	if c.InfluxURL != "" {
+		sinks = append(sinks, &influxSink{url: c.InfluxURL, token: c.InfluxToken})
+	}
+	if c.StatsDAddr != "" {
+		sinks = append(sinks, &statsdSink{addr: c.StatsDAddr, flavor: c.StatsDFlavor})
+	}
+	return sinks
+}
+
+// validateMetricSinks checks the metric sink settings.
+func (c Config) validateMetricSinks() error {
+	if c.InfluxURL != "" {
+		if u, err := url.Parse(c.InfluxURL); err != nil || u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("invalid InfluxDB URL %q: must be an http or https URL", c.InfluxURL)
+		}
+	}
+	if c.StatsDAddr != "" {
+		if _, _, err := net.SplitHostPort(c.StatsDAddr); err != nil {
+			return fmt.Errorf("invalid StatsD address %q: must be host:port", c.StatsDAddr)
+		}
+	}
+	if c.StatsDFlavor != StatsDPlain && c.StatsDFlavor != StatsDDog {
+		return fmt.Errorf("invalid StatsD flavor %q: must be %s or %s", c.StatsDFlavor, StatsDPlain, StatsDDog)
+	}
+	if (c.InfluxURL != "" || c.StatsDAddr != "") && c.MetricsPushInterval <= 0 {
+		return fmt.Errorf("metrics push interval must be positive, got %v", c.MetricsPushInterval)
+	}
+	return nil
+}
+
+// runMetricSinks pushes the monitor's own metrics, leaving out the Go runtime
+// and process metrics, to the metric sinks every push interval until ctx is
+// done. The sinks and interval are re-read on every reload, keeping the next
+// push one interval after the last. The registry is shared by the clusters,
+// so only the first dashboard runs it. Failed writes are not retried; the
+// next push carries the current values.
+func (d *Dashboard) runMetricSinks(ctx context.Context) {
+	announced := ""
+	last := time.Now()
+	for {
+		cfg := d.cfg()
+		sinks := cfg.metricSinks()
+		var timer *time.Timer
+		var tick <-chan time.Time
+		if len(sinks) > 0 {
+			names := make([]string, len(sinks))
+			for i, sink := range sinks {
+				names[i] = sink.Name()
+			}
+			if s := fmt.Sprint(names, cfg.MetricsPushInterval); s != announced {
+				slog.Info("Pushing metrics", "sinks", names, "interval", cfg.MetricsPushInterval)
+				announced = s
+			}
+			timer = time.NewTimer(time.Until(last.Add(cfg.MetricsPushInterval)))
+			tick = timer.C
+		} else {
+			announced = ""
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-d.configChanged():
+		case now := <-tick:
+			last = now
+			samples, err := gatherMetricSamples(d.metrics.registry, now)
+			if err != nil {
+				slog.Warn("Failed to gather metrics for the metric sinks", "error", err)
+				break
+			}
+			own := samples[:0]
+			for _, s := range samples {
+				if strings.HasPrefix(s.name(), metricsNamespace+"_") && !math.IsNaN(s.value) && !math.IsInf(s.value, 0) {
+					own = append(own, s)
+				}
+			}
+			for _, sink := range sinks {
+				wctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+				if err := sink.Write(wctx, own); err != nil {
+					slog.Warn("Failed to push metrics", "sink", sink.Name(), "error", err)
+				}
+				cancel()
+			}
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// influxSink writes the samples in InfluxDB line protocol to a write
+// endpoint: /api/v2/write?org=…&bucket=… of InfluxDB 2 and 3, or
+// /write?db=… of InfluxDB 1. The metric name is the measurement, the labels
+// are tags, and the value is the value field.
+type influxSink struct {
+	url   string
+	token string
+}
+
+func (s *influxSink) Name() string { return "influxdb" }
+
+func (s *influxSink) Write(ctx context.Context, samples []metricSample) error {
+	u, err := url.Parse(s.url)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %v", err)
+	}
+	q := u.Query()
+	if q.Get("precision") == "" {
+		q.Set("precision", "ms")
+		u.RawQuery = q.Encode()
+	}
+
+	var body bytes.Buffer
+	for _, sample := range samples {
+		body.WriteString(influxEscape(sample.name(), ", "))
+		for _, l := range sample.labels {
+			if l[0] == "__name__" || l[1] == "" {
+				continue
+			}
+			fmt.Fprintf(&body, ",%s=%s", influxEscape(l[0], ",= "), influxEscape(l[1], ",= "))
+		}
+		fmt.Fprintf(&body, " value=%s %d\n", strconv.FormatFloat(sample.value, 'g', -1, 64), sample.timestamp)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), &body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Token "+s.token)
+	}
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post: %v", err)
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// influxEscape backslash-escapes the characters special in a line protocol
+// measurement or tag.
+func influxEscape(s, special string) string {
+	if !strings.ContainsAny(s, special+`\`) {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if r == '\\' || strings.ContainsRune(special, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// statsdSink sends the samples as StatsD gauges over UDP. Counters are sent
+// as gauges too, since the samples are cumulative.
+type statsdSink struct {
+	addr   string
+	flavor string
+}
+
+func (s *statsdSink) Name() string { return s.flavor }
+
+func (s *statsdSink) Write(ctx context.Context, samples []metricSample) error {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "udp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %v", s.addr, err)
+	}
+	defer conn.Close()
+
+	var packet []byte
+	flush := func() error {
+		if len(packet) == 0 {
+			return nil
+		}
+		_, err := conn.Write(packet)
+		packet = packet[:0]
+		return err
+	}
+	for _, sample := range samples {
+		for _, line := range s.lines(sample) {
+			if len(packet) > 0 && len(packet)+1+len(line) > maxStatsDPacket {
+				if err := flush(); err != nil {
+					return fmt.Errorf("failed to send: %v", err)
+				}
+			}
+			if len(packet) > 0 {
+				packet = append(packet, '\n')
+			}
+			packet = append(packet, line...)
+		}
+	}
+	if err := flush(); err != nil {
+		return fmt.Errorf("failed to send: %v", err)
+	}
+	return nil
+}
+
+// lines renders a sample. StatsD reads a signed gauge value as a change, so
+// negative values are sent as a reset to zero followed by the decrement.
+func (s *statsdSink) lines(sample metricSample) []string {
+	name := statsdSanitize(sample.name())
+	var tags []string
+	for _, l := range sample.labels {
+		if l[0] == "__name__" || l[0] == "job" || l[1] == "" {
+			continue
+		}
+		if s.flavor == StatsDDog {
+			tags = append(tags, statsdSanitize(l[0])+":"+strings.NewReplacer(",", "_", "|", "_", "\n", "_").Replace(l[1]))
+		} else {
+			name += "." + statsdSanitize(l[1])
+		}
+	}
+	suffix := "|g"
+	if len(tags) > 0 {
+		suffix += "|#" + strings.Join(tags, ",")
+	}
+	value := strconv.FormatFloat(sample.value, 'f', -1, 64)
+	if sample.value < 0 {
+		return []string{name + ":0" + suffix, name + ":" + value + suffix}
+	}
+	return []string{name + ":" + value + suffix}
+}
+
+// statsdSanitize replaces the characters StatsD doesn't allow in names.
+func statsdSanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// newDashboards creates the dashboards for cfg: a single one for the
+// in-cluster or current kubeconfig context, or one per context listed in
+// cfg.Contexts. Dashboards of several clusters share an event hub and a
+// metrics registry, and each of them serves the merged pods of all of them.
+func newDashboards(cfg Config) ([]*Dashboard, error) {
+	if len(cfg.Contexts) == 0 {
+		d, err := NewDashboard(cfg, cfg.Context, newDashboardMetrics())
+		if err != nil {
+			return nil, err
+		}
+		return []*Dashboard{d}, nil
+	}
+
+	registry := newMetricsRegistry()
+	var dashboards []*Dashboard
+	for _, name := range cfg.Contexts {
+		clusterCfg := cfg
+		clusterCfg.StorePath = clusterStorePath(cfg.StorePath, name)
+		d, err := NewDashboard(clusterCfg, name, newClusterMetrics(registry, name))
+		if err != nil {
+			for _, prev := range dashboards {
+				prev.Close()
+			}
+			return nil, fmt.Errorf("cluster %s: %v", name, err)
+		}
+		d.cluster = name
+		if len(dashboards) > 0 {
+			// Nothing has subscribed yet, so the hub can still be swapped.
+			d.events = dashboards[0].events
+			d.recorder = dashboards[0].recorder
+		}
+		dashboards = append(dashboards, d)
+	}
+	for _, d := range dashboards {
+		d.peers = dashboards
+	}
+	return dashboards, nil
+}
+
+// clusterStorePath returns the history store file of a cluster. bbolt locks
+// its file, so every cluster needs its own.
+func clusterStorePath(path, cluster string) string {
+	if cluster == "" {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + cluster + ext
+}
+
+// clusters returns the dashboards whose pods this one serves: its peers when
+// monitoring several clusters, otherwise itself.
+func (d *Dashboard) clusters() []*Dashboard {
+	if d.peers == nil {
+		return []*Dashboard{d}
+	}
+	return d.peers
+}
+
+// byCluster routes a request to the dashboard of the cluster named by its
+// cluster query parameter, defaulting to the first cluster.
+func (d *Dashboard) byCluster(h func(*Dashboard, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("cluster")
+		c := d.clusterNamed(name)
+		if c == nil {
+			http.Error(w, fmt.Sprintf("Unknown cluster %q", name), http.StatusNotFound)
+			return
+		}
+		h(c, w, r)
+	}
+}
+
+// clusterNamed returns the dashboard of a cluster, the first for "", or nil
+// for unknown clusters.
+func (d *Dashboard) clusterNamed(name string) *Dashboard {
+	clusters := d.clusters()
+	if name == "" {
+		return clusters[0]
+	}
+	for _, c := range clusters {
+		if c.cluster == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// sortedPods returns a snapshot of the monitored pods of every cluster in
+// SortKey order.
+func (d *Dashboard) sortedPods() []*PodStatusInfo {
+	var pods []*PodStatusInfo
+	for _, c := range d.clusters() {
+		c.mu.RLock()
+		for _, pod := range c.pods {
+			pods = append(pods, pod)
+		}
+		c.mu.RUnlock()
+	}
+
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].SortKey() < pods[j].SortKey()
+	})
+	return pods
+}
+
+// handleAPI serves /api/pods, the monitored pods by namespace/name. With
+// several clusters the keys are prefixed with the cluster. The X-Revision header
+// tells the revision to pass as since to get only later changes, and the
+// ETag lets pollers revalidate with If-None-Match. Paging, filter or sort
+// parameters select a list of pods instead, see handlePodList, and at the
+// pods as they were at a past time, see handlePodsAt.
+func (d *Dashboard) handleAPI(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Has("at") {
+		d.handlePodsAt(w, r)
+		return
+	}
+	if r.URL.Query().Has("since") {
+		d.handlePodDelta(w, r)
+		return
+	}
+	if isPodListQuery(r.URL.Query()) {
+		d.handlePodList(w, r)
+		return
+	}
+	// Taking the revision first may repeat a change in the next delta but
+	// never misses one.
+	revision := d.events.revision()
+	body, etag, err := d.podsBody.get(revision, func() map[string]*PodStatusInfo {
+		pods := make(map[string]*PodStatusInfo)
+		for _, pod := range d.sortedPods() {
+			pods[pod.Key()] = pod
+		}
+		return pods
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode pods: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Revision", strconv.FormatUint(revision, 10))
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// requireMutations guards endpoints that change cluster objects. They answer
+// 403 unless --allow-mutations is set.
+func (d *Dashboard) requireMutations(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !d.cfg().AllowMutations {
+			http.Error(w, "Mutations are disabled; start the dashboard with --allow-mutations", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// PodActionResponse is the response of a pod delete or eviction.
+type PodActionResponse struct {
+	Pod       string `json:"pod"`
+	Namespace string `json:"namespace"`
+	Action    string `json:"action"`
+	// Replaced tells whether a controller will create a replacement.
+	Replaced bool `json:"replaced"`
+}
+
+// handlePodDelete serves POST /api/pods/{name}/delete. Deleting a pod owned
+// by a ReplicaSet restarts it: the controller creates a replacement that goes
+// through startup and readiness again.
+func (d *Dashboard) handlePodDelete(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	key, err := d.requestPodKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	d.mu.RLock()
+	status := d.pods[key]
+	d.mu.RUnlock()
+	if status == nil {
+		http.Error(w, "Pod not found", http.StatusNotFound)
+		return
+	}
+	pod, err := d.currentWatch().get(status.Namespace, name)
+	if err != nil {
+		http.Error(w, "Pod not found", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), d.cfg().FetchTimeout)
+	defer cancel()
+	err = d.clientset.CoreV1().Pods(pod.Namespace).Delete(ctx, name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &pod.UID},
+	})
+	d.audit(AuditEntry{actor: requestActor(r), Action: "delete", Namespace: pod.Namespace, Pod: name}, err)
+	switch {
+	case apierrors.IsNotFound(err) || apierrors.IsConflict(err):
+		http.Error(w, "Pod not found", http.StatusNotFound)
+		return
+	case apierrors.IsForbidden(err):
+		http.Error(w, fmt.Sprintf("Not allowed to delete the pod: %v", err), http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("Failed to delete the pod: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(PodActionResponse{name, pod.Namespace, "delete", metav1.GetControllerOf(pod) != nil})
+}
+
+// ScaleRequest is the body of POST /api/deployments/{name}/scale. Namespace
+// is only needed when Deployments of that name exist in several watched
+// namespaces.
+type ScaleRequest struct {
+	Replicas  *int32 `json:"replicas"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// ScaleResponse is the response of POST /api/deployments/{name}/scale.
+type ScaleResponse struct {
+	Deployment string `json:"deployment"`
+	Namespace  string `json:"namespace"`
+	Previous   int32  `json:"previousReplicas"`
+	Replicas   int32  `json:"replicas"`
+}
+
+// handleDeploymentScale serves POST /api/deployments/{name}/scale through
+// the Deployment's scale subresource.
+func (d *Dashboard) handleDeploymentScale(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	var req ScaleRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Replicas == nil || *req.Replicas < 0 {
+		http.Error(w, "replicas must be set to a number of at least 0", http.StatusBadRequest)
+		return
+	}
+
+	var candidates []*appsv1.Deployment
+	for _, dep := range d.currentWatch().deploymentsNamed(name) {
+		if req.Namespace == "" || dep.Namespace == req.Namespace {
+			candidates = append(candidates, dep)
+		}
+	}
+	switch {
+	case len(candidates) == 0:
+		http.Error(w, "Deployment not found", http.StatusNotFound)
+		return
+	case len(candidates) > 1:
+		http.Error(w, "Deployment exists in several namespaces; set namespace", http.StatusConflict)
+		return
+	}
+	dep := candidates[0]
+
+	ctx, cancel := context.WithTimeout(r.Context(), d.cfg().FetchTimeout)
+	defer cancel()
+	deployments := d.clientset.AppsV1().Deployments(dep.Namespace)
+	scale, err := deployments.GetScale(ctx, name, metav1.GetOptions{})
+	var previous int32
+	if err == nil {
+		previous = scale.Spec.Replicas
+		scale.Spec.Replicas = *req.Replicas
+		_, err = deployments.UpdateScale(ctx, name, scale, metav1.UpdateOptions{})
+	}
+	d.audit(AuditEntry{
+		actor: requestActor(r), Action: "scale", Namespace: dep.Namespace, Deployment: name,
+		Detail: fmt.Sprintf("%d -> %d replicas", previous, *req.Replicas),
+	}, err)
+	switch {
+	case apierrors.IsNotFound(err):
+		http.Error(w, "Deployment not found", http.StatusNotFound)
+		return
+	case apierrors.IsConflict(err):
+		http.Error(w, "Deployment changed meanwhile; retry", http.StatusConflict)
+		return
+	case apierrors.IsForbidden(err):
+		http.Error(w, fmt.Sprintf("Not allowed to scale the deployment: %v", err), http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("Failed to scale the deployment: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(ScaleResponse{name, dep.Namespace, previous, *req.Replicas})
+}
+
+// handlePodEvict serves POST /api/pods/{name}/evict through the Eviction
+// API. Unlike a delete, the API server refuses the eviction with 429 while it
+// would violate a PodDisruptionBudget, which counts only ready pods as
+// healthy.
+func (d *Dashboard) handlePodEvict(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	key, err := d.requestPodKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	d.mu.RLock()
+	status := d.pods[key]
+	d.mu.RUnlock()
+	if status == nil {
+		http.Error(w, "Pod not found", http.StatusNotFound)
+		return
+	}
+	pod, err := d.currentWatch().get(status.Namespace, name)
+	if err != nil {
+		http.Error(w, "Pod not found", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), d.cfg().FetchTimeout)
+	defer cancel()
+	err = d.evictPod(ctx, pod)
+	d.audit(AuditEntry{actor: requestActor(r), Action: "evict", Namespace: pod.Namespace, Pod: name}, err)
+	switch {
+	case apierrors.IsTooManyRequests(err):
+		http.Error(w, "Eviction refused: "+evictionRefusal(err), http.StatusTooManyRequests)
+		return
+	case apierrors.IsNotFound(err) || apierrors.IsConflict(err):
+		http.Error(w, "Pod not found", http.StatusNotFound)
+		return
+	case apierrors.IsForbidden(err):
+		http.Error(w, fmt.Sprintf("Not allowed to evict the pod: %v", err), http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("Failed to evict the pod: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(PodActionResponse{name, pod.Namespace, "evict", metav1.GetControllerOf(pod) != nil})
+}
+
+// evictPod evicts a pod through the Eviction API, unless it was replaced.
+func (d *Dashboard) evictPod(ctx context.Context, pod *corev1.Pod) error {
+	return d.clientset.PolicyV1().Evictions(pod.Namespace).Evict(ctx, &policyv1.Eviction{
+		ObjectMeta:    metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+		DeleteOptions: &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &pod.UID}},
+	})
+}
+
+// evictionRefusal describes an eviction refused with 429: the disruption
+// budget doesn't allow it right now, and its causes tell how many healthy
+// pods it needs.
+func evictionRefusal(err error) string {
+	msg := err.Error()
+	if status, ok := err.(apierrors.APIStatus); ok && status.Status().Details != nil {
+		for _, cause := range status.Status().Details.Causes {
+			msg += " " + cause.Message
+		}
+	}
+	return msg
+}
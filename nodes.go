@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NodeCondition is a condition the kubelet reports on its node, such as
+// Ready or MemoryPressure.
+type NodeCondition struct {
+	Type   string    `json:"type"`
+	Status string    `json:"status"`
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since"`
+}
+
+// ReadyCounts count pods by readiness.
+type ReadyCounts struct {
+	Pods    int `json:"pods"`
+	Ready   int `json:"ready"`
+	Unready int `json:"unready"`
+	// Unknown are the pods whose readiness couldn't be scraped.
+	Unknown int `json:"unknown"`
+}
+
+func (c *ReadyCounts) add(p *PodStatusInfo) {
+	c.Pods++
+	switch {
+	case p.Effective != nil && p.Effective.Ready, p.Effective == nil && p.Info != nil && p.Info.ProbeStatus.Ready:
+		c.Ready++
+	case p.Info == nil:
+		c.Unknown++
+	default:
+		c.Unready++
+	}
+}
+
+// NodeRollup sums up the monitored pods on a node next to the node's state.
+type NodeRollup struct {
+	Name string `json:"name"`
+	ReadyCounts
+	PodNames []string `json:"podNames"`
+
+	Zone           string          `json:"zone,omitempty"`
+	Region         string          `json:"region,omitempty"`
+	KubeletVersion string          `json:"kubeletVersion,omitempty"`
+	Unschedulable  bool            `json:"unschedulable"`
+	Conditions     []NodeCondition `json:"conditions,omitempty"`
+	// Error is set when the node couldn't be looked up, and the node's
+	// fields are then empty.
+	Error string `json:"error,omitempty"`
+}
+
+// nodeRollups counts the monitored pods per node and adds what the nodes
+// report, ordered by node name.
+func (d *Dashboard) nodeRollups() []NodeRollup {
+	rollups := make(map[string]*NodeRollup)
+	d.mu.RLock()
+	for _, p := range d.pods {
+		if p.Node == "" {
+			continue
+		}
+		r := rollups[p.Node]
+		if r == nil {
+			r = &NodeRollup{Name: p.Node}
+			rollups[p.Node] = r
+		}
+		r.add(p)
+		r.PodNames = append(r.PodNames, p.Name)
+	}
+	d.mu.RUnlock()
+
+	watch := d.currentWatch()
+	out := make([]NodeRollup, 0, len(rollups))
+	for _, r := range rollups {
+		sort.Strings(r.PodNames)
+		node, err := watch.node(r.Name)
+		if err != nil {
+			r.Error = err.Error()
+		} else {
+			r.Zone = node.Labels[corev1.LabelTopologyZone]
+			r.Region = node.Labels[corev1.LabelTopologyRegion]
+			r.KubeletVersion = node.Status.NodeInfo.KubeletVersion
+			r.Unschedulable = node.Spec.Unschedulable
+			for _, c := range node.Status.Conditions {
+				r.Conditions = append(r.Conditions, NodeCondition{
+					Type: string(c.Type), Status: string(c.Status), Reason: c.Reason, Since: c.LastTransitionTime.Time,
+				})
+			}
+		}
+		out = append(out, *r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// handleNodes serves GET /api/nodes, the monitored pods rolled up per node.
+func (d *Dashboard) handleNodes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d.nodeRollups())
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Notification is a message delivered through the configured notifiers.
+type Notification struct {
+	Kind   string            `json:"kind"`
+	Title  string            `json:"title"`
+	Text   string            `json:"text"`
+	Fields map[string]string `json:"fields,omitempty"`
+	Time   time.Time         `json:"time"`
+	// Key identifies what the notification is about, such as a pod's probe
+	// or an alert, so incident tools can deduplicate it. Resolved marks the
+	// recovery from what an earlier notification with the same key reported.
+	// Notifications without a key, such as digests, are informational.
+	Key      string `json:"key,omitempty"`
+	Resolved bool   `json:"resolved,omitempty"`
+}
+
+// Notifier delivers notifications to an external system.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, n Notification) error
+}
+
+// notifyAll sends n through every notifier, logging failures instead of
+// returning them so one broken sink does not block the others.
+func notifyAll(ctx context.Context, notifiers []Notifier, n Notification) {
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(ctx, n); err != nil {
+			slog.Error("Error sending notification", "kind", n.Kind, "notifier", notifier.Name(), "error", err)
+		}
+	}
+}
+
+// SlackNotifier posts notifications to a Slack incoming webhook.
+type SlackNotifier struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+func (s *SlackNotifier) Name() string { return "slack" }
+
+func (s *SlackNotifier) Notify(ctx context.Context, n Notification) error {
+	payload := map[string]string{
+		"text": fmt.Sprintf("*%s*\n%s", n.Title, n.Text),
+	}
+	return postJSON(ctx, s.Client, s.WebhookURL, payload)
+}
+
+// WebhookNotifier posts the notification as JSON to an arbitrary endpoint.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func (w *WebhookNotifier) Name() string { return "webhook" }
+
+func (w *WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	return postJSON(ctx, w.Client, w.URL, n)
+}
+
+// outboundClient sends the monitor's requests to sinks and backends instead
+// of http.DefaultClient, whose transport any imported package may change.
+// Requests are bounded by their contexts; Timeout is a backstop.
+var outboundClient = &http.Client{
+	Transport: http.DefaultTransport.(*http.Transport).Clone(),
+	Timeout:   time.Minute,
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, payload any) error {
+	return postJSONHeader(ctx, client, url, nil, payload)
+}
+
+// postJSONHeader posts payload with additional request headers, such as
+// credentials.
+func postJSONHeader(ctx context.Context, client *http.Client, url string, header http.Header, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// sessionCookie holds the logged-in user, loginCookie the state of a
+	// login in progress.
+	sessionCookie = "probe-monitor-session"
+	loginCookie   = "probe-monitor-login"
+	sessionTTL    = 12 * time.Hour
+	loginTTL      = 10 * time.Minute
+)
+
+// oidcProvider logs users in with the authorization code flow and PKCE and
+// verifies the ID tokens of the issuer. Sessions are HMAC-signed cookies, so
+// nothing is kept server side.
+type oidcProvider struct {
+	oauth    oauth2.Config
+	verifier *oidc.IDTokenVerifier
+	client   *http.Client
+	// secure marks cookies Secure when the dashboard is served over https.
+	secure bool
+	// key signs the cookies. It derives from the client secret so sessions
+	// survive restarts and work across replicas.
+	key []byte
+}
+
+// newOIDCProvider discovers the issuer's endpoints. Its keys are fetched on
+// the first verification and again after a key rotation.
+func newOIDCProvider(ctx context.Context, cfg Config) (*oidcProvider, error) {
+	p := &oidcProvider{
+		client: &http.Client{Timeout: 10 * time.Second},
+		secure: strings.HasPrefix(cfg.OIDCRedirectURL, "https://"),
+	}
+	provider, err := oidc.NewProvider(oidc.ClientContext(ctx, p.client), cfg.OIDCIssuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC issuer: %v", err)
+	}
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: cfg.OIDCClientID})
+	p.oauth = oauth2.Config{
+		ClientID:     cfg.OIDCClientID,
+		ClientSecret: cfg.OIDCClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  cfg.OIDCRedirectURL,
+		Scopes:       []string{oidc.ScopeOpenID, "email"},
+	}
+
+	if cfg.OIDCClientSecret != "" {
+		sum := sha256.Sum256([]byte("k8s-probe-monitor session\x00" + cfg.OIDCClientSecret))
+		p.key = sum[:]
+	} else {
+		p.key = make([]byte, 32)
+		rand.Read(p.key)
+	}
+	return p, nil
+}
+
+// idTokenClaims are the ID token claims the user is read from.
+type idTokenClaims struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified *bool  `json:"email_verified"`
+}
+
+// user is the identity shown in the audit log: the verified email, or the
+// subject when the issuer doesn't provide one.
+func (c *idTokenClaims) user() string {
+	if c.Email != "" && (c.EmailVerified == nil || *c.EmailVerified) {
+		return c.Email
+	}
+	return c.Subject
+}
+
+// verify checks the signature and claims of an ID token issued to the
+// dashboard and returns its user. nonce is checked when not empty.
+func (p *oidcProvider) verify(ctx context.Context, raw, nonce string) (string, error) {
+	token, err := p.verifier.Verify(ctx, raw)
+	if err != nil {
+		return "", err
+	}
+	if nonce != "" && subtle.ConstantTimeCompare([]byte(token.Nonce), []byte(nonce)) != 1 {
+		return "", fmt.Errorf("ID token nonce mismatch")
+	}
+	var claims idTokenClaims
+	if err := token.Claims(&claims); err != nil {
+		return "", fmt.Errorf("malformed ID token claims: %v", err)
+	}
+	return claims.user(), nil
+}
+
+// oidcSession and oidcLogin are the payloads of the session and login
+// cookies.
+type oidcSession struct {
+	User    string `json:"user"`
+	Expires int64  `json:"exp"`
+}
+
+type oidcLogin struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Next     string `json:"next"`
+	Expires  int64  `json:"exp"`
+}
+
+// seal encodes v as a signed cookie value.
+func (p *oidcProvider) seal(v any) string {
+	data, _ := json.Marshal(v)
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write(data)
+	return base64.RawURLEncoding.EncodeToString(data) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// open decodes a cookie value made by seal into v, reporting whether its
+// signature is valid.
+func (p *oidcProvider) open(value string, v any) bool {
+	payload, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write(data)
+	return hmac.Equal(mac.Sum(nil), want) && json.Unmarshal(data, v) == nil
+}
+
+// setCookie sets a cookie for ttl; a negative ttl deletes it.
+func (p *oidcProvider) setCookie(w http.ResponseWriter, name, value, path string, ttl time.Duration) {
+	maxAge := int(ttl.Seconds())
+	if ttl < 0 {
+		maxAge = -1
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   p.secure,
+		// Lax keeps the session off cross-site POSTs.
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// session returns the user of r's session cookie.
+func (p *oidcProvider) session(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return "", false
+	}
+	var s oidcSession
+	if !p.open(cookie.Value, &s) || time.Now().Unix() > s.Expires {
+		return "", false
+	}
+	return s.User, true
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// handleLogin serves GET /auth/login and sends the browser to the provider.
+// next is the dashboard page to return to.
+func (d *Dashboard) handleLogin(w http.ResponseWriter, r *http.Request) {
+	next := r.URL.Query().Get("next")
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		next = "/"
+	}
+	login := oidcLogin{
+		State:    randomString(),
+		Nonce:    randomString(),
+		Verifier: oauth2.GenerateVerifier(),
+		Next:     next,
+		Expires:  time.Now().Add(loginTTL).Unix(),
+	}
+	d.oidc.setCookie(w, loginCookie, d.oidc.seal(login), "/auth/", loginTTL)
+	http.Redirect(w, r, d.oidc.oauth.AuthCodeURL(login.State,
+		oauth2.S256ChallengeOption(login.Verifier), oauth2.SetAuthURLParam("nonce", login.Nonce)), http.StatusFound)
+}
+
+// handleLoginCallback serves GET /auth/callback, where the provider returns
+// the browser with an authorization code. The code is exchanged for an ID
+// token whose user gets a session cookie.
+func (d *Dashboard) handleLoginCallback(w http.ResponseWriter, r *http.Request) {
+	p := d.oidc
+	query := r.URL.Query()
+	if msg := query.Get("error"); msg != "" {
+		http.Error(w, fmt.Sprintf("Login failed: %s %s", msg, query.Get("error_description")), http.StatusUnauthorized)
+		return
+	}
+	cookie, err := r.Cookie(loginCookie)
+	var login oidcLogin
+	if err != nil || !p.open(cookie.Value, &login) || time.Now().Unix() > login.Expires ||
+		subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(login.State)) != 1 {
+		http.Error(w, "Login expired or invalid; start again at /auth/login", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), oauth2.HTTPClient, p.client)
+	token, err := p.oauth.Exchange(ctx, query.Get("code"), oauth2.VerifierOption(login.Verifier))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Login failed: %v", err), http.StatusBadGateway)
+		return
+	}
+	raw, _ := token.Extra("id_token").(string)
+	if raw == "" {
+		http.Error(w, "Login failed: the provider returned no ID token", http.StatusBadGateway)
+		return
+	}
+	user, err := p.verify(ctx, raw, login.Nonce)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Login failed: %v", err), http.StatusUnauthorized)
+		return
+	}
+	if !allowedUser(user, d.cfg().OIDCAllowedUsers) {
+		slog.Warn("Refused login of user not allowed", "user", user, "remote", r.RemoteAddr)
+		http.Error(w, fmt.Sprintf("User %s is not allowed to use the dashboard", user), http.StatusForbidden)
+		return
+	}
+
+	slog.Info("User logged in", "user", user, "remote", r.RemoteAddr)
+	p.setCookie(w, loginCookie, "", "/auth/", -1)
+	p.setCookie(w, sessionCookie, p.seal(oidcSession{User: user, Expires: time.Now().Add(sessionTTL).Unix()}), "/", sessionTTL)
+	http.Redirect(w, r, login.Next, http.StatusFound)
+}
+
+// handleLogout serves GET /auth/logout and ends the session.
+func (d *Dashboard) handleLogout(w http.ResponseWriter, r *http.Request) {
+	d.oidc.setCookie(w, sessionCookie, "", "/", -1)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "Logged out.")
+}
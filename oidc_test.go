@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testIssuer serves the discovery document and keys of an OIDC issuer and
+// signs ID tokens with its key.
+type testIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := &testIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                iss.URL,
+			"authorization_endpoint":                iss.URL + "/auth",
+			"token_endpoint":                        iss.URL + "/token",
+			"jwks_uri":                              iss.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []any{map[string]string{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	iss.Server = httptest.NewServer(mux)
+	t.Cleanup(iss.Close)
+	return iss
+}
+
+// sign returns an RS256 ID token with claims, signed with key.
+func (iss *testIssuer) sign(t *testing.T, key *rsa.PrivateKey, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestOIDCVerify(t *testing.T) {
+	iss := newTestIssuer(t)
+	p, err := newOIDCProvider(context.Background(), Config{
+		OIDCIssuer:      iss.URL,
+		OIDCClientID:    "dashboard",
+		OIDCRedirectURL: "https://dashboard.example/auth/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := func(change func(map[string]any)) map[string]any {
+		c := map[string]any{
+			"iss":   iss.URL,
+			"sub":   "1234",
+			"aud":   "dashboard",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"iat":   time.Now().Unix(),
+			"nonce": "n-1",
+			"email": "ada@example.com",
+		}
+		if change != nil {
+			change(c)
+		}
+		return c
+	}
+	tests := []struct {
+		name    string
+		key     *rsa.PrivateKey
+		claims  map[string]any
+		nonce   string
+		want    string
+		wantErr bool
+	}{
+		{name: "valid", claims: claims(nil), nonce: "n-1", want: "ada@example.com"},
+		{name: "nonce unchecked", claims: claims(nil), want: "ada@example.com"},
+		{name: "audience list", claims: claims(func(c map[string]any) { c["aud"] = []string{"other", "dashboard"} }), want: "ada@example.com"},
+		{name: "unverified email", claims: claims(func(c map[string]any) { c["email_verified"] = false }), want: "1234"},
+		{name: "no email", claims: claims(func(c map[string]any) { delete(c, "email") }), want: "1234"},
+		{name: "nonce mismatch", claims: claims(nil), nonce: "n-2", wantErr: true},
+		{name: "other audience", claims: claims(func(c map[string]any) { c["aud"] = "other" }), wantErr: true},
+		{name: "other issuer", claims: claims(func(c map[string]any) { c["iss"] = "https://issuer.example" }), wantErr: true},
+		{name: "expired", claims: claims(func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() }), wantErr: true},
+		{name: "other key", key: other, claims: claims(nil), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := tt.key
+			if key == nil {
+				key = iss.key
+			}
+			user, err := p.verify(context.Background(), iss.sign(t, key, tt.claims), tt.nonce)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("verify() = %q, want an error", user)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verify() error = %v", err)
+			}
+			if user != tt.want {
+				t.Errorf("verify() = %q, want %q", user, tt.want)
+			}
+		})
+	}
+
+	if _, err := p.verify(context.Background(), "not.a.token", ""); err == nil {
+		t.Error("verify() of a malformed token succeeded")
+	}
+}
+
+func TestOIDCSeal(t *testing.T) {
+	p := &oidcProvider{key: []byte("0123456789abcdef0123456789abcdef")}
+	value := p.seal(oidcSession{User: "ada@example.com", Expires: 42})
+
+	var s oidcSession
+	if !p.open(value, &s) || s.User != "ada@example.com" || s.Expires != 42 {
+		t.Fatalf("open(seal()) = %+v", s)
+	}
+	tests := []struct {
+		name, value string
+	}{
+		{"empty", ""},
+		{"no signature", value[:len(value)/2]},
+		{"tampered", "x" + value[1:]},
+		{"other key", (&oidcProvider{key: []byte("other")}).seal(oidcSession{User: "ada@example.com"})},
+	}
+	for _, tt := range tests {
+		if p.open(tt.value, &s) {
+			t.Errorf("open(%s) succeeded", tt.name)
+		}
+	}
+}
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pascal71/k8s-probe-monitor/pkg/api"
+)
+
+// apiOperation describes an API endpoint for the OpenAPI document. Bodies
+// and responses are Go values whose types the schemas are generated from.
+type apiOperation struct {
+	method, path, summary string
+	params                []apiParam
+	body                  any
+	status                int
+	// responses are the alternative response bodies; contentType
+	// overrides JSON for the first.
+	responses   []any
+	contentType string
+	// mutating operations are guarded by requireToken, private reads by
+	// requireAuth.
+	mutating, private bool
+}
+
+// apiParam is a query or path parameter; path parameters are the ones named
+// in the path.
+type apiParam struct {
+	name, description, typ string
+	enum                   []string
+}
+
+var (
+	podNameParam      = apiParam{name: "name", description: "Pod name", typ: "string"}
+	podNamespaceParam = apiParam{name: "namespace", description: "Namespace of the pod; required when pods of that name exist in several namespaces", typ: "string"}
+	clusterParam      = apiParam{name: "cluster", description: "Cluster (kubeconfig context) of the pod when monitoring several clusters; the first by default", typ: "string"}
+)
+
+// apiOperations is the REST surface described at /api/openapi.json.
+var apiOperations = []apiOperation{
+	{
+		method: "GET", path: "/api/pods",
+		summary: "List the monitored pods: every pod keyed by namespace/name, now or at a past time, the changes since a revision or time, or a filtered and sorted page",
+		params: []apiParam{
+			{name: "since", description: "Revision (from X-Revision or an earlier delta) or RFC 3339 time; returns only the changes after it", typ: "string"},
+			{name: "at", description: "RFC 3339 time; returns every pod as it was at that time, reconstructed from the history store", typ: "string"},
+			{name: "wait", description: "With since, how long to wait for a change when there is none, such as 30s; at most 1m", typ: "string"},
+			{name: "limit", description: "Page size; at most 1000", typ: "integer"},
+			{name: "offset", description: "Position of the first pod returned", typ: "integer"},
+			{name: "continue", description: "Token of the next page from the previous response", typ: "string"},
+			{name: "sort", description: "Sort key, descending with a leading -", typ: "string", enum: []string{"name", "-name", "namespace", "-namespace", "node", "-node", "status", "-status", "age", "-age"}},
+			{name: "cluster", description: "Only pods of this cluster", typ: "string"},
+			{name: "namespace", description: "Only pods in this namespace", typ: "string"},
+			{name: "node", description: "Only pods on this node", typ: "string"},
+			{name: "replicaSet", description: "Only pods of this ReplicaSet, by name or pod-template-hash", typ: "string"},
+			{name: "status", description: "Only pods with this status, such as Running", typ: "string"},
+			{name: "ready", description: "Only pods whose application reports ready, not ready or nothing", typ: "string", enum: []string{"true", "false", "unknown"}},
+		},
+		responses: []any{map[string]*PodStatusInfo{}, PodDelta{}, PodList{}},
+	},
+	{
+		method: "GET", path: "/api/pods/{name}/history", summary: "Probe transitions of a pod",
+		params: []apiParam{podNameParam, podNamespaceParam, clusterParam}, responses: []any{HistoryResponse{}},
+	},
+	{
+		method: "GET", path: "/api/pods/{name}/events", summary: "Recent Kubernetes events of a pod",
+		params: []apiParam{podNameParam, podNamespaceParam, clusterParam}, responses: []any{KubeEventsResponse{}},
+	},
+	{
+		method: "POST", path: "/api/pods/{name}/probes/{probe}/{action}", summary: "Fail or recover a probe of a pod",
+		params: []apiParam{
+			podNameParam,
+			podNamespaceParam,
+			{name: "probe", typ: "string", enum: []string{api.ProbeStartup, api.ProbeLiveness, api.ProbeReadiness}},
+			{name: "action", typ: "string", enum: []string{api.ActionFail, api.ActionRecover}},
+			clusterParam,
+		},
+		responses: []any{ProbeActionResponse{}}, mutating: true,
+	},
+	{
+		method: "POST", path: "/api/pods/{name}/delete", summary: "Delete a pod",
+		params: []apiParam{podNameParam, podNamespaceParam, clusterParam}, status: http.StatusAccepted, responses: []any{PodActionResponse{}}, mutating: true,
+	},
+	{
+		method: "POST", path: "/api/pods/{name}/evict", summary: "Evict a pod, respecting its PodDisruptionBudget",
+		params: []apiParam{podNameParam, podNamespaceParam, clusterParam}, status: http.StatusAccepted, responses: []any{PodActionResponse{}}, mutating: true,
+	},
+	{
+		method: "GET", path: "/api/deployments", summary: "Rollout status of the Deployments of the monitored pods",
+		params: []apiParam{clusterParam}, responses: []any{[]DeploymentStatus{}},
+	},
+	{
+		method: "GET", path: "/api/deployments/{name}/rollouts", summary: "Duration, surge and unavailability of a Deployment's recent rollouts, newest first",
+		params: []apiParam{
+			{name: "name", description: "Deployment name", typ: "string"},
+			{name: "namespace", description: "Only the Deployment in this namespace", typ: "string"},
+			clusterParam,
+		},
+		responses: []any{[]RolloutReport{}},
+	},
+	{
+		method: "POST", path: "/api/nodes/{name}/cordon", summary: "Mark a node unschedulable",
+		params: []apiParam{{name: "name", description: "Node name", typ: "string"}, clusterParam}, responses: []any{NodeActionResponse{}}, mutating: true,
+	},
+	{
+		method: "POST", path: "/api/nodes/{name}/uncordon", summary: "Mark a node schedulable again",
+		params: []apiParam{{name: "name", description: "Node name", typ: "string"}, clusterParam}, responses: []any{NodeActionResponse{}}, mutating: true,
+	},
+	{
+		method: "POST", path: "/api/nodes/{name}/drain", summary: "Cordon a node and evict the monitored pods on it, respecting their PodDisruptionBudgets",
+		params: []apiParam{{name: "name", description: "Node name", typ: "string"}, clusterParam},
+		status: http.StatusAccepted, responses: []any{DrainReport{}}, mutating: true,
+	},
+	{
+		method: "POST", path: "/api/deployments/{name}/scale", summary: "Scale a Deployment",
+		params: []apiParam{{name: "name", description: "Deployment name", typ: "string"}, clusterParam},
+		body:   ScaleRequest{}, status: http.StatusAccepted, responses: []any{ScaleResponse{}}, mutating: true,
+	},
+	{
+		method: "POST", path: "/api/actions/bulk", summary: "Fail or recover a probe of every pod matching a selector, ReplicaSet or node",
+		params: []apiParam{clusterParam}, body: BulkActionRequest{}, responses: []any{BulkActionReport{}}, mutating: true,
+	},
+	{method: "GET", path: "/api/alerts", summary: "Alerts of the alert rules that are firing", params: []apiParam{clusterParam}, responses: []any{[]Alert{}}},
+	{
+		method: "GET", path: "/api/report", summary: "Self-contained HTML report of the pods: summary counts, pod cards and recent transitions; print it for a PDF",
+		params: []apiParam{clusterParam}, responses: []any{""}, contentType: "text/html",
+	},
+	{
+		method: "GET", path: "/api/export", summary: "Stream the stored probe transitions and scrape results as CSV or JSON lines",
+		params: []apiParam{
+			{name: "format", typ: "string", enum: []string{ExportCSV, ExportJSONL}},
+			{name: "from", description: "RFC 3339 time of the oldest record; a day ago by default", typ: "string"},
+			{name: "to", description: "RFC 3339 time the records end at; now by default", typ: "string"},
+			{name: "namespace", description: "Only records of pods in this namespace", typ: "string"},
+			{name: "pod", description: "Only records of pods of this name", typ: "string"},
+			clusterParam,
+		},
+		responses: []any{ExportRecord{}}, contentType: "application/x-ndjson",
+	},
+	{
+		method: "GET", path: "/api/audit", summary: "Audit log of probe actions and other changes",
+		params: []apiParam{
+			{name: "from", description: "RFC 3339 time of the oldest entry", typ: "string"},
+			{name: "to", description: "RFC 3339 time of the newest entry", typ: "string"},
+			{name: "limit", description: "Return only the newest entries", typ: "integer"},
+			{name: "pod", typ: "string"},
+			{name: "action", typ: "string"},
+			clusterParam,
+		},
+		responses: []any{[]AuditEntry{}}, private: true,
+	},
+	{method: "GET", path: "/api/chaos", summary: "Chaos schedules", params: []apiParam{clusterParam}, responses: []any{[]ChaosSchedule{}}},
+	{
+		method: "POST", path: "/api/chaos", summary: "Create a chaos schedule",
+		params: []apiParam{clusterParam}, body: ChaosSchedule{}, status: http.StatusCreated, responses: []any{ChaosSchedule{}}, mutating: true,
+	},
+	{
+		method: "GET", path: "/api/chaos/{id}", summary: "A chaos schedule",
+		params: []apiParam{{name: "id", typ: "string"}, clusterParam}, responses: []any{ChaosSchedule{}},
+	},
+	{
+		method: "PUT", path: "/api/chaos/{id}", summary: "Replace a chaos schedule",
+		params: []apiParam{{name: "id", typ: "string"}, clusterParam}, body: ChaosSchedule{}, responses: []any{ChaosSchedule{}}, mutating: true,
+	},
+	{
+		method: "DELETE", path: "/api/chaos/{id}", summary: "Delete a chaos schedule, recovering the probes it holds failed",
+		params: []apiParam{{name: "id", typ: "string"}, clusterParam}, status: http.StatusNoContent, mutating: true,
+	},
+	{method: "GET", path: "/api/recordings", summary: "Saved recordings of pod changes and actions, and the one in progress", responses: []any{[]RecordingInfo{}}, private: true},
+	{
+		method: "POST", path: "/api/recordings", summary: "Start recording every pod change and action, starting with the pods as they are",
+		body: StartRecordingRequest{}, status: http.StatusCreated, responses: []any{RecordingInfo{}}, mutating: true,
+	},
+	{method: "POST", path: "/api/recordings/stop", summary: "Stop the recording in progress and save it", responses: []any{RecordingInfo{}}, mutating: true},
+	{
+		method: "GET", path: "/api/recordings/{name}", summary: "A saved recording as JSON lines: its description, then its events; replay it with --replay",
+		params: []apiParam{{name: "name", typ: "string"}}, responses: []any{RecordedEvent{}}, contentType: "application/x-ndjson", private: true,
+	},
+	{
+		method: "GET", path: "/api/compare", summary: "Readiness, restarts, startup and scrape latency of two ReplicaSets of a Deployment side by side",
+		params: []apiParam{
+			{name: "rs", description: "The two ReplicaSet names, separated by a comma", typ: "string"},
+			{name: "namespace", description: "Namespace of the ReplicaSets, if their names are ambiguous", typ: "string"},
+			clusterParam,
+		},
+		responses: []any{CompareResponse{}},
+	},
+	{
+		method: "GET", path: "/api/analytics/startup", summary: "Time from pod creation to Started and Ready per ReplicaSet or other controller revision",
+		params: []apiParam{clusterParam}, responses: []any{[]RevisionStartup{}},
+	},
+	{
+		method: "GET", path: "/api/timeline", summary: "Readiness state of every pod in time buckets, for a heatmap of when pods were unready, failing or unreachable",
+		params: []apiParam{
+			{name: "window", description: "How far back the timeline goes, such as 1h (the default)", typ: "string"},
+			{name: "bucket", description: "Bucket size, such as 10s (the default); at most 2000 buckets", typ: "string"},
+			clusterParam,
+		},
+		responses: []any{TimelineResponse{}},
+	},
+	{
+		method: "GET", path: "/api/slo", summary: "Readiness uptime over 1h, 24h and 7d and error budget burn per workload and pod",
+		params: []apiParam{clusterParam}, responses: []any{SLOResponse{}},
+	},
+	{method: "GET", path: "/api/stats", summary: "Pod counts and readiness propagation statistics", params: []apiParam{clusterParam}, responses: []any{StatsResponse{}}},
+	{
+		method: "GET", path: "/api/nodes", summary: "Monitored pods per node with their readiness, next to the node's conditions, zone and kubelet version",
+		params: []apiParam{clusterParam}, responses: []any{[]NodeRollup{}},
+	},
+	{
+		method: "GET", path: "/api/zones", summary: "Monitored pods per topology zone with their readiness and nodes",
+		params: []apiParam{clusterParam}, responses: []any{[]ZoneRollup{}},
+	},
+	{method: "GET", path: "/api/status", summary: "Kubernetes API connection state of every cluster", responses: []any{APIStatusResponse{}}},
+	{
+		method: "GET", path: "/api/stream", summary: "Server-Sent Events of pod changes, starting with every pod",
+		params:    []apiParam{{name: "html", description: "Set to 1 to add the rendered pod card to updates", typ: "string"}},
+		responses: []any{PodEvent{}}, contentType: "text/event-stream",
+	},
+	{
+		method: "GET", path: "/api/graphql", summary: "Run a GraphQL query over pods, deployments, history and events",
+		params: []apiParam{
+			{name: "query", typ: "string"},
+			{name: "variables", description: "JSON object of the query's variables", typ: "string"},
+			{name: "operationName", typ: "string"},
+		},
+		responses: []any{GraphQLResponse{}},
+	},
+	{method: "POST", path: "/api/graphql", summary: "Run a GraphQL query", body: GraphQLRequest{}, responses: []any{GraphQLResponse{}}},
+	{method: "GET", path: "/api/schema", summary: "JSON Schema of the PodInfo document targets serve", responses: []any{map[string]any{}}, contentType: "application/schema+json"},
+}
+
+// openAPISchemas generates the component schemas of Go types the way
+// encoding/json encodes them.
+type openAPISchemas struct {
+	components map[string]any
+	names      map[reflect.Type]string
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// schema returns the schema of t, referring to struct types by name.
+func (s *openAPISchemas) schema(t reflect.Type) map[string]any {
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := s.schema(t.Elem())
+		if _, ok := schema["$ref"]; ok {
+			// OpenAPI 3.0 ignores siblings of $ref.
+			return map[string]any{"allOf": []any{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		schema := map[string]any{"type": "integer"}
+		if t.Kind() == reflect.Int64 || t.Kind() == reflect.Uint64 {
+			schema["format"] = "int64"
+		}
+		return schema
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		name, ok := s.names[t]
+		if !ok {
+			name = t.Name()
+			if _, taken := s.components[name]; taken {
+				name = strings.ReplaceAll(t.PkgPath(), "/", ".") + "." + name
+			}
+			s.names[t] = name
+			// Reserve the name before recursing into recursive types.
+			s.components[name] = nil
+			s.components[name] = s.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{}
+}
+
+// object returns the schema of a struct's JSON fields, including those of
+// embedded structs.
+func (s *openAPISchemas) object(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+	var add func(t reflect.Type)
+	add = func(t reflect.Type) {
+		for _, f := range reflect.VisibleFields(t) {
+			if len(f.Index) > 1 {
+				// Promoted fields are added with their embedded struct.
+				continue
+			}
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+				add(f.Type)
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			schema := s.schema(f.Type)
+			if opts == "string" {
+				schema = map[string]any{"type": "string"}
+			}
+			properties[name] = schema
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+	}
+	add(t)
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+// openAPIDocument builds the OpenAPI 3 document of apiOperations.
+func openAPIDocument() map[string]any {
+	s := &openAPISchemas{components: make(map[string]any), names: make(map[reflect.Type]string)}
+	content := func(contentType string, values []any) map[string]any {
+		var schemas []any
+		for _, v := range values {
+			schemas = append(schemas, s.schema(reflect.TypeOf(v)))
+		}
+		schema := schemas[0]
+		if len(schemas) > 1 {
+			schema = map[string]any{"oneOf": schemas}
+		}
+		return map[string]any{contentType: map[string]any{"schema": schema}}
+	}
+
+	paths := make(map[string]any)
+	for _, op := range apiOperations {
+		var params []any
+		for _, p := range op.params {
+			in := "query"
+			if strings.Contains(op.path, "{"+p.name+"}") {
+				in = "path"
+			}
+			schema := map[string]any{"type": p.typ}
+			if len(p.enum) > 0 {
+				schema["enum"] = p.enum
+			}
+			param := map[string]any{"name": p.name, "in": in, "required": in == "path", "schema": schema}
+			if p.description != "" {
+				param["description"] = p.description
+			}
+			params = append(params, param)
+		}
+
+		status := op.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		response := map[string]any{"description": http.StatusText(status)}
+		if len(op.responses) > 0 {
+			contentType := op.contentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			response["content"] = content(contentType, op.responses)
+		}
+		responses := map[string]any{
+			strconv.Itoa(status): response,
+			"default":            map[string]any{"description": "Error message", "content": map[string]any{"text/plain": map[string]any{"schema": map[string]any{"type": "string"}}}},
+		}
+		operation := map[string]any{"summary": op.summary, "responses": responses}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+		if op.body != nil {
+			operation["requestBody"] = map[string]any{"required": true, "content": content("application/json", []any{op.body})}
+		}
+		if op.mutating || op.private {
+			operation["security"] = []any{map[string]any{"bearerAuth": []any{}}}
+		}
+
+		item, _ := paths[op.path].(map[string]any)
+		if item == nil {
+			item = make(map[string]any)
+			paths[op.path] = item
+		}
+		item[strings.ToLower(op.method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "k8s-probe-monitor",
+			"description": "Monitors the startup, liveness and readiness probes of Kubernetes pods and lets you fail and recover them.",
+			"version":     Version,
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": s.components,
+			"securitySchemes": map[string]any{
+				// Static tokens, OIDC ID tokens or Kubernetes tokens,
+				// whichever are enabled.
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+var openAPIJSON = sync.OnceValue(func() []byte {
+	doc, err := json.MarshalIndent(openAPIDocument(), "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return doc
+})
+
+// handleOpenAPI serves GET /api/openapi.json. Other origins may read it, so
+// a Swagger UI hosted elsewhere can load it.
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Write(openAPIJSON())
+}
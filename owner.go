@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ownerRetry is how long a failed owner lookup is cached before it is retried.
+const ownerRetry = time.Minute
+
+// OwnerInfo identifies a Kubernetes object that controls a pod.
+type OwnerInfo struct {
+	Kind string    `json:"kind"`
+	Name string    `json:"name"`
+	UID  types.UID `json:"uid"`
+}
+
+func ownerFromRef(ref *metav1.OwnerReference) *OwnerInfo {
+	return &OwnerInfo{Kind: ref.Kind, Name: ref.Name, UID: ref.UID}
+}
+
+// ownerLookup is a cached parent lookup of an intermediate owner.
+type ownerLookup struct {
+	parent *OwnerInfo
+	// retryAt is set when the lookup failed.
+	retryAt time.Time
+}
+
+// ownerResolver walks controller owner references from pods up to the
+// workload that created them: ReplicaSets are resolved to their Deployment
+// and Jobs to their CronJob. StatefulSets and DaemonSets own their pods
+// directly. Parents are fetched through the clientset once
+// per intermediate owner and cached by UID.
+type ownerResolver struct {
+	clientset kubernetes.Interface
+	mu        sync.Mutex
+	parents   map[types.UID]ownerLookup
+}
+
+func newOwnerResolver(clientset kubernetes.Interface) *ownerResolver {
+	return &ownerResolver{clientset: clientset, parents: make(map[types.UID]ownerLookup)}
+}
+
+// resolve returns the direct controller of a pod and the top-level workload.
+// Both are nil for bare pods; workload equals owner when there is nothing
+// above it or the parent can't be looked up.
+func (r *ownerResolver) resolve(ctx context.Context, pod *corev1.Pod) (owner, workload *OwnerInfo) {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return nil, nil
+	}
+	owner = ownerFromRef(ref)
+	if parent := r.parent(ctx, pod.Namespace, owner); parent != nil {
+		return owner, parent
+	}
+	return owner, owner
+}
+
+func (r *ownerResolver) parent(ctx context.Context, namespace string, owner *OwnerInfo) *OwnerInfo {
+	var get func() (metav1.Object, error)
+	switch owner.Kind {
+	case "ReplicaSet":
+		get = func() (metav1.Object, error) {
+			return r.clientset.AppsV1().ReplicaSets(namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+		}
+	case "Job":
+		get = func() (metav1.Object, error) {
+			return r.clientset.BatchV1().Jobs(namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+		}
+	default:
+		return nil
+	}
+
+	r.mu.Lock()
+	cached, ok := r.parents[owner.UID]
+	r.mu.Unlock()
+	if ok && (cached.retryAt.IsZero() || time.Now().Before(cached.retryAt)) {
+		return cached.parent
+	}
+
+	var lookup ownerLookup
+	obj, err := get()
+	switch {
+	case err != nil:
+		slog.Warn("Failed to resolve owner", "kind", owner.Kind, "namespace", namespace, "name", owner.Name, "error", err)
+		lookup.retryAt = time.Now().Add(ownerRetry)
+	case obj.GetUID() != owner.UID:
+		// The owner was replaced by a new object of the same name; the pod
+		// is orphaned from its point of view.
+	default:
+		if ref := metav1.GetControllerOf(obj); ref != nil {
+			lookup.parent = ownerFromRef(ref)
+		}
+	}
+
+	r.mu.Lock()
+	r.parents[owner.UID] = lookup
+	r.mu.Unlock()
+	return lookup.parent
+}
+
+// statefulSetOrdinal returns the index of a StatefulSet pod, from the pod
+// index label or else the suffix of its name.
+func statefulSetOrdinal(pod *corev1.Pod, owner *OwnerInfo) *int {
+	if owner == nil || owner.Kind != "StatefulSet" {
+		return nil
+	}
+	index, ok := pod.Labels[appsv1.PodIndexLabel]
+	if !ok {
+		index = strings.TrimPrefix(pod.Name, owner.Name+"-")
+	}
+	ordinal, err := strconv.Atoi(index)
+	if err != nil || ordinal < 0 {
+		return nil
+	}
+	return &ordinal
+}
+
+// forget drops the cached parent of an owner, e.g. when its last pod is gone.
+func (r *ownerResolver) forget(uid types.UID) {
+	r.mu.Lock()
+	delete(r.parents, uid)
+	r.mu.Unlock()
+}
@@ -0,0 +1,82 @@
+// Package api defines the contract between k8s-probe-monitor and the
+// applications it monitors: the JSON document served at InfoPath and the
+// probe actions served at ProbeActionPath. Target applications written in Go
+// can import it instead of copying the definitions; see cmd/probe-demo for a
+// complete implementation.
+package api
+
+import "strings"
+
+// SchemaVersion is the version of the contract defined by this package. It is
+// reported in PodInfo.SchemaVersion and names the JSON schema in Schema.
+const SchemaVersion = "v1"
+
+// InfoPath is the default path of the info endpoint, which answers GET with a
+// PodInfo document.
+const InfoPath = "/api/info"
+
+// Probe types accepted by probe actions.
+const (
+	ProbeStartup   = "startup"
+	ProbeLiveness  = "liveness"
+	ProbeReadiness = "readiness"
+)
+
+// Probe actions. A target answers POST ProbeActionPath(probe, action) with
+// any 2xx status once the probe has been forced to fail or released again.
+const (
+	ActionFail    = "fail"
+	ActionRecover = "recover"
+)
+
+// ProbeActionPath returns the path of a probe action. With the wildcards
+// "{probe}" and "{action}" it doubles as a net/http.ServeMux pattern.
+func ProbeActionPath(probe, action string) string {
+	return "/api/probes/" + probe + "/" + action
+}
+
+// ValidProbe reports whether probe is one of the probe types.
+func ValidProbe(probe string) bool {
+	switch probe {
+	case ProbeStartup, ProbeLiveness, ProbeReadiness:
+		return true
+	}
+	return false
+}
+
+// ValidAction reports whether action is one of the probe actions.
+func ValidAction(action string) bool {
+	return action == ActionFail || action == ActionRecover
+}
+
+// PodInfo is the document a monitored pod serves at its info endpoint.
+type PodInfo struct {
+	// SchemaVersion is the contract version the target implements. It may
+	// be omitted, in which case v1 is assumed.
+	SchemaVersion string `json:"schemaVersion,omitempty"`
+	PodName       string `json:"podName"`
+	PodIP         string `json:"podIP"`
+	NodeHostname  string `json:"nodeHostname"`
+	// ContainerAge is how long the container has been running, in
+	// nanoseconds.
+	ContainerAge int64       `json:"containerAge"`
+	StartTime    string      `json:"startTime"`
+	ProbeStatus  ProbeStatus `json:"probeStatus"`
+	// StartupDelay is how long the application takes to start, in seconds,
+	// and StartupReady when it will be or was done.
+	StartupDelay int    `json:"startupDelay"`
+	StartupReady string `json:"startupReady"`
+}
+
+// ProbeStatus is the state the application reports for each probe.
+type ProbeStatus struct {
+	Started bool `json:"started"`
+	Live    bool `json:"live"`
+	Ready   bool `json:"ready"`
+}
+
+// SupportedVersion reports whether a PodInfo.SchemaVersion can be read by
+// this package. An empty version predates versioning and means v1.
+func SupportedVersion(version string) bool {
+	return version == "" || strings.EqualFold(version, SchemaVersion)
+}
@@ -0,0 +1,9 @@
+package api
+
+import _ "embed"
+
+// Schema is the JSON Schema (draft 2020-12) of the PodInfo document for
+// SchemaVersion, for validating targets written in other languages.
+//
+//go:embed podinfo.v1.schema.json
+var Schema []byte
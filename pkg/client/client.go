@@ -0,0 +1,379 @@
+// Package client is a Go client of the k8s-probe-monitor dashboard API, for
+// automation and test harnesses that list pods, read their probe history,
+// fail and recover probes and follow changes:
+//
+//	c, err := client.New("http://localhost:8090", client.WithToken(token))
+//	if err != nil {
+//		return err
+//	}
+//	if _, err := c.FailProbe(ctx, "web-5d9c7b8f4-czgla", api.ProbeReadiness); err != nil {
+//		return err
+//	}
+//	pods, err := c.ListPods(ctx, client.ListOptions{Ready: "false"})
+//
+// The types hold the commonly used fields of the dashboard's responses;
+// /api/openapi.json describes them in full.
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pascal71/k8s-probe-monitor/pkg/api"
+)
+
+// Client calls a dashboard's API. It is safe for concurrent use.
+type Client struct {
+	base    *url.URL
+	http    *http.Client
+	token   string
+	cluster string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithToken authenticates requests with a bearer token: one of the
+// dashboard's auth tokens, an OIDC ID token or a Kubernetes token.
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithHTTPClient sends requests with hc instead of http.DefaultClient, for
+// example to set a timeout or trust the dashboard's certificate.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// WithCluster addresses the pods of one cluster when the dashboard monitors
+// several.
+func WithCluster(cluster string) Option {
+	return func(c *Client) { c.cluster = cluster }
+}
+
+// New returns a client of the dashboard at baseURL, such as
+// "https://probe-monitor.example.com".
+func New(baseURL string, opts ...Option) (*Client, error) {
+	base, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid dashboard URL: %v", err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("invalid dashboard URL %q: must be http or https", baseURL)
+	}
+	c := &Client{base: base, http: http.DefaultClient}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Error is a response of the dashboard with an error status.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("dashboard returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Pod is the status of a monitored pod.
+type Pod struct {
+	// Cluster is set when the dashboard monitors several clusters.
+	Cluster   string
+	Name      string
+	Namespace string
+	IP        string
+	Node      string
+	Status    string
+	// Info is the pod's last scraped document, nil until it was scraped.
+	Info      *api.PodInfo
+	Error     string
+	ErrorKind string
+	LastCheck time.Time
+	Owner     *Owner
+	Workload  *Owner
+	// ReplicaSetID is the pod-template-hash of the owning ReplicaSet.
+	ReplicaSetID string
+	// Effective is the probe state the kubelet acts on, replayed from the
+	// probes' periods and thresholds.
+	Effective *EffectiveStatus
+}
+
+// Ready reports whether the pod's application reports it ready.
+func (p *Pod) Ready() bool {
+	return p.Info != nil && p.Info.ProbeStatus.Ready
+}
+
+// Owner is a controller of a pod.
+type Owner struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	UID  string `json:"uid"`
+}
+
+// EffectiveStatus is the probe state as the kubelet sees it.
+type EffectiveStatus struct {
+	Started       bool   `json:"started"`
+	Live          bool   `json:"live"`
+	Ready         bool   `json:"ready"`
+	PendingAction string `json:"pendingAction,omitempty"`
+	// RestartAt predicts when the kubelet restarts the container.
+	RestartAt time.Time `json:"restartAt,omitempty"`
+}
+
+// Transition is a change of a probe's reported state.
+type Transition struct {
+	Probe string    `json:"probe"`
+	From  bool      `json:"from"`
+	To    bool      `json:"to"`
+	Time  time.Time `json:"time"`
+	// PreviousStateSeconds is how long the probe had been in From; it is
+	// only set by GetHistory.
+	PreviousStateSeconds float64 `json:"previousStateSeconds,omitempty"`
+}
+
+// ListOptions filter, sort and page ListPods. Empty fields don't filter.
+type ListOptions struct {
+	Namespace string
+	Node      string
+	// ReplicaSet is the ReplicaSet's name or pod-template-hash.
+	ReplicaSet string
+	Status     string
+	// Ready is "true", "false" or "unknown" for pods not scraped yet.
+	Ready string
+	// Sort is name, namespace, node, status or age, descending with a
+	// leading "-"; by default pods are in the dashboard's order.
+	Sort string
+	// Limit returns a page of at most Limit pods, continuing after the
+	// page that returned Continue. Without a limit every pod is returned.
+	Limit    int
+	Continue string
+}
+
+// PodList is a page of pods.
+type PodList struct {
+	Pods []Pod `json:"pods"`
+	// Total is the number of pods matching the filters.
+	Total  int `json:"total"`
+	Offset int `json:"offset"`
+	// Continue fetches the next page; it is empty on the last.
+	Continue string `json:"continue,omitempty"`
+	Revision uint64 `json:"revision"`
+}
+
+// ListPods returns the pods matching opts. Unless opts.Limit is set, the
+// pages are fetched until all pods are returned.
+func (c *Client) ListPods(ctx context.Context, opts ListOptions) (*PodList, error) {
+	query := url.Values{}
+	for name, value := range map[string]string{
+		"cluster": c.cluster, "namespace": opts.Namespace, "node": opts.Node, "replicaSet": opts.ReplicaSet,
+		"status": opts.Status, "ready": opts.Ready, "sort": opts.Sort, "continue": opts.Continue,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	// The limit also selects the list response rather than the map.
+	query.Set("limit", strconv.Itoa(opts.Limit))
+
+	var list PodList
+	if err := c.do(ctx, http.MethodGet, "/api/pods", query, &list); err != nil {
+		return nil, err
+	}
+	for opts.Limit == 0 && list.Continue != "" {
+		query.Set("continue", list.Continue)
+		var page PodList
+		if err := c.do(ctx, http.MethodGet, "/api/pods", query, &page); err != nil {
+			return nil, err
+		}
+		list.Pods = append(list.Pods, page.Pods...)
+		list.Total, list.Continue, list.Revision = page.Total, page.Continue, page.Revision
+	}
+	return &list, nil
+}
+
+// GetHistory returns the probe transitions of a pod, oldest first. Pods are
+// named by name, or by namespace/name when pods of that name exist in several
+// namespaces.
+func (c *Client) GetHistory(ctx context.Context, pod string) ([]Transition, error) {
+	var history struct {
+		Transitions []Transition `json:"transitions"`
+	}
+	path, query := c.podPath(pod)
+	if err := c.do(ctx, http.MethodGet, path+"/history", query, &history); err != nil {
+		return nil, err
+	}
+	return history.Transitions, nil
+}
+
+// FailProbe makes a pod's startup, liveness or readiness probe fail and
+// returns the pod's status afterwards. The pod is named as for GetHistory.
+func (c *Client) FailProbe(ctx context.Context, pod, probe string) (*Pod, error) {
+	return c.probeAction(ctx, pod, probe, api.ActionFail)
+}
+
+// RecoverProbe undoes FailProbe.
+func (c *Client) RecoverProbe(ctx context.Context, pod, probe string) (*Pod, error) {
+	return c.probeAction(ctx, pod, probe, api.ActionRecover)
+}
+
+func (c *Client) probeAction(ctx context.Context, pod, probe, action string) (*Pod, error) {
+	if !api.ValidProbe(probe) {
+		return nil, fmt.Errorf("unknown probe %q", probe)
+	}
+	var result struct {
+		Status *Pod `json:"status"`
+	}
+	path, query := c.podPath(pod)
+	if err := c.do(ctx, http.MethodPost, path+"/probes/"+probe+"/"+action, query, &result); err != nil {
+		return nil, err
+	}
+	return result.Status, nil
+}
+
+// Event types of StreamEvents.
+const (
+	EventAdd        = "add"
+	EventUpdate     = "update"
+	EventDelete     = "delete"
+	EventTransition = "transition"
+)
+
+// Event is a change of the monitored pods.
+type Event struct {
+	Type      string `json:"type"`
+	Cluster   string `json:"cluster,omitempty"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Pod is set for add and update events, Transition for transitions.
+	Pod        *Pod        `json:"pod,omitempty"`
+	Transition *Transition `json:"transition,omitempty"`
+}
+
+// StreamEvents calls handle with every pod as an update event, then with
+// each change as it happens, until ctx is done, handle returns an error or
+// the dashboard ends the stream, for example when it shuts down or the
+// client fell behind. It returns nil when ctx is done and handle's error if
+// it returned one.
+func (c *Client) StreamEvents(ctx context.Context, handle func(Event) error) error {
+	req, err := c.request(ctx, http.MethodGet, "/api/stream", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("failed to open event stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	// Each event carries a whole pod status on one line.
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			if payload, ok := strings.CutPrefix(line, "data:"); ok {
+				data.WriteString(strings.TrimPrefix(payload, " "))
+			}
+			continue
+		}
+		if data.Len() == 0 {
+			continue
+		}
+		var ev Event
+		if err := json.Unmarshal([]byte(data.String()), &ev); err != nil {
+			return fmt.Errorf("invalid event: %v", err)
+		}
+		data.Reset()
+		if err := handle(ev); err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("event stream failed: %v", err)
+	}
+	return nil
+}
+
+func (c *Client) clusterQuery() url.Values {
+	if c.cluster == "" {
+		return nil
+	}
+	return url.Values{"cluster": {c.cluster}}
+}
+
+// podPath returns the /api/pods/{name} path and query of a pod given as
+// name or namespace/name.
+func (c *Client) podPath(pod string) (string, url.Values) {
+	query := c.clusterQuery()
+	if namespace, name, ok := strings.Cut(pod, "/"); ok {
+		if query == nil {
+			query = url.Values{}
+		}
+		query.Set("namespace", namespace)
+		pod = name
+	}
+	return "/api/pods/" + url.PathEscape(pod), query
+}
+
+func (c *Client) request(ctx context.Context, method, path string, query url.Values) (*http.Request, error) {
+	u := *c.base
+	u.Path += path
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+// do sends a request and decodes the JSON response into out.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, out any) error {
+	req, err := c.request(ctx, method, path, query)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return responseError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid response to %s %s: %v", method, path, err)
+	}
+	return nil
+}
+
+// responseError reads the message of an error response.
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// podListParams are the query parameters selecting the paged list response
+// of /api/pods instead of the map of every pod.
+var podListParams = []string{"limit", "offset", "continue", "sort", "cluster", "namespace", "node", "replicaSet", "status", "ready"}
+
+// maxPodListLimit bounds the page size of /api/pods.
+const maxPodListLimit = 1000
+
+// podSortKeys map the sort parameter to a value ordering pods. Pods with
+// equal values keep the dashboard's order.
+var podSortKeys = map[string]func(p *PodStatusInfo) string{
+	"":          func(p *PodStatusInfo) string { return "" },
+	"name":      func(p *PodStatusInfo) string { return p.Name },
+	"namespace": func(p *PodStatusInfo) string { return p.Namespace },
+	"node":      func(p *PodStatusInfo) string { return p.Node },
+	"status":    func(p *PodStatusInfo) string { return p.Status },
+	"age": func(p *PodStatusInfo) string {
+		if p.Info == nil {
+			return ""
+		}
+		return fmt.Sprintf("%020d", p.Info.ContainerAge)
+	},
+}
+
+// PodList is a page of the /api/pods list response.
+type PodList struct {
+	Pods []*PodStatusInfo `json:"pods"`
+	// Total is the number of pods matching the filters and Offset the
+	// position of the first one returned among them.
+	Total  int `json:"total"`
+	Offset int `json:"offset"`
+	// Continue is passed to get the next page; it is empty on the last.
+	Continue string `json:"continue,omitempty"`
+	Revision uint64 `json:"revision"`
+}
+
+// isPodListQuery reports whether the query asks for the list response.
+func isPodListQuery(query url.Values) bool {
+	for _, param := range podListParams {
+		if query.Has(param) {
+			return true
+		}
+	}
+	return false
+}
+
+// podFilter matches pods against the filter parameters of /api/pods.
+type podFilter struct {
+	cluster, namespace, node, replicaSet, status, ready string
+}
+
+func (f podFilter) match(p *PodStatusInfo) bool {
+	if f.cluster != "" && p.Cluster != f.cluster || f.namespace != "" && p.Namespace != f.namespace ||
+		f.node != "" && p.Node != f.node || f.status != "" && !strings.EqualFold(p.Status, f.status) {
+		return false
+	}
+	// replicaSet is the ReplicaSet's name or its pod-template-hash.
+	if f.replicaSet != "" && f.replicaSet != p.ReplicaSetID &&
+		(p.Owner == nil || p.Owner.Kind != "ReplicaSet" || p.Owner.Name != f.replicaSet) {
+		return false
+	}
+	switch f.ready {
+	case "true":
+		return p.Info != nil && p.Info.ProbeStatus.Ready
+	case "false":
+		return p.Info != nil && !p.Info.ProbeStatus.Ready
+	case "unknown":
+		return p.Info == nil
+	}
+	return true
+}
+
+// validReady reports whether a ready filter is valid.
+func validReady(ready string) bool {
+	switch ready {
+	case "", "true", "false", "unknown":
+		return true
+	}
+	return false
+}
+
+// errInvalidSort is returned by listPods for unknown sort keys.
+var errInvalidSort = errors.New("must be one of name, namespace, node, status or age")
+
+// positionedPod is a pod with its position in a listing.
+type positionedPod struct {
+	pod      *PodStatusInfo
+	position string
+}
+
+// listPods returns the pods of every cluster matching filter, ordered by
+// sortParam.
+func (d *Dashboard) listPods(filter podFilter, sortParam string) ([]positionedPod, error) {
+	key, ok := podSortKeys[strings.TrimPrefix(sortParam, "-")]
+	if !ok {
+		return nil, errInvalidSort
+	}
+	descending := strings.HasPrefix(sortParam, "-")
+	var matched []positionedPod
+	for _, pod := range d.sortedPods() {
+		if filter.match(pod) {
+			matched = append(matched, positionedPod{pod, podPosition(key(pod), pod)})
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if descending {
+			return matched[i].position > matched[j].position
+		}
+		return matched[i].position < matched[j].position
+	})
+	return matched, nil
+}
+
+// podPosition is where a pod sorts: by value, then in the dashboard's order.
+func podPosition(value string, p *PodStatusInfo) string {
+	return value + "\x00" + p.SortKey() + "\x00" + p.Key()
+}
+
+// encodeContinue and decodeContinue make the token resuming a listing after
+// the pod at position. The token holds the sort, so a page can't be resumed
+// in another order; unlike an offset it stays put when pods come and go.
+func encodeContinue(sortParam, position string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(sortParam + "\n" + position))
+}
+
+func decodeContinue(token, sortParam string) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", fmt.Errorf("invalid continue token")
+	}
+	tokenSort, position, ok := strings.Cut(string(raw), "\n")
+	if !ok || tokenSort != sortParam {
+		return "", fmt.Errorf("continue token is for another sort order")
+	}
+	return position, nil
+}
+
+// handlePodList serves the list response of /api/pods: the pods matching
+// the cluster, namespace, node, replicaSet, status and ready
+// (true/false/unknown) filters, ordered by sort (name, namespace, node,
+// status or age, descending with a leading "-"), a page of limit pods at a
+// time from offset or a continue token.
+func (d *Dashboard) handlePodList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	sortParam := query.Get("sort")
+	if _, ok := podSortKeys[strings.TrimPrefix(sortParam, "-")]; !ok {
+		http.Error(w, "Invalid sort: "+errInvalidSort.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, offset := 0, 0
+	for _, param := range []struct {
+		name string
+		dst  *int
+	}{{"limit", &limit}, {"offset", &offset}} {
+		if v := query.Get(param.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, fmt.Sprintf("Invalid %s: must be a number of pods", param.name), http.StatusBadRequest)
+				return
+			}
+			*param.dst = n
+		}
+	}
+	if limit == 0 || limit > maxPodListLimit {
+		limit = maxPodListLimit
+	}
+	var after string
+	if token := query.Get("continue"); token != "" {
+		if query.Has("offset") {
+			http.Error(w, "Invalid query: use either offset or continue", http.StatusBadRequest)
+			return
+		}
+		var err error
+		if after, err = decodeContinue(token, sortParam); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid continue: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	ready := query.Get("ready")
+	if !validReady(ready) {
+		http.Error(w, "Invalid ready: must be true, false or unknown", http.StatusBadRequest)
+		return
+	}
+	filter := podFilter{
+		cluster:    query.Get("cluster"),
+		namespace:  query.Get("namespace"),
+		node:       query.Get("node"),
+		replicaSet: query.Get("replicaSet"),
+		status:     query.Get("status"),
+		ready:      ready,
+	}
+
+	revision := d.events.revision()
+	matched, _ := d.listPods(filter, sortParam)
+	if after != "" {
+		descending := strings.HasPrefix(sortParam, "-")
+		offset = sort.Search(len(matched), func(i int) bool {
+			if descending {
+				return matched[i].position < after
+			}
+			return matched[i].position > after
+		})
+	}
+
+	list := PodList{Pods: []*PodStatusInfo{}, Total: len(matched), Offset: min(offset, len(matched)), Revision: revision}
+	end := min(list.Offset+limit, len(matched))
+	for _, m := range matched[list.Offset:end] {
+		list.Pods = append(list.Pods, m.pod)
+	}
+	if end < len(matched) {
+		list.Continue = encodeContinue(sortParam, matched[end-1].position)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newTestDashboard runs a dashboard on a fake clientset holding pods, all
+// served by one fake target as in the bench, and scrapes them once.
+func newTestDashboard(t *testing.T, pods ...*corev1.Pod) (*Dashboard, *fake.Clientset) {
+	t.Helper()
+	clientset := newTestClientset(pods...)
+	return startTestDashboard(t, clientset), clientset
+}
+
+func newTestClientset(pods ...*corev1.Pod) *fake.Clientset {
+	objects := make([]k8sruntime.Object, len(pods))
+	for i, pod := range pods {
+		objects[i] = pod
+	}
+	return fake.NewClientset(objects...)
+}
+
+// startTestDashboard is newTestDashboard for a prepared clientset, such as
+// one with reactors, which must be added before its informers start.
+func startTestDashboard(t *testing.T, clientset *fake.Clientset) *Dashboard {
+	t.Helper()
+	target := httptest.NewServer(fakeTargetHandler(1))
+	t.Cleanup(target.Close)
+	client := &http.Client{Transport: routedTransport(func(string) (string, bool) {
+		return target.Listener.Addr().String(), true
+	})}
+
+	d, err := newDashboard(clientset, client, DefaultConfig(), newDashboardMetrics())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := d.startInformers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	d.updatePodStatuses(ctx, 0)
+	return d
+}
+
+// waitFor polls cond until it holds or a few seconds passed.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+// getPodList requests /api/pods with query and decodes the list.
+func getPodList(t *testing.T, d *Dashboard, query string) (PodList, int) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	d.handleAPI(rec, httptest.NewRequest(http.MethodGet, "/api/pods?"+query, nil))
+	var list PodList
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+			t.Fatalf("GET /api/pods?%s: %v", query, err)
+		}
+	}
+	return list, rec.Code
+}
+
+func testPods(n int) []*corev1.Pod {
+	pods := make([]*corev1.Pod, n)
+	for i := range pods {
+		pods[i] = syntheticPod(i)
+		if i%2 == 1 {
+			pods[i].Namespace = "other"
+		}
+	}
+	return pods
+}
+
+func TestPodListContinue(t *testing.T) {
+	d, _ := newTestDashboard(t, testPods(7)...)
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{
+			name:  "by name",
+			query: "sort=name&limit=3",
+			want: []string{
+				"default/probe-demo-00000000-00000", "other/probe-demo-00000000-00001", "default/probe-demo-00000000-00002",
+				"other/probe-demo-00000000-00003", "default/probe-demo-00000000-00004", "other/probe-demo-00000000-00005",
+				"default/probe-demo-00000000-00006",
+			},
+		},
+		{
+			name:  "descending",
+			query: "sort=-name&limit=4",
+			want: []string{
+				"default/probe-demo-00000000-00006", "other/probe-demo-00000000-00005", "default/probe-demo-00000000-00004",
+				"other/probe-demo-00000000-00003", "default/probe-demo-00000000-00002", "other/probe-demo-00000000-00001",
+				"default/probe-demo-00000000-00000",
+			},
+		},
+		{
+			name:  "filtered",
+			query: "sort=name&namespace=other&limit=2",
+			want:  []string{"other/probe-demo-00000000-00001", "other/probe-demo-00000000-00003", "other/probe-demo-00000000-00005"},
+		},
+		{
+			name:  "one page",
+			query: "sort=name&node=bench-node-1",
+			want:  []string{"other/probe-demo-00000000-00001", "default/probe-demo-00000000-00006"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			query := tt.query
+			for page := 0; ; page++ {
+				if page > len(tt.want) {
+					t.Fatalf("still paging after %d pages", page)
+				}
+				list, code := getPodList(t, d, query)
+				if code != http.StatusOK {
+					t.Fatalf("GET /api/pods?%s = %d", query, code)
+				}
+				if list.Total != len(tt.want) {
+					t.Errorf("total = %d, want %d", list.Total, len(tt.want))
+				}
+				for _, p := range list.Pods {
+					got = append(got, podKey(p.Namespace, p.Name))
+				}
+				if list.Continue == "" {
+					break
+				}
+				query = tt.query + "&continue=" + list.Continue
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("pages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPodListContinueAfterRemoval(t *testing.T) {
+	d, clientset := newTestDashboard(t, testPods(6)...)
+	first, _ := getPodList(t, d, "sort=name&limit=2")
+	if len(first.Pods) != 2 || first.Continue == "" {
+		t.Fatalf("first page = %+v", first)
+	}
+
+	// Pods leaving before the next page don't shift it as an offset would.
+	gone := first.Pods[0]
+	if err := clientset.CoreV1().Pods(gone.Namespace).Delete(context.Background(), gone.Name, metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the pod to be removed", func() bool {
+		d.mu.RLock()
+		defer d.mu.RUnlock()
+		_, ok := d.pods[podKey(gone.Namespace, gone.Name)]
+		return !ok
+	})
+
+	next, code := getPodList(t, d, "sort=name&limit=2&continue="+first.Continue)
+	if code != http.StatusOK || len(next.Pods) != 2 {
+		t.Fatalf("next page = %d %+v", code, next)
+	}
+	if next.Pods[0].Name != "probe-demo-00000000-00002" || next.Offset != 1 || next.Total != 5 {
+		t.Errorf("next page starts with %s at %d of %d, want probe-demo-00000000-00002 at 1 of 5", next.Pods[0].Name, next.Offset, next.Total)
+	}
+}
+
+func TestPodListInvalid(t *testing.T) {
+	d, _ := newTestDashboard(t, testPods(3)...)
+	first, _ := getPodList(t, d, "sort=name&limit=1")
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"unknown sort", "sort=size"},
+		{"negative limit", "limit=-1"},
+		{"offset and continue", "sort=name&offset=1&continue=" + first.Continue},
+		{"continue of another sort", "sort=node&continue=" + first.Continue},
+		{"malformed continue", "sort=name&continue=not-a-token!"},
+		{"unknown ready", "ready=maybe"},
+	}
+	for _, tt := range tests {
+		if _, code := getPodList(t, d, tt.query); code != http.StatusBadRequest {
+			t.Errorf("%s: GET /api/pods?%s = %d, want 400", tt.name, tt.query, code)
+		}
+	}
+}
+
+func TestContinueToken(t *testing.T) {
+	tests := []struct {
+		sort, position string
+	}{
+		{"", "\x00a\x00default/web"},
+		{"-age", "00000000000000000042\x00b\x00other/web"},
+		{"name", "with\nnewline"},
+	}
+	for _, tt := range tests {
+		token := encodeContinue(tt.sort, tt.position)
+		got, err := decodeContinue(token, tt.sort)
+		if err != nil || got != tt.position {
+			t.Errorf("decodeContinue(encodeContinue(%q, %q)) = %q, %v", tt.sort, tt.position, got, err)
+		}
+		if _, err := decodeContinue(token, tt.sort+"x"); err == nil {
+			t.Errorf("decodeContinue() accepted a %q token for sort %q", tt.sort, tt.sort+"x")
+		}
+	}
+}
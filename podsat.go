@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// podsAt reconstructs the monitored pods of this dashboard's cluster at a
+// past time from the stored snapshots: each pod as of its latest snapshot
+// up to then. Snapshots are written on every transition and at least every
+// snapshotInterval, so a pod whose latest one is more than two intervals
+// older was gone by then.
+func (d *Dashboard) podsAt(at time.Time) (map[string]*PodStatusInfo, error) {
+	snapshots, err := d.store.Snapshots("", "", at.Add(-2*snapshotInterval), at.Add(time.Nanosecond))
+	if err != nil {
+		return nil, err
+	}
+	pods := make(map[string]*PodStatusInfo)
+	for i := range snapshots {
+		s := &snapshots[i]
+		pods[s.Key()] = s
+	}
+	return pods, nil
+}
+
+// handlePodsAt serves /api/pods?at=, the pods of every cluster as they were
+// at a past time, keyed like /api/pods.
+func (d *Dashboard) handlePodsAt(w http.ResponseWriter, r *http.Request) {
+	at, err := time.Parse(time.RFC3339Nano, r.URL.Query().Get("at"))
+	if err != nil {
+		http.Error(w, "at must be an RFC 3339 time", http.StatusBadRequest)
+		return
+	}
+	if at.After(time.Now()) {
+		http.Error(w, "at must not be in the future", http.StatusBadRequest)
+		return
+	}
+
+	pods := make(map[string]*PodStatusInfo)
+	for _, c := range d.clusters() {
+		clusterPods, err := c.podsAt(at)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to read snapshots: %v", err), http.StatusInternalServerError)
+			return
+		}
+		for key, pod := range clusterPods {
+			pods[key] = pod
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pods)
+}
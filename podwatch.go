@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// podWatch is the set of pod informers for one selector: a single
+// cluster-wide informer, or one per configured namespace, along with event,
+// EndpointSlice, Deployment and ReplicaSet informers for the same namespaces
+// and a node informer. It is replaced as a whole when the selector or
+// namespaces are reloaded.
+type podWatch struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	listers map[string]corelisters.PodLister
+	synced  []cache.InformerSynced
+	// endpoints tracks the EndpointSlices in the watched namespaces.
+	endpoints *endpointTracker
+	// Deployments and ReplicaSets are cached to report rollouts.
+	deploymentListers map[string]appslisters.DeploymentLister
+	replicaSetListers map[string]appslisters.ReplicaSetLister
+	// Nodes are cached for their topology and state.
+	nodes       corelisters.NodeLister
+	nodesSynced cache.InformerSynced
+}
+
+// forNamespace returns the lister of a namespace, or the cluster-wide one.
+func forNamespace[T any](listers map[string]T, namespace string) (T, bool) {
+	lister, ok := listers[namespace]
+	if !ok {
+		lister, ok = listers[metav1.NamespaceAll]
+	}
+	return lister, ok
+}
+
+// get returns a watched pod from the informer caches. Before the first
+// watch, w is nil and has no pods.
+func (w *podWatch) get(namespace, name string) (*corev1.Pod, error) {
+	if w == nil {
+		return nil, apierrors.NewNotFound(corev1.Resource("pods"), name)
+	}
+	lister, ok := forNamespace(w.listers, namespace)
+	if !ok {
+		return nil, apierrors.NewNotFound(corev1.Resource("pods"), name)
+	}
+	return lister.Pods(namespace).Get(name)
+}
+
+// node returns a node from the informer cache. The dashboard runs without
+// permission to list nodes, only without their topology then.
+func (w *podWatch) node(name string) (*corev1.Node, error) {
+	if w == nil {
+		return nil, apierrors.NewNotFound(corev1.Resource("nodes"), name)
+	}
+	if !w.nodesSynced() {
+		return nil, fmt.Errorf("nodes not listed yet")
+	}
+	return w.nodes.Get(name)
+}
+
+// list returns every watched pod.
+func (w *podWatch) list() ([]*corev1.Pod, error) {
+	if w == nil {
+		return nil, nil
+	}
+	var pods []*corev1.Pod
+	for _, lister := range w.listers {
+		found, err := lister.List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		pods = append(pods, found...)
+	}
+	return pods, nil
+}
+
+func (w *podWatch) hasSynced() bool {
+	for _, synced := range w.synced {
+		if !synced() {
+			return false
+		}
+	}
+	return true
+}
+
+// startInformers starts pod informers for the configured selector and
+// namespaces and blocks until their caches have synced. Pod add, update and
+// delete events are applied to d.pods as they arrive; the API server only sees
+// the initial list and the watch from then on. A previous watch is stopped
+// once the new one has synced, and pods it no longer covers are dropped.
+func (d *Dashboard) startInformers(ctx context.Context) error {
+	cfg := d.cfg()
+	selector, err := cfg.validate()
+	if err != nil {
+		return err
+	}
+
+	namespaces := cfg.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	w := &podWatch{
+		listers:           make(map[string]corelisters.PodLister),
+		endpoints:         newEndpointTracker(),
+		deploymentListers: make(map[string]appslisters.DeploymentLister),
+		replicaSetListers: make(map[string]appslisters.ReplicaSetLister),
+	}
+	w.ctx, w.cancel = context.WithCancel(ctx)
+
+	// Nodes are started right away but not waited for, as reading them may
+	// not be allowed.
+	nodeFactory := informers.NewSharedInformerFactory(d.clientset, 0)
+	nodeInformer := nodeFactory.Core().V1().Nodes()
+	w.nodes, w.nodesSynced = nodeInformer.Lister(), nodeInformer.Informer().HasSynced
+	nodeFactory.Start(w.ctx.Done())
+
+	var factories, extraFactories []informers.SharedInformerFactory
+	for _, ns := range namespaces {
+		factory := informers.NewSharedInformerFactoryWithOptions(d.clientset, cfg.ResyncPeriod,
+			informers.WithNamespace(ns),
+			informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+				opts.LabelSelector = selector.String()
+			}))
+
+		podInformer := factory.Core().V1().Pods()
+		podInformer.Informer().SetWatchErrorHandler(d.watchFailed)
+		podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				if pod, ok := obj.(*corev1.Pod); ok {
+					d.onPodEvent(w.ctx, pod)
+				}
+			},
+			UpdateFunc: func(_, obj interface{}) {
+				if pod, ok := obj.(*corev1.Pod); ok {
+					d.onPodEvent(w.ctx, pod)
+				}
+			},
+			DeleteFunc: func(obj interface{}) {
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				if pod, ok := obj.(*corev1.Pod); ok && w.ctx.Err() == nil {
+					d.removePod(pod.Namespace, pod.Name)
+				}
+			},
+		})
+		w.listers[ns] = podInformer.Lister()
+		w.synced = append(w.synced, podInformer.Informer().HasSynced)
+		factories = append(factories, factory)
+
+		eventFactory := informers.NewSharedInformerFactoryWithOptions(d.clientset, 0,
+			informers.WithNamespace(ns),
+			informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+				opts.FieldSelector = "involvedObject.kind=Pod"
+			}))
+		eventFactory.Core().V1().Events().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				if ev, ok := obj.(*corev1.Event); ok {
+					d.onKubeEvent(w, ev)
+				}
+			},
+			UpdateFunc: func(_, obj interface{}) {
+				if ev, ok := obj.(*corev1.Event); ok {
+					d.onKubeEvent(w, ev)
+				}
+			},
+		})
+		extraFactories = append(extraFactories, eventFactory)
+
+		sliceFactory := informers.NewSharedInformerFactoryWithOptions(d.clientset, 0,
+			informers.WithNamespace(ns),
+			informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+				if cfg.Service != "" {
+					opts.LabelSelector = discoveryv1.LabelServiceName + "=" + cfg.Service
+				}
+			}))
+		onSlice := func(obj interface{}) {
+			key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+			if err != nil {
+				return
+			}
+			if slice, ok := obj.(*discoveryv1.EndpointSlice); ok {
+				d.onEndpointSlice(w, key, slice)
+			}
+		}
+		sliceFactory.Discovery().V1().EndpointSlices().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    onSlice,
+			UpdateFunc: func(_, obj interface{}) { onSlice(obj) },
+			DeleteFunc: func(obj interface{}) {
+				key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+				if err == nil {
+					d.onEndpointSlice(w, key, nil)
+				}
+			},
+		})
+		extraFactories = append(extraFactories, sliceFactory)
+
+		appsFactory := informers.NewSharedInformerFactoryWithOptions(d.clientset, 0, informers.WithNamespace(ns))
+		appsFactory.Apps().V1().Deployments().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				if dep, ok := obj.(*appsv1.Deployment); ok {
+					d.onDeployment(w, dep)
+				}
+			},
+			UpdateFunc: func(_, obj interface{}) {
+				if dep, ok := obj.(*appsv1.Deployment); ok {
+					d.onDeployment(w, dep)
+				}
+			},
+			DeleteFunc: func(obj interface{}) {
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				if dep, ok := obj.(*appsv1.Deployment); ok {
+					d.rollouts.forget(dep.UID)
+				}
+			},
+		})
+		w.deploymentListers[ns] = appsFactory.Apps().V1().Deployments().Lister()
+		w.replicaSetListers[ns] = appsFactory.Apps().V1().ReplicaSets().Lister()
+		extraFactories = append(extraFactories, appsFactory)
+	}
+
+	for _, factory := range factories {
+		factory.Start(w.ctx.Done())
+		for informer, synced := range factory.WaitForCacheSync(w.ctx.Done()) {
+			if !synced {
+				w.cancel()
+				return fmt.Errorf("failed to sync informer cache for %v", informer)
+			}
+		}
+	}
+
+	// Events, EndpointSlices and rollouts are best-effort and matched against the
+	// synced pod caches, so they are started last and not waited for.
+	for _, factory := range extraFactories {
+		factory.Start(w.ctx.Done())
+	}
+
+	// Stopping the old watch under d.mu guarantees none of its handlers
+	// adds a pod after the sweep below.
+	d.mu.Lock()
+	old := d.watch
+	d.watch = w
+	if old != nil {
+		old.cancel()
+	}
+	var gone, updates []*PodStatusInfo
+	for key, p := range d.pods {
+		if _, err := w.get(p.Namespace, p.Name); err != nil {
+			gone = append(gone, p)
+			continue
+		}
+		// Statuses built before the swap couldn't see the new watch's
+		// endpoints.
+		updated := *p
+		updated.Endpoints = w.endpoints.get(key)
+		d.pods[key] = &updated
+		updates = append(updates, &updated)
+	}
+	d.mu.Unlock()
+
+	for _, p := range gone {
+		d.removePod(p.Namespace, p.Name)
+	}
+	for _, p := range updates {
+		d.publish(PodEvent{Type: PodEventUpdate, Namespace: p.Namespace, Name: p.Name, Pod: p})
+	}
+	return nil
+}
+
+// currentWatch returns the active pod watch, or nil before startInformers.
+func (d *Dashboard) currentWatch() *podWatch {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.watch
+}
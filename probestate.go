@@ -0,0 +1,330 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// EffectiveProbe is the kubelet's view of one probe, reconstructed from the
+// results the application reports on /api/info.
+type EffectiveProbe struct {
+	Configured           bool      `json:"configured"`
+	Success              bool      `json:"success"`
+	ConsecutiveSuccesses int       `json:"consecutiveSuccesses"`
+	ConsecutiveFailures  int       `json:"consecutiveFailures"`
+	SuccessThreshold     int       `json:"successThreshold"`
+	FailureThreshold     int       `json:"failureThreshold"`
+	FailuresRemaining    int       `json:"failuresRemaining"`
+	NextProbe            time.Time `json:"nextProbe,omitempty"`
+}
+
+// EffectiveStatus is the probe state the kubelet acts on, which lags the
+// application's self-reported flags by the configured thresholds and periods.
+type EffectiveStatus struct {
+	Started       bool           `json:"started"`
+	Live          bool           `json:"live"`
+	Ready         bool           `json:"ready"`
+	Startup       EffectiveProbe `json:"startup"`
+	Liveness      EffectiveProbe `json:"liveness"`
+	Readiness     EffectiveProbe `json:"readiness"`
+	PendingAction string         `json:"pendingAction,omitempty"`
+	// RestartAt predicts when the kubelet restarts the container because a
+	// failing liveness or startup probe reaches its failure threshold.
+	RestartAt time.Time `json:"restartAt,omitempty"`
+}
+
+// probeMachine replays one probe the way the kubelet prober worker does: a
+// result every period after the initial delay, with the outcome only flipping
+// once the success or failure threshold is reached.
+type probeMachine struct {
+	configured       bool
+	initialDelay     time.Duration
+	period           time.Duration
+	successThreshold int
+	failureThreshold int
+
+	nextTick  time.Time
+	success   bool
+	successes int
+	failures  int
+	// failedAt is the tick at which the failure threshold was last reached.
+	failedAt time.Time
+}
+
+func newProbeMachine(p *corev1.Probe, initial bool) *probeMachine {
+	m := &probeMachine{success: initial}
+	if p == nil {
+		m.success = true
+		return m
+	}
+	m.configured = true
+	m.initialDelay = time.Duration(p.InitialDelaySeconds) * time.Second
+	m.period = time.Duration(orDefault(p.PeriodSeconds, 10)) * time.Second
+	m.successThreshold = int(orDefault(p.SuccessThreshold, 1))
+	m.failureThreshold = int(orDefault(p.FailureThreshold, 3))
+	return m
+}
+
+func orDefault(v, def int32) int32 {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
+
+// start schedules the first probe. The kubelet counts the initial delay from
+// container start but does not run liveness or readiness probes before the
+// startup probe has succeeded.
+func (m *probeMachine) start(containerStart, notBefore time.Time) {
+	first := containerStart.Add(m.initialDelay)
+	if first.Before(notBefore) {
+		first = notBefore
+	}
+	m.nextTick = first
+}
+
+// observe applies the observed result once for every probe period that has
+// elapsed up to now, assuming the application held that state in between.
+// Only the first ticks can change the state, so after a long gap the rest
+// are skipped in one step.
+func (m *probeMachine) observe(result bool, now time.Time) {
+	if !m.configured || m.nextTick.IsZero() || m.nextTick.After(now) {
+		return
+	}
+	ticks := int64(now.Sub(m.nextTick)/m.period) + 1
+	limit := int64(m.successThreshold + m.failureThreshold)
+	for n := int64(0); n < min(ticks, limit); n++ {
+		m.record(result, m.nextTick.Add(time.Duration(n)*m.period))
+	}
+	m.nextTick = m.nextTick.Add(time.Duration(ticks) * m.period)
+}
+
+func (m *probeMachine) record(result bool, at time.Time) {
+	if result {
+		m.successes++
+		m.failures = 0
+		if m.successes >= m.successThreshold {
+			m.success = true
+		}
+		return
+	}
+	m.failures++
+	m.successes = 0
+	if m.failures == m.failureThreshold {
+		m.failedAt = at
+	}
+	if m.failures >= m.failureThreshold {
+		m.success = false
+	}
+}
+
+// failsAt predicts the tick at which a failing probe reaches its failure
+// threshold, assuming it keeps failing. It is zero while the probe passes.
+func (m *probeMachine) failsAt() time.Time {
+	switch {
+	case !m.configured || m.failures == 0:
+		return time.Time{}
+	case m.failures >= m.failureThreshold:
+		return m.failedAt
+	}
+	return m.nextTick.Add(time.Duration(m.failureThreshold-m.failures-1) * m.period)
+}
+
+func (m *probeMachine) snapshot() EffectiveProbe {
+	e := EffectiveProbe{
+		Configured:           m.configured,
+		Success:              m.success,
+		ConsecutiveSuccesses: m.successes,
+		ConsecutiveFailures:  m.failures,
+		SuccessThreshold:     m.successThreshold,
+		FailureThreshold:     m.failureThreshold,
+		NextProbe:            m.nextTick,
+	}
+	if m.configured {
+		e.FailuresRemaining = max(m.failureThreshold-m.failures, 0)
+	}
+	return e
+}
+
+// containerProbes holds the three probe machines for the monitored container
+// of one pod. It is discarded when the container restarts.
+type containerProbes struct {
+	containerStart time.Time
+	startup        *probeMachine
+	liveness       *probeMachine
+	readiness      *probeMachine
+
+	// sawStarting and seenReady gate startup-time sampling to containers
+	// that were observed before they first became ready.
+	sawStarting bool
+	seenReady   bool
+}
+
+// monitoredContainer returns the container whose probes the dashboard tracks:
+// the first one that declares a probe, or the first container otherwise.
+func monitoredContainer(pod *corev1.Pod) (*corev1.Container, time.Time) {
+	if len(pod.Spec.Containers) == 0 {
+		return nil, time.Time{}
+	}
+	c := &pod.Spec.Containers[0]
+	for i := range pod.Spec.Containers {
+		spec := &pod.Spec.Containers[i]
+		if spec.StartupProbe != nil || spec.LivenessProbe != nil || spec.ReadinessProbe != nil {
+			c = spec
+			break
+		}
+	}
+
+	started := time.Time{}
+	if pod.Status.StartTime != nil {
+		started = pod.Status.StartTime.Time
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name == c.Name && cs.State.Running != nil {
+			started = cs.State.Running.StartedAt.Time
+		}
+	}
+	return c, started
+}
+
+// observeProbes feeds the application's self-reported probe flags into the
+// pod's probe machines and returns the resulting effective status.
+func (d *Dashboard) observeProbes(pod *corev1.Pod, reported ProbeStatus, now time.Time) *EffectiveStatus {
+	container, containerStart := monitoredContainer(pod)
+	if container == nil || containerStart.IsZero() {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := podKey(pod.Namespace, pod.Name)
+	cp := d.probeStates[key]
+	if cp == nil || !cp.containerStart.Equal(containerStart) {
+		cp = &containerProbes{
+			containerStart: containerStart,
+			startup:        newProbeMachine(container.StartupProbe, false),
+			liveness:       newProbeMachine(container.LivenessProbe, true),
+			readiness:      newProbeMachine(container.ReadinessProbe, false),
+		}
+		cp.startup.start(containerStart, containerStart)
+		d.probeStates[key] = cp
+	}
+
+	// The kubelet stops running the startup probe once it has succeeded.
+	if !cp.startup.success {
+		cp.startup.observe(reported.Started, now)
+	}
+	if cp.startup.success {
+		if cp.liveness.nextTick.IsZero() {
+			startedAt := now
+			if !cp.startup.configured {
+				startedAt = containerStart
+			}
+			cp.liveness.start(containerStart, startedAt)
+			cp.readiness.start(containerStart, startedAt)
+		}
+		cp.liveness.observe(reported.Live, now)
+		cp.readiness.observe(reported.Ready, now)
+	}
+
+	status := &EffectiveStatus{
+		Started:   cp.startup.success,
+		Live:      cp.liveness.success,
+		Ready:     cp.startup.success && cp.readiness.success,
+		Startup:   cp.startup.snapshot(),
+		Liveness:  cp.liveness.snapshot(),
+		Readiness: cp.readiness.snapshot(),
+	}
+	switch {
+	case cp.startup.configured && !cp.startup.success && cp.startup.failures >= cp.startup.failureThreshold:
+		status.PendingAction = "restart"
+		status.Live = false
+	case cp.liveness.configured && !cp.liveness.success:
+		status.PendingAction = "restart"
+	}
+	if cp.startup.success {
+		status.RestartAt = cp.liveness.failsAt()
+	} else {
+		status.RestartAt = cp.startup.failsAt()
+	}
+	return status
+}
+
+// ProbeSpec is a probe as configured in the pod manifest, with the kubelet's
+// defaults filled in.
+type ProbeSpec struct {
+	// Handler describes the check, e.g. "HTTP GET :8080/healthz".
+	Handler             string `json:"handler"`
+	InitialDelaySeconds int32  `json:"initialDelaySeconds"`
+	PeriodSeconds       int32  `json:"periodSeconds"`
+	TimeoutSeconds      int32  `json:"timeoutSeconds"`
+	SuccessThreshold    int32  `json:"successThreshold"`
+	FailureThreshold    int32  `json:"failureThreshold"`
+	// FailureWindowSeconds is roughly how long a probe has to keep failing
+	// before the kubelet acts on it.
+	FailureWindowSeconds int32 `json:"failureWindowSeconds"`
+}
+
+// ProbeSpecs are the configured probes of the monitored container. Probes
+// that aren't configured are nil.
+type ProbeSpecs struct {
+	Container string     `json:"container"`
+	Startup   *ProbeSpec `json:"startup,omitempty"`
+	Liveness  *ProbeSpec `json:"liveness,omitempty"`
+	Readiness *ProbeSpec `json:"readiness,omitempty"`
+}
+
+func probeSpecs(pod *corev1.Pod) *ProbeSpecs {
+	container, _ := monitoredContainer(pod)
+	if container == nil {
+		return nil
+	}
+	return &ProbeSpecs{
+		Container: container.Name,
+		Startup:   newProbeSpec(container.StartupProbe),
+		Liveness:  newProbeSpec(container.LivenessProbe),
+		Readiness: newProbeSpec(container.ReadinessProbe),
+	}
+}
+
+func newProbeSpec(p *corev1.Probe) *ProbeSpec {
+	if p == nil {
+		return nil
+	}
+	spec := &ProbeSpec{
+		Handler:             probeHandler(p.ProbeHandler),
+		InitialDelaySeconds: p.InitialDelaySeconds,
+		PeriodSeconds:       orDefault(p.PeriodSeconds, 10),
+		TimeoutSeconds:      orDefault(p.TimeoutSeconds, 1),
+		SuccessThreshold:    orDefault(p.SuccessThreshold, 1),
+		FailureThreshold:    orDefault(p.FailureThreshold, 3),
+	}
+	spec.FailureWindowSeconds = spec.FailureThreshold * spec.PeriodSeconds
+	return spec
+}
+
+func probeHandler(h corev1.ProbeHandler) string {
+	switch {
+	case h.HTTPGet != nil:
+		method := "HTTP"
+		if h.HTTPGet.Scheme == corev1.URISchemeHTTPS {
+			method = "HTTPS"
+		}
+		return fmt.Sprintf("%s GET :%s%s", method, h.HTTPGet.Port.String(), h.HTTPGet.Path)
+	case h.TCPSocket != nil:
+		return "TCP :" + h.TCPSocket.Port.String()
+	case h.GRPC != nil:
+		handler := fmt.Sprintf("gRPC :%d", h.GRPC.Port)
+		if h.GRPC.Service != nil && *h.GRPC.Service != "" {
+			handler += " " + *h.GRPC.Service
+		}
+		return handler
+	case h.Exec != nil:
+		return "exec " + strings.Join(h.Exec.Command, " ")
+	}
+	return "unknown"
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestProbeMachine(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+	type step struct {
+		result        bool
+		at            int
+		wantSuccess   bool
+		wantSuccesses int
+		wantFailures  int
+		wantFailsAt   int // seconds after start; -1 when zero
+	}
+	tests := []struct {
+		name    string
+		probe   *corev1.Probe
+		initial bool
+		steps   []step
+	}{
+		{
+			name:    "liveness fails after the failure threshold",
+			probe:   &corev1.Probe{},
+			initial: true,
+			steps: []step{
+				{result: false, at: 0, wantSuccess: true, wantFailures: 1, wantFailsAt: 20},
+				{result: false, at: 10, wantSuccess: true, wantFailures: 2, wantFailsAt: 20},
+				{result: false, at: 20, wantSuccess: false, wantFailures: 3, wantFailsAt: 20},
+				{result: true, at: 30, wantSuccess: true, wantSuccesses: 1, wantFailsAt: -1},
+			},
+		},
+		{
+			name:  "readiness needs the success threshold",
+			probe: &corev1.Probe{PeriodSeconds: 5, SuccessThreshold: 2},
+			steps: []step{
+				{result: true, at: 0, wantSuccess: false, wantSuccesses: 1, wantFailsAt: -1},
+				{result: true, at: 5, wantSuccess: true, wantSuccesses: 2, wantFailsAt: -1},
+				{result: false, at: 10, wantSuccess: true, wantFailures: 1, wantFailsAt: 20},
+			},
+		},
+		{
+			name:  "nothing is probed before the initial delay",
+			probe: &corev1.Probe{InitialDelaySeconds: 30},
+			steps: []step{
+				{result: true, at: 29, wantSuccess: false, wantFailsAt: -1},
+				{result: true, at: 30, wantSuccess: true, wantSuccesses: 1, wantFailsAt: -1},
+			},
+		},
+		{
+			name:    "a long gap counts at most the thresholds",
+			probe:   &corev1.Probe{FailureThreshold: 2},
+			initial: true,
+			steps: []step{
+				{result: false, at: 600, wantSuccess: false, wantFailures: 3, wantFailsAt: 10},
+				{result: true, at: 610, wantSuccess: true, wantSuccesses: 1, wantFailsAt: -1},
+			},
+		},
+		{
+			name:    "a gap of months keeps the tick schedule",
+			probe:   &corev1.Probe{PeriodSeconds: 1},
+			initial: true,
+			steps: []step{
+				{result: false, at: 90 * 86400, wantSuccess: false, wantFailures: 4, wantFailsAt: 2},
+				{result: true, at: 90 * 86400, wantSuccess: false, wantFailures: 4, wantFailsAt: 2},
+				{result: true, at: 90*86400 + 1, wantSuccess: true, wantSuccesses: 1, wantFailsAt: -1},
+			},
+		},
+		{
+			name:  "without a probe the machine always succeeds",
+			probe: nil,
+			steps: []step{
+				{result: false, at: 100, wantSuccess: true, wantFailsAt: -1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newProbeMachine(tt.probe, tt.initial)
+			m.start(start, start)
+			for i, s := range tt.steps {
+				m.observe(s.result, at(s.at))
+				var wantFailsAt time.Time
+				if s.wantFailsAt >= 0 {
+					wantFailsAt = at(s.wantFailsAt)
+				}
+				if m.success != s.wantSuccess || m.successes != s.wantSuccesses || m.failures != s.wantFailures || !m.failsAt().Equal(wantFailsAt) {
+					t.Errorf("step %d: success %v, successes %d, failures %d, failsAt %v; want %v, %d, %d, %v",
+						i, m.success, m.successes, m.failures, m.failsAt(), s.wantSuccess, s.wantSuccesses, s.wantFailures, wantFailsAt)
+				}
+			}
+		})
+	}
+}
+
+func TestObserveProbes(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name:           "app",
+			StartupProbe:   &corev1.Probe{PeriodSeconds: 5, FailureThreshold: 2},
+			LivenessProbe:  &corev1.Probe{PeriodSeconds: 10},
+			ReadinessProbe: &corev1.Probe{PeriodSeconds: 10},
+		}}},
+		Status: corev1.PodStatus{
+			StartTime: &metav1.Time{Time: start},
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "app",
+				State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: metav1.Time{Time: start}}},
+			}},
+		},
+	}
+	tests := []struct {
+		name       string
+		reported   ProbeStatus
+		at         int
+		wantStatus EffectiveStatus
+	}{
+		{
+			name:       "starting",
+			reported:   ProbeStatus{},
+			at:         0,
+			wantStatus: EffectiveStatus{Live: true},
+		},
+		{
+			name:       "startup threshold reached",
+			reported:   ProbeStatus{},
+			at:         5,
+			wantStatus: EffectiveStatus{PendingAction: "restart"},
+		},
+		{
+			name:       "started",
+			reported:   ProbeStatus{Started: true, Live: true, Ready: true},
+			at:         10,
+			wantStatus: EffectiveStatus{Started: true, Live: true, Ready: true},
+		},
+		{
+			name:       "liveness failing",
+			reported:   ProbeStatus{Started: true, Ready: true},
+			at:         30,
+			wantStatus: EffectiveStatus{Started: true, Live: true, Ready: true},
+		},
+		{
+			name:       "liveness failed",
+			reported:   ProbeStatus{Started: true, Ready: true},
+			at:         40,
+			wantStatus: EffectiveStatus{Started: true, Live: false, Ready: true, PendingAction: "restart"},
+		},
+	}
+	d := &Dashboard{probeStates: make(map[string]*containerProbes)}
+	for _, tt := range tests {
+		status := d.observeProbes(pod, tt.reported, start.Add(time.Duration(tt.at)*time.Second))
+		if status == nil {
+			t.Fatalf("%s: observeProbes() = nil", tt.name)
+		}
+		got := EffectiveStatus{Started: status.Started, Live: status.Live, Ready: status.Ready, PendingAction: status.PendingAction}
+		if got != tt.wantStatus {
+			t.Errorf("%s: observeProbes() = %+v, want %+v", tt.name, got, tt.wantStatus)
+		}
+	}
+
+	// A restarted container starts over.
+	restarted := pod.DeepCopy()
+	restarted.Status.ContainerStatuses[0].State.Running.StartedAt = metav1.Time{Time: start.Add(time.Minute)}
+	if status := d.observeProbes(restarted, ProbeStatus{}, start.Add(time.Minute)); status.Started || status.PendingAction != "" {
+		t.Errorf("observeProbes() after a restart = %+v, want a starting container", status)
+	}
+}
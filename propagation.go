@@ -0,0 +1,193 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxPropagationSamples bounds the latency samples kept per pod and per
+// ReplicaSet.
+const maxPropagationSamples = 100
+
+// Propagation stages of a readiness change.
+const (
+	StageKubelet   = "kubelet"
+	StageEndpoints = "endpoints"
+)
+
+// LatencyStats summarizes latency samples.
+type LatencyStats struct {
+	Samples    int     `json:"samples"`
+	P50Seconds float64 `json:"p50Seconds"`
+	P95Seconds float64 `json:"p95Seconds"`
+	MaxSeconds float64 `json:"maxSeconds"`
+}
+
+func latencyStats(samples []time.Duration) LatencyStats {
+	if len(samples) == 0 {
+		return LatencyStats{}
+	}
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	pct := func(p float64) float64 {
+		return sorted[int(p*float64(len(sorted)-1))].Seconds()
+	}
+	return LatencyStats{
+		Samples:    len(sorted),
+		P50Seconds: pct(0.50),
+		P95Seconds: pct(0.95),
+		MaxSeconds: sorted[len(sorted)-1].Seconds(),
+	}
+}
+
+// pendingPropagation is a readiness change reported by the application that
+// has not yet shown up in one of the stages.
+type pendingPropagation struct {
+	ready bool
+	since time.Time
+}
+
+type podPropagation struct {
+	replicaSet string
+	pending    map[string]pendingPropagation
+	samples    map[string][]time.Duration
+}
+
+// propagationTracker measures how long a readiness change reported by the
+// application takes to reach the pod's Ready condition and its EndpointSlices.
+type propagationTracker struct {
+	mu          sync.Mutex
+	pods        map[string]*podPropagation
+	replicaSets map[string]map[string][]time.Duration
+}
+
+func newPropagationTracker() *propagationTracker {
+	return &propagationTracker{
+		pods:        make(map[string]*podPropagation),
+		replicaSets: make(map[string]map[string][]time.Duration),
+	}
+}
+
+// replicaSetKey groups a pod's samples by its direct controller.
+func replicaSetKey(status *PodStatusInfo) string {
+	if status.Owner == nil {
+		return ""
+	}
+	return status.Namespace + "/" + status.Owner.Name
+}
+
+// endpointsReady reports whether the pod is a ready endpoint of any Service,
+// and whether it is tracked in any at all.
+func endpointsReady(endpoints []EndpointMembership) (ready, tracked bool) {
+	for _, m := range endpoints {
+		ready = ready || m.Ready
+	}
+	return ready, len(endpoints) > 0
+}
+
+// appChanged starts measuring a readiness change the application reported at
+// the given time. Stages that already agree can't be measured and are
+// skipped; a previous measurement still in progress is abandoned.
+func (t *propagationTracker) appChanged(status *PodStatusInfo, ready bool, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := podKey(status.Namespace, status.Name)
+	p := t.pods[key]
+	if p == nil {
+		p = &podPropagation{
+			pending: make(map[string]pendingPropagation),
+			samples: make(map[string][]time.Duration),
+		}
+		t.pods[key] = p
+	}
+	p.replicaSet = replicaSetKey(status)
+
+	delete(p.pending, StageKubelet)
+	delete(p.pending, StageEndpoints)
+	if status.Kubelet != nil && status.Kubelet.PodReady != ready {
+		p.pending[StageKubelet] = pendingPropagation{ready, at}
+	}
+	if epReady, tracked := endpointsReady(status.Endpoints); tracked && epReady != ready {
+		p.pending[StageEndpoints] = pendingPropagation{ready, at}
+	}
+}
+
+// observe completes the measurement of a stage once it reaches the state the
+// application reported.
+func (t *propagationTracker) observe(pod, stage string, ready bool, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p := t.pods[pod]
+	if p == nil {
+		return
+	}
+	pending, ok := p.pending[stage]
+	if !ok || pending.ready != ready {
+		return
+	}
+	delete(p.pending, stage)
+	took := max(at.Sub(pending.since), 0)
+
+	p.samples[stage] = appendSample(p.samples[stage], took)
+	if p.replicaSet != "" {
+		rs := t.replicaSets[p.replicaSet]
+		if rs == nil {
+			rs = make(map[string][]time.Duration)
+			t.replicaSets[p.replicaSet] = rs
+		}
+		rs[stage] = appendSample(rs[stage], took)
+	}
+}
+
+func appendSample(samples []time.Duration, d time.Duration) []time.Duration {
+	samples = append(samples, d)
+	if len(samples) > maxPropagationSamples {
+		samples = samples[len(samples)-maxPropagationSamples:]
+	}
+	return samples
+}
+
+// forget drops a pod's samples. Its ReplicaSet keeps them.
+func (t *propagationTracker) forget(pod string) {
+	t.mu.Lock()
+	delete(t.pods, pod)
+	t.mu.Unlock()
+}
+
+// PropagationStats are readiness propagation latencies by stage, per pod and
+// per ReplicaSet, both keyed by namespace/name.
+type PropagationStats struct {
+	Pods        map[string]map[string]LatencyStats `json:"pods"`
+	ReplicaSets map[string]map[string]LatencyStats `json:"replicaSets"`
+}
+
+func (t *propagationTracker) stats() PropagationStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	summarize := func(samples map[string][]time.Duration) map[string]LatencyStats {
+		out := make(map[string]LatencyStats)
+		for stage, s := range samples {
+			if len(s) > 0 {
+				out[stage] = latencyStats(s)
+			}
+		}
+		return out
+	}
+	stats := PropagationStats{
+		Pods:        make(map[string]map[string]LatencyStats),
+		ReplicaSets: make(map[string]map[string]LatencyStats),
+	}
+	for name, p := range t.pods {
+		if s := summarize(p.samples); len(s) > 0 {
+			stats.Pods[name] = s
+		}
+	}
+	for key, samples := range t.replicaSets {
+		stats.ReplicaSets[key] = summarize(samples)
+	}
+	return stats
+}
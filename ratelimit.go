@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// limiterIdle is how long a client's bucket is kept after its last request.
+const limiterIdle = 10 * time.Minute
+
+// clientLimiter keeps a token bucket per client.
+type clientLimiter struct {
+	mu      sync.Mutex
+	clients map[string]*limitedClient
+	swept   time.Time
+}
+
+type limitedClient struct {
+	limiter *rate.Limiter
+	seen    time.Time
+}
+
+func newClientLimiter() *clientLimiter {
+	return &clientLimiter{clients: make(map[string]*limitedClient)}
+}
+
+// allow takes a token from key's bucket, which refills at limit per second
+// up to burst. When the bucket is empty it returns how long until the next
+// token.
+func (l *clientLimiter) allow(key string, limit float64, burst int) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.swept) > limiterIdle {
+		for k, c := range l.clients {
+			if now.Sub(c.seen) > limiterIdle {
+				delete(l.clients, k)
+			}
+		}
+		l.swept = now
+	}
+
+	c := l.clients[key]
+	if c == nil {
+		c = &limitedClient{limiter: rate.NewLimiter(rate.Limit(limit), burst)}
+		l.clients[key] = c
+	}
+	// The limits may have been changed by a config reload.
+	if c.limiter.Limit() != rate.Limit(limit) || c.limiter.Burst() != burst {
+		c.limiter.SetLimitAt(now, rate.Limit(limit))
+		c.limiter.SetBurstAt(now, burst)
+	}
+	c.seen = now
+	if c.limiter.AllowN(now, 1) {
+		return true, 0
+	}
+	return false, time.Duration(float64(time.Second) / limit)
+}
+
+// clientKey identifies the client of r for rate limiting: its authenticated
+// user, else its IP address.
+func clientKey(r *http.Request) string {
+	if user := requestUser(r); user != "" {
+		return "user:" + user
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// limitClient answers 429 and reports false when r's client exceeded limit.
+// A zero limit disables limiting.
+func (d *Dashboard) limitClient(w http.ResponseWriter, r *http.Request, l *clientLimiter, name string, limit float64, burst int) bool {
+	if limit <= 0 {
+		return true
+	}
+	ok, wait := l.allow(clientKey(r), limit, burst)
+	if ok {
+		return true
+	}
+	d.metrics.rateLimited.WithLabelValues(name).Inc()
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, fmt.Sprintf("Too many requests; limit is %g per second", limit), http.StatusTooManyRequests)
+	return false
+}
+
+// rateLimit limits the API and WebSocket requests of each client to
+// RateLimit per second. Probe actions and other changes are limited
+// separately by requireToken.
+func (d *Dashboard) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/ws" {
+			cfg := d.cfg()
+			if !d.limitClient(w, r, d.apiLimiter, "api", cfg.RateLimit, cfg.RateBurst) {
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
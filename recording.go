@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// maxRecordingEvents bounds a recording in memory; it is stopped and saved
+// once it holds this many events.
+const maxRecordingEvents = 100000
+
+// recordingName is what recordings may be named; the name is also their
+// file name in the recordings directory.
+var recordingName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// RecordedEvent is a pod change or an action of a recording.
+type RecordedEvent struct {
+	Time   time.Time   `json:"time"`
+	Pod    *PodEvent   `json:"pod,omitempty"`
+	Action *AuditEntry `json:"action,omitempty"`
+}
+
+// RecordingInfo describes a recording. A saved recording is a JSON lines
+// file: a RecordingInfo followed by its events, oldest first. The first
+// events are the pods as they were when the recording started.
+type RecordingInfo struct {
+	Name    string     `json:"name"`
+	Started time.Time  `json:"started"`
+	Stopped *time.Time `json:"stopped,omitempty"`
+	Events  int        `json:"events"`
+	// Active is set while the recording is in progress.
+	Active bool `json:"active,omitempty"`
+}
+
+// recording is a recording in progress.
+type recording struct {
+	RecordingInfo
+	events []RecordedEvent
+}
+
+// recorder records the pod changes and actions of every cluster while a
+// recording is active.
+type recorder struct {
+	mu     sync.Mutex
+	active *recording
+}
+
+// errRecordingActive and errNoRecording are the conflicts of starting and
+// stopping a recording.
+var (
+	errRecordingActive = fmt.Errorf("a recording is already in progress")
+	errNoRecording     = fmt.Errorf("no recording is in progress")
+)
+
+// startRecording starts recording under name, or under the current time if
+// it is empty. The pods as they are now are its first events.
+func (d *Dashboard) startRecording(name string, now time.Time) (RecordingInfo, error) {
+	if name == "" {
+		name = now.UTC().Format("20060102-150405")
+	}
+	if !recordingName.MatchString(name) {
+		return RecordingInfo{}, fmt.Errorf("invalid recording name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	if _, err := os.Stat(recordingPath(d.cfg().RecordingsDir, name)); err == nil {
+		return RecordingInfo{}, fmt.Errorf("recording %s already exists", name)
+	}
+
+	r := d.recorder
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.active != nil {
+		return RecordingInfo{}, errRecordingActive
+	}
+	// Pods are published only after they are stored, so with r.mu held
+	// no change falls between this state and the events that follow.
+	rec := &recording{RecordingInfo: RecordingInfo{Name: name, Started: now, Active: true}}
+	for _, pod := range d.sortedPods() {
+		rec.events = append(rec.events, RecordedEvent{Time: now, Pod: &PodEvent{Type: PodEventUpdate, Cluster: pod.Cluster, Namespace: pod.Namespace, Name: pod.Name, Pod: pod}})
+	}
+	r.active = rec
+	slog.Info("Recording started", "name", name, "pods", len(rec.events))
+	return rec.info(), nil
+}
+
+// stop ends the active recording and saves it to dir.
+func (r *recorder) stop(dir string, now time.Time) (RecordingInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.active == nil {
+		return RecordingInfo{}, errNoRecording
+	}
+	rec := r.active
+	r.active = nil
+	rec.Stopped, rec.Active = &now, false
+	info := rec.info()
+	if err := rec.save(dir); err != nil {
+		return info, err
+	}
+	slog.Info("Recording saved", "name", rec.Name, "events", info.Events, "duration", now.Sub(rec.Started).Round(time.Second))
+	return info, nil
+}
+
+// add records an event if a recording is active. A recording that reaches
+// maxRecordingEvents is stopped and saved to dir.
+func (r *recorder) add(ev RecordedEvent, dir string) {
+	r.mu.Lock()
+	if r.active == nil {
+		r.mu.Unlock()
+		return
+	}
+	r.active.events = append(r.active.events, ev)
+	full := len(r.active.events) >= maxRecordingEvents
+	r.mu.Unlock()
+	if full {
+		slog.Warn("Recording is full; stopping it", "events", maxRecordingEvents)
+		if _, err := r.stop(dir, ev.Time); err != nil && err != errNoRecording {
+			slog.Error("Failed to save recording", "error", err)
+		}
+	}
+}
+
+// activeInfo returns the active recording, if any.
+func (r *recorder) activeInfo() (RecordingInfo, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.active == nil {
+		return RecordingInfo{}, false
+	}
+	return r.active.info(), true
+}
+
+func (rec *recording) info() RecordingInfo {
+	info := rec.RecordingInfo
+	info.Events = len(rec.events)
+	return info
+}
+
+// recordPod records a pod event of this dashboard's cluster. Transitions
+// aren't recorded; replaying the pods' statuses brings them back.
+func (d *Dashboard) recordPod(ev PodEvent) {
+	if ev.Type == PodEventTransition {
+		return
+	}
+	d.recorder.add(RecordedEvent{Time: time.Now(), Pod: &ev}, d.cfg().RecordingsDir)
+}
+
+// recordAction records an audited action.
+func (d *Dashboard) recordAction(e AuditEntry) {
+	d.recorder.add(RecordedEvent{Time: e.Time, Action: &e}, d.cfg().RecordingsDir)
+}
+
+func recordingPath(dir, name string) string {
+	return filepath.Join(dir, name+".jsonl")
+}
+
+// save writes the recording to its file in dir.
+func (rec *recording) save(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create recordings directory: %v", err)
+	}
+	path := recordingPath(dir, rec.Name)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create recording: %v", err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(rec.info()); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write recording: %v", err)
+	}
+	for _, ev := range rec.events {
+		if err := enc.Encode(ev); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write recording: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write recording: %v", err)
+	}
+	return f.Close()
+}
+
+// loadRecording reads a saved recording from path, or from the recordings
+// directory if path is a recording name.
+func loadRecording(dir, path string) (RecordingInfo, []RecordedEvent, error) {
+	if recordingName.MatchString(path) && !strings.HasSuffix(path, ".jsonl") {
+		path = recordingPath(dir, path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return RecordingInfo{}, nil, fmt.Errorf("failed to open recording: %v", err)
+	}
+	defer f.Close()
+	dec := json.NewDecoder(bufio.NewReader(f))
+	var info RecordingInfo
+	if err := dec.Decode(&info); err != nil {
+		return RecordingInfo{}, nil, fmt.Errorf("failed to read recording %s: %v", path, err)
+	}
+	var events []RecordedEvent
+	for {
+		var ev RecordedEvent
+		if err := dec.Decode(&ev); err == io.EOF {
+			break
+		} else if err != nil {
+			return RecordingInfo{}, nil, fmt.Errorf("failed to read recording %s: %v", path, err)
+		}
+		events = append(events, ev)
+	}
+	return info, events, nil
+}
+
+// listRecordings returns the saved recordings in dir, newest first, with
+// the active one, if any, in front.
+func (d *Dashboard) listRecordings() ([]RecordingInfo, error) {
+	dir := d.cfg().RecordingsDir
+	var saved []RecordingInfo
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read recordings directory: %v", err)
+	}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".jsonl")
+		if !ok || e.IsDir() || !recordingName.MatchString(name) {
+			continue
+		}
+		f, err := os.Open(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		var info RecordingInfo
+		// Only the first line is read.
+		err = json.NewDecoder(f).Decode(&info)
+		f.Close()
+		if err != nil {
+			slog.Warn("Skipping unreadable recording", "file", e.Name(), "error", err)
+			continue
+		}
+		saved = append(saved, info)
+	}
+	sort.Slice(saved, func(i, j int) bool { return saved[i].Started.After(saved[j].Started) })
+
+	recordings := []RecordingInfo{}
+	if active, ok := d.recorder.activeInfo(); ok {
+		recordings = append(recordings, active)
+	}
+	return append(recordings, saved...), nil
+}
+
+// replaySession is a recording loaded to be replayed with --replay.
+type replaySession struct {
+	info   RecordingInfo
+	events []RecordedEvent
+}
+
+// newReplaySession loads the recording to replay and creates the dashboard
+// it is replayed through, over an empty simulated cluster so only the
+// recorded pods show up.
+func newReplaySession(cfg Config) (*replaySession, *Dashboard, error) {
+	info, events, err := loadRecording(cfg.RecordingsDir, cfg.Replay)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg.AccessMode = AccessDirect
+	cfg.Contexts = nil
+	d, err := newDashboard(fake.NewClientset(), &http.Client{}, cfg, newDashboardMetrics())
+	if err != nil {
+		return nil, nil, err
+	}
+	slog.Info("Replaying a recording instead of monitoring a cluster", "name", info.Name, "events", len(events), "speed", cfg.ReplaySpeed)
+	return &replaySession{info, events}, d, nil
+}
+
+// replay feeds a recording through the dashboard as if its pods were being
+// monitored: every event is applied when its offset from the start of the
+// recording, divided by speed, has passed. Pod check and audit times are
+// moved to when they are replayed so history, snapshots and the audit log
+// line up; other times stay as recorded.
+func (d *Dashboard) replay(ctx context.Context, s *replaySession, speed float64) {
+	start := time.Now()
+	at := func(t time.Time) time.Time {
+		return start.Add(time.Duration(float64(t.Sub(s.info.Started)) / speed))
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for _, ev := range s.events {
+		when := at(ev.Time)
+		if wait := time.Until(when); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+		}
+		switch {
+		case ev.Pod != nil:
+			d.replayPod(*ev.Pod, when)
+		case ev.Action != nil:
+			e := *ev.Action
+			e.Time, e.Cluster = when, d.cluster
+			slog.Info("Replayed action", "action", e.Action, "pod", e.Pod, "probe", e.Probe, "result", e.Result)
+			if err := d.store.AppendAudit(e); err != nil {
+				slog.Error("Failed to store audit entry", "action", e.Action, "error", err)
+			}
+		}
+	}
+	slog.Info("Replay finished", "name", s.info.Name)
+}
+
+// replayPod applies a recorded pod event. Pods of several recorded clusters
+// are replayed into this dashboard's cluster.
+func (d *Dashboard) replayPod(ev PodEvent, now time.Time) {
+	if ev.Type == PodEventDelete {
+		d.removePod(ev.Namespace, ev.Name)
+		return
+	}
+	if ev.Pod == nil {
+		return
+	}
+	status := *ev.Pod
+	status.Cluster, status.LastCheck = d.cluster, now
+	key := podKey(status.Namespace, status.Name)
+	d.mu.Lock()
+	d.pods[key] = &status
+	d.mu.Unlock()
+
+	entries := d.history.observe(key, status.Info, now)
+	d.persist(&status, entries)
+	d.publish(PodEvent{Type: ev.Type, Namespace: status.Namespace, Name: status.Name, Pod: &status})
+	for i := range entries {
+		d.publish(PodEvent{Type: PodEventTransition, Namespace: status.Namespace, Name: status.Name, Transition: &entries[i].ProbeTransition})
+	}
+}
+
+// StartRecordingRequest is the optional body of POST /api/recordings.
+type StartRecordingRequest struct {
+	// Name defaults to the start time.
+	Name string `json:"name,omitempty"`
+}
+
+// handleRecordings serves GET /api/recordings.
+func (d *Dashboard) handleRecordings(w http.ResponseWriter, r *http.Request) {
+	recordings, err := d.listRecordings()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recordings)
+}
+
+// handleRecordingStart serves POST /api/recordings.
+func (d *Dashboard) handleRecordingStart(w http.ResponseWriter, r *http.Request) {
+	var req StartRecordingRequest
+	if r.ContentLength != 0 {
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	info, err := d.startRecording(req.Name, time.Now())
+	switch {
+	case err == errRecordingActive:
+		http.Error(w, "A recording is already in progress", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("Failed to start recording: %v", err), http.StatusBadRequest)
+		return
+	}
+	d.audit(AuditEntry{actor: requestActor(r), Action: "recording-start", Detail: "recording " + info.Name}, nil)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/recordings/"+info.Name)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(info)
+}
+
+// handleRecordingStop serves POST /api/recordings/stop.
+func (d *Dashboard) handleRecordingStop(w http.ResponseWriter, r *http.Request) {
+	info, err := d.recorder.stop(d.cfg().RecordingsDir, time.Now())
+	if err == errNoRecording {
+		http.Error(w, "No recording is in progress", http.StatusConflict)
+		return
+	}
+	d.audit(AuditEntry{actor: requestActor(r), Action: "recording-stop", Detail: "recording " + info.Name}, err)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to save recording: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// handleRecordingGet serves GET /api/recordings/{name}, the saved recording
+// file to replay elsewhere.
+func (d *Dashboard) handleRecordingGet(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !recordingName.MatchString(name) {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return
+	}
+	f, err := os.Open(recordingPath(d.cfg().RecordingsDir, name))
+	if err != nil {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".jsonl"))
+	io.Copy(w, f)
+}
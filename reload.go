@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+)
+
+// configPollInterval is how often the config file is checked for changes.
+// Polling also catches the symlink swap of ConfigMap volume updates.
+const configPollInterval = 5 * time.Second
+
+// cfg returns the current configuration.
+func (d *Dashboard) cfg() Config {
+	d.cfgMu.RLock()
+	defer d.cfgMu.RUnlock()
+	return d.config
+}
+
+// configChanged returns a channel that is closed on the next reload, so
+// long-running loops can pick up new intervals.
+func (d *Dashboard) configChanged() <-chan struct{} {
+	d.cfgMu.RLock()
+	defer d.cfgMu.RUnlock()
+	return d.reloaded
+}
+
+// applyConfig switches the dashboard to next. Settings that need a restart
+// (kubeconfig and contexts, store, access mode, IP family, target and server
+// TLS, OIDC, templates, event bus) keep their current values with a warning.
+// The pod informers are restarted when the selector, namespaces or Service
+// changed.
+func (d *Dashboard) applyConfig(ctx context.Context, next Config) error {
+	if _, err := next.validate(); err != nil {
+		return err
+	}
+	prev := d.cfg()
+
+	// auto was resolved to direct or proxy at startup.
+	if next.AccessMode == AccessAuto {
+		next.AccessMode = prev.AccessMode
+	}
+	if next.AccessMode != prev.AccessMode {
+		slog.Warn("Access mode changes require a restart", "current", prev.AccessMode, "requested", next.AccessMode)
+		next.AccessMode = prev.AccessMode
+	}
+	if next.Kubeconfig != prev.Kubeconfig || next.Context != prev.Context || !slices.Equal(next.Contexts, prev.Contexts) {
+		slog.Warn("Kubeconfig and context changes require a restart")
+		next.Kubeconfig, next.Context, next.Contexts = prev.Kubeconfig, prev.Context, prev.Contexts
+	}
+	if next.IPFamily != prev.IPFamily {
+		slog.Warn("IP family changes require a restart", "current", prev.IPFamily, "requested", next.IPFamily)
+		next.IPFamily = prev.IPFamily
+	}
+	if tlsSettingsChanged(next, prev) {
+		slog.Warn("Target TLS changes require a restart")
+		next.TargetCAFile, next.TargetCertFile, next.TargetKeyFile = prev.TargetCAFile, prev.TargetCertFile, prev.TargetKeyFile
+		next.TargetServerName, next.TargetInsecureSkipVerify = prev.TargetServerName, prev.TargetInsecureSkipVerify
+	}
+	if next.OIDCIssuer != prev.OIDCIssuer || next.OIDCClientID != prev.OIDCClientID ||
+		next.OIDCClientSecret != prev.OIDCClientSecret || next.OIDCRedirectURL != prev.OIDCRedirectURL {
+		slog.Warn("OIDC changes require a restart, except for the allowed users")
+		next.OIDCIssuer, next.OIDCClientID = prev.OIDCIssuer, prev.OIDCClientID
+		next.OIDCClientSecret, next.OIDCRedirectURL = prev.OIDCClientSecret, prev.OIDCRedirectURL
+	}
+	if serverTLSSettingsChanged(next, prev) {
+		slog.Warn("Dashboard TLS changes require a restart")
+		next.TLSCertFile, next.TLSKeyFile, next.TLSSelfSigned = prev.TLSCertFile, prev.TLSKeyFile, prev.TLSSelfSigned
+		next.TLSMinVersion, next.TLSCipherSuites, next.HTTPRedirectAddr = prev.TLSMinVersion, prev.TLSCipherSuites, prev.HTTPRedirectAddr
+	}
+	if next.ReadTimeout != prev.ReadTimeout || next.WriteTimeout != prev.WriteTimeout ||
+		next.IdleTimeout != prev.IdleTimeout || next.MaxHeaderBytes != prev.MaxHeaderBytes {
+		slog.Warn("Server timeout and header limit changes require a restart")
+		next.ReadTimeout, next.WriteTimeout = prev.ReadTimeout, prev.WriteTimeout
+		next.IdleTimeout, next.MaxHeaderBytes = prev.IdleTimeout, prev.MaxHeaderBytes
+	}
+	if next.DebugAddr != prev.DebugAddr {
+		slog.Warn("Debug address changes require a restart", "current", prev.DebugAddr, "requested", next.DebugAddr)
+		next.DebugAddr = prev.DebugAddr
+	}
+	if next.TemplateDir != prev.TemplateDir || next.Timezone != prev.Timezone {
+		slog.Warn("Template directory and timezone changes require a restart")
+		next.TemplateDir, next.Timezone = prev.TemplateDir, prev.Timezone
+	}
+	next.StorePath = clusterStorePath(next.StorePath, d.cluster)
+	if next.Store != prev.Store || next.StorePath != prev.StorePath {
+		slog.Warn("Store changes require a restart", "current", prev.Store, "requested", next.Store)
+		next.Store, next.StorePath = prev.Store, prev.StorePath
+	}
+	if next.EventBus != prev.EventBus || !slices.Equal(next.EventBusBrokers, prev.EventBusBrokers) ||
+		next.EventBusTopic != prev.EventBusTopic || next.EventBusEncoding != prev.EventBusEncoding {
+		slog.Warn("Event bus changes require a restart")
+		next.EventBus, next.EventBusBrokers = prev.EventBus, prev.EventBusBrokers
+		next.EventBusTopic, next.EventBusEncoding = prev.EventBusTopic, prev.EventBusEncoding
+	}
+	if next.OTLPEndpoint != prev.OTLPEndpoint || !maps.Equal(next.OTLPHeaders, prev.OTLPHeaders) || next.TraceSampleRatio != prev.TraceSampleRatio {
+		slog.Warn("Tracing changes require a restart")
+		next.OTLPEndpoint, next.OTLPHeaders, next.TraceSampleRatio = prev.OTLPEndpoint, prev.OTLPHeaders, prev.TraceSampleRatio
+	}
+
+	d.cfgMu.Lock()
+	d.config = next
+	close(d.reloaded)
+	d.reloaded = make(chan struct{})
+	d.cfgMu.Unlock()
+
+	if next.Selector != prev.Selector || !slices.Equal(next.Namespaces, prev.Namespaces) || next.Service != prev.Service || next.ResyncPeriod != prev.ResyncPeriod {
+		slog.Info("Restarting pod informers", "selector", next.Selector, "namespaces", next.Namespaces, "service", next.Service, "resyncPeriod", next.ResyncPeriod)
+		if err := d.startInformers(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// watchConfig reloads the configuration on SIGHUP and whenever the config
+// file changes, until ctx is cancelled. Invalid configurations are logged and
+// the current one stays in effect.
+func (d *Dashboard) watchConfig(ctx context.Context, args []string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+	lastMod := configModTime(d.cfg().ConfigFile)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			slog.Info("Received SIGHUP, reloading configuration")
+		case <-ticker.C:
+			mod := configModTime(d.cfg().ConfigFile)
+			if mod.Equal(lastMod) {
+				continue
+			}
+			lastMod = mod
+			slog.Info("Config file changed, reloading configuration", "path", d.cfg().ConfigFile)
+		}
+
+		next, err := loadConfig(args, io.Discard)
+		if err != nil {
+			slog.Error("Failed to reload configuration", "error", err)
+			continue
+		}
+		if err := setupLogging(next.LogLevel, next.LogFormat); err != nil {
+			slog.Error("Failed to reload configuration", "error", err)
+			continue
+		}
+		if err := d.applyConfig(ctx, next); err != nil {
+			slog.Error("Failed to apply configuration", "error", err)
+			continue
+		}
+		lastMod = configModTime(next.ConfigFile)
+		slog.Info("Configuration reloaded")
+	}
+}
+
+// configModTime returns the modification time of the config file, or the zero
+// time when there is none.
+func configModTime(path string) time.Time {
+	if path == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// maxRemoteWriteBacklog is how many gathered batches are kept for retry
+// while the remote-write endpoint is failing; older ones are dropped.
+const maxRemoteWriteBacklog = 120
+
+// runRemoteWrite ships the metrics of /metrics, including every pod's probe
+// state and scrape latency, to a Prometheus remote-write endpoint such as
+// Prometheus, Mimir or VictoriaMetrics every remote-write interval, until
+// ctx is done. The endpoint and interval are re-read on every reload, keeping
+// the next shipment one interval after the last. The registry is shared by
+// the clusters, so only the first dashboard runs it.
+func (d *Dashboard) runRemoteWrite(ctx context.Context) {
+	var backlog [][]metricSample
+	announced := ""
+	last := time.Now()
+	for {
+		cfg := d.cfg()
+		var timer *time.Timer
+		var tick <-chan time.Time
+		if cfg.RemoteWriteURL != "" {
+			if cfg.RemoteWriteURL != announced {
+				// Validated with the config; the URL may hold credentials.
+				u, _ := url.Parse(cfg.RemoteWriteURL)
+				slog.Info("Shipping metrics with remote write", "url", u.Redacted(), "interval", cfg.RemoteWriteInterval)
+			}
+			timer = time.NewTimer(time.Until(last.Add(cfg.RemoteWriteInterval)))
+			tick = timer.C
+		} else {
+			backlog = nil
+		}
+		announced = cfg.RemoteWriteURL
+
+		select {
+		case <-ctx.Done():
+		case <-d.configChanged():
+		case now := <-tick:
+			last = now
+			series, err := gatherMetricSamples(d.metrics.registry, now)
+			if err != nil {
+				slog.Warn("Failed to gather metrics for remote write", "error", err)
+				break
+			}
+			backlog = append(backlog, series)
+			if len(backlog) > maxRemoteWriteBacklog {
+				slog.Warn("Remote-write backlog full; dropping the oldest samples", "batches", len(backlog)-maxRemoteWriteBacklog)
+				backlog = backlog[len(backlog)-maxRemoteWriteBacklog:]
+			}
+			backlog = d.sendRemoteWrite(ctx, cfg, backlog)
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// sendRemoteWrite sends the batches oldest first and returns those that
+// failed and should be retried.
+func (d *Dashboard) sendRemoteWrite(ctx context.Context, cfg Config, backlog [][]metricSample) [][]metricSample {
+	for len(backlog) > 0 {
+		retry, err := postRemoteWrite(ctx, cfg, encodeWriteRequest(backlog[0]))
+		if err != nil && retry {
+			slog.Warn("Remote write failed; will retry", "pending", len(backlog), "error", err)
+			return backlog
+		}
+		if err != nil {
+			slog.Error("Remote write rejected; dropping the batch", "error", err)
+		}
+		backlog = backlog[1:]
+	}
+	return nil
+}
+
+// postRemoteWrite sends one WriteRequest and reports whether a failure is
+// worth retrying, as for server errors and throttling.
+func postRemoteWrite(ctx context.Context, cfg Config, request []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.RemoteWriteURL, bytes.NewReader(snappy.Encode(nil, request)))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if cfg.RemoteWriteBearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.RemoteWriteBearerToken)
+	}
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("failed to post: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		return false, nil
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return true, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	return false, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+}
+
+// encodeWriteRequest encodes a prometheus.WriteRequest protobuf message.
+func encodeWriteRequest(series []metricSample) []byte {
+	var req []byte
+	for _, s := range series {
+		var ts []byte
+		for _, l := range s.labels {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, l[0])
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, l[1])
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, label)
+		}
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(s.timestamp))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sample)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+	return req
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodeWriteRequest is the inverse of encodeWriteRequest, reading the
+// fields of prometheus.WriteRequest it writes.
+func decodeWriteRequest(t *testing.T, b []byte) []metricSample {
+	t.Helper()
+	// fields calls fn with each length-delimited or scalar field of msg.
+	fields := func(msg []byte, fn func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64)) {
+		for len(msg) > 0 {
+			num, typ, n := protowire.ConsumeTag(msg)
+			if n < 0 {
+				t.Fatalf("invalid tag: %v", protowire.ParseError(n))
+			}
+			msg = msg[n:]
+			switch typ {
+			case protowire.BytesType:
+				v, n := protowire.ConsumeBytes(msg)
+				if n < 0 {
+					t.Fatalf("invalid field %d: %v", num, protowire.ParseError(n))
+				}
+				fn(num, typ, v, 0)
+				msg = msg[n:]
+			case protowire.Fixed64Type:
+				v, n := protowire.ConsumeFixed64(msg)
+				if n < 0 {
+					t.Fatalf("invalid field %d: %v", num, protowire.ParseError(n))
+				}
+				fn(num, typ, nil, v)
+				msg = msg[n:]
+			case protowire.VarintType:
+				v, n := protowire.ConsumeVarint(msg)
+				if n < 0 {
+					t.Fatalf("invalid field %d: %v", num, protowire.ParseError(n))
+				}
+				fn(num, typ, nil, v)
+				msg = msg[n:]
+			default:
+				t.Fatalf("unexpected wire type %v of field %d", typ, num)
+			}
+		}
+	}
+
+	var series []metricSample
+	fields(b, func(num protowire.Number, _ protowire.Type, ts []byte, _ uint64) {
+		if num != 1 {
+			t.Fatalf("unexpected WriteRequest field %d", num)
+		}
+		var s metricSample
+		fields(ts, func(num protowire.Number, _ protowire.Type, value []byte, _ uint64) {
+			switch num {
+			case 1:
+				var label [2]string
+				fields(value, func(num protowire.Number, _ protowire.Type, value []byte, _ uint64) {
+					label[num-1] = string(value)
+				})
+				s.labels = append(s.labels, label)
+			case 2:
+				fields(value, func(num protowire.Number, _ protowire.Type, _ []byte, scalar uint64) {
+					switch num {
+					case 1:
+						s.value = math.Float64frombits(scalar)
+					case 2:
+						s.timestamp = int64(scalar)
+					}
+				})
+			}
+		})
+		series = append(series, s)
+	})
+	return series
+}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		series []metricSample
+	}{
+		{name: "empty"},
+		{
+			name: "one sample",
+			series: []metricSample{{
+				labels:    [][2]string{{"__name__", "probe_monitor_pods"}, {"job", "k8s-probe-monitor"}},
+				value:     3,
+				timestamp: 1735732800000,
+			}},
+		},
+		{
+			name: "several series",
+			series: []metricSample{
+				{labels: [][2]string{{"__name__", "up"}, {"pod", "default/web-1"}}, value: 1, timestamp: 1},
+				{labels: [][2]string{{"__name__", "latency_seconds_bucket"}, {"le", "+Inf"}}, value: 0.25, timestamp: 2},
+				{labels: [][2]string{{"__name__", "negative"}, {"unicode", "pödé"}}, value: -1.5e-9, timestamp: 3},
+			},
+		},
+		{
+			name:   "special values",
+			series: []metricSample{{labels: [][2]string{{"__name__", "inf"}}, value: math.Inf(1)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := decodeWriteRequest(t, encodeWriteRequest(tt.series))
+			if !reflect.DeepEqual(got, tt.series) {
+				t.Errorf("decoded %+v, want %+v", got, tt.series)
+			}
+		})
+	}
+}
+
+func TestPostRemoteWrite(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		wantErr   bool
+		wantRetry bool
+	}{
+		{name: "accepted", status: http.StatusNoContent},
+		{name: "bad request", status: http.StatusBadRequest, wantErr: true},
+		{name: "throttled", status: http.StatusTooManyRequests, wantErr: true, wantRetry: true},
+		{name: "server error", status: http.StatusServiceUnavailable, wantErr: true, wantRetry: true},
+	}
+	series := []metricSample{{labels: [][2]string{{"__name__", "up"}}, value: 1, timestamp: 42}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []metricSample
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("Content-Type") != "application/x-protobuf" ||
+					r.Header.Get("X-Prometheus-Remote-Write-Version") != "0.1.0" || r.Header.Get("Authorization") != "Bearer secret" {
+					t.Errorf("unexpected headers %v", r.Header)
+				}
+				body, _ := io.ReadAll(r.Body)
+				decoded, err := snappy.Decode(nil, body)
+				if err != nil {
+					t.Errorf("body is not snappy-compressed: %v", err)
+				}
+				got = decodeWriteRequest(t, decoded)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			cfg := Config{RemoteWriteURL: server.URL, RemoteWriteBearerToken: "secret"}
+			retry, err := postRemoteWrite(context.Background(), cfg, encodeWriteRequest(series))
+			if (err != nil) != tt.wantErr || retry != tt.wantRetry {
+				t.Errorf("postRemoteWrite() = %v, %v; want retry %v, error %v", retry, err, tt.wantRetry, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, series) {
+				t.Errorf("server received %+v, want %+v", got, series)
+			}
+		})
+	}
+}
+
+func TestSendRemoteWriteBacklog(t *testing.T) {
+	statuses := []int{http.StatusOK, http.StatusBadRequest, http.StatusServiceUnavailable}
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statuses[min(calls, len(statuses)-1)])
+		calls++
+	}))
+	defer server.Close()
+
+	batch := func(v float64) []metricSample {
+		return []metricSample{{labels: [][2]string{{"__name__", "up"}}, value: v}}
+	}
+	backlog := [][]metricSample{batch(1), batch(2), batch(3), batch(4)}
+	d := &Dashboard{}
+	left := d.sendRemoteWrite(context.Background(), Config{RemoteWriteURL: server.URL}, backlog)
+	// The first batch is sent, the second rejected for good and dropped, and
+	// the third kept for a retry with the ones after it.
+	if calls != 3 || !reflect.DeepEqual(left, backlog[2:]) {
+		t.Errorf("sendRemoteWrite() made %d calls and left %v, want 3 calls and %v", calls, left, backlog[2:])
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// reportTemplate renders /api/report.
+const reportTemplate = "report.html"
+
+// reportTransitions is the number of the most recent transitions a report
+// lists.
+const reportTransitions = 100
+
+// ReportTransition is a transition of a pod listed in a report.
+type ReportTransition struct {
+	Pod string
+	HistoryEntry
+}
+
+// recentTransitions returns the newest transitions of the monitored pods,
+// newest first.
+func (d *Dashboard) recentTransitions(pods []*PodStatusInfo, limit int) []ReportTransition {
+	var out []ReportTransition
+	for _, p := range pods {
+		entries, _ := d.history.get(p.Name)
+		for _, e := range entries {
+			out = append(out, ReportTransition{p.Name, e})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Time.After(out[j].Time) })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// dashboardCSS returns the stylesheet of the page, from the static
+// directory under dir when it has one.
+func dashboardCSS(dir string) ([]byte, error) {
+	if dir != "" {
+		css, err := os.ReadFile(filepath.Join(dir, "static", "dashboard.css"))
+		if err == nil || !os.IsNotExist(err) {
+			return css, err
+		}
+	}
+	return fs.ReadFile(webFiles, "web/static/dashboard.css")
+}
+
+// handleReport serves GET /api/report, a self-contained HTML snapshot of
+// this cluster's pods: summary counts, the pod cards and the recent
+// transitions, with the stylesheet inlined and no scripts, so it can be
+// saved and attached to a write-up. Printing it gives a PDF.
+func (d *Dashboard) handleReport(w http.ResponseWriter, r *http.Request) {
+	cfg := d.cfg()
+	css, err := dashboardCSS(cfg.TemplateDir)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read stylesheet: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	d.mu.RLock()
+	pods := make([]*PodStatusInfo, 0, len(d.pods))
+	for _, p := range d.pods {
+		pods = append(pods, p)
+	}
+	d.mu.RUnlock()
+	sort.Slice(pods, func(i, j int) bool { return pods[i].SortKey() < pods[j].SortKey() })
+
+	now := time.Now()
+	stats := d.podStats()
+	data := struct {
+		Generated       time.Time
+		Cluster         string
+		Selector        string
+		Version         string
+		CSS             template.CSS
+		Stats           PodStats
+		AvgContainerAge time.Duration
+		Pods            []*PodStatusInfo
+		Transitions     []ReportTransition
+	}{
+		Generated:       now,
+		Cluster:         d.cluster,
+		Selector:        cfg.Selector,
+		Version:         Version,
+		CSS:             template.CSS(css),
+		Stats:           stats,
+		AvgContainerAge: time.Duration(stats.AvgContainerAgeSeconds * float64(time.Second)),
+		Pods:            pods,
+		Transitions:     d.recentTransitions(pods, reportTransitions),
+	}
+
+	// The report never offers actions, whatever the mode.
+	var buf bytes.Buffer
+	if err := d.templates.readOnly.ExecuteTemplate(&buf, reportTemplate, data); err != nil {
+		http.Error(w, "Template execution error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", "probe-report-"+now.UTC().Format("20060102T150405Z")+".html"))
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// revisionAnnotation is set by the Deployment controller on Deployments and
+// their ReplicaSets.
+const revisionAnnotation = "deployment.kubernetes.io/revision"
+
+// Rollout states of a Deployment.
+const (
+	RolloutComplete    = "complete"
+	RolloutProgressing = "progressing"
+	RolloutPaused      = "paused"
+	RolloutFailed      = "failed"
+)
+
+// ReplicaSetStatus is one revision of a Deployment.
+type ReplicaSetStatus struct {
+	Name            string `json:"name"`
+	Revision        string `json:"revision"`
+	PodTemplateHash string `json:"podTemplateHash"`
+	Replicas        int32  `json:"replicas"`
+	Ready           int32  `json:"ready"`
+	Available       int32  `json:"available"`
+}
+
+// DeploymentStatus is the rollout state of a Deployment that owns monitored
+// pods.
+type DeploymentStatus struct {
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	UID       types.UID `json:"uid"`
+	Revision  string    `json:"revision"`
+	Desired   int32     `json:"desired"`
+	Current   int32     `json:"current"`
+	Updated   int32     `json:"updated"`
+	Ready     int32     `json:"ready"`
+	Available int32     `json:"available"`
+	// Progress is the share of desired replicas that run the new revision
+	// and are available.
+	Progress float64 `json:"progress"`
+	State    string  `json:"state"`
+	Message  string  `json:"message,omitempty"`
+	// ReplicaSets are the revisions that still have pods, newest first.
+	ReplicaSets []ReplicaSetStatus `json:"replicaSets"`
+}
+
+// newDeploymentStatus summarizes a Deployment and its ReplicaSets the way
+// kubectl rollout status judges progress.
+func newDeploymentStatus(dep *appsv1.Deployment, replicaSets []*appsv1.ReplicaSet) DeploymentStatus {
+	desired := int32(1)
+	if dep.Spec.Replicas != nil {
+		desired = *dep.Spec.Replicas
+	}
+	s := DeploymentStatus{
+		Namespace: dep.Namespace,
+		Name:      dep.Name,
+		UID:       dep.UID,
+		Revision:  dep.Annotations[revisionAnnotation],
+		Desired:   desired,
+		Current:   dep.Status.Replicas,
+		Updated:   dep.Status.UpdatedReplicas,
+		Ready:     dep.Status.ReadyReplicas,
+		Available: dep.Status.AvailableReplicas,
+	}
+	if desired > 0 {
+		s.Progress = float64(min(s.Updated, s.Available)) / float64(desired)
+	} else {
+		s.Progress = 1
+	}
+
+	var progressing *appsv1.DeploymentCondition
+	for i := range dep.Status.Conditions {
+		if dep.Status.Conditions[i].Type == appsv1.DeploymentProgressing {
+			progressing = &dep.Status.Conditions[i]
+		}
+	}
+	switch {
+	case dep.Spec.Paused:
+		s.State = RolloutPaused
+	case progressing != nil && progressing.Reason == "ProgressDeadlineExceeded":
+		s.State = RolloutFailed
+		s.Message = progressing.Message
+	case dep.Generation > dep.Status.ObservedGeneration,
+		s.Updated < desired, s.Current > s.Updated, s.Available < s.Updated:
+		s.State = RolloutProgressing
+		if progressing != nil {
+			s.Message = progressing.Message
+		}
+	default:
+		s.State = RolloutComplete
+	}
+
+	for _, rs := range replicaSets {
+		ref := metav1.GetControllerOf(rs)
+		if ref == nil || ref.UID != dep.UID || (rs.Status.Replicas == 0 && rs.Annotations[revisionAnnotation] != s.Revision) {
+			continue
+		}
+		s.ReplicaSets = append(s.ReplicaSets, ReplicaSetStatus{
+			Name:            rs.Name,
+			Revision:        rs.Annotations[revisionAnnotation],
+			PodTemplateHash: rs.Labels[appsv1.DefaultDeploymentUniqueLabelKey],
+			Replicas:        rs.Status.Replicas,
+			Ready:           rs.Status.ReadyReplicas,
+			Available:       rs.Status.AvailableReplicas,
+		})
+	}
+	sort.Slice(s.ReplicaSets, func(i, j int) bool {
+		a, _ := strconv.Atoi(s.ReplicaSets[i].Revision)
+		b, _ := strconv.Atoi(s.ReplicaSets[j].Revision)
+		return a > b
+	})
+	return s
+}
+
+// deployments returns the rollout state of every Deployment that owns a
+// monitored pod, ordered by namespace and name. Deployments not yet in the
+// informer caches are left out.
+func (d *Dashboard) deployments() []DeploymentStatus {
+	type key struct{ namespace, name string }
+	owners := make(map[key]bool)
+	d.mu.RLock()
+	w := d.watch
+	for _, p := range d.pods {
+		if p.Workload != nil && p.Workload.Kind == "Deployment" {
+			owners[key{p.Namespace, p.Workload.Name}] = true
+		}
+	}
+	d.mu.RUnlock()
+	if w == nil {
+		return nil
+	}
+
+	var out []DeploymentStatus
+	for k := range owners {
+		dep, err := w.deployment(k.namespace, k.name)
+		if err != nil {
+			continue
+		}
+		replicaSets, _ := w.replicaSets(k.namespace)
+		out = append(out, newDeploymentStatus(dep, replicaSets))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Namespace != out[j].Namespace {
+			return out[i].Namespace < out[j].Namespace
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// handleDeployments serves GET /api/deployments.
+func (d *Dashboard) handleDeployments(w http.ResponseWriter, r *http.Request) {
+	deployments := d.deployments()
+	if deployments == nil {
+		deployments = []DeploymentStatus{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deployments)
+}
+
+// deployment returns a Deployment from the watch's informer caches.
+func (w *podWatch) deployment(namespace, name string) (*appsv1.Deployment, error) {
+	lister, ok := forNamespace(w.deploymentListers, namespace)
+	if !ok {
+		return nil, fmt.Errorf("namespace %q is not watched", namespace)
+	}
+	return lister.Deployments(namespace).Get(name)
+}
+
+// replicaSets returns the ReplicaSets of a namespace from the watch's
+// informer caches.
+func (w *podWatch) replicaSets(namespace string) ([]*appsv1.ReplicaSet, error) {
+	lister, ok := forNamespace(w.replicaSetListers, namespace)
+	if !ok {
+		return nil, fmt.Errorf("namespace %q is not watched", namespace)
+	}
+	return lister.ReplicaSets(namespace).List(labels.Everything())
+}
+
+// deploymentsNamed returns the Deployments with a name in every watched
+// namespace.
+func (w *podWatch) deploymentsNamed(name string) []*appsv1.Deployment {
+	if w == nil {
+		return nil
+	}
+	var found []*appsv1.Deployment
+	for _, lister := range w.deploymentListers {
+		deployments, err := lister.List(labels.Everything())
+		if err != nil {
+			continue
+		}
+		for _, dep := range deployments {
+			if dep.Name == name {
+				found = append(found, dep)
+			}
+		}
+	}
+	return found
+}
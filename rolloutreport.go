@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// maxRolloutReports is the number of rollouts kept per Deployment.
+const maxRolloutReports = 10
+
+// RolloutSuperseded is a rollout replaced by a newer revision before it
+// completed.
+const RolloutSuperseded = "superseded"
+
+// PodRollout is a pod created by a rollout and when it became ready.
+type PodRollout struct {
+	Name         string     `json:"name"`
+	Created      time.Time  `json:"created"`
+	Ready        *time.Time `json:"ready,omitempty"`
+	ReadySeconds float64    `json:"readySeconds,omitempty"`
+}
+
+// RolloutReport measures one rollout of a Deployment to a new revision: how
+// long it took and how far it went above and below the desired replicas on
+// the way, next to the strategy that allowed it.
+type RolloutReport struct {
+	Namespace        string `json:"namespace"`
+	Deployment       string `json:"deployment"`
+	Revision         string `json:"revision"`
+	PreviousRevision string `json:"previousRevision,omitempty"`
+	ReplicaSet       string `json:"replicaSet,omitempty"`
+	Strategy         string `json:"strategy"`
+	MaxSurge         string `json:"maxSurge,omitempty"`
+	MaxUnavailable   string `json:"maxUnavailable,omitempty"`
+	Desired          int32  `json:"desired"`
+	// State is progressing, complete, failed, paused or superseded.
+	State           string     `json:"state"`
+	Started         time.Time  `json:"started"`
+	Finished        *time.Time `json:"finished,omitempty"`
+	DurationSeconds float64    `json:"durationSeconds"`
+	// MaxSurgeObserved is the most pods above the desired replicas and
+	// MaxUnavailableObserved the most desired replicas missing from the
+	// available ones at any update of the Deployment during the rollout.
+	MaxSurgeObserved       int32        `json:"maxSurgeObserved"`
+	MaxUnavailableObserved int32        `json:"maxUnavailableObserved"`
+	Pods                   []PodRollout `json:"pods"`
+}
+
+// deploymentRollouts are the rollout reports of one Deployment, oldest
+// first, and the revision it was last seen at.
+type deploymentRollouts struct {
+	revision string
+	reports  []*RolloutReport
+}
+
+// rolloutTracker follows the revisions of the Deployments in the watched
+// namespaces and records a report of every rollout of those of monitored
+// pods.
+type rolloutTracker struct {
+	mu          sync.Mutex
+	deployments map[types.UID]*deploymentRollouts
+}
+
+func newRolloutTracker() *rolloutTracker {
+	return &rolloutTracker{deployments: make(map[types.UID]*deploymentRollouts)}
+}
+
+// onDeployment follows a Deployment add or update. A new revision starts a
+// rollout, unless the Deployment is seen for the first time, in which case
+// only an unfinished rollout is followed from here on. The report of the
+// current rollout is updated until the rollout ends.
+func (d *Dashboard) onDeployment(w *podWatch, dep *appsv1.Deployment) {
+	if w.ctx.Err() != nil {
+		return
+	}
+	replicaSets, _ := w.replicaSets(dep.Namespace)
+	status := newDeploymentStatus(dep, replicaSets)
+	monitored := d.ownsPods(dep.UID)
+	now := time.Now()
+
+	t := d.rollouts
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rollouts := t.deployments[dep.UID]
+	var report *RolloutReport
+	switch {
+	case rollouts == nil:
+		rollouts = &deploymentRollouts{revision: status.Revision}
+		t.deployments[dep.UID] = rollouts
+		if status.State == RolloutComplete || !monitored {
+			return
+		}
+		report = rollouts.start(dep, "", now)
+	case rollouts.revision != status.Revision:
+		if current := rollouts.current(); current != nil {
+			current.finish(RolloutSuperseded, now)
+		}
+		previous := rollouts.revision
+		rollouts.revision = status.Revision
+		if !monitored {
+			return
+		}
+		report = rollouts.start(dep, previous, now)
+	default:
+		report = rollouts.current()
+	}
+	if report == nil {
+		return
+	}
+
+	report.Desired = status.Desired
+	report.MaxSurgeObserved = max(report.MaxSurgeObserved, status.Current-status.Desired)
+	report.MaxUnavailableObserved = max(report.MaxUnavailableObserved, status.Desired-status.Available)
+	for _, rs := range replicaSets {
+		ref := metav1.GetControllerOf(rs)
+		if ref != nil && ref.UID == dep.UID && rs.Annotations[revisionAnnotation] == report.Revision {
+			report.ReplicaSet = rs.Name
+			// The ReplicaSet's creation is when the Deployment controller
+			// began the rollout.
+			if created := rs.CreationTimestamp.Time; !created.IsZero() && created.Before(report.Started) {
+				report.Started = created
+			}
+			d.rolloutPods(w, report, rs.UID)
+		}
+	}
+	report.State = status.State
+	if status.State == RolloutComplete || status.State == RolloutFailed {
+		report.finish(status.State, now)
+	}
+}
+
+// start begins the report of a rollout to the Deployment's revision.
+func (r *deploymentRollouts) start(dep *appsv1.Deployment, previous string, now time.Time) *RolloutReport {
+	report := &RolloutReport{
+		Namespace:        dep.Namespace,
+		Deployment:       dep.Name,
+		Revision:         dep.Annotations[revisionAnnotation],
+		PreviousRevision: previous,
+		Strategy:         string(dep.Spec.Strategy.Type),
+		State:            RolloutProgressing,
+		Started:          now,
+		Pods:             []PodRollout{},
+	}
+	if report.Strategy == "" {
+		report.Strategy = string(appsv1.RollingUpdateDeploymentStrategyType)
+	}
+	if ru := dep.Spec.Strategy.RollingUpdate; ru != nil {
+		if ru.MaxSurge != nil {
+			report.MaxSurge = ru.MaxSurge.String()
+		}
+		if ru.MaxUnavailable != nil {
+			report.MaxUnavailable = ru.MaxUnavailable.String()
+		}
+	}
+	slog.Info("Rollout started", "namespace", dep.Namespace, "deployment", dep.Name, "revision", report.Revision, "previousRevision", previous)
+	r.reports = append(r.reports, report)
+	if len(r.reports) > maxRolloutReports {
+		r.reports = r.reports[len(r.reports)-maxRolloutReports:]
+	}
+	return report
+}
+
+// current returns the report of the rollout in progress, if any.
+func (r *deploymentRollouts) current() *RolloutReport {
+	if len(r.reports) == 0 {
+		return nil
+	}
+	if report := r.reports[len(r.reports)-1]; report.Finished == nil {
+		return report
+	}
+	return nil
+}
+
+// finish ends a rollout in a final state.
+func (r *RolloutReport) finish(state string, now time.Time) {
+	r.State = state
+	r.Finished = &now
+	r.DurationSeconds = now.Sub(r.Started).Seconds()
+	slog.Info("Rollout finished", "namespace", r.Namespace, "deployment", r.Deployment, "revision", r.Revision,
+		"state", state, "duration", now.Sub(r.Started).Round(time.Second),
+		"maxSurge", r.MaxSurgeObserved, "maxUnavailable", r.MaxUnavailableObserved)
+}
+
+// rolloutPods adds the monitored pods of the rollout's ReplicaSet to its
+// report and records when they became ready. Pods deleted meanwhile stay in
+// the report.
+func (d *Dashboard) rolloutPods(w *podWatch, report *RolloutReport, replicaSet types.UID) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, p := range d.pods {
+		if p.Namespace != report.Namespace || p.Owner == nil || p.Owner.UID != replicaSet {
+			continue
+		}
+		i := sort.Search(len(report.Pods), func(i int) bool { return report.Pods[i].Name >= p.Name })
+		if i == len(report.Pods) || report.Pods[i].Name != p.Name {
+			pod, err := w.get(p.Namespace, p.Name)
+			if err != nil {
+				continue
+			}
+			report.Pods = append(report.Pods, PodRollout{})
+			copy(report.Pods[i+1:], report.Pods[i:])
+			report.Pods[i] = PodRollout{Name: p.Name, Created: pod.CreationTimestamp.Time}
+		}
+		pod := &report.Pods[i]
+		if k := p.Kubelet; pod.Ready == nil && k != nil && k.PodReady && !k.PodReadySince.IsZero() {
+			ready := k.PodReadySince
+			pod.Ready = &ready
+			pod.ReadySeconds = ready.Sub(pod.Created).Seconds()
+		}
+	}
+}
+
+// ownsPods reports whether uid is the workload of a monitored pod.
+func (d *Dashboard) ownsPods(uid types.UID) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, p := range d.pods {
+		if p.Workload != nil && p.Workload.UID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *rolloutTracker) forget(uid types.UID) {
+	t.mu.Lock()
+	delete(t.deployments, uid)
+	t.mu.Unlock()
+}
+
+// reports returns copies of the rollout reports of the Deployments named
+// name in namespace, or in every namespace if it is empty, newest first.
+func (t *rolloutTracker) reports(namespace, name string) []RolloutReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var out []RolloutReport
+	for _, rollouts := range t.deployments {
+		for _, r := range rollouts.reports {
+			if r.Deployment == name && (namespace == "" || r.Namespace == namespace) {
+				report := *r
+				report.Pods = append([]PodRollout(nil), r.Pods...)
+				if report.Finished == nil {
+					report.DurationSeconds = time.Since(report.Started).Seconds()
+				}
+				out = append(out, report)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Started.After(out[j].Started) })
+	return out
+}
+
+// handleRollouts serves GET /api/deployments/{name}/rollouts.
+func (d *Dashboard) handleRollouts(w http.ResponseWriter, r *http.Request) {
+	reports := d.rollouts.reports(r.URL.Query().Get("namespace"), r.PathValue("name"))
+	if reports == nil {
+		reports = []RolloutReport{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
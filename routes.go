@@ -0,0 +1,93 @@
+package main
+
+import "net/http"
+
+// routes returns the dashboard's router. The first dashboard serves every
+// cluster; per-cluster endpoints pick theirs with byCluster. The page and the
+// larger pod responses are compressed.
+func (d *Dashboard) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", compressed(d.handleIndex))
+	mux.Handle("GET /static/", staticHandler(d.cfg().TemplateDir))
+	mux.HandleFunc("/healthz", d.handleHealthz)
+	mux.HandleFunc("/readyz", d.handleReadyz)
+	mux.Handle("/metrics", d.metrics.handler())
+
+	// Pods
+	mux.HandleFunc("/api/pods", compressed(d.handleAPI))
+	mux.HandleFunc("GET /api/pods/{name}/history", compressed(d.byCluster((*Dashboard).handleHistory)))
+	mux.HandleFunc("GET /api/pods/{name}/events", d.byCluster((*Dashboard).handleKubeEvents))
+	mux.HandleFunc("GET /api/stats", d.byCluster((*Dashboard).handleStats))
+	mux.HandleFunc("GET /api/timeline", compressed(d.byCluster((*Dashboard).handleTimeline)))
+	mux.HandleFunc("GET /api/slo", d.byCluster((*Dashboard).handleSLO))
+	mux.HandleFunc("GET /api/compare", d.byCluster((*Dashboard).handleCompare))
+	mux.HandleFunc("GET /api/analytics/startup", d.byCluster((*Dashboard).handleStartupAnalytics))
+	mux.HandleFunc("GET /api/status", d.handleAPIStatus)
+	mux.HandleFunc("GET /api/nodes", d.byCluster((*Dashboard).handleNodes))
+	mux.HandleFunc("GET /api/zones", d.byCluster((*Dashboard).handleZones))
+	mux.HandleFunc("GET /api/deployments", d.byCluster((*Dashboard).handleDeployments))
+	mux.HandleFunc("GET /api/deployments/{name}/rollouts", d.byCluster((*Dashboard).handleRollouts))
+	mux.HandleFunc("GET /api/alerts", d.byCluster((*Dashboard).handleAlerts))
+	mux.HandleFunc("GET /api/report", compressed(d.byCluster((*Dashboard).handleReport)))
+	mux.HandleFunc("GET /api/export", d.byCluster((*Dashboard).handleExport))
+	mux.HandleFunc("GET /api/audit", d.requireAuth(d.byCluster((*Dashboard).handleAudit)))
+	mux.HandleFunc("/api/stream", d.handleStream)
+	mux.Handle("/ws", d.websocketHandler())
+
+	// Actions and changes
+	mux.HandleFunc("POST /api/pods/{name}/probes/{probe}/{action}", d.requireToken(d.byCluster((*Dashboard).handleProbeAction)))
+	mux.HandleFunc("POST /api/pods/{name}/delete", d.requireToken(d.requireMutations(d.byCluster((*Dashboard).handlePodDelete))))
+	mux.HandleFunc("POST /api/pods/{name}/evict", d.requireToken(d.requireMutations(d.byCluster((*Dashboard).handlePodEvict))))
+	mux.HandleFunc("POST /api/nodes/{name}/cordon", d.requireToken(d.requireMutations(d.byCluster((*Dashboard).handleNodeCordon))))
+	mux.HandleFunc("POST /api/nodes/{name}/uncordon", d.requireToken(d.requireMutations(d.byCluster((*Dashboard).handleNodeUncordon))))
+	mux.HandleFunc("POST /api/nodes/{name}/drain", d.requireToken(d.requireMutations(d.byCluster((*Dashboard).handleNodeDrain))))
+	mux.HandleFunc("POST /api/deployments/{name}/scale", d.requireToken(d.requireMutations(d.byCluster((*Dashboard).handleDeploymentScale))))
+	mux.HandleFunc("POST /api/actions/bulk", d.requireToken(d.byCluster((*Dashboard).handleBulkAction)))
+	mux.HandleFunc("GET /api/chaos", d.byCluster((*Dashboard).handleChaosList))
+	mux.HandleFunc("POST /api/chaos", d.requireToken(d.byCluster((*Dashboard).handleChaosCreate)))
+	mux.HandleFunc("GET /api/chaos/{id}", d.byCluster((*Dashboard).handleChaosGet))
+	mux.HandleFunc("PUT /api/chaos/{id}", d.requireToken(d.byCluster((*Dashboard).handleChaosUpdate)))
+	mux.HandleFunc("DELETE /api/chaos/{id}", d.requireToken(d.byCluster((*Dashboard).handleChaosDelete)))
+	mux.HandleFunc("GET /api/recordings", d.requireAuth(d.handleRecordings))
+	mux.HandleFunc("POST /api/recordings", d.requireToken(d.handleRecordingStart))
+	mux.HandleFunc("POST /api/recordings/stop", d.requireToken(d.handleRecordingStop))
+	mux.HandleFunc("GET /api/recordings/{name}", d.requireAuth(d.handleRecordingGet))
+
+	// Schemas and query APIs
+	mux.HandleFunc("GET /api/schema", handleSchema)
+	mux.HandleFunc("GET /api/openapi.json", handleOpenAPI)
+	mux.HandleFunc("GET /api/graphql", d.handleGraphQL)
+	mux.HandleFunc("POST /api/graphql", d.handleGraphQL)
+	mux.HandleFunc("GET /grafana/{$}", d.byCluster((*Dashboard).handleGrafanaTest))
+	mux.HandleFunc("POST /grafana/search", d.byCluster((*Dashboard).handleGrafanaSearch))
+	mux.HandleFunc("POST /grafana/query", d.byCluster((*Dashboard).handleGrafanaQuery))
+	mux.HandleFunc("POST /grafana/annotations", d.byCluster((*Dashboard).handleGrafanaAnnotations))
+
+	if d.oidc != nil {
+		mux.HandleFunc("GET /auth/login", d.handleLogin)
+		mux.HandleFunc("GET /auth/callback", d.handleLoginCallback)
+		mux.HandleFunc("GET /auth/logout", d.handleLogout)
+	}
+	return mux
+}
+
+// handler returns the router wrapped in the middleware: tracing, request
+// logging and metrics, login, then rate limiting.
+func (d *Dashboard) handler() http.Handler {
+	mux := d.routes()
+	return traceRequests(mux, d.observeRequests(mux, d.requireLogin(d.rateLimit(mux))))
+}
+
+// newServer returns a server for handler on addr with the configured
+// timeouts and header limit. Streams and WebSockets lift the write timeout
+// for themselves.
+func newServer(cfg Config, addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:           addr,
+		Handler:        handler,
+		ReadTimeout:    cfg.ReadTimeout,
+		WriteTimeout:   cfg.WriteTimeout,
+		IdleTimeout:    cfg.IdleTimeout,
+		MaxHeaderBytes: cfg.MaxHeaderBytes,
+	}
+}
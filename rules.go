@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Alert rule conditions.
+const (
+	RuleUnready           = "unready"
+	RuleNotLive           = "not-live"
+	RuleNotStarted        = "not-started"
+	RuleUnreachable       = "unreachable"
+	RuleRestarted         = "restarted"
+	RuleFlapping          = "flapping"
+	RuleReplicaSetUnready = "replicaset-unready"
+)
+
+// ruleEvalInterval is how often the alert rules are evaluated.
+const ruleEvalInterval = 5 * time.Second
+
+// defaultRestartWindow is how long a restarted alert fires after the last
+// restart when its rule sets no For.
+const defaultRestartWindow = 5 * time.Minute
+
+// AlertRule is a condition on pods that fires an alert once it held for For.
+// For restarted, which fires as soon as a pod's restart count increases, For
+// is instead how long the pod must go without restarts before the alert
+// resolves. Threshold is the percentage of a ReplicaSet's pods that must be
+// unready for replicaset-unready.
+type AlertRule struct {
+	Name      string   `json:"name"`
+	Condition string   `json:"condition"`
+	For       duration `json:"for"`
+	Threshold float64  `json:"threshold"`
+	Severity  string   `json:"severity"`
+}
+
+// validateAlertRules checks the alert rules.
+func (c Config) validateAlertRules() error {
+	names := make(map[string]bool)
+	for _, rule := range c.AlertRules {
+		if rule.Name == "" || names[rule.Name] {
+			return fmt.Errorf("alert rule names must be non-empty and unique, got %q", rule.Name)
+		}
+		names[rule.Name] = true
+		switch rule.Condition {
+		case RuleUnready, RuleNotLive, RuleNotStarted, RuleUnreachable, RuleRestarted, RuleFlapping, RuleReplicaSetUnready:
+		default:
+			return fmt.Errorf("invalid condition %q of alert rule %s: must be %s, %s, %s, %s, %s, %s or %s", rule.Condition, rule.Name,
+				RuleUnready, RuleNotLive, RuleNotStarted, RuleUnreachable, RuleRestarted, RuleFlapping, RuleReplicaSetUnready)
+		}
+		if rule.For < 0 {
+			return fmt.Errorf("for of alert rule %s must not be negative", rule.Name)
+		}
+		if rule.Threshold < 0 || rule.Threshold >= 100 {
+			return fmt.Errorf("threshold of alert rule %s must be a percentage from 0 to 100, got %v", rule.Name, rule.Threshold)
+		}
+	}
+	return nil
+}
+
+// Alert is a rule firing for a pod or, for replicaset-unready, a ReplicaSet.
+type Alert struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity,omitempty"`
+	// Cluster is set when monitoring several clusters.
+	Cluster   string `json:"cluster,omitempty"`
+	Namespace string `json:"namespace"`
+	// Subject is the name of the pod or ReplicaSet.
+	Subject     string `json:"subject"`
+	Description string `json:"description"`
+	// Since is when the condition was first seen, FiredAt when it had held
+	// long enough to fire.
+	Since   time.Time `json:"since"`
+	FiredAt time.Time `json:"firedAt"`
+}
+
+func (a Alert) notification(resolved bool, now time.Time) Notification {
+	kind, state, text := "alert", "FIRING", a.Description
+	if resolved {
+		kind, state = "alert-resolved", "RESOLVED"
+		text = fmt.Sprintf("Resolved after %s: %s", now.Sub(a.FiredAt).Round(time.Second), a.Description)
+	}
+	fields := map[string]string{
+		"rule":      a.Rule,
+		"status":    state,
+		"namespace": a.Namespace,
+		"subject":   a.Subject,
+	}
+	if a.Severity != "" {
+		fields["severity"] = a.Severity
+	}
+	key := "alert/" + a.Rule + "/" + a.Namespace + "/" + a.Subject
+	if a.Cluster != "" {
+		fields["cluster"] = a.Cluster
+		key = "alert/" + a.Rule + "/" + a.Cluster + "/" + a.Namespace + "/" + a.Subject
+	}
+	return Notification{
+		Kind:     kind,
+		Title:    fmt.Sprintf("[%s] %s: %s", state, a.Rule, a.Subject),
+		Text:     text,
+		Fields:   fields,
+		Time:     now,
+		Key:      key,
+		Resolved: resolved,
+	}
+}
+
+// ruleMatch is a subject for which a rule's condition holds.
+type ruleMatch struct {
+	namespace   string
+	subject     string
+	description string
+	// since overrides when the condition began, if known.
+	since time.Time
+}
+
+// ruleState is a rule's condition holding for a subject; it fires once it
+// held for the rule's For.
+type ruleState struct {
+	Alert
+	firing bool
+}
+
+type restartSeen struct {
+	uid   types.UID
+	count int32
+	at    time.Time
+}
+
+// ruleEngine evaluates the alert rules against a dashboard's pods and
+// tracks which alerts are pending and firing.
+type ruleEngine struct {
+	mu     sync.Mutex
+	states map[string]*ruleState
+	// restarts are the last restart count of each pod by pod key and when it
+	// was seen to increase.
+	restarts map[string]restartSeen
+}
+
+func newRuleEngine() *ruleEngine {
+	return &ruleEngine{states: make(map[string]*ruleState), restarts: make(map[string]restartSeen)}
+}
+
+// evaluate checks rules against pods and returns the alerts that fired and
+// those that resolved. Alerts of rules no longer configured resolve too.
+func (e *ruleEngine) evaluate(rules []AlertRule, pods []*PodStatusInfo, now time.Time) (fired, resolved []Alert) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.observeRestarts(pods, now)
+
+	seen := make(map[string]bool)
+	for _, rule := range rules {
+		for _, m := range e.matches(rule, pods, now) {
+			key := rule.Name + "\x00" + m.namespace + "/" + m.subject
+			seen[key] = true
+			s := e.states[key]
+			if s == nil {
+				since := now
+				if !m.since.IsZero() {
+					since = m.since
+				}
+				s = &ruleState{Alert: Alert{Rule: rule.Name, Cluster: clusterOf(pods), Namespace: m.namespace, Subject: m.subject, Since: since}}
+				e.states[key] = s
+			}
+			s.Severity, s.Description = rule.Severity, m.description
+			held := rule.Condition == RuleRestarted || now.Sub(s.Since) >= time.Duration(rule.For)
+			if !s.firing && held {
+				s.firing, s.FiredAt = true, now
+				fired = append(fired, s.Alert)
+			}
+		}
+	}
+	for key, s := range e.states {
+		if !seen[key] {
+			if s.firing {
+				resolved = append(resolved, s.Alert)
+			}
+			delete(e.states, key)
+		}
+	}
+	return fired, resolved
+}
+
+// observeRestarts notes the pods whose restart count increased. A pod
+// replaced by one of the same name starts over from the new pod's count. The
+// caller holds e.mu.
+func (e *ruleEngine) observeRestarts(pods []*PodStatusInfo, now time.Time) {
+	current := make(map[string]bool, len(pods))
+	for _, pod := range pods {
+		key := podKey(pod.Namespace, pod.Name)
+		current[key] = true
+		if pod.Kubelet == nil {
+			continue
+		}
+		prev, ok := e.restarts[key]
+		switch {
+		case !ok || prev.uid != pod.UID:
+			e.restarts[key] = restartSeen{uid: pod.UID, count: pod.Kubelet.RestartCount}
+		case pod.Kubelet.RestartCount > prev.count:
+			e.restarts[key] = restartSeen{uid: pod.UID, count: pod.Kubelet.RestartCount, at: now}
+		}
+	}
+	for key := range e.restarts {
+		if !current[key] {
+			delete(e.restarts, key)
+		}
+	}
+}
+
+// matches returns the subjects for which rule's condition holds. The caller
+// holds e.mu.
+func (e *ruleEngine) matches(rule AlertRule, pods []*PodStatusInfo, now time.Time) []ruleMatch {
+	var out []ruleMatch
+	if rule.Condition == RuleReplicaSetUnready {
+		type replicaSet struct{ namespace, name string }
+		total, unready := make(map[replicaSet]int), make(map[replicaSet]int)
+		for _, pod := range pods {
+			if pod.Owner == nil || pod.Owner.Kind != "ReplicaSet" {
+				continue
+			}
+			rs := replicaSet{pod.Namespace, pod.Owner.Name}
+			total[rs]++
+			if pod.Info == nil || !pod.Info.ProbeStatus.Ready {
+				unready[rs]++
+			}
+		}
+		for rs, n := range total {
+			if pct := 100 * float64(unready[rs]) / float64(n); pct > rule.Threshold {
+				out = append(out, ruleMatch{
+					namespace:   rs.namespace,
+					subject:     rs.name,
+					description: fmt.Sprintf("%d of %d pods of ReplicaSet %s are unready (%.0f%%)", unready[rs], n, rs.name, pct),
+				})
+			}
+		}
+		return out
+	}
+
+	for _, pod := range pods {
+		m := ruleMatch{namespace: pod.Namespace, subject: pod.Name}
+		var what string
+		switch probes := pod.Info; rule.Condition {
+		case RuleUnready:
+			if probes != nil && !probes.ProbeStatus.Ready {
+				what = "is unready"
+			}
+		case RuleNotLive:
+			if probes != nil && !probes.ProbeStatus.Live {
+				what = "is not live"
+			}
+		case RuleNotStarted:
+			if probes != nil && !probes.ProbeStatus.Started {
+				what = "is not started"
+			}
+		case RuleUnreachable:
+			if probes == nil && pod.ErrorKind == ErrorKindConnection {
+				what = "is unreachable"
+			}
+		case RuleRestarted:
+			window := time.Duration(rule.For)
+			if window == 0 {
+				window = defaultRestartWindow
+			}
+			if seen := e.restarts[podKey(pod.Namespace, pod.Name)]; seen.uid == pod.UID && !seen.at.IsZero() && now.Sub(seen.at) < window {
+				what = fmt.Sprintf("restarted (%d restarts in total)", seen.count)
+				m.since = seen.at
+			}
+		case RuleFlapping:
+			if f := pod.Flap; f != nil && f.Flapping {
+				what = fmt.Sprintf("is flapping (%d readiness transitions in %s)", f.Transitions, time.Duration(f.WindowSeconds*float64(time.Second)))
+				m.since = *f.Since
+			}
+		}
+		if what != "" {
+			m.description = fmt.Sprintf("%s on %s %s", pod.Name, pod.Node, what)
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// firing returns the firing alerts, oldest first.
+func (e *ruleEngine) firing() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	alerts := []Alert{}
+	for _, s := range e.states {
+		if s.firing {
+			alerts = append(alerts, s.Alert)
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		if !alerts[i].FiredAt.Equal(alerts[j].FiredAt) {
+			return alerts[i].FiredAt.Before(alerts[j].FiredAt)
+		}
+		return alerts[i].Rule+alerts[i].Subject < alerts[j].Rule+alerts[j].Subject
+	})
+	return alerts
+}
+
+func clusterOf(pods []*PodStatusInfo) string {
+	if len(pods) == 0 {
+		return ""
+	}
+	return pods[0].Cluster
+}
+
+// runAlertRules evaluates the alert rules every few seconds and sends
+// firing and resolve notifications until ctx is done.
+func (d *Dashboard) runAlertRules(ctx context.Context) {
+	ticker := time.NewTicker(ruleEvalInterval)
+	defer ticker.Stop()
+	warned := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			cfg := d.cfg()
+			notifiers := d.notifiers()
+			if len(cfg.AlertRules) > 0 && len(notifiers) == 0 && !warned {
+				slog.Warn("Alert rules configured but no notifiers; alerts will not be delivered")
+				warned = true
+			}
+
+			d.mu.RLock()
+			pods := make([]*PodStatusInfo, 0, len(d.pods))
+			for _, pod := range d.pods {
+				pods = append(pods, pod)
+			}
+			d.mu.RUnlock()
+
+			fired, resolved := d.rules.evaluate(cfg.AlertRules, pods, now)
+			for _, a := range fired {
+				slog.Info("Alert firing", "rule", a.Rule, "subject", a.Subject, "description", a.Description)
+				d.sendNotification(notifiers, a.notification(false, now))
+			}
+			for _, a := range resolved {
+				slog.Info("Alert resolved", "rule", a.Rule, "subject", a.Subject)
+				d.sendNotification(notifiers, a.notification(true, now))
+			}
+		}
+	}
+}
+
+// sendNotification delivers n in the background, so slow sinks don't hold
+// up scraping or rule evaluation.
+func (d *Dashboard) sendNotification(notifiers []Notifier, n Notification) {
+	if len(notifiers) == 0 {
+		return
+	}
+	d.inflight.Add(1)
+	go func() {
+		defer d.inflight.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		notifyAll(ctx, notifiers, n)
+	}()
+}
+
+// handleAlerts serves the firing alerts.
+func (d *Dashboard) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d.rules.firing())
+}
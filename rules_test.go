@@ -0,0 +1,66 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestRestartedRule(t *testing.T) {
+	pod := func(namespace string, uid types.UID, restarts int32) *PodStatusInfo {
+		return &PodStatusInfo{Name: "web-0", Namespace: namespace, UID: uid, Kubelet: &KubeletStatus{RestartCount: restarts}}
+	}
+	rules := []AlertRule{{Name: "restarts", Condition: RuleRestarted}}
+	tests := []struct {
+		name  string
+		scans [][]*PodStatusInfo
+		// want is the namespaces of the pods alerting after the last scan.
+		want []string
+	}{
+		{
+			name:  "restart",
+			scans: [][]*PodStatusInfo{{pod("default", "a", 1)}, {pod("default", "a", 2)}},
+			want:  []string{"default"},
+		},
+		{
+			name:  "no restart",
+			scans: [][]*PodStatusInfo{{pod("default", "a", 3)}, {pod("default", "a", 3)}},
+		},
+		{
+			name: "same name in another namespace",
+			scans: [][]*PodStatusInfo{
+				{pod("default", "a", 5), pod("other", "b", 0)},
+				{pod("default", "a", 5), pod("other", "b", 1)},
+			},
+			want: []string{"other"},
+		},
+		{
+			name:  "replaced pod",
+			scans: [][]*PodStatusInfo{{pod("default", "a", 5)}, {pod("default", "b", 0)}, {pod("default", "b", 1)}},
+			want:  []string{"default"},
+		},
+		{
+			name:  "replacement starting with restarts",
+			scans: [][]*PodStatusInfo{{pod("default", "a", 0)}, {pod("default", "b", 2)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newRuleEngine()
+			now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+			for _, pods := range tt.scans {
+				now = now.Add(time.Minute)
+				e.evaluate(rules, pods, now)
+			}
+			var got []string
+			for _, a := range e.firing() {
+				got = append(got, a.Namespace)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("alerting in %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SchedulingInfo is how the pod was scheduled, to tell a slow start caused by
+// waiting for a node apart from a slow container.
+type SchedulingInfo struct {
+	QOSClass          string    `json:"qosClass,omitempty"`
+	PriorityClassName string    `json:"priorityClassName,omitempty"`
+	Priority          *int32    `json:"priority,omitempty"`
+	Created           time.Time `json:"created"`
+	// Scheduled is when the pod was bound to a node, and SchedulingSeconds
+	// how long that took after its creation. Both are unset while the pod
+	// is pending.
+	Scheduled         *time.Time `json:"scheduled,omitempty"`
+	SchedulingSeconds *float64   `json:"schedulingSeconds,omitempty"`
+	// Unschedulable is why the scheduler couldn't place the pod yet.
+	Unschedulable string `json:"unschedulable,omitempty"`
+	// NominatedNode is the node a preempting pod waits for victims to leave.
+	NominatedNode string `json:"nominatedNode,omitempty"`
+}
+
+// schedulingInfo reads the pod's QoS class, priority and scheduling times.
+func schedulingInfo(pod *corev1.Pod) *SchedulingInfo {
+	info := &SchedulingInfo{
+		QOSClass:          string(pod.Status.QOSClass),
+		PriorityClassName: pod.Spec.PriorityClassName,
+		Priority:          pod.Spec.Priority,
+		Created:           pod.CreationTimestamp.Time,
+		NominatedNode:     pod.Status.NominatedNodeName,
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type != corev1.PodScheduled {
+			continue
+		}
+		switch cond.Status {
+		case corev1.ConditionTrue:
+			scheduled := cond.LastTransitionTime.Time
+			took := scheduled.Sub(info.Created).Seconds()
+			info.Scheduled, info.SchedulingSeconds = &scheduled, &took
+		case corev1.ConditionFalse:
+			info.Unschedulable = cond.Reason
+			if cond.Message != "" {
+				info.Unschedulable += ": " + cond.Message
+			}
+		}
+	}
+	return info
+}
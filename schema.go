@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pascal71/k8s-probe-monitor/pkg/api"
+)
+
+// Error categories recorded in PodStatusInfo.ErrorKind.
+const (
+	ErrorKindConnection = "connection"
+	ErrorKindHTTP       = "http"
+	ErrorKindSchema     = "schema"
+	// ErrorKindGRPC is a gRPC health check that reached the pod but failed,
+	// for example because the health service isn't registered.
+	ErrorKindGRPC = "grpc"
+	// ErrorKindAnnotation is a pod whose probe-monitor annotations are
+	// invalid, so it isn't scraped at all.
+	ErrorKindAnnotation = "annotation"
+)
+
+// Schema validation modes for target responses.
+const (
+	SchemaStrict  = "strict"
+	SchemaLenient = "lenient"
+)
+
+// FieldError describes a single field of the /api/info response that did not
+// match the expected contract.
+type FieldError struct {
+	Field   string `json:"field"`
+	Problem string `json:"problem"`
+}
+
+// SchemaError is returned when a target's /api/info response is valid JSON but
+// does not follow the PodInfo contract.
+type SchemaError struct {
+	Fields []FieldError
+}
+
+func (e *SchemaError) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		parts[i] = f.Field + ": " + f.Problem
+	}
+	return "invalid response schema: " + strings.Join(parts, "; ")
+}
+
+// fetchError tags an error from getPodInfo with its category.
+type fetchError struct {
+	kind string
+	err  error
+}
+
+func (e *fetchError) Error() string { return e.err.Error() }
+func (e *fetchError) Unwrap() error { return e.err }
+
+// errorKind returns the category of an error returned by getPodInfo.
+func errorKind(err error) string {
+	switch e := err.(type) {
+	case *SchemaError:
+		return ErrorKindSchema
+	case *fetchError:
+		return e.kind
+	}
+	return ErrorKindConnection
+}
+
+// decodePodInfo parses an /api/info response and validates every field against
+// the PodInfo contract. In strict mode any problem discards the response; in
+// lenient mode the fields that did decode are kept and returned alongside the
+// SchemaError.
+func decodePodInfo(body []byte, mode string) (*PodInfo, error) {
+	if !json.Valid(body) {
+		return nil, &SchemaError{Fields: []FieldError{{Field: "(body)", Problem: "invalid JSON"}}}
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil || raw == nil {
+		return nil, &SchemaError{Fields: []FieldError{{Field: "(body)", Problem: "expected object, got " + jsonType(body)}}}
+	}
+
+	var info PodInfo
+	var problems []FieldError
+
+	decodeFields(raw, "", []schemaField{
+		{"podName", "string", &info.PodName},
+		{"podIP", "string", &info.PodIP},
+		{"nodeHostname", "string", &info.NodeHostname},
+		{"containerAge", "integer", &info.ContainerAge},
+		{"startTime", "string", &info.StartTime},
+		{"startupDelay", "integer", &info.StartupDelay},
+		{"startupReady", "string", &info.StartupReady},
+	}, &problems)
+
+	// The version is optional; targets that predate it implement v1.
+	if version, ok := raw["schemaVersion"]; ok {
+		if err := json.Unmarshal(version, &info.SchemaVersion); err != nil {
+			problems = append(problems, FieldError{Field: "schemaVersion", Problem: "expected string, got " + jsonType(version)})
+		} else if !api.SupportedVersion(info.SchemaVersion) {
+			problems = append(problems, FieldError{Field: "schemaVersion", Problem: fmt.Sprintf("unsupported version %q, expected %s", info.SchemaVersion, api.SchemaVersion)})
+		}
+	}
+
+	if status, ok := raw["probeStatus"]; !ok {
+		problems = append(problems, FieldError{Field: "probeStatus", Problem: "missing"})
+	} else {
+		var nested map[string]json.RawMessage
+		if err := json.Unmarshal(status, &nested); err != nil || nested == nil {
+			problems = append(problems, FieldError{Field: "probeStatus", Problem: "expected object, got " + jsonType(status)})
+		} else {
+			decodeFields(nested, "probeStatus.", []schemaField{
+				{"started", "boolean", &info.ProbeStatus.Started},
+				{"live", "boolean", &info.ProbeStatus.Live},
+				{"ready", "boolean", &info.ProbeStatus.Ready},
+			}, &problems)
+		}
+	}
+
+	if len(problems) == 0 {
+		return &info, nil
+	}
+	if mode == SchemaLenient {
+		return &info, &SchemaError{Fields: problems}
+	}
+	return nil, &SchemaError{Fields: problems}
+}
+
+type schemaField struct {
+	name string
+	kind string
+	dst  any
+}
+
+func decodeFields(raw map[string]json.RawMessage, prefix string, fields []schemaField, problems *[]FieldError) {
+	for _, f := range fields {
+		value, ok := raw[f.name]
+		if !ok {
+			*problems = append(*problems, FieldError{Field: prefix + f.name, Problem: "missing"})
+			continue
+		}
+		if err := json.Unmarshal(value, f.dst); err != nil || jsonType(value) == "null" {
+			*problems = append(*problems, FieldError{
+				Field:   prefix + f.name,
+				Problem: fmt.Sprintf("expected %s, got %s", f.kind, jsonType(value)),
+			})
+		}
+	}
+}
+
+// jsonType names the JSON type of a raw value for error messages.
+func jsonType(value json.RawMessage) string {
+	v := strings.TrimSpace(string(value))
+	if v == "" {
+		return "nothing"
+	}
+	switch v[0] {
+	case '"':
+		return "string"
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case 't', 'f':
+		return "boolean"
+	case 'n':
+		return "null"
+	}
+	if strings.ContainsAny(v, ".eE") {
+		return "number"
+	}
+	return "integer"
+}
+
+// handleSchema serves the JSON schema of the /api/info contract so target
+// applications can validate their responses.
+func handleSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(api.Schema)
+}
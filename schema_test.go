@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDecodePodInfo(t *testing.T) {
+	valid := map[string]any{
+		"schemaVersion": "v1",
+		"podName":       "web-1",
+		"podIP":         "10.0.0.1",
+		"nodeHostname":  "node-a",
+		"containerAge":  42,
+		"startTime":     "2025-01-01T12:00:00Z",
+		"startupDelay":  5,
+		"startupReady":  "2025-01-01T12:00:05Z",
+		"probeStatus":   map[string]any{"started": true, "live": true, "ready": false},
+	}
+	body := func(change func(map[string]any)) string {
+		m := make(map[string]any, len(valid))
+		for k, v := range valid {
+			m[k] = v
+		}
+		if change != nil {
+			change(m)
+		}
+		b, _ := json.Marshal(m)
+		return string(b)
+	}
+	tests := []struct {
+		name       string
+		body       string
+		mode       string
+		wantFields []FieldError
+		// wantInfo is whether a PodInfo is returned.
+		wantInfo bool
+	}{
+		{name: "valid", body: body(nil), mode: SchemaStrict, wantInfo: true},
+		{name: "version omitted", body: body(func(m map[string]any) { delete(m, "schemaVersion") }), mode: SchemaStrict, wantInfo: true},
+		{
+			name: "unsupported version", body: body(func(m map[string]any) { m["schemaVersion"] = "v2" }), mode: SchemaStrict,
+			wantFields: []FieldError{{Field: "schemaVersion", Problem: `unsupported version "v2", expected v1`}},
+		},
+		{
+			name: "missing field", body: body(func(m map[string]any) { delete(m, "podIP") }), mode: SchemaStrict,
+			wantFields: []FieldError{{Field: "podIP", Problem: "missing"}},
+		},
+		{
+			name: "missing field lenient", body: body(func(m map[string]any) { delete(m, "podIP") }), mode: SchemaLenient,
+			wantFields: []FieldError{{Field: "podIP", Problem: "missing"}}, wantInfo: true,
+		},
+		{
+			name: "wrong types", body: body(func(m map[string]any) { m["containerAge"] = "old"; m["podName"] = nil }), mode: SchemaStrict,
+			wantFields: []FieldError{
+				{Field: "podName", Problem: "expected string, got null"},
+				{Field: "containerAge", Problem: "expected integer, got string"},
+			},
+		},
+		{
+			name: "float for an integer", body: body(func(m map[string]any) { m["startupDelay"] = 1.5 }), mode: SchemaStrict,
+			wantFields: []FieldError{{Field: "startupDelay", Problem: "expected integer, got number"}},
+		},
+		{
+			name: "nested field", body: body(func(m map[string]any) { m["probeStatus"] = map[string]any{"started": true, "live": "yes"} }), mode: SchemaStrict,
+			wantFields: []FieldError{
+				{Field: "probeStatus.live", Problem: "expected boolean, got string"},
+				{Field: "probeStatus.ready", Problem: "missing"},
+			},
+		},
+		{
+			name: "probe status not an object", body: body(func(m map[string]any) { m["probeStatus"] = []bool{true} }), mode: SchemaLenient,
+			wantFields: []FieldError{{Field: "probeStatus", Problem: "expected object, got array"}}, wantInfo: true,
+		},
+		{
+			name: "invalid JSON", body: `{"podName":`, mode: SchemaLenient,
+			wantFields: []FieldError{{Field: "(body)", Problem: "invalid JSON"}},
+		},
+		{
+			name: "not an object", body: `[1, 2]`, mode: SchemaLenient,
+			wantFields: []FieldError{{Field: "(body)", Problem: "expected object, got array"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := decodePodInfo([]byte(tt.body), tt.mode)
+			if (info != nil) != tt.wantInfo {
+				t.Errorf("decodePodInfo() info = %+v, want info %v", info, tt.wantInfo)
+			}
+			var fields []FieldError
+			if err != nil {
+				schemaErr, ok := err.(*SchemaError)
+				if !ok {
+					t.Fatalf("decodePodInfo() error = %v, want a SchemaError", err)
+				}
+				fields = schemaErr.Fields
+				if errorKind(err) != ErrorKindSchema {
+					t.Errorf("errorKind() = %q, want %q", errorKind(err), ErrorKindSchema)
+				}
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("decodePodInfo() problems = %+v, want %+v", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestDecodePodInfoValues(t *testing.T) {
+	body := `{"podName":"web-1","podIP":"10.0.0.1","nodeHostname":"node-a","containerAge":42,
+		"startTime":"t0","startupDelay":5,"startupReady":"t1","probeStatus":{"started":true,"live":true,"ready":false}}`
+	info, err := decodePodInfo([]byte(body), SchemaStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.PodName != "web-1" || info.ContainerAge != 42 || !info.ProbeStatus.Started || info.ProbeStatus.Ready {
+		t.Errorf("decodePodInfo() = %+v", info)
+	}
+}
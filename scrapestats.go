@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// scrapeWindow is the number of recent scrapes per pod the rolling scrape
+// statistics are computed over.
+const scrapeWindow = 100
+
+// ScrapeStats summarizes a pod's recent scrapes: the round-trip time of the
+// info requests that got a response, and the share of scrapes that reached
+// the pod at all. They show network trouble to a pod or node regardless of
+// its probe state.
+type ScrapeStats struct {
+	LatencyStats
+	LastSeconds  float64 `json:"lastSeconds"`
+	Scrapes      int     `json:"scrapes"`
+	Reachability float64 `json:"reachability"`
+}
+
+type scrapeSample struct {
+	took      time.Duration
+	reachable bool
+}
+
+// scrapeTracker keeps a rolling window of scrape samples per pod.
+type scrapeTracker struct {
+	mu   sync.Mutex
+	pods map[string][]scrapeSample
+}
+
+func newScrapeTracker() *scrapeTracker {
+	return &scrapeTracker{pods: make(map[string][]scrapeSample)}
+}
+
+// observe records a scrape and returns the pod's updated statistics.
+func (t *scrapeTracker) observe(pod string, took time.Duration, reachable bool) *ScrapeStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	samples := append(t.pods[pod], scrapeSample{took, reachable})
+	if len(samples) > scrapeWindow {
+		samples = samples[len(samples)-scrapeWindow:]
+	}
+	t.pods[pod] = samples
+
+	var latencies []time.Duration
+	for _, s := range samples {
+		if s.reachable {
+			latencies = append(latencies, s.took)
+		}
+	}
+	return &ScrapeStats{
+		LatencyStats: latencyStats(latencies),
+		LastSeconds:  took.Seconds(),
+		Scrapes:      len(samples),
+		Reachability: float64(len(latencies)) / float64(len(samples)),
+	}
+}
+
+// latencies returns the latencies of the recent scrapes of pods that got a
+// response.
+func (t *scrapeTracker) latencies(pods []string) []time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var out []time.Duration
+	for _, pod := range pods {
+		for _, s := range t.pods[pod] {
+			if s.reachable {
+				out = append(out, s.took)
+			}
+		}
+	}
+	return out
+}
+
+func (t *scrapeTracker) forget(pod string) {
+	t.mu.Lock()
+	delete(t.pods, pod)
+	t.mu.Unlock()
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// tlsVersions are the accepted minimum TLS versions of the dashboard server.
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// serveTLS reports whether the dashboard is served over HTTPS.
+func (c Config) serveTLS() bool {
+	return c.TLSCertFile != "" || c.TLSSelfSigned
+}
+
+// cipherSuiteIDs looks up the named cipher suites among Go's secure ones.
+func cipherSuiteIDs(names []string) ([]uint16, error) {
+	var ids []uint16
+	for _, name := range names {
+		i := slices.IndexFunc(tls.CipherSuites(), func(s *tls.CipherSuite) bool { return s.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, tls.CipherSuites()[i].ID)
+	}
+	return ids, nil
+}
+
+// serverTLSConfig builds the TLS settings of the dashboard server. The
+// certificate is read again when its file changes, so renewals such as
+// cert-manager's apply without a restart.
+func serverTLSConfig(cfg Config) (*tls.Config, error) {
+	ciphers, err := cipherSuiteIDs(cfg.TLSCipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion: tlsVersions[cfg.TLSMinVersion],
+		// Go only lets TLS 1.2 and older choose the cipher suites.
+		CipherSuites: ciphers,
+	}
+	if cfg.TLSSelfSigned {
+		cert, err := selfSignedCertificate()
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+		return tlsConfig, nil
+	}
+
+	loader := &certLoader{certFile: cfg.TLSCertFile, keyFile: cfg.TLSKeyFile}
+	if _, err := loader.certificate(); err != nil {
+		return nil, err
+	}
+	tlsConfig.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return loader.certificate()
+	}
+	return tlsConfig, nil
+}
+
+// certLoader keeps the server certificate and reloads it when the
+// certificate file's modification time changes.
+type certLoader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func (l *certLoader) certificate() (*tls.Certificate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	info, err := os.Stat(l.certFile)
+	if err != nil {
+		if l.cert != nil {
+			return l.cert, nil
+		}
+		return nil, fmt.Errorf("failed to read server certificate: %v", err)
+	}
+	if l.cert != nil && info.ModTime().Equal(l.modTime) {
+		return l.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		if l.cert != nil {
+			// A renewal may be half written; keep serving the old
+			// certificate until both files match.
+			slog.Warn("Failed to reload server certificate", "error", err)
+			return l.cert, nil
+		}
+		return nil, fmt.Errorf("failed to load server certificate: %v", err)
+	}
+	if l.cert != nil {
+		slog.Info("Reloaded server certificate", "path", l.certFile)
+	}
+	l.cert, l.modTime = &cert, info.ModTime()
+	return l.cert, nil
+}
+
+// selfSignedCertificate generates a certificate for localhost and the host
+// name, valid for a year. Browsers warn about it; it only spares setting up
+// certificates for tests and internal use.
+func selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to generate key: %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to generate serial number: %v", err)
+	}
+	names := []string{"localhost"}
+	if host, err := os.Hostname(); err == nil && host != "localhost" {
+		names = append(names, host)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "k8s-probe-monitor"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     names,
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to create self-signed certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// httpsRedirect sends plain HTTP requests to the same URL on the HTTPS port.
+// Health checks are answered by next, since probes of the redirect port may
+// not follow redirects.
+func httpsRedirect(httpsPort string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// serverTLSSettingsChanged reports whether the server TLS settings differ,
+// which needs a restart to take effect.
+func serverTLSSettingsChanged(a, b Config) bool {
+	return a.TLSCertFile != b.TLSCertFile || a.TLSKeyFile != b.TLSKeyFile || a.TLSSelfSigned != b.TLSSelfSigned ||
+		a.TLSMinVersion != b.TLSMinVersion || !slices.Equal(a.TLSCipherSuites, b.TLSCipherSuites) ||
+		a.HTTPRedirectAddr != b.HTTPRedirectAddr
+}
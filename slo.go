@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// sloWindows are the windows uptime is computed over; the longest one is the
+// error budget period.
+var sloWindows = [...]struct {
+	name   string
+	length time.Duration
+}{
+	{"1h", time.Hour},
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+}
+
+// maxSLOGap caps the time credited after a stored snapshot. Snapshots are
+// written at least every snapshotInterval, so a longer gap means the pod or
+// the monitor was gone, which counts neither way.
+const maxSLOGap = 2 * snapshotInterval
+
+// sloCacheTTL is how long a computed SLO report is served; the snapshots it
+// is computed from change only about once a minute.
+const sloCacheTTL = 30 * time.Second
+
+// Burn states of an error budget.
+const (
+	BurnOK        = "ok"
+	BurnSlow      = "slow"
+	BurnFast      = "fast"
+	BurnExhausted = "exhausted"
+)
+
+// Burn rates over the shortest and the middle window that are a fast and a
+// slow burn: 14.4 spends a week's budget in about half a day, 3 in a little
+// over two days.
+const (
+	fastBurnRate = 14.4
+	slowBurnRate = 3
+)
+
+// SLOWindow is the readiness uptime over one window.
+type SLOWindow struct {
+	Window string `json:"window"`
+	// Uptime is the percentage of the observed time the pods were ready,
+	// or -1 without observations.
+	Uptime          float64 `json:"uptime"`
+	ObservedSeconds float64 `json:"observedSeconds"`
+	// BurnRate is how fast the error budget was spent in the window: 1
+	// spends exactly the budget over the budget period.
+	BurnRate float64 `json:"burnRate"`
+}
+
+// PodSLO is the readiness uptime of one pod.
+type PodSLO struct {
+	Namespace string      `json:"namespace"`
+	Name      string      `json:"name"`
+	Windows   []SLOWindow `json:"windows"`
+}
+
+// WorkloadSLO is the readiness uptime of a workload's pods together, and
+// how much of its error budget is left.
+type WorkloadSLO struct {
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Pods      int    `json:"pods"`
+	// Windows are the pods' pooled uptime: the share of pod time ready.
+	Windows []SLOWindow `json:"windows"`
+	// BudgetRemaining is the share of the error budget of the longest
+	// window not yet spent; negative once overspent.
+	BudgetRemaining float64 `json:"budgetRemaining"`
+	// Burn is ok, slow, fast or exhausted.
+	Burn string `json:"burn"`
+}
+
+// SLOResponse is the response of GET /api/slo.
+type SLOResponse struct {
+	// Target is the readiness objective in percent.
+	Target    float64       `json:"target"`
+	Computed  time.Time     `json:"computed"`
+	Workloads []WorkloadSLO `json:"workloads"`
+	Pods      []PodSLO      `json:"pods"`
+}
+
+// sloTotals accumulates observed and ready time per window.
+type sloTotals struct {
+	observed, ready [len(sloWindows)]time.Duration
+}
+
+func (t *sloTotals) add(from, to time.Time, ready bool, now time.Time) {
+	for i, w := range sloWindows {
+		start := now.Add(-w.length)
+		if to.Before(start) {
+			continue
+		}
+		span := to.Sub(from)
+		if from.Before(start) {
+			span = to.Sub(start)
+		}
+		t.observed[i] += span
+		if ready {
+			t.ready[i] += span
+		}
+	}
+}
+
+func (t *sloTotals) merge(o *sloTotals) {
+	for i := range sloWindows {
+		t.observed[i] += o.observed[i]
+		t.ready[i] += o.ready[i]
+	}
+}
+
+func (t *sloTotals) windows(target float64) []SLOWindow {
+	out := make([]SLOWindow, len(sloWindows))
+	for i, w := range sloWindows {
+		out[i] = SLOWindow{Window: w.name, Uptime: -1, ObservedSeconds: t.observed[i].Seconds()}
+		if t.observed[i] == 0 {
+			continue
+		}
+		out[i].Uptime = 100 * t.ready[i].Seconds() / t.observed[i].Seconds()
+		out[i].BurnRate = (100 - out[i].Uptime) / (100 - target)
+	}
+	return out
+}
+
+// burnState judges a workload's error budget from its windows and returns
+// the share of it left over the longest one.
+func burnState(windows []SLOWindow) (remaining float64, state string) {
+	longest := windows[len(windows)-1]
+	remaining = 1
+	if longest.Uptime >= 0 {
+		remaining = 1 - longest.BurnRate
+	}
+	switch {
+	case remaining <= 0:
+		return remaining, BurnExhausted
+	case windows[0].Uptime >= 0 && windows[0].BurnRate >= fastBurnRate:
+		return remaining, BurnFast
+	case windows[1].Uptime >= 0 && windows[1].BurnRate >= slowBurnRate:
+		return remaining, BurnSlow
+	}
+	return remaining, BurnOK
+}
+
+// sloCache holds the last computed SLO report.
+type sloCache struct {
+	mu     sync.Mutex
+	report *SLOResponse
+}
+
+// slo computes the readiness uptime of every pod and workload from the
+// snapshots in the store. Between two snapshots a pod counts as it was in the
+// first; a pod that failed to be scraped counts as not ready.
+func (d *Dashboard) slo(now time.Time) (*SLOResponse, error) {
+	target := d.cfg().SLOTarget
+	d.sloCache.mu.Lock()
+	defer d.sloCache.mu.Unlock()
+	if r := d.sloCache.report; r != nil && r.Target == target && now.Sub(r.Computed) < sloCacheTTL {
+		return r, nil
+	}
+
+	longest := sloWindows[len(sloWindows)-1].length
+	snapshots, err := d.store.Snapshots("", "", now.Add(-longest-maxSLOGap), time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	type podID struct{ namespace, name string }
+	type workloadKey struct{ namespace, kind, name string }
+	pods := make(map[podID]*sloTotals)
+	last := make(map[podID]PodStatusInfo)
+	podWorkload := make(map[podID]workloadKey)
+	for _, s := range snapshots {
+		key := podID{s.Namespace, s.Name}
+		totals := pods[key]
+		if totals == nil {
+			totals = &sloTotals{}
+			pods[key] = totals
+		}
+		if prev, ok := last[key]; ok {
+			totals.add(prev.LastCheck, minTime(s.LastCheck, prev.LastCheck.Add(maxSLOGap)), snapshotReady(prev), now)
+		}
+		last[key] = s
+		wk := workloadKey{s.Namespace, "Pod", s.Name}
+		if s.Workload != nil {
+			wk = workloadKey{s.Namespace, s.Workload.Kind, s.Workload.Name}
+		}
+		podWorkload[key] = wk
+	}
+	for key, s := range last {
+		pods[key].add(s.LastCheck, minTime(now, s.LastCheck.Add(maxSLOGap)), snapshotReady(s), now)
+	}
+
+	report := &SLOResponse{Target: target, Computed: now, Workloads: []WorkloadSLO{}, Pods: []PodSLO{}}
+	workloads := make(map[workloadKey]*sloTotals)
+	counts := make(map[workloadKey]int)
+	for key, totals := range pods {
+		report.Pods = append(report.Pods, PodSLO{Namespace: key.namespace, Name: key.name, Windows: totals.windows(target)})
+		wk := podWorkload[key]
+		if workloads[wk] == nil {
+			workloads[wk] = &sloTotals{}
+		}
+		workloads[wk].merge(totals)
+		counts[wk]++
+	}
+	for wk, totals := range workloads {
+		w := WorkloadSLO{Namespace: wk.namespace, Kind: wk.kind, Name: wk.name, Pods: counts[wk], Windows: totals.windows(target)}
+		w.BudgetRemaining, w.Burn = burnState(w.Windows)
+		report.Workloads = append(report.Workloads, w)
+	}
+	sort.Slice(report.Pods, func(i, j int) bool {
+		a, b := report.Pods[i], report.Pods[j]
+		return a.Namespace+"/"+a.Name < b.Namespace+"/"+b.Name
+	})
+	sort.Slice(report.Workloads, func(i, j int) bool {
+		a, b := report.Workloads[i], report.Workloads[j]
+		return a.Namespace+"/"+a.Kind+"/"+a.Name < b.Namespace+"/"+b.Kind+"/"+b.Name
+	})
+	d.sloCache.report = report
+	return report, nil
+}
+
+// snapshotReady reports whether a stored pod status was ready.
+func snapshotReady(s PodStatusInfo) bool {
+	if s.Effective != nil {
+		return s.Effective.Ready
+	}
+	return s.Info != nil && s.Info.ProbeStatus.Ready
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// handleSLO serves GET /api/slo.
+func (d *Dashboard) handleSLO(w http.ResponseWriter, r *http.Request) {
+	report, err := d.slo(time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read snapshots: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
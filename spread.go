@@ -0,0 +1,41 @@
+package main
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// scheduledScrape is a pod and when in the cycle to scrape it.
+type scheduledScrape struct {
+	pod    *corev1.Pod
+	hash   uint64
+	offset time.Duration
+}
+
+// spreadScrapes spreads the pods' scrapes evenly over window. The pods are
+// ordered by a hash of their name, so each keeps its place, and so roughly its
+// scrape interval, from cycle to cycle; each gets a slot of window/len(pods)
+// and a random offset within it, so several monitors or many pods don't fire
+// in lockstep. The schedule is sorted by offset; a zero window scrapes all
+// pods at once.
+func spreadScrapes(pods []*corev1.Pod, window time.Duration) []scheduledScrape {
+	schedule := make([]scheduledScrape, len(pods))
+	for i, pod := range pods {
+		h := fnv.New64a()
+		h.Write([]byte(pod.Namespace + "/" + pod.Name))
+		schedule[i] = scheduledScrape{pod: pod, hash: h.Sum64()}
+	}
+	sort.Slice(schedule, func(i, j int) bool { return schedule[i].hash < schedule[j].hash })
+	if window <= 0 || len(pods) == 0 {
+		return schedule
+	}
+	slot := window / time.Duration(len(pods))
+	for i := range schedule {
+		schedule[i].offset = time.Duration(i)*slot + rand.N(slot+1)
+	}
+	return schedule
+}
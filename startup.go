@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Bounds of the startup analytics: the pods sampled per revision and the
+// revisions kept per controller.
+const (
+	maxRevisionSamples  = 200
+	maxStartupRevisions = 10
+)
+
+// StartupStats summarizes how long pods took to reach a probe state, from
+// their creation.
+type StartupStats struct {
+	Samples    int     `json:"samples"`
+	MinSeconds float64 `json:"minSeconds"`
+	AvgSeconds float64 `json:"avgSeconds"`
+	P95Seconds float64 `json:"p95Seconds"`
+	MaxSeconds float64 `json:"maxSeconds"`
+}
+
+func startupStats(samples []time.Duration) StartupStats {
+	if len(samples) == 0 {
+		return StartupStats{}
+	}
+	latency := latencyStats(samples)
+	var sum time.Duration
+	low := samples[0]
+	for _, s := range samples {
+		sum += s
+		low = min(low, s)
+	}
+	return StartupStats{
+		Samples:    latency.Samples,
+		MinSeconds: low.Seconds(),
+		AvgSeconds: (sum / time.Duration(len(samples))).Seconds(),
+		P95Seconds: latency.P95Seconds,
+		MaxSeconds: latency.MaxSeconds,
+	}
+}
+
+// RevisionStartup is the startup analytics of one revision of a controller,
+// such as a ReplicaSet of a Deployment, with the probes its pods were
+// created with.
+type RevisionStartup struct {
+	Namespace string     `json:"namespace"`
+	Owner     OwnerInfo  `json:"owner"`
+	Workload  *OwnerInfo `json:"workload,omitempty"`
+	// Hash is the pod-template-hash or controller-revision-hash of the
+	// revision, and Revision the Deployment revision of a ReplicaSet.
+	Hash     string      `json:"hash"`
+	Revision string      `json:"revision,omitempty"`
+	Probes   *ProbeSpecs `json:"probes,omitempty"`
+	// Started and Ready are measured from pod creation.
+	Started  StartupStats `json:"started"`
+	Ready    StartupStats `json:"ready"`
+	LastSeen time.Time    `json:"lastSeen"`
+}
+
+type revisionKey struct {
+	namespace string
+	owner     types.UID
+	hash      string
+}
+
+type revisionSamples struct {
+	RevisionStartup
+	started []time.Duration
+	ready   []time.Duration
+}
+
+// podStartup is a pod being followed from creation to Ready. Only states
+// the pod was seen reaching count: a pod already started or ready when first
+// scraped, such as after a restart of the dashboard, is no sample for them.
+type podStartup struct {
+	key         revisionKey
+	created     time.Time
+	sawStarting bool
+	sawUnready  bool
+	started     bool
+	ready       bool
+}
+
+// startupTracker measures how long pods take from creation to Started and to
+// Ready and aggregates the times per revision of their controller, so the
+// rollout speed of different startup probe settings can be compared.
+type startupTracker struct {
+	mu        sync.Mutex
+	pods      map[types.UID]*podStartup
+	revisions map[revisionKey]*revisionSamples
+}
+
+func newStartupTracker() *startupTracker {
+	return &startupTracker{
+		pods:      make(map[types.UID]*podStartup),
+		revisions: make(map[revisionKey]*revisionSamples),
+	}
+}
+
+// observe follows a pod's scraped Started and Ready flags. Pods without a
+// controller aren't tracked.
+func (t *startupTracker) observe(status *PodStatusInfo, created time.Time, hash string, started, ready bool, now time.Time) {
+	if status.Owner == nil || status.UID == "" || created.IsZero() {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p := t.pods[status.UID]
+	if p == nil {
+		p = &podStartup{
+			key:         revisionKey{status.Namespace, status.Owner.UID, hash},
+			created:     created,
+			sawStarting: !started,
+			sawUnready:  !ready,
+		}
+		t.pods[status.UID] = p
+	}
+	if p.started && p.ready {
+		return
+	}
+
+	rev := t.revisions[p.key]
+	if rev == nil {
+		t.dropOldestRevision(p.key.owner)
+		rev = &revisionSamples{RevisionStartup: RevisionStartup{
+			Namespace: status.Namespace,
+			Owner:     *status.Owner,
+			Workload:  status.Workload,
+			Hash:      hash,
+		}}
+		t.revisions[p.key] = rev
+	}
+	rev.Probes = status.Probes
+	rev.LastSeen = now
+
+	if started && !p.started {
+		p.started = true
+		if p.sawStarting {
+			rev.started = appendStartupSample(rev.started, now.Sub(p.created))
+		}
+	}
+	if ready && !p.ready {
+		p.ready = true
+		if p.sawUnready {
+			rev.ready = appendStartupSample(rev.ready, now.Sub(p.created))
+		}
+	}
+}
+
+func appendStartupSample(samples []time.Duration, took time.Duration) []time.Duration {
+	samples = append(samples, took)
+	if len(samples) > maxRevisionSamples {
+		samples = samples[len(samples)-maxRevisionSamples:]
+	}
+	return samples
+}
+
+// dropOldestRevision makes room for a new revision of a controller by
+// forgetting its least recently seen one. t.mu must be held.
+func (t *startupTracker) dropOldestRevision(owner types.UID) {
+	var oldest *revisionKey
+	n := 0
+	for k, rev := range t.revisions {
+		if k.owner != owner {
+			continue
+		}
+		n++
+		if oldest == nil || rev.LastSeen.Before(t.revisions[*oldest].LastSeen) {
+			oldest = &k
+		}
+	}
+	if n >= maxStartupRevisions {
+		delete(t.revisions, *oldest)
+	}
+}
+
+func (t *startupTracker) forget(uid types.UID) {
+	t.mu.Lock()
+	delete(t.pods, uid)
+	t.mu.Unlock()
+}
+
+// list returns the analytics of every revision with samples.
+func (t *startupTracker) list() []RevisionStartup {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var out []RevisionStartup
+	for _, rev := range t.revisions {
+		if len(rev.started) == 0 && len(rev.ready) == 0 {
+			continue
+		}
+		r := rev.RevisionStartup
+		r.Started = startupStats(rev.started)
+		r.Ready = startupStats(rev.ready)
+		out = append(out, r)
+	}
+	return out
+}
+
+// revision returns the analytics of the ReplicaSet name in namespace, or of
+// the one with uid if it is set.
+func (t *startupTracker) revision(namespace, name string, uid types.UID) *RevisionStartup {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var found *revisionSamples
+	for k, rev := range t.revisions {
+		if k.namespace != namespace || rev.Owner.Kind != "ReplicaSet" || rev.Owner.Name != name || (uid != "" && k.owner != uid) {
+			continue
+		}
+		if found == nil || rev.LastSeen.After(found.LastSeen) {
+			found = rev
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	r := found.RevisionStartup
+	r.Started = startupStats(found.started)
+	r.Ready = startupStats(found.ready)
+	return &r
+}
+
+// revisionHash returns the label that tells a pod's revision apart.
+func revisionHash(labels map[string]string) string {
+	if hash := labels[appsv1.DefaultDeploymentUniqueLabelKey]; hash != "" {
+		return hash
+	}
+	return labels[appsv1.ControllerRevisionHashLabelKey]
+}
+
+// startupAnalytics returns the startup analytics of every revision, with the
+// Deployment revisions of ReplicaSets still in the informer caches, ordered
+// by namespace, owner and last seen.
+func (d *Dashboard) startupAnalytics() []RevisionStartup {
+	revisions := d.startup.list()
+	if w := d.currentWatch(); w != nil {
+		for i := range revisions {
+			r := &revisions[i]
+			if r.Owner.Kind != "ReplicaSet" {
+				continue
+			}
+			replicaSets, _ := w.replicaSets(r.Namespace)
+			for _, rs := range replicaSets {
+				if rs.UID == r.Owner.UID {
+					r.Revision = rs.Annotations[revisionAnnotation]
+				}
+			}
+		}
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		a, b := revisions[i], revisions[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if wa, wb := workloadName(a), workloadName(b); wa != wb {
+			return wa < wb
+		}
+		if a.Revision != b.Revision {
+			ra, _ := strconv.Atoi(a.Revision)
+			rb, _ := strconv.Atoi(b.Revision)
+			return ra > rb
+		}
+		return a.LastSeen.After(b.LastSeen)
+	})
+	return revisions
+}
+
+func workloadName(r RevisionStartup) string {
+	if r.Workload != nil {
+		return r.Workload.Kind + "/" + r.Workload.Name
+	}
+	return r.Owner.Kind + "/" + r.Owner.Name
+}
+
+// handleStartupAnalytics serves GET /api/analytics/startup.
+func (d *Dashboard) handleStartupAnalytics(w http.ResponseWriter, r *http.Request) {
+	revisions := d.startupAnalytics()
+	if revisions == nil {
+		revisions = []RevisionStartup{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// PodStats are counts over the monitored pods.
+type PodStats struct {
+	Total                  int            `json:"total"`
+	ByPhase                map[string]int `json:"byPhase"`
+	ByReadiness            map[string]int `json:"byReadiness"`
+	ByNode                 map[string]int `json:"byNode"`
+	ByReplicaSet           map[string]int `json:"byReplicaSet"`
+	ByWorkload             map[string]int `json:"byWorkload"`
+	ScrapeErrors           map[string]int `json:"scrapeErrors"`
+	AvgContainerAgeSeconds float64        `json:"avgContainerAgeSeconds"`
+}
+
+// podStats counts the monitored pods. Pods whose info couldn't be scraped
+// count as unknown readiness and don't contribute to the average age.
+func (d *Dashboard) podStats() PodStats {
+	stats := PodStats{
+		ByPhase:      make(map[string]int),
+		ByReadiness:  make(map[string]int),
+		ByNode:       make(map[string]int),
+		ByReplicaSet: make(map[string]int),
+		ByWorkload:   make(map[string]int),
+		ScrapeErrors: make(map[string]int),
+	}
+	var age time.Duration
+	aged := 0
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, p := range d.pods {
+		stats.Total++
+		stats.ByPhase[p.Status]++
+		if p.Node != "" {
+			stats.ByNode[p.Node]++
+		}
+		if p.Owner != nil && p.Owner.Kind == "ReplicaSet" {
+			stats.ByReplicaSet[p.Namespace+"/"+p.Owner.Name]++
+		}
+		if p.Workload != nil {
+			stats.ByWorkload[p.Workload.Kind+"/"+p.Namespace+"/"+p.Workload.Name]++
+		}
+		if p.ErrorKind != "" {
+			stats.ScrapeErrors[p.ErrorKind]++
+		}
+		switch {
+		case p.Info == nil:
+			stats.ByReadiness["unknown"]++
+		case p.Info.ProbeStatus.Ready:
+			stats.ByReadiness["ready"]++
+		default:
+			stats.ByReadiness["notReady"]++
+		}
+		if p.Info != nil {
+			age += time.Duration(p.Info.ContainerAge)
+			aged++
+		}
+	}
+	if aged > 0 {
+		stats.AvgContainerAgeSeconds = (age / time.Duration(aged)).Seconds()
+	}
+	return stats
+}
+
+// StatsResponse is the response of GET /api/stats.
+type StatsResponse struct {
+	Pods        PodStats         `json:"pods"`
+	Propagation PropagationStats `json:"propagation"`
+}
+
+// handleStats serves GET /api/stats.
+func (d *Dashboard) handleStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(StatsResponse{d.podStats(), d.propagation.stats()})
+}
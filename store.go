@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store backends selectable with --store.
+const (
+	StoreMemory = "memory"
+	StoreBolt   = "bolt"
+)
+
+// snapshotInterval is how often an unchanged pod's status is persisted.
+// Transitions always trigger a snapshot.
+const snapshotInterval = time.Minute
+
+// StoredTransition is a probe transition together with the pod it belongs to.
+type StoredTransition struct {
+	Namespace string `json:"namespace,omitempty"`
+	Pod       string `json:"pod"`
+	HistoryEntry
+}
+
+// Store persists pod snapshots and probe transitions beyond the in-memory
+// ring buffers, and the audit log. Queries return records with from <= time
+// < to, oldest first; an empty namespace or pod name matches every one.
+type Store interface {
+	AppendTransition(t StoredTransition) error
+	AppendSnapshot(s PodStatusInfo) error
+	AppendAudit(e AuditEntry) error
+	Transitions(namespace, pod string, from, to time.Time) ([]StoredTransition, error)
+	Snapshots(namespace, pod string, from, to time.Time) ([]PodStatusInfo, error)
+	Audit(from, to time.Time) ([]AuditEntry, error)
+	// Prune deletes transitions and snapshots older than before and
+	// returns how many were removed. The audit log is append-only and kept.
+	Prune(before time.Time) (int, error)
+	Close() error
+}
+
+// openStore creates the store selected by kind.
+func openStore(kind, path string) (Store, error) {
+	switch kind {
+	case StoreMemory:
+		return newMemoryStore(), nil
+	case StoreBolt:
+		return openBoltStore(path)
+	}
+	return nil, fmt.Errorf("unknown store %q: must be %q or %q", kind, StoreMemory, StoreBolt)
+}
+
+// memoryStore keeps records in process memory. It is the default and loses
+// everything on restart, but gives time-range queries the same semantics as
+// the persistent backends.
+type memoryStore struct {
+	mu          sync.RWMutex
+	transitions []StoredTransition
+	snapshots   []PodStatusInfo
+	audit       []AuditEntry
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{}
+}
+
+func (m *memoryStore) AppendTransition(t StoredTransition) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.transitions = append(m.transitions, t)
+	return nil
+}
+
+func (m *memoryStore) AppendSnapshot(s PodStatusInfo) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshots = append(m.snapshots, s)
+	return nil
+}
+
+func (m *memoryStore) AppendAudit(e AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.audit = append(m.audit, e)
+	return nil
+}
+
+func (m *memoryStore) Transitions(namespace, pod string, from, to time.Time) ([]StoredTransition, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var out []StoredTransition
+	for _, t := range m.transitions {
+		if podMatches(namespace, pod, t.Namespace, t.Pod) && inRange(t.Time, from, to) {
+			out = append(out, t)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	return out, nil
+}
+
+func (m *memoryStore) Snapshots(namespace, pod string, from, to time.Time) ([]PodStatusInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var out []PodStatusInfo
+	for _, s := range m.snapshots {
+		if podMatches(namespace, pod, s.Namespace, s.Name) && inRange(s.LastCheck, from, to) {
+			out = append(out, s)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].LastCheck.Before(out[j].LastCheck) })
+	return out, nil
+}
+
+func (m *memoryStore) Audit(from, to time.Time) ([]AuditEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var out []AuditEntry
+	for _, e := range m.audit {
+		if inRange(e.Time, from, to) {
+			out = append(out, e)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	return out, nil
+}
+
+func (m *memoryStore) Prune(before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	removed := 0
+	transitions := m.transitions[:0]
+	for _, t := range m.transitions {
+		if t.Time.Before(before) {
+			removed++
+			continue
+		}
+		transitions = append(transitions, t)
+	}
+	m.transitions = transitions
+
+	snapshots := m.snapshots[:0]
+	for _, s := range m.snapshots {
+		if s.LastCheck.Before(before) {
+			removed++
+			continue
+		}
+		snapshots = append(snapshots, s)
+	}
+	m.snapshots = snapshots
+	return removed, nil
+}
+
+func (m *memoryStore) Close() error { return nil }
+
+// podMatches reports whether a record of the pod name in namespace matches a
+// query for pod in wantNamespace.
+func podMatches(wantNamespace, wantPod, namespace, name string) bool {
+	return (wantNamespace == "" || namespace == wantNamespace) && (wantPod == "" || name == wantPod)
+}
+
+// inRange reports whether from <= t < to, treating zero bounds as open.
+func inRange(t, from, to time.Time) bool {
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+}
+
+// persist writes a pod's new transitions to the store, together with a
+// snapshot of its status when something changed or snapshotInterval has
+// passed since the last one.
+func (d *Dashboard) persist(status *PodStatusInfo, entries []HistoryEntry) {
+	for _, e := range entries {
+		if err := d.store.AppendTransition(StoredTransition{Namespace: status.Namespace, Pod: status.Name, HistoryEntry: e}); err != nil {
+			slog.Error("Failed to store transition", "pod", status.Name, "namespace", status.Namespace, "error", err)
+		}
+	}
+
+	key := podKey(status.Namespace, status.Name)
+	d.mu.Lock()
+	last, seen := d.lastSnapshot[key]
+	due := len(entries) > 0 || !seen || status.LastCheck.Sub(last) >= snapshotInterval
+	if due {
+		d.lastSnapshot[key] = status.LastCheck
+	}
+	d.mu.Unlock()
+
+	if due {
+		if err := d.store.AppendSnapshot(*status); err != nil {
+			slog.Error("Failed to store snapshot", "pod", status.Name, "namespace", status.Namespace, "error", err)
+		}
+	}
+}
+
+// restoreHistory loads the transitions still within retention into the
+// in-memory history.
+func (d *Dashboard) restoreHistory(now time.Time) error {
+	cfg := d.cfg()
+	transitions, err := d.store.Transitions("", "", now.Add(-cfg.StoreRetention), time.Time{})
+	if err != nil {
+		return fmt.Errorf("failed to load history: %v", err)
+	}
+	d.history.restore(transitions, now)
+	if len(transitions) > 0 {
+		slog.Info("Restored probe transitions", "count", len(transitions), "store", cfg.Store)
+	}
+	return nil
+}
+
+// pruneStore deletes records older than the retention period every hour.
+func (d *Dashboard) pruneStore(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		removed, err := d.store.Prune(time.Now().Add(-d.cfg().StoreRetention))
+		if err != nil {
+			slog.Error("Failed to prune history store", "error", err)
+		} else if removed > 0 {
+			slog.Info("Pruned expired history records", "count", removed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltTransitions = []byte("transitions")
+	boltSnapshots   = []byte("snapshots")
+	boltAudit       = []byte("audit")
+)
+
+// boltStore persists records in an embedded bbolt database. Keys are the
+// record time as big-endian Unix nanoseconds followed by the pod key and the
+// bucket's next sequence number, so a cursor walks each bucket in time order
+// and records of one pod at the same time, such as the transitions of one
+// scrape, don't overwrite each other.
+type boltStore struct {
+	db *bolt.DB
+}
+
+func openBoltStore(path string) (*boltStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("--store-path is required for the bolt store")
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltTransitions, boltSnapshots, boltAudit} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize %s: %v", path, err)
+	}
+	return &boltStore{db: db}, nil
+}
+
+func boltKey(t time.Time, pod string) []byte {
+	key := make([]byte, 8, 8+len(pod))
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return append(key, pod...)
+}
+
+// boltKeyPod returns the pod of a stored key, dropping its sequence number.
+func boltKeyPod(key []byte) (namespace, name string) {
+	if len(key) < 16 {
+		return "", ""
+	}
+	return splitPodKey(string(key[8 : len(key)-8]))
+}
+
+func (s *boltStore) put(bucket []byte, t time.Time, pod string, v any) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	// Batch coalesces concurrent writers into a single transaction.
+	return s.db.Batch(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return b.Put(binary.BigEndian.AppendUint64(boltKey(t, pod), seq), value)
+	})
+}
+
+func (s *boltStore) AppendTransition(t StoredTransition) error {
+	return s.put(boltTransitions, t.Time, podKey(t.Namespace, t.Pod), t)
+}
+
+func (s *boltStore) AppendSnapshot(p PodStatusInfo) error {
+	return s.put(boltSnapshots, p.LastCheck, podKey(p.Namespace, p.Name), p)
+}
+
+func (s *boltStore) AppendAudit(e AuditEntry) error {
+	return s.put(boltAudit, e.Time, "", e)
+}
+
+// scan calls fn for every record of pod in namespace in [from, to).
+func (s *boltStore) scan(bucket []byte, namespace, pod string, from, to time.Time, fn func(value []byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucket).Cursor()
+		var k, v []byte
+		if from.IsZero() {
+			k, v = c.First()
+		} else {
+			k, v = c.Seek(boltKey(from, ""))
+		}
+		var end []byte
+		if !to.IsZero() {
+			end = boltKey(to, "")
+		}
+		for ; k != nil; k, v = c.Next() {
+			if end != nil && bytes.Compare(k, end) >= 0 {
+				break
+			}
+			if ns, name := boltKeyPod(k); !podMatches(namespace, pod, ns, name) {
+				continue
+			}
+			if err := fn(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) Transitions(namespace, pod string, from, to time.Time) ([]StoredTransition, error) {
+	var out []StoredTransition
+	err := s.scan(boltTransitions, namespace, pod, from, to, func(v []byte) error {
+		var t StoredTransition
+		if err := json.Unmarshal(v, &t); err != nil {
+			return err
+		}
+		out = append(out, t)
+		return nil
+	})
+	return out, err
+}
+
+func (s *boltStore) Snapshots(namespace, pod string, from, to time.Time) ([]PodStatusInfo, error) {
+	var out []PodStatusInfo
+	err := s.scan(boltSnapshots, namespace, pod, from, to, func(v []byte) error {
+		var p PodStatusInfo
+		if err := json.Unmarshal(v, &p); err != nil {
+			return err
+		}
+		out = append(out, p)
+		return nil
+	})
+	return out, err
+}
+
+func (s *boltStore) Audit(from, to time.Time) ([]AuditEntry, error) {
+	var out []AuditEntry
+	err := s.scan(boltAudit, "", "", from, to, func(v []byte) error {
+		var e AuditEntry
+		if err := json.Unmarshal(v, &e); err != nil {
+			return err
+		}
+		out = append(out, e)
+		return nil
+	})
+	return out, err
+}
+
+func (s *boltStore) Prune(before time.Time) (int, error) {
+	removed := 0
+	limit := boltKey(before, "")
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltTransitions, boltSnapshots} {
+			c := tx.Bucket(name).Cursor()
+			for k, _ := c.First(); k != nil && bytes.Compare(k, limit) < 0; k, _ = c.First() {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+				removed++
+			}
+		}
+		return nil
+	})
+	return removed, err
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
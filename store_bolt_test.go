@@ -0,0 +1,61 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBoltStoreSameTime(t *testing.T) {
+	s, err := openBoltStore(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// The transitions of one scrape share its time.
+	at := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	transitions := []StoredTransition{
+		{Namespace: "default", Pod: "web-1", HistoryEntry: HistoryEntry{ProbeTransition: ProbeTransition{Probe: "started", To: true, Time: at}}},
+		{Namespace: "default", Pod: "web-1", HistoryEntry: HistoryEntry{ProbeTransition: ProbeTransition{Probe: "ready", To: true, Time: at}}},
+		{Namespace: "other", Pod: "web-1", HistoryEntry: HistoryEntry{ProbeTransition: ProbeTransition{Probe: "ready", To: true, Time: at}}},
+		{Namespace: "default", Pod: "web-1", HistoryEntry: HistoryEntry{ProbeTransition: ProbeTransition{Probe: "ready", Time: at.Add(time.Second)}}},
+	}
+	for _, tr := range transitions {
+		if err := s.AppendTransition(tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name, namespace, pod string
+		from, to             time.Time
+		want                 []string
+	}{
+		{name: "all", want: []string{"started", "ready", "ready", "ready"}},
+		{name: "pod", namespace: "default", pod: "web-1", want: []string{"started", "ready", "ready"}},
+		{name: "other namespace", namespace: "other", pod: "web-1", want: []string{"ready"}},
+		{name: "range", namespace: "default", pod: "web-1", from: at, to: at.Add(time.Second), want: []string{"started", "ready"}},
+		{name: "after", from: at.Add(time.Second), want: []string{"ready"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Transitions(tt.namespace, tt.pod, tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			probes := make([]string, len(got))
+			for i, tr := range got {
+				probes[i] = tr.Probe
+			}
+			if !slices.Equal(probes, tt.want) {
+				t.Errorf("Transitions() = %v, want %v", probes, tt.want)
+			}
+		})
+	}
+
+	if removed, err := s.Prune(at.Add(time.Second)); err != nil || removed != 3 {
+		t.Errorf("Prune() = %d, %v; want 3", removed, err)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Pod event types published on the event hub.
+const (
+	PodEventAdd        = "add"
+	PodEventUpdate     = "update"
+	PodEventDelete     = "delete"
+	PodEventTransition = "transition"
+)
+
+// PodEvent announces a change to the monitored pod set.
+type PodEvent struct {
+	Type string `json:"type"`
+	// Cluster is set when monitoring several clusters.
+	Cluster    string           `json:"cluster,omitempty"`
+	Namespace  string           `json:"namespace"`
+	Name       string           `json:"name"`
+	Pod        *PodStatusInfo   `json:"pod,omitempty"`
+	Transition *ProbeTransition `json:"transition,omitempty"`
+}
+
+// Key identifies the event's pod like PodStatusInfo.Key.
+func (ev PodEvent) Key() string {
+	if ev.Cluster == "" {
+		return podKey(ev.Namespace, ev.Name)
+	}
+	return ev.Cluster + "/" + podKey(ev.Namespace, ev.Name)
+}
+
+// eventHub fans pod events out to live subscribers such as SSE and WebSocket
+// clients. Each subscriber has its own bounded send buffer.
+type eventHub struct {
+	mu     sync.Mutex
+	subs   map[chan PodEvent]struct{}
+	closed bool
+	log    changeLog
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subs: make(map[chan PodEvent]struct{}), log: newChangeLog()}
+}
+
+// subscribe registers a subscriber with a send buffer of the given size. The
+// returned channel is closed when the subscriber is dropped or cancelled.
+func (h *eventHub) subscribe(buffer int) (<-chan PodEvent, func()) {
+	ch := make(chan PodEvent, buffer)
+	h.mu.Lock()
+	if h.closed {
+		close(ch)
+	} else {
+		h.subs[ch] = struct{}{}
+	}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subs[ch]; ok {
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// publish delivers ev to every subscriber without blocking. A subscriber whose
+// buffer is full is dropped; clients resync from a fresh snapshot when they
+// reconnect.
+func (h *eventHub) publish(ev PodEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if ev.Type != PodEventTransition {
+		h.record(ev)
+	}
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// publish sends a pod event of this dashboard's cluster to the event hub.
+func (d *Dashboard) publish(ev PodEvent) {
+	ev.Cluster = d.cluster
+	d.recordPod(ev)
+	d.events.publish(ev)
+}
+
+// close ends every subscription and refuses new ones. It is called on
+// shutdown so that long-lived streams return.
+func (h *eventHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.closed {
+		close(h.log.changed)
+	}
+	h.closed = true
+	for ch := range h.subs {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+// isClosed reports whether close has been called.
+func (h *eventHub) isClosed() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.closed
+}
+
+// handleStream serves pod updates as Server-Sent Events. The current state is
+// sent first as a series of update events, followed by changes as they happen.
+// With ?html=1 every update also carries the rendered pod card.
+func (d *Dashboard) handleStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	withHTML := r.URL.Query().Get("html") == "1"
+
+	// Subscribe before taking the snapshot so no change falls in between.
+	events, cancel := d.events.subscribe(256)
+	defer cancel()
+
+	// The stream outlives the server's write timeout.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	for _, pod := range d.sortedPods() {
+		if err := d.writeEvent(w, PodEvent{Type: PodEventUpdate, Cluster: pod.Cluster, Namespace: pod.Namespace, Name: pod.Name, Pod: pod}, withHTML); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case ev, ok := <-events:
+			if !ok {
+				// Dropped for being too slow or shutting down; the
+				// client will reconnect.
+				return
+			}
+			if err := d.writeEvent(w, ev, withHTML); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func (d *Dashboard) writeEvent(w http.ResponseWriter, ev PodEvent, withHTML bool) error {
+	payload := struct {
+		PodEvent
+		HTML string `json:"html,omitempty"`
+	}{PodEvent: ev}
+
+	if withHTML && ev.Pod != nil {
+		var buf bytes.Buffer
+		if err := d.template().ExecuteTemplate(&buf, "pod-card", ev.Pod); err != nil {
+			return err
+		}
+		payload.HTML = buf.String()
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+	return err
+}
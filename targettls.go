@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// targetTLSConfig builds the TLS settings for https targets reached
+// directly. Pods are dialed by IP, so unless TargetServerName is set the
+// certificate is verified against the pod IP.
+func targetTLSConfig(cfg Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.TargetServerName,
+		InsecureSkipVerify: cfg.TargetInsecureSkipVerify,
+	}
+	if cfg.TargetCAFile != "" {
+		pem, err := os.ReadFile(cfg.TargetCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read target CA bundle: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in target CA bundle %s", cfg.TargetCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.TargetCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TargetCertFile, cfg.TargetKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load target client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// tlsSettingsChanged reports whether the target TLS settings differ, which
+// needs a restart to take effect.
+func tlsSettingsChanged(a, b Config) bool {
+	return a.TargetCAFile != b.TargetCAFile || a.TargetCertFile != b.TargetCertFile ||
+		a.TargetKeyFile != b.TargetKeyFile || a.TargetServerName != b.TargetServerName ||
+		a.TargetInsecureSkipVerify != b.TargetInsecureSkipVerify
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Readiness states of a timeline bucket, from the least to the most severe.
+// A bucket takes the most severe state the pod was in during it; it is
+// empty while the pod wasn't monitored.
+const (
+	TimelineReady       = "ready"
+	TimelineUnready     = "unready"
+	TimelineFailing     = "failing"
+	TimelineUnreachable = "unreachable"
+)
+
+var timelineSeverity = map[string]int{"": 0, TimelineReady: 1, TimelineUnready: 2, TimelineFailing: 3, TimelineUnreachable: 4}
+
+// Defaults and bounds of the /api/timeline range.
+const (
+	defaultTimelineWindow = time.Hour
+	defaultTimelineBucket = 10 * time.Second
+	maxTimelineBuckets    = 2000
+)
+
+// PodTimeline is a pod's readiness state per bucket, oldest first.
+type PodTimeline struct {
+	Namespace string   `json:"namespace"`
+	Name      string   `json:"name"`
+	States    []string `json:"states"`
+}
+
+// TimelineResponse is the response of GET /api/timeline. Bucket i covers
+// From + i*BucketSeconds up to the next one.
+type TimelineResponse struct {
+	From          time.Time     `json:"from"`
+	To            time.Time     `json:"to"`
+	BucketSeconds float64       `json:"bucketSeconds"`
+	Buckets       int           `json:"buckets"`
+	Pods          []PodTimeline `json:"pods"`
+}
+
+// snapshotState classifies a stored pod status for the timeline: a pod that
+// couldn't be scraped is unreachable, and one whose liveness fails is
+// failing whatever its readiness.
+func snapshotState(s PodStatusInfo) string {
+	if s.Info == nil {
+		if s.Error != "" {
+			return TimelineUnreachable
+		}
+		return ""
+	}
+	live := s.Info.ProbeStatus.Live
+	if s.Effective != nil {
+		live = s.Effective.Live
+	}
+	switch {
+	case !live:
+		return TimelineFailing
+	case snapshotReady(s):
+		return TimelineReady
+	}
+	return TimelineUnready
+}
+
+// timeline buckets the stored snapshots from from to to. A snapshot's state
+// lasts until the pod's next one, and at most two snapshot intervals, after
+// which the pod was gone.
+func (d *Dashboard) timeline(from, to time.Time, bucket time.Duration) (TimelineResponse, error) {
+	resp := TimelineResponse{From: from, To: to, BucketSeconds: bucket.Seconds(), Pods: []PodTimeline{}}
+	resp.Buckets = int((to.Sub(from) + bucket - 1) / bucket)
+	snapshots, err := d.store.Snapshots("", "", from.Add(-2*snapshotInterval), to)
+	if err != nil {
+		return resp, err
+	}
+
+	type podID struct{ namespace, name string }
+	byPod := make(map[podID][]PodStatusInfo)
+	for _, s := range snapshots {
+		key := podID{s.Namespace, s.Name}
+		byPod[key] = append(byPod[key], s)
+	}
+	for key, pod := range byPod {
+		states := make([]string, resp.Buckets)
+		for i, s := range pod {
+			end := s.LastCheck.Add(2 * snapshotInterval)
+			if i+1 < len(pod) {
+				end = minTime(end, pod[i+1].LastCheck)
+			}
+			state := snapshotState(s)
+			start := s.LastCheck
+			if start.Before(from) {
+				start = from
+			}
+			if !end.After(start) {
+				continue
+			}
+			first := int(start.Sub(from) / bucket)
+			last := min(int((end.Sub(from)-1)/bucket), resp.Buckets-1)
+			for b := first; b <= last; b++ {
+				if timelineSeverity[state] > timelineSeverity[states[b]] {
+					states[b] = state
+				}
+			}
+		}
+		resp.Pods = append(resp.Pods, PodTimeline{Namespace: key.namespace, Name: key.name, States: states})
+	}
+	sort.Slice(resp.Pods, func(i, j int) bool {
+		a, b := resp.Pods[i], resp.Pods[j]
+		return a.Namespace+"/"+a.Name < b.Namespace+"/"+b.Name
+	})
+	return resp, nil
+}
+
+// handleTimeline serves GET /api/timeline, every pod's readiness state over
+// the last window (1h by default) in buckets (10s by default), for a
+// heatmap of when pods were unready, failing or unreachable.
+func (d *Dashboard) handleTimeline(w http.ResponseWriter, r *http.Request) {
+	window, bucket := defaultTimelineWindow, defaultTimelineBucket
+	for _, param := range []struct {
+		name string
+		dst  *time.Duration
+	}{{"window", &window}, {"bucket", &bucket}} {
+		if v := r.URL.Query().Get(param.name); v != "" {
+			dur, err := time.ParseDuration(v)
+			if err != nil || dur <= 0 {
+				http.Error(w, fmt.Sprintf("Invalid %s: must be a positive duration such as 1h", param.name), http.StatusBadRequest)
+				return
+			}
+			*param.dst = dur
+		}
+	}
+	if window/bucket > maxTimelineBuckets {
+		http.Error(w, fmt.Sprintf("Too many buckets: window/bucket must be at most %d", maxTimelineBuckets), http.StatusBadRequest)
+		return
+	}
+
+	// Buckets are aligned to their size so polling clients see stable ones.
+	to := time.Now().Truncate(bucket).Add(bucket)
+	resp, err := d.timeline(to.Add(-window), to, bucket)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read snapshots: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the monitor's spans. It is a no-op until setupTracing
+// installs a provider.
+var tracer = otel.Tracer("github.com/pascal71/k8s-probe-monitor")
+
+// setupTracing exports spans to the OTLP endpoint, if configured, and
+// returns a function that flushes and stops the exporter.
+func setupTracing(cfg Config) func(context.Context) error {
+	if cfg.OTLPEndpoint == "" {
+		return func(context.Context) error { return nil }
+	}
+	endpoint := strings.TrimSuffix(cfg.OTLPEndpoint, "/") + "/v1/traces"
+	exporter, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(endpoint),
+		otlptracehttp.WithHeaders(cfg.OTLPHeaders),
+		otlptracehttp.WithTimeout(10*time.Second),
+	)
+	if err != nil {
+		slog.Warn("Failed to create the trace exporter", "error", err)
+		return func(context.Context) error { return nil }
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.TraceSampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName("k8s-probe-monitor"),
+			semconv.ServiceVersion(Version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	u, _ := url.Parse(endpoint) // Validated with the config.
+	slog.Info("Exporting traces", "endpoint", u.Redacted(), "sampleRatio", cfg.TraceSampleRatio)
+	return provider.Shutdown
+}
+
+// validateTracing checks the tracing settings.
+func (c Config) validateTracing() error {
+	if c.OTLPEndpoint != "" {
+		if u, err := url.Parse(c.OTLPEndpoint); err != nil || u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("invalid OTLP endpoint %q: must be an http or https URL", c.OTLPEndpoint)
+		}
+	}
+	if c.TraceSampleRatio < 0 || c.TraceSampleRatio > 1 {
+		return fmt.Errorf("trace sample ratio must be from 0 to 1, got %v", c.TraceSampleRatio)
+	}
+	return nil
+}
+
+// endSpan records err, if any, on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracingTransport traces outgoing requests as client spans and propagates
+// the trace context to the server. name names the spans, e.g. "kubernetes".
+type tracingTransport struct {
+	next http.RoundTripper
+	name string
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := tracer.Start(req.Context(), t.name+" "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.ServerAddress(req.URL.Hostname()),
+			semconv.URLPath(req.URL.Path),
+		))
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	// The span ends with the response headers; watches stream on.
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+	span.End()
+	return resp, nil
+}
+
+// traceRequests traces the dashboard's requests as server spans named by
+// their route in mux, continuing traces propagated by the client.
+func traceRequests(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := requestRoute(mux, r)
+		name := strings.TrimSpace(r.Method + " " + route)
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+			))
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rec.status))
+		if rec.status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	})
+}
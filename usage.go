@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Sources of pod usage.
+const (
+	// UsageMetricsServer reads the metrics.k8s.io API.
+	UsageMetricsServer = "metrics-server"
+	// UsageKubelet reads the kubelet summary API of the pods' nodes
+	// through the API server's nodes/proxy subresource.
+	UsageKubelet = "kubelet"
+	UsageNone    = "none"
+)
+
+// usageRefreshInterval is how often pod usage is listed. metrics-server
+// samples every 15s by default.
+const usageRefreshInterval = 15 * time.Second
+
+// ResourceUsage is the monitored container's requests and limits, in
+// millicores and bytes with zero for unset ones, and its current usage.
+type ResourceUsage struct {
+	Container          string `json:"container"`
+	CPURequestMillis   int64  `json:"cpuRequestMillis,omitempty"`
+	CPULimitMillis     int64  `json:"cpuLimitMillis,omitempty"`
+	MemoryRequestBytes int64  `json:"memoryRequestBytes,omitempty"`
+	MemoryLimitBytes   int64  `json:"memoryLimitBytes,omitempty"`
+	// Usage is nil when the usage source is none, unavailable, not allowed
+	// to be read or hasn't measured the container yet.
+	Usage *ContainerUsage `json:"usage,omitempty"`
+}
+
+// ContainerUsage is a container's usage as last measured, averaged over the
+// window ending at Time. Memory is the working set.
+type ContainerUsage struct {
+	Source      string `json:"source"`
+	CPUMillis   int64  `json:"cpuMillis"`
+	MemoryBytes int64  `json:"memoryBytes"`
+	// FilesystemBytes is the container's writable layer and logs, which
+	// only the kubelet reports.
+	FilesystemBytes int64     `json:"filesystemBytes,omitempty"`
+	Time            time.Time `json:"time"`
+	WindowSeconds   float64   `json:"windowSeconds,omitempty"`
+}
+
+// podMetrics mirrors the PodMetrics of the metrics.k8s.io API, which
+// client-go has no types for. Kubelet stats are converted to it, with the
+// filesystem usage as ephemeral storage.
+type podMetrics struct {
+	Metadata   metav1.ObjectMeta  `json:"metadata"`
+	Timestamp  metav1.Time        `json:"timestamp"`
+	Window     metav1.Duration    `json:"window"`
+	Containers []containerMetrics `json:"containers"`
+}
+
+type containerMetrics struct {
+	Name  string              `json:"name"`
+	Usage corev1.ResourceList `json:"usage"`
+}
+
+// podMetricsLister lists the usage of the pods of a namespace, or of a node
+// for the kubelet source. Listing more pods than asked for is fine.
+type podMetricsLister func(ctx context.Context, key string) ([]podMetrics, error)
+
+// metricsServerLister reads the metrics.k8s.io API through the clientset.
+// Without an API server, as in demo mode, there is no usage.
+func metricsServerLister(clientset kubernetes.Interface) podMetricsLister {
+	return func(ctx context.Context, namespace string) ([]podMetrics, error) {
+		client := clientset.Discovery().RESTClient()
+		if client == nil {
+			return nil, nil
+		}
+		body, err := client.Get().AbsPath("/apis/metrics.k8s.io/v1beta1/namespaces", namespace, "pods").Do(ctx).Raw()
+		if err != nil {
+			return nil, err
+		}
+		var list struct {
+			Items []podMetrics `json:"items"`
+		}
+		if err := json.Unmarshal(body, &list); err != nil {
+			return nil, fmt.Errorf("failed to decode pod metrics: %v", err)
+		}
+		return list.Items, nil
+	}
+}
+
+// kubeletSummary is the part of the kubelet's /stats/summary used.
+type kubeletSummary struct {
+	Pods []struct {
+		PodRef struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"podRef"`
+		Containers []struct {
+			Name string `json:"name"`
+			CPU  *struct {
+				Time           metav1.Time `json:"time"`
+				UsageNanoCores *uint64     `json:"usageNanoCores"`
+			} `json:"cpu"`
+			Memory *struct {
+				WorkingSetBytes *uint64 `json:"workingSetBytes"`
+			} `json:"memory"`
+			Rootfs *struct {
+				UsedBytes *uint64 `json:"usedBytes"`
+			} `json:"rootfs"`
+			Logs *struct {
+				UsedBytes *uint64 `json:"usedBytes"`
+			} `json:"logs"`
+		} `json:"containers"`
+	} `json:"pods"`
+}
+
+// kubeletLister reads the summary API of a node's kubelet through the API
+// server proxy, which needs get on nodes/proxy.
+func kubeletLister(clientset kubernetes.Interface) podMetricsLister {
+	return func(ctx context.Context, node string) ([]podMetrics, error) {
+		client := clientset.Discovery().RESTClient()
+		if client == nil {
+			return nil, nil
+		}
+		body, err := client.Get().AbsPath("/api/v1/nodes", node, "proxy/stats/summary").Do(ctx).Raw()
+		if err != nil {
+			return nil, err
+		}
+		var summary kubeletSummary
+		if err := json.Unmarshal(body, &summary); err != nil {
+			return nil, fmt.Errorf("failed to decode kubelet stats: %v", err)
+		}
+		items := make([]podMetrics, 0, len(summary.Pods))
+		for _, p := range summary.Pods {
+			m := podMetrics{Metadata: metav1.ObjectMeta{Name: p.PodRef.Name, Namespace: p.PodRef.Namespace}}
+			for _, c := range p.Containers {
+				usage := make(corev1.ResourceList)
+				if c.CPU != nil && c.CPU.UsageNanoCores != nil {
+					usage[corev1.ResourceCPU] = *resource.NewScaledQuantity(int64(*c.CPU.UsageNanoCores), resource.Nano)
+					m.Timestamp = c.CPU.Time
+				}
+				if c.Memory != nil && c.Memory.WorkingSetBytes != nil {
+					usage[corev1.ResourceMemory] = *resource.NewQuantity(int64(*c.Memory.WorkingSetBytes), resource.BinarySI)
+				}
+				var fs uint64
+				if c.Rootfs != nil && c.Rootfs.UsedBytes != nil {
+					fs += *c.Rootfs.UsedBytes
+				}
+				if c.Logs != nil && c.Logs.UsedBytes != nil {
+					fs += *c.Logs.UsedBytes
+				}
+				if fs > 0 {
+					usage[corev1.ResourceEphemeralStorage] = *resource.NewQuantity(int64(fs), resource.BinarySI)
+				}
+				m.Containers = append(m.Containers, containerMetrics{Name: c.Name, Usage: usage})
+			}
+			items = append(items, m)
+		}
+		return items, nil
+	}
+}
+
+// usageListers are the listers of the usage sources.
+func usageListers(clientset kubernetes.Interface) map[string]podMetricsLister {
+	return map[string]podMetricsLister{
+		UsageMetricsServer: metricsServerLister(clientset),
+		UsageKubelet:       kubeletLister(clientset),
+	}
+}
+
+// usageCache holds the pod usage last listed from the configured source, by
+// the namespace or node it was listed for. runUsage refreshes it in the
+// background, so building a pod's status never waits for the source.
+type usageCache struct {
+	listers map[string]podMetricsLister
+	mu      sync.RWMutex
+	// source is the one lookups were listed from; they are ignored once the
+	// source is changed by a reload.
+	source string
+	// lookups holds the listed pods by namespace/name.
+	lookups map[string]map[string]podMetrics
+}
+
+func newUsageCache(listers map[string]podMetricsLister) *usageCache {
+	return &usageCache{listers: listers}
+}
+
+// usageKey returns the namespace or node the usage of pod is listed for.
+func usageKey(source string, pod *corev1.Pod) string {
+	if source == UsageKubelet {
+		return pod.Spec.NodeName
+	}
+	return pod.Namespace
+}
+
+// get returns a pod's usage as last listed.
+func (c *usageCache) get(source string, pod *corev1.Pod) (podMetrics, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if source != c.source {
+		return podMetrics{}, false
+	}
+	m, ok := c.lookups[usageKey(source, pod)][pod.Namespace+"/"+pod.Name]
+	return m, ok
+}
+
+// refresh lists the usage of the pods' namespaces or nodes, each within
+// timeout, and replaces the cached usage once all are listed. Usage that
+// can't be listed is dropped.
+func (c *usageCache) refresh(ctx context.Context, source string, pods []*corev1.Pod, timeout time.Duration) {
+	lookups := make(map[string]map[string]podMetrics)
+	if list := c.listers[source]; list != nil {
+		for _, pod := range pods {
+			key := usageKey(source, pod)
+			if _, done := lookups[key]; done || key == "" {
+				continue
+			}
+			listCtx, cancel := context.WithTimeout(ctx, timeout)
+			items, err := list(listCtx, key)
+			cancel()
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				slog.Debug("Pod usage unavailable", "source", source, "from", key, "error", err)
+			}
+			l := make(map[string]podMetrics, len(items))
+			for _, m := range items {
+				l[m.Metadata.Namespace+"/"+m.Metadata.Name] = m
+			}
+			lookups[key] = l
+		}
+	}
+	c.mu.Lock()
+	c.source, c.lookups = source, lookups
+	c.mu.Unlock()
+}
+
+// runUsage lists the usage of the monitored pods right away and every
+// usageRefreshInterval until ctx is done. Pods pick it up with their next
+// scrape.
+func (d *Dashboard) runUsage(ctx context.Context) {
+	ticker := time.NewTicker(usageRefreshInterval)
+	defer ticker.Stop()
+	for {
+		cfg := d.cfg()
+		pods, err := d.currentWatch().list()
+		if err != nil {
+			slog.Warn("Failed to list pods for their usage", "error", err)
+		}
+		d.usage.refresh(ctx, cfg.UsageSource, pods, cfg.FetchTimeout)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// resourceUsage returns the monitored container's requests, limits and
+// cached usage, or nil for a pod without containers.
+func (d *Dashboard) resourceUsage(pod *corev1.Pod) *ResourceUsage {
+	container, _ := monitoredContainer(pod)
+	if container == nil {
+		return nil
+	}
+	res := container.Resources
+	usage := &ResourceUsage{
+		Container:          container.Name,
+		CPURequestMillis:   res.Requests.Cpu().MilliValue(),
+		CPULimitMillis:     res.Limits.Cpu().MilliValue(),
+		MemoryRequestBytes: res.Requests.Memory().Value(),
+		MemoryLimitBytes:   res.Limits.Memory().Value(),
+	}
+	source := d.cfg().UsageSource
+	m, ok := d.usage.get(source, pod)
+	if !ok {
+		return usage
+	}
+	for _, c := range m.Containers {
+		if c.Name == container.Name {
+			usage.Usage = &ContainerUsage{
+				Source:          source,
+				CPUMillis:       c.Usage.Cpu().MilliValue(),
+				MemoryBytes:     c.Usage.Memory().Value(),
+				FilesystemBytes: c.Usage.StorageEphemeral().Value(),
+				Time:            m.Timestamp.Time,
+				WindowSeconds:   m.Window.Seconds(),
+			}
+		}
+	}
+	return usage
+}
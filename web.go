@@ -0,0 +1,168 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// webFiles holds the page templates in templates/ and the stylesheet and
+// script in static/. The pod-card template is also rendered on its own for
+// live updates pushed over /api/stream.
+//
+//go:embed web
+var webFiles embed.FS
+
+// pageTemplate is the template rendering the dashboard page.
+const pageTemplate = "dashboard.html"
+
+// loadingTemplate is the page shown until the first scrape cycle completes.
+const loadingTemplate = "loading.html"
+
+// pageTemplates are the parsed templates in normal and read-only mode.
+type pageTemplates struct {
+	normal, readOnly *template.Template
+}
+
+// embeddedTemplates are the built-in templates showing server local time,
+// parsed at startup.
+var embeddedTemplates = func() *pageTemplates {
+	t, err := loadTemplates("", time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}()
+
+// loadTemplates parses the embedded templates, then the *.html files in dir
+// when set. A file there replaces the embedded file of the same name, and a
+// template it defines replaces the embedded one, so overriding the pod card
+// only takes a pod-card.html defining "pod-card". Times are shown in loc.
+func loadTemplates(dir string, loc *time.Location) (*pageTemplates, error) {
+	parse := func(readOnly bool) (*template.Template, error) {
+		embedded, _ := fs.Sub(webFiles, "web/templates")
+		t, err := template.New(pageTemplate).Funcs(template.FuncMap{
+			"percent":       func(ratio float64) float64 { return ratio * 100 },
+			"join":          strings.Join,
+			"readOnly":      func() bool { return readOnly },
+			"humanDuration": humanDuration,
+			"mebibytes":     func(b int64) float64 { return float64(b) / (1 << 20) },
+			"localTime":     func(v any) string { return localTime(v, loc) },
+			"countdown":     func(t time.Time) string { return countdown(t, time.Now()) },
+		}).ParseFS(embedded, "*.html")
+		if err != nil {
+			return nil, err
+		}
+		if dir == "" {
+			return t, nil
+		}
+		overrides, err := filepath.Glob(filepath.Join(dir, "*.html"))
+		if err != nil || len(overrides) == 0 {
+			return t, err
+		}
+		return t.ParseFiles(overrides...)
+	}
+
+	normal, err := parse(false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse templates: %v", err)
+	}
+	readOnly, err := parse(true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse templates: %v", err)
+	}
+	return &pageTemplates{normal: normal, readOnly: readOnly}, nil
+}
+
+// humanDuration formats a time.Duration, or nanoseconds as reported in
+// ContainerAge, with its two largest units, such as "3h 12m".
+func humanDuration(v any) string {
+	var d time.Duration
+	switch v := v.(type) {
+	case time.Duration:
+		d = v
+	case int64:
+		d = time.Duration(v)
+	default:
+		return fmt.Sprint(v)
+	}
+
+	seconds := int64(d / time.Second)
+	minutes, hours, days := seconds/60, seconds/3600, seconds/86400
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours%24)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes%60)
+	case minutes > 0:
+		return fmt.Sprintf("%dm %ds", minutes, seconds%60)
+	}
+	return fmt.Sprintf("%ds", seconds)
+}
+
+// localTime formats a time.Time, or an RFC 3339 string as reported in
+// StartTime, in loc. Strings that don't parse are returned as they are.
+func localTime(v any, loc *time.Location) string {
+	var t time.Time
+	switch v := v.(type) {
+	case time.Time:
+		t = v
+	case string:
+		parsed, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return v
+		}
+		t = parsed
+	default:
+		return fmt.Sprint(v)
+	}
+	if t.IsZero() {
+		return ""
+	}
+	return t.In(loc).Format("2006-01-02 15:04:05 MST")
+}
+
+// countdown tells how long until t: "in ~12s", or "due" once it passed.
+func countdown(t, now time.Time) string {
+	if !t.After(now) {
+		return "due"
+	}
+	return "in ~" + humanDuration(t.Sub(now))
+}
+
+// template returns the dashboard template for the current mode.
+func (d *Dashboard) template() *template.Template {
+	if d.cfg().ReadOnly {
+		return d.templates.readOnly
+	}
+	return d.templates.normal
+}
+
+// staticHandler serves /static/ from the static directory under dir when it
+// has the file, else from the embedded files.
+func staticHandler(dir string) http.Handler {
+	embedded, _ := fs.Sub(webFiles, "web/static")
+	files := http.FileServerFS(embedded)
+	if dir == "" {
+		return http.StripPrefix("/static/", files)
+	}
+	overrides := http.FileServer(http.Dir(filepath.Join(dir, "static")))
+	return http.StripPrefix("/static/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := filepath.Join(dir, "static", filepath.FromSlash(r.URL.Path))
+		if info, err := os.Stat(name); err == nil && !info.IsDir() {
+			overrides.ServeHTTP(w, r)
+			return
+		} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, "Failed to read static file", http.StatusInternalServerError)
+			return
+		}
+		files.ServeHTTP(w, r)
+	}))
+}
@@ -0,0 +1,225 @@
+let refreshInterval = 1000; // Default 1 second
+let refreshTimer;
+
+function formatDuration(ms) {
+    const seconds = Math.floor(ms / 1000);
+    const minutes = Math.floor(seconds / 60);
+    const hours = Math.floor(minutes / 60);
+    const days = Math.floor(hours / 24);
+
+    if (days > 0) return days + 'd ' + (hours % 24) + 'h';
+    if (hours > 0) return hours + 'h ' + (minutes % 60) + 'm';
+    if (minutes > 0) return minutes + 'm ' + (seconds % 60) + 's';
+    return seconds + 's';
+}
+
+function formatCountdown(el) {
+    const ms = new Date(el.dataset.countdown) - Date.now();
+    el.textContent = ms > 0 ? 'in ~' + formatDuration(ms) : 'due';
+}
+
+// Cards are rendered by the server; only countdowns are kept current
+function formatCards(root) {
+    root.querySelectorAll('[data-countdown]').forEach(formatCountdown);
+}
+
+function updateRefreshInterval(value) {
+    refreshInterval = value * 1000;
+    document.getElementById('refresh-value').textContent = value + 's';
+
+    // Clear existing timer and set new one
+    if (refreshTimer) {
+        clearInterval(refreshTimer);
+        refreshTimer = null;
+    }
+    // Page reloads are only a fallback while the live stream is down
+    if (!streaming) {
+        refreshTimer = setInterval(refreshPage, refreshInterval);
+    }
+
+    // Save preference
+    localStorage.setItem('refreshInterval', value);
+}
+
+function refreshPage() {
+    location.reload();
+}
+
+// Live updates: patch individual cards from /api/stream events
+let streaming = false;
+
+function updateEmptyState() {
+    const empty = document.getElementById('pod-grid').children.length === 0;
+    document.getElementById('no-pods').style.display = empty ? '' : 'none';
+}
+
+function upsertCard(name, html) {
+    const holder = document.createElement('div');
+    holder.innerHTML = html.trim();
+    const card = holder.firstElementChild;
+    formatCards(card);
+
+    const existing = document.getElementById('pod-' + name);
+    if (existing) {
+        existing.replaceWith(card);
+    } else {
+        const grid = document.getElementById('pod-grid');
+        const next = Array.from(grid.children).find(function(el) {
+            return el.dataset.sort > card.dataset.sort;
+        });
+        grid.insertBefore(card, next || null);
+    }
+    updateEmptyState();
+}
+
+function removeCard(name) {
+    const existing = document.getElementById('pod-' + name);
+    if (existing) {
+        existing.remove();
+    }
+    updateEmptyState();
+}
+
+function connectStream() {
+    if (!window.EventSource) {
+        return;
+    }
+    const source = new EventSource('/api/stream?html=1');
+    const key = function(ev) {
+        const pod = ev.namespace + '/' + ev.name;
+        return ev.cluster ? ev.cluster + '/' + pod : pod;
+    };
+    const onUpsert = function(e) {
+        const ev = JSON.parse(e.data);
+        upsertCard(key(ev), ev.html);
+    };
+    source.addEventListener('add', onUpsert);
+    source.addEventListener('update', onUpsert);
+    source.addEventListener('delete', function(e) {
+        removeCard(key(JSON.parse(e.data)));
+    });
+    source.onopen = function() {
+        streaming = true;
+        updateRefreshInterval(document.getElementById('refresh-slider').value);
+    };
+    source.onerror = function() {
+        // EventSource reconnects by itself; reload meanwhile
+        if (streaming) {
+            streaming = false;
+            updateRefreshInterval(document.getElementById('refresh-slider').value);
+        }
+    };
+}
+
+// The header summary is polled from /api/stats
+async function refreshSummary() {
+    try {
+        const response = await fetch('/api/stats');
+        if (!response.ok) {
+            return;
+        }
+        const stats = (await response.json()).pods;
+        const errors = Object.values(stats.scrapeErrors).reduce(function(a, b) { return a + b; }, 0);
+        document.getElementById('summary').textContent =
+            stats.total + ' pods on ' + Object.keys(stats.byNode).length + ' nodes • ' +
+            (stats.byReadiness.ready || 0) + ' ready • ' +
+            (stats.byReadiness.notReady || 0) + ' not ready • ' +
+            errors + ' scrape errors • avg age ' + formatDuration(stats.avgContainerAgeSeconds * 1000);
+    } catch (error) {
+        console.error('Error loading stats:', error);
+    }
+}
+
+// Rollouts in flight are polled; their pods update through the stream
+async function refreshRollouts() {
+    const panel = document.getElementById('rollouts');
+    try {
+        const response = await fetch('/api/deployments');
+        if (!response.ok) {
+            return;
+        }
+        const deployments = await response.json();
+        panel.replaceChildren();
+        deployments.filter(function(d) { return d.state !== 'complete'; }).forEach(function(d) {
+            const el = document.createElement('div');
+            el.className = 'rollout ' + d.state;
+            const title = document.createElement('div');
+            title.textContent = d.namespace + '/' + d.name + ' rev ' + d.revision + ': ' + d.state +
+                ' (' + d.updated + ' updated, ' + d.ready + ' ready, ' + d.available + ' available of ' + d.desired + ')' +
+                (d.message ? ' - ' + d.message : '');
+            const bar = document.createElement('div');
+            bar.className = 'rollout-bar';
+            const fill = document.createElement('div');
+            fill.style.width = Math.round(d.progress * 100) + '%';
+            bar.appendChild(fill);
+            el.append(title, bar);
+            panel.appendChild(el);
+        });
+    } catch (error) {
+        console.error('Error loading rollouts:', error);
+    }
+}
+
+// postAction sends a mutating request, asking for an API token
+// when the server requires one. The token is kept for the session.
+async function postAction(url) {
+    const headers = {};
+    const token = sessionStorage.getItem('apiToken');
+    if (token) {
+        headers['Authorization'] = 'Bearer ' + token;
+    }
+    const response = await fetch(url, { method: 'POST', headers: headers });
+    if (response.status === 401) {
+        const entered = prompt('API token required for this action:');
+        if (entered) {
+            sessionStorage.setItem('apiToken', entered);
+            return postAction(url);
+        }
+    }
+    return response;
+}
+
+async function toggleProbe(podName, namespace, cluster, probeType, currentState) {
+    const action = currentState ? 'fail' : 'recover';
+    let url = `/api/pods/${encodeURIComponent(podName)}/probes/${probeType}/${action}` +
+        '?namespace=' + encodeURIComponent(namespace);
+    if (cluster) {
+        url += '&cluster=' + encodeURIComponent(cluster);
+    }
+
+    try {
+        const response = await postAction(url);
+
+        if (!response.ok) {
+            console.error('Failed to toggle probe:', await response.text());
+        } else if (!streaming) {
+            // The response already carries the new state, but the
+            // page is only re-rendered by a reload without a stream
+            refreshPage();
+        }
+    } catch (error) {
+        console.error('Error toggling probe:', error);
+    }
+}
+
+// Initialize on page load
+window.onload = function() {
+    formatCards(document);
+    setInterval(function() {
+        document.querySelectorAll('[data-countdown]').forEach(formatCountdown);
+    }, 1000);
+    refreshSummary();
+    refreshRollouts();
+    setInterval(function() {
+        refreshSummary();
+        refreshRollouts();
+    }, 5000);
+
+    // Restore saved refresh interval or use default of 1 second
+    const savedInterval = localStorage.getItem('refreshInterval');
+    const defaultInterval = savedInterval || '1';
+    const slider = document.getElementById('refresh-slider');
+    slider.value = defaultInterval;
+    updateRefreshInterval(parseInt(defaultInterval));
+    connectStream();
+};
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// wsSendBuffer is the number of events queued per WebSocket client before
+	// it is considered too slow and dropped.
+	wsSendBuffer = 64
+	// wsWriteTimeout bounds how long a single message may take to send.
+	wsWriteTimeout = 10 * time.Second
+)
+
+// wsMessage is a control message sent to WebSocket clients in addition to the
+// regular pod events.
+type wsMessage struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// websocketHandler returns the /ws endpoint. Each client first receives an
+// "add" event per monitored pod, followed by add/update/delete and probe
+// transition events as they happen.
+func (d *Dashboard) websocketHandler() http.Handler {
+	return websocket.Handler(d.serveWebSocket)
+}
+
+func (d *Dashboard) serveWebSocket(ws *websocket.Conn) {
+	defer ws.Close()
+	// The hijacked connection keeps the server's read deadline.
+	ws.SetReadDeadline(time.Time{})
+
+	events, cancel := d.events.subscribe(wsSendBuffer)
+	defer cancel()
+
+	// Incoming messages are ignored; reading only detects the client going
+	// away so the writer can stop.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		var discard string
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+	}()
+
+	send := func(v any) bool {
+		ws.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		return websocket.JSON.Send(ws, v) == nil
+	}
+
+	for _, pod := range d.sortedPods() {
+		if !send(PodEvent{Type: PodEventAdd, Cluster: pod.Cluster, Namespace: pod.Namespace, Name: pod.Name, Pod: pod}) {
+			return
+		}
+	}
+
+	for {
+		select {
+		case <-closed:
+			return
+		case ev, ok := <-events:
+			if !ok {
+				if d.events.isClosed() {
+					send(wsMessage{Type: "shutdown", Message: "server is shutting down"})
+					return
+				}
+				slog.Warn("Dropping slow WebSocket client", "remote", ws.Request().RemoteAddr)
+				send(wsMessage{Type: "dropped", Message: "client too slow; reconnect to resync"})
+				return
+			}
+			if !send(ev) {
+				return
+			}
+		}
+	}
+}
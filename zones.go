@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// ZoneRollup sums up the monitored pods in a topology zone, to show how
+// they spread over zones and what a zone outage takes down.
+type ZoneRollup struct {
+	// Zone is empty for the pods whose node has no zone label or couldn't
+	// be read.
+	Zone   string `json:"zone"`
+	Region string `json:"region,omitempty"`
+	ReadyCounts
+	Nodes []string `json:"nodes"`
+}
+
+// zoneRollups counts the monitored pods per zone, ordered by zone.
+func (d *Dashboard) zoneRollups() []ZoneRollup {
+	rollups := make(map[string]*ZoneRollup)
+	nodes := make(map[string]map[string]bool)
+	d.mu.RLock()
+	for _, p := range d.pods {
+		r := rollups[p.Zone]
+		if r == nil {
+			r = &ZoneRollup{Zone: p.Zone, Region: p.Region}
+			rollups[p.Zone] = r
+			nodes[p.Zone] = make(map[string]bool)
+		}
+		r.add(p)
+		if p.Node != "" {
+			nodes[p.Zone][p.Node] = true
+		}
+	}
+	d.mu.RUnlock()
+
+	out := make([]ZoneRollup, 0, len(rollups))
+	for zone, r := range rollups {
+		r.Nodes = make([]string, 0, len(nodes[zone]))
+		for n := range nodes[zone] {
+			r.Nodes = append(r.Nodes, n)
+		}
+		sort.Strings(r.Nodes)
+		out = append(out, *r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Zone < out[j].Zone })
+	return out
+}
+
+// handleZones serves GET /api/zones, the monitored pods rolled up per zone.
+func (d *Dashboard) handleZones(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d.zoneRollups())
+}